@@ -2,42 +2,318 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/auth"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/config"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/csrf"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/events"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/fx"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/ratelimit"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/risk"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/rpc"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/settlement"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/threeds"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/velocity"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
-	bankURL = "http://localhost:8080"
+	bankURL      = "http://localhost:8080"
+	bankAcquirer = "simulator"
+
+	// gatewayURL is where shoppers reach us, it is used to build the 3-D Secure links.
+	gatewayURL = "http://localhost:8090"
+
+	// authenticationCheckInterval is how often we look for shoppers that never finished a 3-D Secure
+	// challenge, the card details kept for them are dropped then.
+	authenticationCheckInterval = time.Minute
+
+	// settlementCheckInterval is how often we look for a finished day to settle.
+	settlementCheckInterval = time.Hour
+
+	// eventHistorySize is how many payment events clients can resume from with Last-Event-ID.
+	eventHistorySize = 10000
+
+	// subscriptionCheckInterval is how often we look for subscriptions to charge.
+	subscriptionCheckInterval = time.Minute
+
+	// disputeCheckInterval is how often we look for disputes past their deadline.
+	disputeCheckInterval = time.Hour
+
+	// keyringCheckInterval is how often we look for a rotated keyring and rewrap the stored card data.
+	keyringCheckInterval = time.Minute
+
+	// retentionCheckInterval is how often the retention policies are applied.
+	retentionCheckInterval = time.Hour
+
+	// certificateCheckInterval is how often we look for renewed certificates.
+	certificateCheckInterval = time.Minute
+
+	// defaultGRPCAddr is where the gRPC API listens when the settings do not say, next to the REST one.
+	defaultGRPCAddr = ":9090"
 )
 
 type Api struct {
 	router             *chi.Mux
 	paymentsRepo       *repository.PaymentsRepository
+	listsRepo          *repository.ListsRepository
+	reconciliationRepo *repository.ReconciliationsRepository
+	settlementsRepo    *repository.SettlementsRepository
+	merchantsRepo      *repository.MerchantsRepository
+	batchesRepo        *repository.BatchesRepository
+	subscriptionsRepo  *repository.SubscriptionsRepository
+	subscriptions      *domain.SubscriptionServiceImpl
+	disputesRepo       *repository.DisputesRepository
+	disputes           *domain.DisputesServiceImpl
+	retention          *domain.RetentionServiceImpl
+	paymentLinksRepo   *repository.PaymentLinksRepository
+	csrf               *csrf.Protector
+	auditLog           *audit.Log
+	keyring            *keyring.Keyring
+	serverTLS          *tls.Config
+	clientCerts        *certs.ServerConfig
+	certificates       []*certs.Certificate
+	threeDSSimulator   *threeds.Simulator
+	paymentQueue       *queue.Queue
+	events             *events.Broker
+	settlementService  *domain.SettlementServiceImpl
 	domain             *domain.Domain
+	rateLimiter        *ratelimit.Limiter
+	admins             auth.Tokens
+	merchants          auth.Tokens
+	grpcAddr           string
 	PostPaymentService *domain.PaymentServiceImpl
 }
 
-func New() *Api {
-	a := &Api{}
-	repo := repository.NewPaymentsRepository()
+func New(config config.Config) *Api {
+	a := &Api{admins: config.Admins, merchants: config.Merchants, grpcAddr: config.GRPCAddr}
+	if a.grpcAddr == "" {
+		a.grpcAddr = defaultGRPCAddr
+	}
+	if err := domain.CheckDeclineCodes(config.DeclineCodes); err != nil {
+		panic(fmt.Errorf("invalid decline codes: %w", err))
+	}
+	fingerprintKey, err := config.FingerprintKey()
+	if err != nil {
+		panic(fmt.Errorf("could not read the card fingerprint key: %w", err))
+	}
+	a.keyring = openKeyring(config)
+	repo := repository.NewPaymentsRepository().WithKeyring(a.keyring)
 	a.paymentsRepo = repo
-	client := client.NewClient(bankURL, 5*time.Second)
-	postPaymentService := domain.NewPaymentServiceImpl(repo, client)
+	router := a.newBankRouter(config, a.loadTLS(config.TLSFile))
+	listsRepo := repository.NewListsRepository()
+	a.listsRepo = listsRepo
+	riskConfig := risk.DefaultConfig()
+	riskEngine := risk.NewEngine(riskConfig)
+	limiter := velocity.NewLimiter(velocity.NewMemoryStore(), velocity.DefaultLimits()...)
+	rates := openRates(config.RatesFile)
+	quotesRepo := repository.NewQuotesRepository()
+	publicURL := gatewayURL
+	if a.serverTLS != nil {
+		publicURL = strings.Replace(gatewayURL, "http://", "https://", 1)
+	}
+	a.events = events.NewBroker(eventHistorySize)
+	// payments waiting for a worker are journaled so they survive a restart
+	journal, err := queue.NewFileJournal(filepath.Join(config.DataDir, "queue"))
+	if err != nil {
+		panic(fmt.Errorf("could not open payment queue journal: %w", err))
+	}
+	a.paymentQueue, err = queue.New(queue.DefaultConfig(), journal.WithKeyring(a.keyring))
+	if err != nil {
+		// starting with an empty queue would quietly drop the payments that were waiting
+		panic(fmt.Errorf("could not recover queued payments: %w", err))
+	}
+	a.auditLog, err = audit.Open(filepath.Join(config.DataDir, "audit.log"))
+	if err != nil {
+		// a log kept in memory would lose the entries on restart, and a broken one has to be looked
+		// at with audit verify and moved aside by hand before anything is appended again
+		panic(fmt.Errorf("could not open audit log: %w", err))
+	}
+	a.merchantsRepo = repository.NewMerchantsRepository()
+	options := []domain.Option{
+		domain.WithRiskEngine(riskEngine),
+		domain.WithVelocityLimiter(limiter),
+		domain.WithLists(listsRepo, riskConfig.BINCountries),
+		domain.WithFX(rates, quotesRepo),
+		domain.WithMerchantProfiles(a.merchantsRepo),
+		domain.WithQueue(a.paymentQueue),
+		domain.WithEvents(a.events),
+		domain.WithAudit(a.auditLog),
+		domain.WithFingerprintKey(fingerprintKey),
+		domain.WithDeclineCodes(config.DeclineCodes),
+	}
+	if config.Dev {
+		// there is no real directory server yet so challenges are answered by the local simulator, its
+		// CAVVs mean nothing to a real issuer so it never runs outside dev mode
+		a.threeDSSimulator = threeds.NewSimulator(publicURL)
+		options = append(options, domain.WithThreeDS(a.threeDSSimulator, threeds.DefaultConfig(), publicURL))
+	} else {
+		log.Printf("no 3-D Secure directory server, payments are not authenticated")
+	}
+	postPaymentService := domain.NewPaymentServiceImpl(repo, router, options...)
 	a.domain = domain.NewDomain(postPaymentService)
+	a.PostPaymentService = postPaymentService
+	a.domain.Audit = a.auditLog
+	a.domain.ListsService = domain.NewListsServiceImpl(listsRepo)
+	a.reconciliationRepo = repository.NewReconciliationsRepository()
+	a.domain.ReconciliationService = domain.NewReconciliationServiceImpl(repo, a.reconciliationRepo)
+	a.domain.ThreeDSService = postPaymentService
+	a.domain.AsyncPaymentService = postPaymentService
+	a.domain.MerchantsService = domain.NewMerchantsServiceImpl(a.merchantsRepo)
+	a.domain.FXService = domain.NewFXServiceImpl(rates, quotesRepo, domain.DefaultQuoteTTL)
+	a.settlementsRepo = repository.NewSettlementsRepository()
+	fees := settlement.DefaultFeeSchedule()
+	for merchantID, rules := range config.MerchantFees {
+		fees.Merchants[merchantID] = rules
+	}
+	a.settlementService = domain.NewSettlementServiceImpl(repo, a.settlementsRepo, fees)
+	a.domain.SettlementService = a.settlementService
+	a.batchesRepo = repository.NewBatchesRepository()
+	a.domain.BatchService = domain.NewBatchServiceImpl(postPaymentService, a.batchesRepo, domain.DefaultBatchConfig())
+	a.subscriptionsRepo = repository.NewSubscriptionsRepository().WithKeyring(a.keyring)
+	a.subscriptions = domain.NewSubscriptionServiceImpl(postPaymentService, a.subscriptionsRepo, domain.DefaultDunningConfig())
+	a.domain.SubscriptionService = a.subscriptions
+	a.disputesRepo = repository.NewDisputesRepository()
+	a.disputes = domain.NewDisputesServiceImpl(repo, a.disputesRepo, domain.DefaultDisputeConfig()).WithAudit(a.auditLog)
+	a.domain.DisputesService = a.disputes
+	a.retention = domain.NewRetentionServiceImpl(repo, a.merchantsRepo).
+		WithAudit(a.auditLog).
+		WithDisputes(a.disputesRepo).
+		WithFingerprintKey(fingerprintKey).
+		WithCardData(a.subscriptions, listsRepo, limiter, riskEngine)
+	a.domain.RetentionService = a.retention
+	a.paymentLinksRepo = repository.NewPaymentLinksRepository()
+	a.domain.PaymentLinksService = domain.NewPaymentLinksServiceImpl(postPaymentService, postPaymentService, a.paymentLinksRepo, publicURL)
+	a.csrf, err = csrf.NewRandom()
+	if err != nil {
+		// the system has no randomness left, nothing else would work either
+		panic(err)
+	}
+	a.rateLimiter = ratelimit.NewLimiter(ratelimit.DefaultConfig(), rateLimitKey)
 	a.setupRouter()
 
 	return a
 }
 
+// loadTLS applies the TLS settings in path and returns their bank section, nil when there is none.
+// Settings that are set but missing or broken stop the gateway rather than have it fall back to plain HTTP.
+func (a *Api) loadTLS(path string) *certs.ClientConfig {
+	if path == "" {
+		return nil
+	}
+	config, err := certs.LoadConfig(path)
+	if err != nil {
+		panic(fmt.Errorf("could not load TLS settings: %w", err))
+	}
+
+	if config.Server != nil {
+		var cert *certs.Certificate
+		a.serverTLS, cert, err = config.Server.TLSConfig()
+		if err != nil {
+			panic(fmt.Errorf("could not load server certificate: %w", err))
+		}
+		a.clientCerts = config.Server
+		a.certificates = append(a.certificates, cert)
+	}
+	return config.Bank
+}
+
+// newBankRouter connects to the acquirers of config and routes payments between them.  Without any
+// acquirers every payment goes to the bank simulator, over the bank section of the TLS settings.
+func (a *Api) newBankRouter(config config.Config, bank *certs.ClientConfig) *client.Router {
+	acquirers := config.Acquirers
+	if len(acquirers) == 0 {
+		simulator := certs.ClientConfig{URL: bankURL}
+		if bank != nil {
+			simulator = *bank
+			if simulator.URL == "" {
+				simulator.URL = bankURL
+			}
+		}
+		acquirers = map[string]certs.ClientConfig{bankAcquirer: simulator}
+	} else if bank != nil {
+		panic(errors.New("the bank section of the TLS settings is only used without acquirers, give the acquirers their TLS files instead"))
+	}
+
+	routing := client.RoutingConfig{Routes: config.Routes, Breaker: client.DefaultBreakerConfig()}
+	clients := map[string]client.Client{}
+	for name, settings := range acquirers {
+		tlsConfig, cert, err := settings.TLSConfig()
+		if err != nil {
+			panic(fmt.Errorf("could not load TLS settings of acquirer %s: %w", name, err))
+		}
+		if cert != nil {
+			a.certificates = append(a.certificates, cert)
+		}
+		clients[name] = client.NewClient(settings.URL, 5*time.Second).WithTLS(tlsConfig)
+		// config only leaves out the routes when there is a single acquirer
+		if len(config.Routes) == 0 {
+			routing = client.DefaultRoutingConfig(name)
+		}
+	}
+
+	router, err := client.NewRouter(routing, clients)
+	if err != nil {
+		panic(fmt.Errorf("invalid acquirer routes: %w", err))
+	}
+	return router
+}
+
+// openRates reads the exchange rates in path.  Without a file every conversion is refused as an unsupported
+// currency pair, a file that is set but broken stops the gateway rather than quietly refusing them.
+func openRates(path string) fx.Provider {
+	if path == "" {
+		log.Printf("no rates_file set, currency conversion is off")
+		rates, _ := fx.NewTable("USD", nil)
+		return rates
+	}
+	rates, err := fx.NewFileProvider(path)
+	if err != nil {
+		panic(fmt.Errorf("could not load exchange rates: %w", err))
+	}
+	return rates
+}
+
+// openKeyring opens the keyring file of config, in dev mode it is generated on first start.  There is
+// no falling back here, the gateway refuses to keep card data in the clear.
+func openKeyring(config config.Config) *keyring.Keyring {
+	path := config.KeyringFile
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && config.Dev {
+		key, err := keyring.Generate(path)
+		if err != nil {
+			panic(fmt.Errorf("could not generate keyring: %w", err))
+		}
+		log.Printf("generated keyring %s with key %s", path, key.Id)
+	}
+	k, err := keyring.Open(path)
+	if err != nil {
+		panic(fmt.Errorf("could not open keyring: %w", err))
+	}
+	return k
+}
+
 func (a *Api) Run(ctx context.Context, addr string) error {
 	httpServer := &http.Server{
 		Addr:        addr,
@@ -45,6 +321,14 @@ func (a *Api) Run(ctx context.Context, addr string) error {
 		BaseContext: func(_ net.Listener) context.Context { return ctx },
 	}
 
+	var grpcOptions []grpc.ServerOption
+	if a.serverTLS != nil {
+		httpServer.TLSConfig = a.serverTLS
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(a.serverTLS)))
+	}
+	grpcAuth := rpc.Auth{Merchants: a.merchants, ClientCerts: a.clientCerts, Limiter: a.rateLimiter}
+	grpcServer := rpc.NewGRPCServer(a.paymentsRepo, a.domain, grpcAuth, grpcOptions...)
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
@@ -54,8 +338,69 @@ func (a *Api) Run(ctx context.Context, addr string) error {
 	})
 
 	g.Go(func() error {
-		fmt.Printf("starting HTTP server on %s\n", addr)
-		err := httpServer.ListenAndServe()
+		<-ctx.Done()
+		fmt.Printf("shutting down gRPC server\n")
+		grpcServer.GracefulStop()
+		return nil
+	})
+
+	g.Go(func() error {
+		listener, err := net.Listen("tcp", a.grpcAddr)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("starting gRPC server on %s\n", a.grpcAddr)
+		err = grpcServer.Serve(listener)
+		if err != nil && err != grpc.ErrServerStopped {
+			return err
+		}
+
+		return nil
+	})
+
+	g.Go(func() error {
+		return a.paymentQueue.Run(ctx, a.PostPaymentService.ProcessJob)
+	})
+
+	g.Go(func() error {
+		return a.PostPaymentService.RunAuthenticationExpiry(ctx, authenticationCheckInterval)
+	})
+
+	g.Go(func() error {
+		return a.settlementService.Run(ctx, settlementCheckInterval)
+	})
+
+	g.Go(func() error {
+		return a.subscriptions.Run(ctx, subscriptionCheckInterval)
+	})
+
+	g.Go(func() error {
+		return a.disputes.Run(ctx, disputeCheckInterval)
+	})
+
+	g.Go(func() error {
+		return a.retention.Run(ctx, retentionCheckInterval)
+	})
+
+	g.Go(func() error {
+		return a.keyring.Run(ctx, keyringCheckInterval, a.paymentsRepo, a.subscriptionsRepo)
+	})
+
+	for _, cert := range a.certificates {
+		g.Go(func() error {
+			return cert.Run(ctx, certificateCheckInterval)
+		})
+	}
+
+	g.Go(func() error {
+		var err error
+		if a.serverTLS != nil {
+			fmt.Printf("starting HTTPS server on %s\n", addr)
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			fmt.Printf("starting HTTP server on %s\n", addr)
+			err = httpServer.ListenAndServe()
+		}
 		if err != nil && err != http.ErrServerClosed {
 			return err
 		}
@@ -68,11 +413,72 @@ func (a *Api) Run(ctx context.Context, addr string) error {
 
 func (a *Api) setupRouter() {
 	a.router = chi.NewRouter()
+	a.router.Use(middleware.RequestID)
+	a.router.Use(requestIDHeader)
 	a.router.Use(middleware.Logger)
+	a.router.Use(merchantMiddleware(a.merchants))
+	if a.clientCerts != nil {
+		a.router.Use(clientCertMiddleware(*a.clientCerts))
+	}
 
 	a.router.Get("/ping", a.PingHandler())
 	a.router.Get("/swagger/*", a.SwaggerHandler())
+	a.router.With(a.rateLimiter.Middleware("admin"), adminMiddleware(a.admins)).Get("/debug/vars", expvar.Handler().ServeHTTP)
 
-	a.router.Get("/api/payments/{id}", a.GetPaymentHandler())
-	a.router.Post("/api/payments", a.PostPaymentHandler())
+	a.router.With(a.rateLimiter.Middleware("payments.get")).Get("/api/payments/{id}", a.GetPaymentHandler())
+	a.router.With(a.rateLimiter.Middleware("payments.create")).Post("/api/payments", a.PostPaymentHandler())
+	a.router.With(a.rateLimiter.Middleware("payments.batch")).Post("/api/payments/batch", a.PostPaymentBatchHandler())
+	a.router.With(a.rateLimiter.Middleware("payments.batch")).Get("/api/payments/batch/{id}", a.GetPaymentBatchHandler())
+	a.router.With(a.rateLimiter.Middleware("payments.3ds")).Get("/api/payments/{id}/3ds/callback", a.ThreeDSCallbackHandler())
+	a.router.With(a.rateLimiter.Middleware("events")).Get("/api/payments/{id}/events", a.PaymentEventsHandler())
+	a.router.With(a.rateLimiter.Middleware("events")).Get("/api/events", a.MerchantEventsHandler())
+	if a.threeDSSimulator != nil {
+		a.router.With(a.rateLimiter.Middleware("payments.3ds")).Handle("/3ds/acs/*", a.threeDSSimulator.Handler())
+	}
+	a.router.With(a.rateLimiter.Middleware("fx.quotes")).Post("/api/fx/quotes", a.PostFXQuoteHandler())
+	a.router.Group(func(r chi.Router) {
+		r.Use(a.rateLimiter.Middleware("subscriptions"))
+		r.Post("/api/subscriptions", a.PostSubscriptionHandler())
+		r.Get("/api/subscriptions", a.GetSubscriptionsHandler())
+		r.Get("/api/subscriptions/{id}", a.GetSubscriptionHandler())
+		r.Post("/api/subscriptions/{id}/pause", a.PauseSubscriptionHandler())
+		r.Post("/api/subscriptions/{id}/resume", a.ResumeSubscriptionHandler())
+		r.Post("/api/subscriptions/{id}/cancel", a.CancelSubscriptionHandler())
+	})
+	a.router.Group(func(r chi.Router) {
+		r.Use(a.rateLimiter.Middleware("disputes"))
+		r.Get("/api/disputes", a.GetDisputesHandler())
+		r.Get("/api/disputes/{id}", a.GetDisputeHandler())
+		r.Post("/api/disputes/{id}/evidence", a.PostDisputeEvidenceHandler())
+		r.Post("/api/disputes/{id}/submit", a.SubmitDisputeHandler())
+		r.Post("/api/disputes/{id}/accept", a.AcceptDisputeHandler())
+	})
+	a.router.With(a.rateLimiter.Middleware("payment_links")).Post("/api/payment-links", a.PostPaymentLinkHandler())
+	a.router.With(a.rateLimiter.Middleware("payment_links")).Get("/api/payment-links/{id}", a.GetPaymentLinkHandler())
+	a.router.With(a.rateLimiter.Middleware("payments.page")).Get("/pay/{id}", a.PaymentPageHandler())
+	a.router.With(a.rateLimiter.Middleware("payments.hosted")).Post("/pay/{id}", a.SubmitPaymentPageHandler())
+	a.router.With(a.rateLimiter.Middleware("payments.page")).Get("/pay/{id}/return", a.PaymentPageReturnHandler())
+	a.router.With(a.rateLimiter.Middleware("settlements")).Get("/api/settlements", a.GetSettlementsHandler())
+	a.router.With(a.rateLimiter.Middleware("settlements")).Get("/api/settlements/{id}", a.GetSettlementHandler())
+
+	a.router.Group(func(r chi.Router) {
+		r.Use(a.rateLimiter.Middleware("admin"))
+		r.Use(adminMiddleware(a.admins))
+		r.Get("/api/admin/lists", a.GetListsHandler())
+		r.Get("/api/admin/lists/audit", a.GetListsAuditHandler())
+		r.Get("/api/admin/audit", a.GetAuditLogHandler())
+		r.Post("/api/admin/lists", a.PostListEntryHandler())
+		r.Delete("/api/admin/lists/{id}", a.DeleteListEntryHandler())
+		r.Post("/api/admin/reconciliations", a.PostReconciliationHandler())
+		r.Get("/api/admin/reconciliations/{id}", a.GetReconciliationHandler())
+		r.Get("/api/admin/reports/payments", a.PaymentsExportHandler())
+		r.Post("/api/admin/settlements/run", a.PostSettlementRunHandler())
+		r.Post("/api/admin/disputes/notifications", a.PostDisputeNotificationsHandler())
+		r.Post("/api/admin/retention/run", a.PostRetentionRunHandler())
+		r.Post("/api/admin/erasures", a.PostErasureHandler())
+		r.Get("/api/admin/merchants", a.GetMerchantsHandler())
+		r.Get("/api/admin/merchants/{id}", a.GetMerchantHandler())
+		r.Put("/api/admin/merchants/{id}", a.PutMerchantHandler())
+		r.Delete("/api/admin/merchants/{id}", a.DeleteMerchantHandler())
+	})
 }
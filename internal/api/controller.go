@@ -44,3 +44,278 @@ func (a *Api) PostPaymentHandler() http.HandlerFunc {
 
 	return h.PostHandler()
 }
+
+// GetListsHandler returns an http.HandlerFunc that lists the block and allow list entries.
+func (a *Api) GetListsHandler() http.HandlerFunc {
+	h := handlers.NewListsHandler(a.listsRepo, a.domain)
+
+	return h.GetHandler()
+}
+
+// GetAuditLogHandler returns an http.HandlerFunc that returns entries from the audit log.
+func (a *Api) GetAuditLogHandler() http.HandlerFunc {
+	h := handlers.NewAuditHandler(a.auditLog)
+
+	return h.ListHandler()
+}
+
+// GetListsAuditHandler returns an http.HandlerFunc that returns the audit trail of list changes.
+func (a *Api) GetListsAuditHandler() http.HandlerFunc {
+	h := handlers.NewListsHandler(a.listsRepo, a.domain)
+
+	return h.AuditHandler()
+}
+
+func (a *Api) PostListEntryHandler() http.HandlerFunc {
+	h := handlers.NewListsHandler(a.listsRepo, a.domain)
+
+	return h.PostHandler()
+}
+
+func (a *Api) DeleteListEntryHandler() http.HandlerFunc {
+	h := handlers.NewListsHandler(a.listsRepo, a.domain)
+
+	return h.DeleteHandler()
+}
+
+// PostReconciliationHandler returns an http.HandlerFunc that reconciles an acquirer settlement file.
+func (a *Api) PostReconciliationHandler() http.HandlerFunc {
+	h := handlers.NewReconciliationHandler(a.reconciliationRepo, a.domain)
+
+	return h.PostHandler()
+}
+
+// GetReconciliationHandler returns an http.HandlerFunc that returns a stored reconciliation report.
+func (a *Api) GetReconciliationHandler() http.HandlerFunc {
+	h := handlers.NewReconciliationHandler(a.reconciliationRepo, a.domain)
+
+	return h.GetHandler()
+}
+
+// PaymentsExportHandler returns an http.HandlerFunc that exports payments as CSV or JSON Lines.
+func (a *Api) PaymentsExportHandler() http.HandlerFunc {
+	h := handlers.NewReportsHandler(a.paymentsRepo)
+
+	return h.PaymentsExportHandler()
+}
+
+// GetSettlementsHandler returns an http.HandlerFunc that lists settlement batches.
+func (a *Api) GetSettlementsHandler() http.HandlerFunc {
+	h := handlers.NewSettlementsHandler(a.settlementsRepo, a.domain)
+
+	return h.ListHandler()
+}
+
+// GetSettlementHandler returns an http.HandlerFunc that returns a settlement batch with its lines.
+func (a *Api) GetSettlementHandler() http.HandlerFunc {
+	h := handlers.NewSettlementsHandler(a.settlementsRepo, a.domain)
+
+	return h.GetHandler()
+}
+
+// PostSettlementRunHandler returns an http.HandlerFunc that builds the settlement batches for a day.
+func (a *Api) PostSettlementRunHandler() http.HandlerFunc {
+	h := handlers.NewSettlementsHandler(a.settlementsRepo, a.domain)
+
+	return h.RunHandler()
+}
+
+// PostFXQuoteHandler returns an http.HandlerFunc that locks an exchange rate for a merchant.
+func (a *Api) PostFXQuoteHandler() http.HandlerFunc {
+	h := handlers.NewFXHandler(a.domain)
+
+	return h.QuoteHandler()
+}
+
+// GetMerchantsHandler returns an http.HandlerFunc that lists the merchant profiles.
+func (a *Api) GetMerchantsHandler() http.HandlerFunc {
+	h := handlers.NewMerchantsHandler(a.merchantsRepo, a.domain)
+
+	return h.ListHandler()
+}
+
+func (a *Api) GetMerchantHandler() http.HandlerFunc {
+	h := handlers.NewMerchantsHandler(a.merchantsRepo, a.domain)
+
+	return h.GetHandler()
+}
+
+func (a *Api) PutMerchantHandler() http.HandlerFunc {
+	h := handlers.NewMerchantsHandler(a.merchantsRepo, a.domain)
+
+	return h.PutHandler()
+}
+
+func (a *Api) DeleteMerchantHandler() http.HandlerFunc {
+	h := handlers.NewMerchantsHandler(a.merchantsRepo, a.domain)
+
+	return h.DeleteHandler()
+}
+
+// ThreeDSCallbackHandler returns an http.HandlerFunc that resumes a payment after 3-D Secure.
+func (a *Api) ThreeDSCallbackHandler() http.HandlerFunc {
+	h := handlers.NewPaymentsHandler(a.paymentsRepo, a.domain)
+
+	return h.CallbackHandler()
+}
+
+// PaymentEventsHandler returns an http.HandlerFunc that streams the status changes of a payment.
+func (a *Api) PaymentEventsHandler() http.HandlerFunc {
+	h := handlers.NewEventsHandler(a.paymentsRepo, a.events, handlers.DefaultHeartbeat)
+
+	return h.PaymentHandler()
+}
+
+// MerchantEventsHandler returns an http.HandlerFunc that streams the status changes of a merchant's payments.
+func (a *Api) MerchantEventsHandler() http.HandlerFunc {
+	h := handlers.NewEventsHandler(a.paymentsRepo, a.events, handlers.DefaultHeartbeat)
+
+	return h.MerchantHandler()
+}
+
+// PostPaymentBatchHandler returns an http.HandlerFunc that submits a batch of payments.
+func (a *Api) PostPaymentBatchHandler() http.HandlerFunc {
+	h := handlers.NewBatchesHandler(a.batchesRepo, a.domain)
+
+	return h.PostHandler()
+}
+
+// GetPaymentBatchHandler returns an http.HandlerFunc that returns the results of a batch.
+func (a *Api) GetPaymentBatchHandler() http.HandlerFunc {
+	h := handlers.NewBatchesHandler(a.batchesRepo, a.domain)
+
+	return h.GetHandler()
+}
+
+// PostSubscriptionHandler returns an http.HandlerFunc that creates a subscription.
+func (a *Api) PostSubscriptionHandler() http.HandlerFunc {
+	h := handlers.NewSubscriptionsHandler(a.subscriptionsRepo, a.domain)
+
+	return h.PostHandler()
+}
+
+// GetSubscriptionsHandler returns an http.HandlerFunc that lists the merchant's subscriptions.
+func (a *Api) GetSubscriptionsHandler() http.HandlerFunc {
+	h := handlers.NewSubscriptionsHandler(a.subscriptionsRepo, a.domain)
+
+	return h.ListHandler()
+}
+
+// GetSubscriptionHandler returns an http.HandlerFunc that returns a subscription.
+func (a *Api) GetSubscriptionHandler() http.HandlerFunc {
+	h := handlers.NewSubscriptionsHandler(a.subscriptionsRepo, a.domain)
+
+	return h.GetHandler()
+}
+
+// PauseSubscriptionHandler returns an http.HandlerFunc that pauses a subscription.
+func (a *Api) PauseSubscriptionHandler() http.HandlerFunc {
+	h := handlers.NewSubscriptionsHandler(a.subscriptionsRepo, a.domain)
+
+	return h.PauseHandler()
+}
+
+// ResumeSubscriptionHandler returns an http.HandlerFunc that resumes a subscription.
+func (a *Api) ResumeSubscriptionHandler() http.HandlerFunc {
+	h := handlers.NewSubscriptionsHandler(a.subscriptionsRepo, a.domain)
+
+	return h.ResumeHandler()
+}
+
+// CancelSubscriptionHandler returns an http.HandlerFunc that cancels a subscription.
+func (a *Api) CancelSubscriptionHandler() http.HandlerFunc {
+	h := handlers.NewSubscriptionsHandler(a.subscriptionsRepo, a.domain)
+
+	return h.CancelHandler()
+}
+
+// GetDisputesHandler returns an http.HandlerFunc that lists the merchant's disputes.
+func (a *Api) GetDisputesHandler() http.HandlerFunc {
+	h := handlers.NewDisputesHandler(a.disputesRepo, a.domain)
+
+	return h.ListHandler()
+}
+
+// GetDisputeHandler returns an http.HandlerFunc that returns a dispute.
+func (a *Api) GetDisputeHandler() http.HandlerFunc {
+	h := handlers.NewDisputesHandler(a.disputesRepo, a.domain)
+
+	return h.GetHandler()
+}
+
+// PostDisputeEvidenceHandler returns an http.HandlerFunc that uploads evidence for a dispute.
+func (a *Api) PostDisputeEvidenceHandler() http.HandlerFunc {
+	h := handlers.NewDisputesHandler(a.disputesRepo, a.domain)
+
+	return h.EvidenceHandler()
+}
+
+// SubmitDisputeHandler returns an http.HandlerFunc that sends a dispute's evidence to the acquirer.
+func (a *Api) SubmitDisputeHandler() http.HandlerFunc {
+	h := handlers.NewDisputesHandler(a.disputesRepo, a.domain)
+
+	return h.SubmitHandler()
+}
+
+// AcceptDisputeHandler returns an http.HandlerFunc that accepts a dispute.
+func (a *Api) AcceptDisputeHandler() http.HandlerFunc {
+	h := handlers.NewDisputesHandler(a.disputesRepo, a.domain)
+
+	return h.AcceptHandler()
+}
+
+// PostDisputeNotificationsHandler returns an http.HandlerFunc that ingests the acquirer's dispute notifications.
+func (a *Api) PostDisputeNotificationsHandler() http.HandlerFunc {
+	h := handlers.NewDisputesHandler(a.disputesRepo, a.domain)
+
+	return h.NotificationsHandler()
+}
+
+// PostPaymentLinkHandler returns an http.HandlerFunc that creates a payment link.
+func (a *Api) PostPaymentLinkHandler() http.HandlerFunc {
+	h := handlers.NewPaymentLinksHandler(a.paymentLinksRepo, a.domain, a.csrf)
+
+	return h.PostHandler()
+}
+
+// GetPaymentLinkHandler returns an http.HandlerFunc that returns a payment link.
+func (a *Api) GetPaymentLinkHandler() http.HandlerFunc {
+	h := handlers.NewPaymentLinksHandler(a.paymentLinksRepo, a.domain, a.csrf)
+
+	return h.GetHandler()
+}
+
+// PaymentPageHandler returns an http.HandlerFunc that serves the hosted payment page of a link.
+func (a *Api) PaymentPageHandler() http.HandlerFunc {
+	h := handlers.NewPaymentLinksHandler(a.paymentLinksRepo, a.domain, a.csrf)
+
+	return h.PageHandler()
+}
+
+// SubmitPaymentPageHandler returns an http.HandlerFunc that pays a link with the card posted from the hosted page.
+func (a *Api) SubmitPaymentPageHandler() http.HandlerFunc {
+	h := handlers.NewPaymentLinksHandler(a.paymentLinksRepo, a.domain, a.csrf)
+
+	return h.SubmitHandler()
+}
+
+// PaymentPageReturnHandler returns an http.HandlerFunc that finishes a link's payment after 3-D Secure.
+func (a *Api) PaymentPageReturnHandler() http.HandlerFunc {
+	h := handlers.NewPaymentLinksHandler(a.paymentLinksRepo, a.domain, a.csrf)
+
+	return h.ReturnHandler()
+}
+
+// PostRetentionRunHandler returns an http.HandlerFunc that applies the merchants' retention policies.
+func (a *Api) PostRetentionRunHandler() http.HandlerFunc {
+	h := handlers.NewRetentionHandler(a.domain)
+
+	return h.RunHandler()
+}
+
+// PostErasureHandler returns an http.HandlerFunc that erases a card holder's personal data from their payments.
+func (a *Api) PostErasureHandler() http.HandlerFunc {
+	h := handlers.NewRetentionHandler(a.domain)
+
+	return h.EraseHandler()
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/auth"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/ratelimit"
+	"github.com/go-chi/chi/middleware"
+)
+
+// merchantMiddleware authenticates the merchant by the basic auth username and API key.  Requests without
+// credentials go on anonymously, for shoppers and the like, wrong credentials are refused.
+func merchantMiddleware(merchants auth.Tokens) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			merchantID, key, ok := r.BasicAuth()
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !merchants.Check(merchantID, key) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="payments"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(handlers.WithMerchantID(r.Context(), merchantID)))
+		})
+	}
+}
+
+// clientCertMiddleware identifies the merchant by the client certificate when one was presented, it
+// has to run after merchantMiddleware.  A basic auth username naming another merchant is refused.
+func clientCertMiddleware(config certs.ServerConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			merchantID, err := config.Merchant(r.TLS)
+			if err != nil {
+				log.Printf("refused client certificate: %v", err)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if merchantID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if claimed := handlers.MerchantIDFromContext(r.Context()); claimed != "" && claimed != merchantID {
+				log.Printf("client certificate of %s used with basic auth for %s", merchantID, claimed)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(handlers.WithMerchantID(r.Context(), merchantID)))
+		})
+	}
+}
+
+// adminMiddleware lets admins through on their bearer token, whoever it belongs to is the actor of the
+// changes they make.
+func adminMiddleware(admins auth.Tokens) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor, ok := admins.Verify(auth.BearerToken(r))
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(handlers.WithActor(r.Context(), actor)))
+		})
+	}
+}
+
+// rateLimitKey counts requests against the merchant, or the client IP for anonymous callers.  The
+// merchant has been authenticated by now so nobody can spread their requests over made up merchants.
+func rateLimitKey(r *http.Request) string {
+	return ratelimit.Key(handlers.MerchantIDFromContext(r.Context()), handlers.ClientIP(r))
+}
+
+// requestIDHeader hands the request id back to the client so it can be matched against the audit log.
+func requestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,388 @@
+package audit
+
+/*
+The audit log records who changed what.  Entries are only ever appended and each one carries the SHA-256 of the one before it, so editing, removing or reordering entries breaks the chain from that point on.  Somebody able to rewrite the whole file could also rewrite the hashes after their change, which is why the head hash printed by the audit verify command is worth writing down somewhere else now and then.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// ActorSystem is the actor of changes the gateway makes by itself, like scheduled jobs.
+const ActorSystem = "system"
+
+// Change is what the caller knows about a change, the log works out the rest of the entry.
+type Change struct {
+	Actor     string
+	RequestID string
+	// Action defaults to <resource>.created, <resource>.updated or <resource>.deleted.
+	Action     string
+	Resource   string
+	ResourceID string
+	// After is the resource once changed, nil when it was removed.  Before is whatever After was the
+	// last time the same resource was recorded.
+	After any
+}
+
+// Query picks entries out of the log, empty fields match everything.
+type Query struct {
+	Resource   string
+	ResourceID string
+	Actor      string
+	Action     string
+	// AfterSeq skips the entries up to and including this one, for paging.
+	AfterSeq uint64
+	Limit    int
+}
+
+// indexEvery is how many entries apart the offsets kept for paging are.
+const indexEvery = 1024
+
+// Log keeps its entries in the file only.  What stays in memory is the head of the chain, where every
+// indexEvery-th entry starts so pages can be read without going through the whole file, and where the
+// last entry of each resource starts so the next change to it can be given its before.
+type Log struct {
+	mu     sync.Mutex
+	file   logFile
+	size   int64
+	seq    uint64
+	hash   string
+	index  []int64
+	latest map[string]int64
+	now    func() time.Time
+}
+
+// logFile is where the entries are written, a file or a buffer for logs that are only kept in memory.
+type logFile interface {
+	io.Writer
+	io.ReaderAt
+	io.Closer
+}
+
+// NewLog returns a log that is only kept in memory.
+func NewLog() *Log {
+	return &Log{
+		file:   &memoryFile{},
+		latest: map[string]int64{},
+		now:    time.Now,
+	}
+}
+
+// Open continues the log in the file at path, one JSON entry per line.  The entries already in the
+// file are verified first, a log that has been tampered with is not appended to.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l := NewLog()
+	l.file = file
+	var chain Chain
+	err = scan(file, 0, info.Size(), func(entry models.AuditEntry, offset int64) (bool, error) {
+		if err := chain.Next(entry); err != nil {
+			return false, err
+		}
+		l.apply(entry, offset)
+		return true, nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	l.size = info.Size()
+	return l, nil
+}
+
+// WithClock swaps the clock used to time entries, handy for tests.
+func (l *Log) WithClock(now func() time.Time) *Log {
+	l.now = now
+	return l
+}
+
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Record appends change to the log.  A nil log records nothing so the log can stay optional.
+func (l *Log) Record(change Change) (*models.AuditEntry, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	after, err := json.Marshal(change.After)
+	if err != nil {
+		return nil, err
+	}
+	if change.After == nil {
+		after = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	before, err := l.state(change.Resource, change.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+	action := change.Action
+	if action == "" {
+		switch {
+		case after == nil:
+			action = change.Resource + ".deleted"
+		case before != nil:
+			action = change.Resource + ".updated"
+		default:
+			action = change.Resource + ".created"
+		}
+	}
+
+	entry := models.AuditEntry{
+		Seq:        l.seq + 1,
+		At:         l.now().UTC(),
+		Actor:      change.Actor,
+		RequestID:  change.RequestID,
+		Action:     action,
+		Resource:   change.Resource,
+		ResourceID: change.ResourceID,
+		Before:     before,
+		After:      after,
+		PrevHash:   l.hash,
+	}
+	entry.Hash, err = Hash(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// the file comes first, an entry that is not written down must not be built on
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	l.apply(entry, l.size)
+	l.size += int64(len(line)) + 1
+	return &entry, nil
+}
+
+// apply moves the head of the log on to entry, which starts at offset in the file.
+func (l *Log) apply(entry models.AuditEntry, offset int64) {
+	l.seq, l.hash = entry.Seq, entry.Hash
+	if (entry.Seq-1)%indexEvery == 0 {
+		l.index = append(l.index, offset)
+	}
+	key := stateKey(entry.Resource, entry.ResourceID)
+	// entries read back from the file have a literal null for removed resources
+	if entry.After == nil || string(entry.After) == "null" {
+		delete(l.latest, key)
+		return
+	}
+	l.latest[key] = offset
+}
+
+// state is the resource as the last entry for it left it, nil when there is none or it was removed.
+func (l *Log) state(resource, id string) (json.RawMessage, error) {
+	offset, ok := l.latest[stateKey(resource, id)]
+	if !ok {
+		return nil, nil
+	}
+	var state json.RawMessage
+	err := scan(l.file, offset, l.size, func(entry models.AuditEntry, _ int64) (bool, error) {
+		state = entry.After
+		return false, nil
+	})
+	return state, err
+}
+
+// Entries returns the entries matching q, oldest first.  They are read from the file starting at the
+// closest indexed entry before q.AfterSeq, so later pages do not cost more than earlier ones.
+func (l *Log) Entries(q Query) ([]models.AuditEntry, error) {
+	l.mu.Lock()
+	// entries are only ever appended so whatever was written so far can be read without the lock
+	size := l.size
+	var from int64
+	if i := int(q.AfterSeq / indexEvery); i < len(l.index) {
+		from = l.index[i]
+	} else {
+		from = size
+	}
+	l.mu.Unlock()
+
+	entries := []models.AuditEntry{}
+	err := scan(l.file, from, size, func(entry models.AuditEntry, _ int64) (bool, error) {
+		if entry.Seq <= q.AfterSeq ||
+			(q.Resource != "" && entry.Resource != q.Resource) ||
+			(q.ResourceID != "" && entry.ResourceID != q.ResourceID) ||
+			(q.Actor != "" && entry.Actor != q.Actor) ||
+			(q.Action != "" && entry.Action != q.Action) {
+			return true, nil
+		}
+		entries = append(entries, entry)
+		return q.Limit == 0 || len(entries) < q.Limit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func stateKey(resource, id string) string {
+	return resource + "/" + id
+}
+
+// scan reads the entries in r between from and to, passing each one to fn along with where it
+// starts, until fn returns false.
+func scan(r io.ReaderAt, from, to int64, fn func(entry models.AuditEntry, offset int64) (bool, error)) error {
+	reader := bufio.NewReader(io.NewSectionReader(r, from, to-from))
+	offset := from
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		start := offset
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry models.AuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("offset %d: %w", start, err)
+		}
+		more, err := fn(entry, start)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// memoryFile holds the entries of a log made with NewLog.
+type memoryFile struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+func (f *memoryFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data = append(f.data, p...)
+	return len(p), nil
+}
+
+func (f *memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+// Hash is the hash of entry covering every field but Hash itself.
+func Hash(entry models.AuditEntry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Read parses a log written by Open.
+func Read(r io.Reader) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry models.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+var ErrTampered = errors.New("audit log has been tampered with")
+
+// Chain checks entries one at a time, so a log can be verified while it is paged through.
+type Chain struct {
+	seq  uint64
+	hash string
+}
+
+// Next checks that entry follows on from the entries seen so far.
+func (c *Chain) Next(entry models.AuditEntry) error {
+	if entry.Seq != c.seq+1 {
+		return fmt.Errorf("%w: expected entry %d but found %d", ErrTampered, c.seq+1, entry.Seq)
+	}
+	if entry.PrevHash != c.hash {
+		return fmt.Errorf("%w: entry %d does not follow on from entry %d", ErrTampered, entry.Seq, c.seq)
+	}
+	hash, err := Hash(entry)
+	if err != nil {
+		return err
+	}
+	if hash != entry.Hash {
+		return fmt.Errorf("%w: entry %d has been changed", ErrTampered, entry.Seq)
+	}
+	c.seq, c.hash = entry.Seq, entry.Hash
+	return nil
+}
+
+// Head is the number of entries verified and the hash of the last one.
+func (c *Chain) Head() (uint64, string) {
+	return c.seq, c.hash
+}
+
+// Verify checks that entries form an unbroken chain from the first entry.
+func Verify(entries []models.AuditEntry) error {
+	var chain Chain
+	for _, entry := range entries {
+		if err := chain.Next(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
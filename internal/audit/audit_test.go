@@ -0,0 +1,175 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type profile struct {
+	Limit int `json:"limit"`
+}
+
+func entries(t *testing.T, l *audit.Log, q audit.Query) []models.AuditEntry {
+	t.Helper()
+	entries, err := l.Entries(q)
+	require.NoError(t, err)
+	return entries
+}
+
+func TestLog_Record(t *testing.T) {
+	l := audit.NewLog()
+
+	created, err := l.Record(audit.Change{Actor: "admin", RequestID: "req-1", Resource: "merchant", ResourceID: "m1", After: profile{Limit: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, "merchant.created", created.Action)
+	assert.Equal(t, uint64(1), created.Seq)
+	assert.Empty(t, created.PrevHash)
+	assert.Nil(t, created.Before)
+	assert.JSONEq(t, `{"limit":1}`, string(created.After))
+
+	updated, err := l.Record(audit.Change{Actor: "admin", Resource: "merchant", ResourceID: "m1", After: profile{Limit: 2}})
+	require.NoError(t, err)
+	assert.Equal(t, "merchant.updated", updated.Action)
+	assert.Equal(t, created.Hash, updated.PrevHash)
+	assert.JSONEq(t, `{"limit":1}`, string(updated.Before))
+
+	deleted, err := l.Record(audit.Change{Actor: "admin", Resource: "merchant", ResourceID: "m1"})
+	require.NoError(t, err)
+	assert.Equal(t, "merchant.deleted", deleted.Action)
+	assert.JSONEq(t, `{"limit":2}`, string(deleted.Before))
+
+	_, err = l.Record(audit.Change{Actor: "system", Action: "settlement.run", Resource: "settlement", ResourceID: "s1", After: "done"})
+	require.NoError(t, err)
+
+	all := entries(t, l, audit.Query{})
+	assert.Len(t, all, 4)
+	assert.Len(t, entries(t, l, audit.Query{Resource: "merchant", Actor: "admin"}), 3)
+	assert.Len(t, entries(t, l, audit.Query{Action: "settlement.run"}), 1)
+	page := entries(t, l, audit.Query{AfterSeq: 1, Limit: 2})
+	require.Len(t, page, 2)
+	assert.Equal(t, uint64(2), page[0].Seq)
+	assert.NoError(t, audit.Verify(all))
+
+	var nilLog *audit.Log
+	entry, err := nilLog.Record(audit.Change{Resource: "merchant"})
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestLog_OpenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	clock := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	l, err := audit.Open(path)
+	require.NoError(t, err)
+	l.WithClock(func() time.Time { return clock })
+	_, err = l.Record(audit.Change{Actor: "admin", Resource: "list_entry", ResourceID: "e1", After: map[string]string{"value": "<script>"}})
+	require.NoError(t, err)
+	_, err = l.Record(audit.Change{Actor: "admin", Resource: "list_entry", ResourceID: "e1"})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	l, err = audit.Open(path)
+	require.NoError(t, err)
+	// the entity was removed before the restart so adding it again is a creation
+	entry, err := l.Record(audit.Change{Actor: "admin", Resource: "list_entry", ResourceID: "e1", After: map[string]string{"value": "x"}})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	assert.Equal(t, uint64(3), entry.Seq)
+	assert.Equal(t, "list_entry.created", entry.Action)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	entries, err := audit.Read(f)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.NoError(t, audit.Verify(entries))
+}
+
+func TestLog_PagesFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := audit.Open(path)
+	require.NoError(t, err)
+	for i := 1; i <= 3000; i++ {
+		_, err := l.Record(audit.Change{Actor: "admin", Resource: "merchant", ResourceID: "m" + strconv.Itoa(i%10), After: profile{Limit: i}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.Close())
+
+	l, err = audit.Open(path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	page := entries(t, l, audit.Query{AfterSeq: 2500, Limit: 2})
+	require.Len(t, page, 2)
+	assert.Equal(t, uint64(2501), page[0].Seq)
+	assert.Equal(t, uint64(2502), page[1].Seq)
+	assert.Empty(t, entries(t, l, audit.Query{AfterSeq: 3000}))
+
+	// the before of a change after the restart is read back from the file
+	entry, err := l.Record(audit.Change{Actor: "admin", Resource: "merchant", ResourceID: "m3", After: profile{Limit: 0}})
+	require.NoError(t, err)
+	assert.Equal(t, "merchant.updated", entry.Action)
+	assert.JSONEq(t, `{"limit":2993}`, string(entry.Before))
+	assert.Len(t, entries(t, l, audit.Query{ResourceID: "m3", AfterSeq: 2990}), 2)
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	l := audit.NewLog()
+	for _, id := range []string{"p1", "p2", "p3"} {
+		_, err := l.Record(audit.Change{Actor: "merchant-1", Resource: "payment", ResourceID: id, After: map[string]int{"amount": 100}})
+		require.NoError(t, err)
+	}
+	recorded := entries(t, l, audit.Query{})
+
+	tests := map[string]func([]models.AuditEntry) []models.AuditEntry{
+		"changed value": func(e []models.AuditEntry) []models.AuditEntry {
+			e[1].After = json.RawMessage(`{"amount":1}`)
+			return e
+		},
+		"changed actor": func(e []models.AuditEntry) []models.AuditEntry {
+			e[0].Actor = "admin"
+			return e
+		},
+		"removed entry": func(e []models.AuditEntry) []models.AuditEntry {
+			return append(e[:1], e[2:]...)
+		},
+		"reordered": func(e []models.AuditEntry) []models.AuditEntry {
+			e[1], e[2] = e[2], e[1]
+			return e
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			copied := append([]models.AuditEntry{}, recorded...)
+			assert.ErrorIs(t, audit.Verify(tamper(copied)), audit.ErrTampered)
+		})
+	}
+}
+
+func TestOpen_RefusesTamperedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := audit.Open(path)
+	require.NoError(t, err)
+	_, err = l.Record(audit.Change{Actor: "admin", Resource: "merchant", ResourceID: "m1", After: profile{Limit: 5}})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(contents), `"limit":5`, `"limit":500`, 1)), 0o600))
+
+	_, err = audit.Open(path)
+	assert.ErrorIs(t, err, audit.ErrTampered)
+}
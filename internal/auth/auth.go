@@ -0,0 +1,80 @@
+package auth
+
+/*
+Credentials for the callers of the gateway.  The settings only hold the SHA-256 of each token so that reading them is not enough to call the gateway.  Tokens are random, see Generate, so a plain hash is as good as a password hash would be.
+*/
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Tokens maps the name of a caller to the hex encoded SHA-256 of their token.
+type Tokens map[string]string
+
+// Verify returns the name token belongs to.  Every entry is compared in constant time so the answer takes
+// as long for a near miss as for a wild guess.
+func (t Tokens) Verify(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(token))
+	name := ""
+	for candidate, hash := range t {
+		expected, err := hex.DecodeString(hash)
+		if err == nil && subtle.ConstantTimeCompare(sum[:], expected) == 1 {
+			name = candidate
+		}
+	}
+	return name, name != ""
+}
+
+// Check reports whether token belongs to name.
+func (t Tokens) Check(name, token string) bool {
+	hash, ok := t[name]
+	if !ok || token == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(hash)
+	sum := sha256.Sum256([]byte(token))
+	return err == nil && subtle.ConstantTimeCompare(sum[:], expected) == 1
+}
+
+// Validate checks that every entry is a hash and not, say, the token itself.
+func (t Tokens) Validate() error {
+	for name, hash := range t {
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("the token of %q is not a hex encoded SHA-256", name)
+		}
+	}
+	return nil
+}
+
+// Hash is what goes into the settings for token.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate makes a new random token.
+func Generate() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// BearerToken returns the token of an Authorization: Bearer header.
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,41 @@
+package auth_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokens_Verify(t *testing.T) {
+	token, err := auth.Generate()
+	require.NoError(t, err)
+	tokens := auth.Tokens{"alice": auth.Hash(token), "bob": auth.Hash("bob-token")}
+	require.NoError(t, tokens.Validate())
+
+	name, ok := tokens.Verify(token)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", name)
+
+	for _, wrong := range []string{"", "bob", auth.Hash(token)} {
+		_, ok = tokens.Verify(wrong)
+		assert.False(t, ok, wrong)
+	}
+
+	assert.True(t, tokens.Check("bob", "bob-token"))
+	assert.False(t, tokens.Check("alice", "bob-token"))
+	assert.False(t, tokens.Check("carol", "bob-token"))
+
+	assert.Error(t, auth.Tokens{"alice": token + "x"}.Validate())
+}
+
+func TestBearerToken(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.Empty(t, auth.BearerToken(req))
+	req.SetBasicAuth("alice", "secret")
+	assert.Empty(t, auth.BearerToken(req))
+	req.Header.Set("Authorization", "Bearer abc")
+	assert.Equal(t, "abc", auth.BearerToken(req))
+}
@@ -0,0 +1,236 @@
+package certs
+
+/*
+TLS for the gateway and for its connections to the acquirers.  The settings come from a JSON file, see Config, and the certificates named in it are read again when they change on disk so they can be renewed without a restart.  Connections made before a renewal keep the certificate they were made with.
+
+Client certificates are optional for merchants.  When the server has a client CA, a merchant presenting a certificate signed by it is identified by the certificate rather than by the basic auth username, see ServerConfig.ClientMerchants.
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Config is the layout of the TLS settings file, a missing section keeps that side on plain HTTP.
+type Config struct {
+	Server *ServerConfig `json:"server,omitempty"`
+	Bank   *ClientConfig `json:"bank,omitempty"`
+}
+
+type ServerConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ClientCAFile turns on client certificates, they are asked for but not required.
+	ClientCAFile string `json:"client_ca_file,omitempty"`
+	// ClientMerchants maps the subject common name of a client certificate to the merchant it stands
+	// for.  A valid certificate that is not in here is refused.
+	ClientMerchants map[string]string `json:"client_merchants,omitempty"`
+}
+
+var ErrUnknownClient = errors.New("client certificate is not mapped to a merchant")
+
+// Merchant returns the merchant the verified client certificate of a connection stands for, or an empty
+// string when no certificate was presented.
+func (c ServerConfig) Merchant(state *tls.ConnectionState) (string, error) {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return "", nil
+	}
+	subject := state.VerifiedChains[0][0].Subject.CommonName
+	merchantID, ok := c.ClientMerchants[subject]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownClient, subject)
+	}
+	return merchantID, nil
+}
+
+// ClientConfig secures the connection to an acquirer.  An empty CAFile trusts the system roots, the
+// client certificate is only needed for mutual TLS.
+type ClientConfig struct {
+	URL      string `json:"url,omitempty"`
+	CAFile   string `json:"ca_file,omitempty"`
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+}
+
+// LoadConfig reads the settings file at path, the error wraps os.ErrNotExist when there is none.  Relative
+// paths in the file are taken from the directory the file is in.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	paths := []*string{}
+	if config.Server != nil {
+		paths = append(paths, &config.Server.CertFile, &config.Server.KeyFile, &config.Server.ClientCAFile)
+	}
+	if config.Bank != nil {
+		paths = append(paths, &config.Bank.CAFile, &config.Bank.CertFile, &config.Bank.KeyFile)
+	}
+	for _, file := range paths {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(filepath.Dir(path), *file)
+		}
+	}
+	return config, nil
+}
+
+// TLSConfig builds the server side, the certificate returned has to be kept reloaded by the caller.
+func (c ServerConfig) TLSConfig() (*tls.Config, *Certificate, error) {
+	cert, err := Load(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.GetCertificate,
+	}
+	if c.ClientCAFile != "" {
+		config.ClientCAs, err = LoadPool(c.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, cert, nil
+}
+
+// TLSConfig builds the client side, the certificate is nil when there is no client certificate.
+func (c ClientConfig) TLSConfig() (*tls.Config, *Certificate, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		pool, err := LoadPool(c.CAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile == "" && c.KeyFile == "" {
+		return config, nil, nil
+	}
+	cert, err := Load(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.GetClientCertificate = cert.GetClientCertificate
+	return config, cert, nil
+}
+
+// LoadPool reads a bundle of PEM encoded CA certificates.
+func LoadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificates found", path)
+	}
+	return pool, nil
+}
+
+// Certificate is a key pair that is read again from its files once they change.
+type Certificate struct {
+	mu       sync.RWMutex
+	certFile string
+	keyFile  string
+	modTime  time.Time
+	cert     *tls.Certificate
+}
+
+// Load reads the PEM encoded certificate chain and private key.
+func Load(certFile, keyFile string) (*Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both a certificate and a key file are needed")
+	}
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the key pair again when either file changed since it was last read, it reports whether
+// it did.  A broken pair is not loaded and the certificate in use stays.
+func (c *Certificate) Reload() (bool, error) {
+	modTime, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := modTime.Equal(c.modTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert, c.modTime = &cert, modTime
+	return true, nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *Certificate) current() *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert
+}
+
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current(), nil
+}
+
+func (c *Certificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.current(), nil
+}
+
+// Run reloads the certificate every interval until ctx is cancelled.
+func (c *Certificate) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if changed, err := c.Reload(); err != nil {
+				log.Printf("could not reload certificate %s: %v", c.certFile, err)
+			} else if changed {
+				log.Printf("reloaded certificate %s", c.certFile)
+			}
+		}
+	}
+}
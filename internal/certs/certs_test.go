@@ -0,0 +1,168 @@
+package certs_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert issues a certificate for commonName and writes it to dir, it returns the certificate and key paths.
+func writeCert(t *testing.T, ca *certs.CA, dir, commonName string, hosts ...string) (string, string) {
+	cert, key, err := ca.Issue(commonName, hosts...)
+	require.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, commonName+".pem"), filepath.Join(dir, commonName+"-key.pem")
+	require.NoError(t, os.WriteFile(certFile, cert, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, key, 0o600))
+	return certFile, keyFile
+}
+
+func newCA(t *testing.T, dir string) (*certs.CA, string) {
+	ca, err := certs.NewCA("test CA")
+	require.NoError(t, err)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.CertPEM, 0o600))
+	return ca, caFile
+}
+
+// newServer serves the merchant of the client certificate, or the error mapping it.
+func newServer(t *testing.T, config certs.ServerConfig) (*httptest.Server, *certs.Certificate) {
+	tlsConfig, cert, err := config.TLSConfig()
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		merchantID, err := config.Merchant(r.TLS)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(merchantID))
+	}))
+	// StartTLS would add its own certificate, which wins over GetCertificate without SNI
+	server.Listener = tls.NewListener(server.Listener, tlsConfig)
+	server.Start()
+	server.URL = strings.Replace(server.URL, "http://", "https://", 1)
+	t.Cleanup(server.Close)
+	return server, cert
+}
+
+func get(t *testing.T, config certs.ClientConfig, url string) (*http.Response, error) {
+	tlsConfig, _, err := config.TLSConfig()
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(url)
+	if err == nil {
+		t.Cleanup(func() { resp.Body.Close() })
+	}
+	return resp, err
+}
+
+func TestServerConfig_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile := newCA(t, dir)
+	certFile, keyFile := writeCert(t, ca, dir, "localhost", "127.0.0.1")
+	merchantCert, merchantKey := writeCert(t, ca, dir, "merchant-1.example")
+	unknownCert, unknownKey := writeCert(t, ca, dir, "unknown.example")
+
+	server, _ := newServer(t, certs.ServerConfig{
+		CertFile:        certFile,
+		KeyFile:         keyFile,
+		ClientCAFile:    caFile,
+		ClientMerchants: map[string]string{"merchant-1.example": "merchant-1"},
+	})
+
+	t.Run("without the CA the server is not trusted", func(t *testing.T) {
+		_, err := get(t, certs.ClientConfig{}, server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("client certificates are optional", func(t *testing.T) {
+		resp, err := get(t, certs.ClientConfig{CAFile: caFile}, server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("the certificate subject is mapped to the merchant", func(t *testing.T) {
+		resp, err := get(t, certs.ClientConfig{CAFile: caFile, CertFile: merchantCert, KeyFile: merchantKey}, server.URL)
+		require.NoError(t, err)
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		assert.Equal(t, "merchant-1", string(body[:n]))
+	})
+
+	t.Run("a certificate without a merchant is refused", func(t *testing.T) {
+		resp, err := get(t, certs.ClientConfig{CAFile: caFile, CertFile: unknownCert, KeyFile: unknownKey}, server.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("a certificate from another CA is refused", func(t *testing.T) {
+		other, err := certs.NewCA("other CA")
+		require.NoError(t, err)
+		otherCert, otherKey := writeCert(t, other, t.TempDir(), "merchant-1.example")
+		_, err = get(t, certs.ClientConfig{CAFile: caFile, CertFile: otherCert, KeyFile: otherKey}, server.URL)
+		assert.Error(t, err)
+	})
+}
+
+func TestCertificate_Reload(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile := newCA(t, dir)
+	certFile, keyFile := writeCert(t, ca, dir, "localhost", "127.0.0.1")
+	server, cert := newServer(t, certs.ServerConfig{CertFile: certFile, KeyFile: keyFile})
+
+	serial := func() string {
+		resp, err := get(t, certs.ClientConfig{CAFile: caFile}, server.URL)
+		require.NoError(t, err)
+		return resp.TLS.PeerCertificates[0].SerialNumber.String()
+	}
+	before := serial()
+
+	changed, err := cert.Reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// a broken pair is not picked up
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	_, err = cert.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, before, serial())
+
+	renewedCert, renewedKey, err := ca.Issue("localhost", "127.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, renewedCert, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, renewedKey, 0o600))
+	later = later.Add(time.Second)
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+
+	changed, err = cert.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotEqual(t, before, serial())
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tls.json")
+	_, err := certs.LoadConfig(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"server":{"cert_file":"server.pem","key_file":"server-key.pem","client_merchants":{"m1.example":"merchant-1"}},"bank":{"ca_file":"bank-ca.pem"}}`), 0o600))
+	config, err := certs.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "merchant-1", config.Server.ClientMerchants["m1.example"])
+	// relative to the settings file
+	assert.Equal(t, filepath.Join(filepath.Dir(path), "server.pem"), config.Server.CertFile)
+	assert.Equal(t, filepath.Join(filepath.Dir(path), "bank-ca.pem"), config.Bank.CAFile)
+
+	_, _, err = certs.ServerConfig{CertFile: "server.pem"}.TLSConfig()
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// auditPageSize is how many entries are fetched from the gateway at a time.
+const auditPageSize = 1000
+
+func runAudit(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return errors.New("usage: audit verify [flags]")
+	}
+	return runAuditVerify(args[1:], stdout)
+}
+
+// runAuditVerify checks the hash chain of the audit log, either the file the gateway writes or the
+// entries served by a running gateway.  A head hash written down earlier must still be part of the chain,
+// which catches a log that was rewritten from some point on.
+func runAuditVerify(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	file := flags.String("file", "", "path of the audit log file, the gateway is asked when empty")
+	head := flags.String("head", "", "hash of an entry that must still be in the log")
+	gateway := addGatewayFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var chain audit.Chain
+	seenHead := false
+	verify := func(entries []models.AuditEntry) error {
+		for _, entry := range entries {
+			if err := chain.Next(entry); err != nil {
+				return err
+			}
+			seenHead = seenHead || entry.Hash == *head
+		}
+		return nil
+	}
+
+	var err error
+	if *file != "" {
+		err = verifyAuditFile(*file, verify)
+	} else {
+		err = verifyAuditGateway(gateway, verify)
+	}
+	if err != nil {
+		return err
+	}
+
+	count, hash := chain.Head()
+	if *head != "" && !seenHead {
+		return fmt.Errorf("%w: entry %s is no longer in the log", audit.ErrTampered, *head)
+	}
+	fmt.Fprintf(stdout, "verified %d entries, head %s\n", count, hash)
+	return nil
+}
+
+func verifyAuditFile(path string, verify func([]models.AuditEntry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := audit.Read(f)
+	if err != nil {
+		return err
+	}
+	return verify(entries)
+}
+
+// verifyAuditGateway pages through the whole log, each page is verified before the next is fetched.
+func verifyAuditGateway(gateway *gatewayFlags, verify func([]models.AuditEntry) error) error {
+	client, err := gateway.client(requestTimeout)
+	if err != nil {
+		return err
+	}
+	after := uint64(0)
+	for {
+		query := url.Values{}
+		query.Set("after", strconv.FormatUint(after, 10))
+		query.Set("limit", strconv.Itoa(auditPageSize))
+		req, err := http.NewRequest("GET", gateway.baseURL()+"/api/admin/audit?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		authorize(req)
+
+		entries, err := fetchAuditPage(client, req)
+		if err != nil {
+			return err
+		}
+		if err := verify(entries); err != nil {
+			return err
+		}
+		if len(entries) < auditPageSize {
+			return nil
+		}
+		after = entries[len(entries)-1].Seq
+	}
+}
+
+func fetchAuditPage(client *http.Client, req *http.Request) ([]models.AuditEntry, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	var entries []models.AuditEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode audit log: %w", err)
+	}
+	return entries, nil
+}
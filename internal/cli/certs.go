@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
+)
+
+func runCerts(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "generate" {
+		return errors.New("usage: certs generate [flags]")
+	}
+	return runCertsGenerate(args[1:], stdout)
+}
+
+// runCertsGenerate writes a throwaway CA with a server certificate and client certificates signed by it,
+// enough to try out TLS and client certificates locally.  Existing files are never overwritten.
+func runCertsGenerate(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("certs generate", flag.ContinueOnError)
+	dir := flags.String("dir", "certs", "directory to write the certificates to")
+	hosts := flags.String("hosts", "localhost,127.0.0.1", "comma separated names and addresses of the server")
+	clients := flags.String("clients", "", "comma separated common names to issue client certificates for")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(*clients, ",") {
+		if name == "" {
+			continue
+		}
+		if strings.ContainsAny(name, `/\`) || name == "server" || name == "ca" {
+			return fmt.Errorf("invalid client name %q", name)
+		}
+		names = append(names, name)
+	}
+
+	ca, err := certs.NewCA("payment gateway development CA")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		return err
+	}
+	if err := writeNew(filepath.Join(*dir, "ca.pem"), ca.CertPEM, stdout); err != nil {
+		return err
+	}
+	if err := issue(ca, *dir, "server", strings.Split(*hosts, ","), stdout); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := issue(ca, *dir, name, nil, stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func issue(ca *certs.CA, dir, name string, hosts []string, stdout io.Writer) error {
+	commonName := name
+	if len(hosts) > 0 {
+		commonName = hosts[0]
+	}
+	cert, key, err := ca.Issue(commonName, hosts...)
+	if err != nil {
+		return err
+	}
+	if err := writeNew(filepath.Join(dir, name+".pem"), cert, stdout); err != nil {
+		return err
+	}
+	return writeNew(filepath.Join(dir, name+"-key.pem"), key, stdout)
+}
+
+func writeNew(path string, data []byte, stdout io.Writer) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "wrote %s\n", path)
+	return nil
+}
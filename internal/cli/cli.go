@@ -0,0 +1,103 @@
+package cli
+
+/*
+The gateway binary doubles up as a small operations tool, anything other than no arguments is treated as a subcommand.  The subcommands talk to a running gateway over HTTP since that is where the payments live, except for keys, certs and token which work on local files or nothing at all.  The admin token to call the gateway with is taken from GATEWAY_ADMIN_TOKEN, it is kept off the command line so that it does not show up in the process list.
+*/
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
+)
+
+const (
+	defaultURL    = "http://localhost:8090"
+	defaultTLSURL = "https://localhost:8090"
+
+	tokenEnvVar = "GATEWAY_ADMIN_TOKEN"
+
+	// requestTimeout bounds the calls to the gateway, apart from exports which can be large.
+	requestTimeout = time.Minute
+)
+
+// Run executes the subcommand in args, the program name must already have been stripped.
+func Run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("no command given")
+	}
+
+	switch args[0] {
+	case "reconcile":
+		return runReconcile(args[1:], stdout)
+	case "export":
+		return runExport(args[1:], stdout)
+	case "audit":
+		return runAudit(args[1:], stdout)
+	case "keys":
+		return runKeys(args[1:], stdout)
+	case "certs":
+		return runCerts(args[1:], stdout)
+	case "token":
+		return runToken(args[1:], stdout)
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// gatewayFlags are the flags of the subcommands that call a running gateway.
+type gatewayFlags struct {
+	url      *string
+	caFile   *string
+	certFile *string
+	keyFile  *string
+}
+
+func addGatewayFlags(flags *flag.FlagSet) *gatewayFlags {
+	return &gatewayFlags{
+		url:      flags.String("url", "", "base URL of the gateway, "+defaultTLSURL+" with -ca or -cert and "+defaultURL+" otherwise"),
+		caFile:   flags.String("ca", "", "CA bundle to trust the gateway's certificate with instead of the system roots"),
+		certFile: flags.String("cert", "", "client certificate to present to the gateway"),
+		keyFile:  flags.String("key", "", "key of the client certificate"),
+	}
+}
+
+func (g *gatewayFlags) baseURL() string {
+	switch {
+	case *g.url != "":
+		return *g.url
+	case *g.caFile != "" || *g.certFile != "":
+		return defaultTLSURL
+	}
+	return defaultURL
+}
+
+// client connects to the gateway with the TLS files of the flags, a zero timeout means none.
+func (g *gatewayFlags) client(timeout time.Duration) (*http.Client, error) {
+	tlsConfig, _, err := certs.ClientConfig{CAFile: *g.caFile, CertFile: *g.certFile, KeyFile: *g.keyFile}.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS files: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// authorize adds the admin token to a request for the gateway.
+func authorize(req *http.Request) {
+	if token := os.Getenv(tokenEnvVar); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func checkStatus(resp *http.Response, expected int) error {
+	if resp.StatusCode == expected {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("gateway returned %d: %s", resp.StatusCode, body)
+}
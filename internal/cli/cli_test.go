@@ -0,0 +1,191 @@
+package cli_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/cli"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_UnknownCommand(t *testing.T) {
+	err := cli.Run([]string{"frobnicate"}, io.Discard)
+	assert.EqualError(t, err, `unknown command "frobnicate"`)
+}
+
+func TestRun_Reconcile(t *testing.T) {
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/admin/reconciliations", r.URL.Path)
+		assert.Equal(t, "fixed", r.URL.Query().Get("format"))
+		assert.Equal(t, "simulator", r.URL.Query().Get("acquirer"))
+		body, _ := io.ReadAll(r.Body)
+		uploaded = string(body)
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.ReconciliationReport{
+			Id:      "report-1",
+			Summary: models.ReconciliationSummary{Matched: 1, Missing: 2},
+		})
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "settlement.txt")
+	require.NoError(t, os.WriteFile(file, []byte("settlement contents"), 0o600))
+
+	var stdout bytes.Buffer
+	err := cli.Run([]string{"reconcile", "-file", file, "-format", "fixed", "-acquirer", "simulator", "-url", server.URL}, &stdout)
+
+	assert.EqualError(t, err, "reconciliation report-1: 1 matched, 2 missing, 0 unexpected, 0 amount mismatches")
+	assert.Equal(t, "settlement contents", uploaded)
+	assert.Contains(t, stdout.String(), `"id": "report-1"`)
+}
+
+func TestRun_Export(t *testing.T) {
+	t.Setenv("GATEWAY_ADMIN_TOKEN", "admin-token")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/admin/reports/payments", r.URL.Path)
+		assert.Equal(t, "Bearer admin-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "jsonl", r.URL.Query().Get("format"))
+		assert.Equal(t, "merchant-1", r.URL.Query().Get("merchant"))
+		w.Write([]byte(`{"id":"p1"}` + "\n"))
+	}))
+	defer server.Close()
+
+	out := filepath.Join(t.TempDir(), "payments.jsonl")
+	err := cli.Run([]string{"export", "-format", "jsonl", "-merchant", "merchant-1", "-out", out, "-url", server.URL}, io.Discard)
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"p1"}`+"\n", string(contents))
+}
+
+func TestRun_AuditVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := audit.Open(path)
+	require.NoError(t, err)
+	var head *models.AuditEntry
+	for _, id := range []string{"p1", "p2"} {
+		head, err = log.Record(audit.Change{Actor: "merchant-1", Resource: "payment", ResourceID: id, After: map[string]int{"amount": 100}})
+		require.NoError(t, err)
+	}
+	defer log.Close()
+
+	var stdout bytes.Buffer
+	require.NoError(t, cli.Run([]string{"audit", "verify", "-file", path, "-head", head.Hash}, &stdout))
+	assert.Equal(t, "verified 2 entries, head "+head.Hash+"\n", stdout.String())
+
+	// the gateway serves the same entries
+	entries, err := log.Entries(audit.Query{})
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/admin/audit", r.URL.Path)
+		page := []models.AuditEntry{}
+		if r.URL.Query().Get("after") == "0" {
+			page = entries
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+	stdout.Reset()
+	require.NoError(t, cli.Run([]string{"audit", "verify", "-url", server.URL}, &stdout))
+	assert.Equal(t, "verified 2 entries, head "+head.Hash+"\n", stdout.String())
+
+	// a log rewritten from the first entry on no longer has the head that was written down
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+"\n"), 0o600))
+	err = cli.Run([]string{"audit", "verify", "-file", path, "-head", head.Hash}, io.Discard)
+	assert.ErrorIs(t, err, audit.ErrTampered)
+
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(lines[0], "merchant-1", "merchant-2", 1)+"\n"), 0o600))
+	err = cli.Run([]string{"audit", "verify", "-file", path}, io.Discard)
+	assert.ErrorIs(t, err, audit.ErrTampered)
+}
+
+func TestRun_Keys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	var stdout bytes.Buffer
+	require.NoError(t, cli.Run([]string{"keys", "generate", "-file", path}, &stdout))
+	assert.Error(t, cli.Run([]string{"keys", "generate", "-file", path}, io.Discard))
+
+	require.NoError(t, cli.Run([]string{"keys", "rotate", "-file", path}, io.Discard))
+	file, err := keyring.List(path)
+	require.NoError(t, err)
+	require.Len(t, file.Keys, 2)
+	assert.Equal(t, file.Keys[1].Id, file.Primary)
+
+	stdout.Reset()
+	require.NoError(t, cli.Run([]string{"keys", "list", "-file", path}, &stdout))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], file.Keys[0].Id+" "))
+	assert.True(t, strings.HasSuffix(lines[1], " primary"))
+	assert.NotContains(t, stdout.String(), base64.StdEncoding.EncodeToString(file.Keys[0].Secret))
+
+	assert.Error(t, cli.Run([]string{"keys", "destroy", "-file", path}, io.Discard))
+}
+
+func TestRun_CertsGenerate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	require.NoError(t, cli.Run([]string{"certs", "generate", "-dir", dir, "-clients", "merchant-1.example"}, io.Discard))
+
+	pool, err := certs.LoadPool(filepath.Join(dir, "ca.pem"))
+	require.NoError(t, err)
+	for _, name := range []string{"server", "merchant-1.example"} {
+		pair, err := tls.LoadX509KeyPair(filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem"))
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		require.NoError(t, err)
+		_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		assert.NoError(t, err)
+	}
+
+	// nothing is overwritten
+	assert.Error(t, cli.Run([]string{"certs", "generate", "-dir", dir}, io.Discard))
+	assert.Error(t, cli.Run([]string{"certs", "generate", "-dir", t.TempDir(), "-clients", "../escape"}, io.Discard))
+}
+
+func TestRun_ExportOverMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, cli.Run([]string{"certs", "generate", "-dir", dir, "-clients", "ops.example"}, io.Discard))
+	pool, err := certs.LoadPool(filepath.Join(dir, "ca.pem"))
+	require.NoError(t, err)
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "ops.example", r.TLS.PeerCertificates[0].Subject.CommonName)
+		w.Write([]byte("id\n"))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	var stdout bytes.Buffer
+	err = cli.Run([]string{"export", "-url", server.URL, "-ca", filepath.Join(dir, "ca.pem"),
+		"-cert", filepath.Join(dir, "ops.example.pem"), "-key", filepath.Join(dir, "ops.example-key.pem")}, &stdout)
+	require.NoError(t, err)
+	assert.Equal(t, "id\n", stdout.String())
+
+	// the gateway's certificate is not trusted without the CA
+	err = cli.Run([]string{"export", "-url", server.URL}, io.Discard)
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// runExport streams a payments export from the gateway to stdout or a file without buffering it.
+func runExport(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "export format, csv or jsonl")
+	merchant := flags.String("merchant", "", "only export payments for this merchant")
+	from := flags.String("from", "", "first day to export, YYYY-MM-DD")
+	to := flags.String("to", "", "day after the last day to export, YYYY-MM-DD")
+	columns := flags.String("columns", "", "comma separated list of columns, defaults to the finance set")
+	out := flags.String("out", "", "file to write to, defaults to stdout")
+	gateway := addGatewayFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// exports can be large so they are not subject to the usual timeout
+	client, err := gateway.client(0)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("format", *format)
+	for key, value := range map[string]string{"merchant": *merchant, "from": *from, "to": *to, "columns": *columns} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	req, err := http.NewRequest("GET", gateway.baseURL()+"/api/admin/reports/payments?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return err
+	}
+
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
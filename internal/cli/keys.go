@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/config"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+)
+
+// runKeys manages the keyring file the gateway encrypts card data with.  Unlike the other commands it
+// works on the file directly, a running gateway picks up a rotated keyring by itself.
+func runKeys(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: keys generate|rotate|list [flags]")
+	}
+
+	flags := flag.NewFlagSet("keys "+args[0], flag.ContinueOnError)
+	file := flags.String("file", "", "path of the keyring file, the keyring_file of the gateway's settings when empty")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *file == "" {
+		settings, err := config.Load(os.Getenv(config.EnvVar))
+		if err != nil {
+			return err
+		}
+		*file = settings.KeyringFile
+	}
+
+	switch args[0] {
+	case "generate":
+		key, err := keyring.Generate(*file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "generated key %s in %s\n", key.Id, *file)
+		return nil
+	case "rotate":
+		key, err := keyring.Rotate(*file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "rotated to key %s, stored values are rewrapped by the gateway in the background\n", key.Id)
+		return nil
+	case "list":
+		return listKeys(*file, stdout)
+	}
+	return fmt.Errorf("unknown keys command %q", args[0])
+}
+
+// listKeys prints the ids of the keys, never their secrets.
+func listKeys(path string, stdout io.Writer) error {
+	file, err := keyring.List(path)
+	if err != nil {
+		return err
+	}
+	for _, key := range file.Keys {
+		primary := ""
+		if key.Id == file.Primary {
+			primary = " primary"
+		}
+		fmt.Fprintf(stdout, "%s %s%s\n", key.Id, key.CreatedAt.Format(time.RFC3339), primary)
+	}
+	return nil
+}
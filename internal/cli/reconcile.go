@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// runReconcile uploads a settlement file to the gateway and prints the report, it fails when anything did not match.
+func runReconcile(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	file := flags.String("file", "", "path of the acquirer settlement file")
+	format := flags.String("format", "csv", "settlement file format, csv or fixed")
+	acquirer := flags.String("acquirer", "", "only reconcile payments processed by this acquirer")
+	from := flags.String("from", "", "first day covered by the file, YYYY-MM-DD")
+	to := flags.String("to", "", "day after the last day covered by the file, YYYY-MM-DD")
+	gateway := addGatewayFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	client, err := gateway.client(requestTimeout)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	query := url.Values{}
+	query.Set("format", *format)
+	for key, value := range map[string]string{"acquirer": *acquirer, "from": *from, "to": *to} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	req, err := http.NewRequest("POST", gateway.baseURL()+"/api/admin/reconciliations?"+query.Encode(), f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusCreated); err != nil {
+		return err
+	}
+
+	var report models.ReconciliationReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("failed to decode report: %w", err)
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	summary := report.Summary
+	if summary.Missing+summary.Unexpected+summary.AmountMismatch > 0 {
+		return fmt.Errorf("reconciliation %s: %d matched, %d missing, %d unexpected, %d amount mismatches",
+			report.Id, summary.Matched, summary.Missing, summary.Unexpected, summary.AmountMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/auth"
+)
+
+// runToken makes a new token, the hash goes into the gateway settings and the token to whoever calls it.
+func runToken(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	token, err := auth.Generate()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "token: %s\nhash:  %s\n", token, auth.Hash(token))
+	return nil
+}
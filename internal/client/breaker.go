@@ -0,0 +1,68 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+type BreakerConfig struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+// breaker opens after FailureThreshold consecutive failures and lets a single trial request through once Cooldown has passed.
+type breaker struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	failures int
+	openedAt time.Time
+	trial    bool
+	now      func() time.Time
+}
+
+func newBreaker(config BreakerConfig, now func() time.Time) *breaker {
+	return &breaker{
+		config: config,
+		now:    now,
+	}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.config.FailureThreshold <= 0 || b.failures < b.config.FailureThreshold {
+		return true
+	}
+	if b.trial || b.now().Sub(b.openedAt) < b.config.Cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.failures >= b.config.FailureThreshold {
+		b.openedAt = b.now()
+	}
+}
+
+func (b *breaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.config.FailureThreshold > 0 && b.failures >= b.config.FailureThreshold
+}
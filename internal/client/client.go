@@ -2,10 +2,10 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
@@ -29,6 +29,14 @@ func NewClient(baseURL string, timeout time.Duration) *HTTPClient {
 	}
 }
 
+// WithTLS connects to the bank with config, for a private CA or mutual TLS.
+func (c *HTTPClient) WithTLS(config *tls.Config) *HTTPClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	c.httpClient.Transport = transport
+	return c
+}
+
 func (c *HTTPClient) PostBankPayment(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
 	url := fmt.Sprintf("%s/payments", c.baseURL)
 	body, err := json.Marshal(request)
@@ -36,9 +44,6 @@ func (c *HTTPClient) PostBankPayment(request *models.PostPaymentBankRequest) (*m
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Log the JSON payload
-	log.Printf("Sending request to %s with payload: %s", url, string(body))
-
 	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to make POST request: %w", err)
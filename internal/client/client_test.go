@@ -1,13 +1,19 @@
 package client_test
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
@@ -22,6 +28,8 @@ func TestHTTPClient_PostBankPayment(t *testing.T) {
 		json.NewEncoder(w).Encode(&models.PostPaymentBankResponse{
 			Authorised:        true,
 			AuthorizationCode: "123456",
+			AcquirerReference: "acq-ref",
+			ResponseCode:      "00",
 		})
 	}))
 	defer testServer.Close()
@@ -43,9 +51,34 @@ func TestHTTPClient_PostBankPayment(t *testing.T) {
 
 	assert.True(t, resp.Authorised)
 	assert.NotEmpty(t, resp.AuthorizationCode)
+	assert.Equal(t, "acq-ref", resp.AcquirerReference)
+	assert.Equal(t, "00", resp.ResponseCode)
 
 }
 
+func TestHTTPClient_PostBankPayment_LogsNoCardData(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&models.PostPaymentBankResponse{Authorised: true})
+	}))
+	defer testServer.Close()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := client.NewClient(testServer.URL, 5*time.Second).PostBankPayment(&models.PostPaymentBankRequest{
+		CardNumber: "2222405343248877",
+		ExpiryDate: "4/2025",
+		Currency:   "GBP",
+		Amount:     100,
+		CVV:        "123",
+		CAVV:       "AAABBEg0VhI0VniQEjRWAAAAAAA=",
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, logged.String(), "2222405343248877")
+	assert.NotContains(t, logged.String(), "AAABBEg0VhI0VniQEjRWAAAAAAA=")
+}
+
 func TestHTTPClient_PostBankPayment_ServiceUnavailable(t *testing.T) {
 	// Create a test server that returns a 503 Service Unavailable response
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -74,3 +107,47 @@ func TestHTTPClient_PostBankPayment_ServiceUnavailable(t *testing.T) {
 
 	assert.Equal(t, http.StatusServiceUnavailable, bankErr.StatusCode)
 }
+
+func TestHTTPClient_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := certs.NewCA("acquirer CA")
+	require.NoError(t, err)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.CertPEM, 0o600))
+	write := func(name string, hosts ...string) (string, string) {
+		cert, key, err := ca.Issue(name, hosts...)
+		require.NoError(t, err)
+		certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+		require.NoError(t, os.WriteFile(certFile, cert, 0o600))
+		require.NoError(t, os.WriteFile(keyFile, key, 0o600))
+		return certFile, keyFile
+	}
+	bankCert, bankKey := write("bank", "127.0.0.1")
+	gatewayCert, gatewayKey := write("gateway")
+
+	// the acquirer only talks to clients with a certificate from its CA
+	testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gateway", r.TLS.PeerCertificates[0].Subject.CommonName)
+		json.NewEncoder(w).Encode(&models.PostPaymentBankResponse{Authorised: true, AuthorizationCode: "123456"})
+	}))
+	serverCert, err := tls.LoadX509KeyPair(bankCert, bankKey)
+	require.NoError(t, err)
+	pool, err := certs.LoadPool(caFile)
+	require.NoError(t, err)
+	testServer.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	testServer.StartTLS()
+	defer testServer.Close()
+
+	request := &models.PostPaymentBankRequest{CardNumber: "2222405343248877", ExpiryDate: "4/2025", Currency: "GBP", Amount: 100, CVV: "123"}
+
+	withoutCert, _, err := certs.ClientConfig{CAFile: caFile}.TLSConfig()
+	require.NoError(t, err)
+	_, err = client.NewClient(testServer.URL, 5*time.Second).WithTLS(withoutCert).PostBankPayment(request)
+	assert.Error(t, err)
+
+	mutual, _, err := certs.ClientConfig{CAFile: caFile, CertFile: gatewayCert, KeyFile: gatewayKey}.TLSConfig()
+	require.NoError(t, err)
+	resp, err := client.NewClient(testServer.URL, 5*time.Second).WithTLS(mutual).PostBankPayment(request)
+	require.NoError(t, err)
+	assert.True(t, resp.Authorised)
+}
@@ -0,0 +1,217 @@
+package client
+
+/*
+The router lets us talk to more than one acquiring bank.  Every acquirer connection is just another Client with a name, the router picks the primary for a payment from the first route that matches it and falls back to the other acquirers of that route when the primary is unavailable.
+
+We only fail over on an explicit 503 or when the circuit for an acquirer is open.  A timeout or a broken connection could mean the bank did authorise the payment, retrying it somewhere else would risk charging the shopper twice.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+type Target struct {
+	Acquirer string `json:"acquirer"`
+	Weight   int    `json:"weight"`
+}
+
+// Route matches payments on every non empty criteria, Targets share the traffic by weight and Failover is tried in order afterwards.
+type Route struct {
+	Name       string   `json:"name"`
+	Currencies []string `json:"currencies,omitempty"`
+	Schemes    []string `json:"schemes,omitempty"`
+	Merchants  []string `json:"merchants,omitempty"`
+	MinAmount  int      `json:"min_amount,omitempty"`
+	MaxAmount  int      `json:"max_amount,omitempty"`
+	Targets    []Target `json:"targets"`
+	Failover   []string `json:"failover,omitempty"`
+}
+
+type RoutingConfig struct {
+	Routes  []Route
+	Breaker BreakerConfig
+}
+
+// DefaultRoutingConfig sends every payment to acquirer.
+func DefaultRoutingConfig(acquirer string) RoutingConfig {
+	return RoutingConfig{
+		Routes: []Route{
+			{Name: "default", Targets: []Target{{Acquirer: acquirer, Weight: 1}}},
+		},
+		Breaker: DefaultBreakerConfig(),
+	}
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+type Router struct {
+	config    RoutingConfig
+	acquirers map[string]Client
+	breakers  map[string]*breaker
+	random    func(n int) int
+}
+
+func NewRouter(config RoutingConfig, acquirers map[string]Client) (*Router, error) {
+	r := &Router{
+		config:    config,
+		acquirers: acquirers,
+		breakers:  map[string]*breaker{},
+		random:    rand.IntN,
+	}
+
+	for name := range acquirers {
+		r.breakers[name] = newBreaker(config.Breaker, time.Now)
+	}
+
+	for _, route := range config.Routes {
+		if len(route.Targets) == 0 {
+			return nil, fmt.Errorf("route %q has no targets", route.Name)
+		}
+		for _, name := range route.acquirers() {
+			if _, ok := acquirers[name]; !ok {
+				return nil, fmt.Errorf("route %q uses unknown acquirer %q", route.Name, name)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// WithRandom swaps the source used for the weighted split, handy for tests.
+func (r *Router) WithRandom(random func(n int) int) *Router {
+	r.random = random
+	return r
+}
+
+// WithClock swaps the clock used by the circuit breakers, handy for tests.
+func (r *Router) WithClock(now func() time.Time) *Router {
+	for _, b := range r.breakers {
+		b.now = now
+	}
+	return r
+}
+
+// CircuitOpen reports whether the circuit for the named acquirer is currently open.
+func (r *Router) CircuitOpen(acquirer string) bool {
+	b, ok := r.breakers[acquirer]
+	return ok && b.open()
+}
+
+func (r *Router) PostBankPayment(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+	route := r.match(request)
+	if route == nil {
+		return nil, errors.New("no acquirer route matches the payment")
+	}
+
+	var lastErr error
+	for _, name := range r.candidates(route) {
+		b := r.breakers[name]
+		if !b.allow() {
+			lastErr = fmt.Errorf("circuit open for acquirer %s", name)
+			continue
+		}
+
+		response, err := r.acquirers[name].PostBankPayment(request)
+		if err == nil {
+			b.success()
+			response.Acquirer = name
+			return response, nil
+		}
+
+		var bankErr *gatewayerrors.BankError
+		if errors.As(err, &bankErr) && bankErr.StatusCode == http.StatusServiceUnavailable {
+			b.failure()
+			lastErr = err
+			continue
+		}
+
+		// the outcome at the bank is unknown so we must not try anyone else
+		b.failure()
+		return nil, err
+	}
+
+	return nil, gatewayerrors.NewBankError(
+		fmt.Errorf("no acquirer available: %w", lastErr),
+		http.StatusServiceUnavailable,
+	)
+}
+
+func (r *Router) match(request *models.PostPaymentBankRequest) *Route {
+	scheme := CardScheme(request.CardNumber)
+	for i := range r.config.Routes {
+		route := &r.config.Routes[i]
+		if !matches(route.Currencies, request.Currency) ||
+			!matches(route.Schemes, scheme) ||
+			!matches(route.Merchants, request.MerchantID) {
+			continue
+		}
+		if route.MinAmount > 0 && request.Amount < route.MinAmount {
+			continue
+		}
+		if route.MaxAmount > 0 && request.Amount > route.MaxAmount {
+			continue
+		}
+		return route
+	}
+	return nil
+}
+
+// candidates is the weighted pick first, then the other targets and finally the failover acquirers.
+func (r *Router) candidates(route *Route) []string {
+	total := 0
+	for _, target := range route.Targets {
+		total += target.Weight
+	}
+
+	primary := 0
+	if total > 0 {
+		n := r.random(total)
+		for i, target := range route.Targets {
+			if n < target.Weight {
+				primary = i
+				break
+			}
+			n -= target.Weight
+		}
+	}
+
+	candidates := []string{route.Targets[primary].Acquirer}
+	for i, target := range route.Targets {
+		if i != primary {
+			candidates = append(candidates, target.Acquirer)
+		}
+	}
+	return append(candidates, route.Failover...)
+}
+
+func (route Route) acquirers() []string {
+	names := []string{}
+	for _, target := range route.Targets {
+		names = append(names, target.Acquirer)
+	}
+	return append(names, route.Failover...)
+}
+
+func matches(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package client_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func unavailable() error {
+	return gatewayerrors.NewBankError(errors.New("acquiring bank unavailble"), http.StatusServiceUnavailable)
+}
+
+func TestRouter_RoutesByCurrencyAndScheme(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	eu := mocks.NewMockClient(ctrl)
+	uk := mocks.NewMockClient(ctrl)
+
+	router, err := client.NewRouter(client.RoutingConfig{
+		Routes: []client.Route{
+			{Name: "eur-visa", Currencies: []string{"EUR"}, Schemes: []string{client.SchemeVisa}, Targets: []client.Target{{Acquirer: "eu", Weight: 1}}},
+			{Name: "rest", Targets: []client.Target{{Acquirer: "uk", Weight: 1}}},
+		},
+	}, map[string]client.Client{"eu": eu, "uk": uk})
+	require.NoError(t, err)
+
+	eu.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+	uk.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+
+	response, err := router.PostBankPayment(&models.PostPaymentBankRequest{CardNumber: "4111111111111111", Currency: "EUR", Amount: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "eu", response.Acquirer)
+
+	// a mastercard in euros does not match the first route
+	response, err = router.PostBankPayment(&models.PostPaymentBankRequest{CardNumber: "2222405343248877", Currency: "EUR", Amount: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "uk", response.Acquirer)
+}
+
+func TestRouter_RoutesByMerchantAndAmount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	big := mocks.NewMockClient(ctrl)
+	small := mocks.NewMockClient(ctrl)
+
+	router, err := client.NewRouter(client.RoutingConfig{
+		Routes: []client.Route{
+			{Name: "big-tickets", Merchants: []string{"merchant-1"}, MinAmount: 10000, Targets: []client.Target{{Acquirer: "big", Weight: 1}}},
+			{Name: "rest", Targets: []client.Target{{Acquirer: "small", Weight: 1}}},
+		},
+	}, map[string]client.Client{"big": big, "small": small})
+	require.NoError(t, err)
+
+	big.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{}, nil)
+	small.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{}, nil).Times(2)
+
+	response, err := router.PostBankPayment(&models.PostPaymentBankRequest{MerchantID: "merchant-1", Amount: 20000})
+	require.NoError(t, err)
+	assert.Equal(t, "big", response.Acquirer)
+
+	response, err = router.PostBankPayment(&models.PostPaymentBankRequest{MerchantID: "merchant-1", Amount: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "small", response.Acquirer)
+
+	response, err = router.PostBankPayment(&models.PostPaymentBankRequest{MerchantID: "merchant-2", Amount: 20000})
+	require.NoError(t, err)
+	assert.Equal(t, "small", response.Acquirer)
+}
+
+func TestRouter_WeightedSplit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	a := mocks.NewMockClient(ctrl)
+	b := mocks.NewMockClient(ctrl)
+
+	router, err := client.NewRouter(client.RoutingConfig{
+		Routes: []client.Route{
+			{Name: "split", Targets: []client.Target{{Acquirer: "a", Weight: 80}, {Acquirer: "b", Weight: 20}}},
+		},
+	}, map[string]client.Client{"a": a, "b": b})
+	require.NoError(t, err)
+
+	n := 0
+	router.WithRandom(func(int) int { return n })
+
+	a.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{}, nil)
+	b.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{}, nil)
+
+	n = 79
+	response, err := router.PostBankPayment(&models.PostPaymentBankRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "a", response.Acquirer)
+
+	n = 80
+	response, err = router.PostBankPayment(&models.PostPaymentBankRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "b", response.Acquirer)
+}
+
+func TestRouter_FailoverAndCircuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mocks.NewMockClient(ctrl)
+	secondary := mocks.NewMockClient(ctrl)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	router, err := client.NewRouter(client.RoutingConfig{
+		Routes: []client.Route{
+			{Name: "default", Targets: []client.Target{{Acquirer: "primary", Weight: 1}}, Failover: []string{"secondary"}},
+		},
+		Breaker: client.BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute},
+	}, map[string]client.Client{"primary": primary, "secondary": secondary})
+	require.NoError(t, err)
+	router.WithClock(func() time.Time { return now })
+
+	// two 503s from the primary open its circuit, both payments fail over
+	primary.EXPECT().PostBankPayment(gomock.Any()).Return(nil, unavailable()).Times(2)
+	secondary.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil).Times(3)
+
+	for i := 0; i < 2; i++ {
+		response, err := router.PostBankPayment(&models.PostPaymentBankRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "secondary", response.Acquirer)
+	}
+	assert.True(t, router.CircuitOpen("primary"))
+
+	// while the circuit is open the primary is not called at all
+	response, err := router.PostBankPayment(&models.PostPaymentBankRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "secondary", response.Acquirer)
+
+	// after the cooldown a trial request goes to the primary and closes the circuit
+	now = now.Add(2 * time.Minute)
+	primary.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+	response, err = router.PostBankPayment(&models.PostPaymentBankRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "primary", response.Acquirer)
+	assert.False(t, router.CircuitOpen("primary"))
+}
+
+func TestRouter_NoFailoverOnUnknownOutcome(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mocks.NewMockClient(ctrl)
+	secondary := mocks.NewMockClient(ctrl)
+
+	router, err := client.NewRouter(client.RoutingConfig{
+		Routes: []client.Route{
+			{Name: "default", Targets: []client.Target{{Acquirer: "primary", Weight: 1}}, Failover: []string{"secondary"}},
+		},
+	}, map[string]client.Client{"primary": primary, "secondary": secondary})
+	require.NoError(t, err)
+
+	primary.EXPECT().PostBankPayment(gomock.Any()).Return(nil, errors.New("timeout"))
+
+	_, err = router.PostBankPayment(&models.PostPaymentBankRequest{})
+	assert.EqualError(t, err, "timeout")
+}
+
+func TestRouter_AllAcquirersUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mocks.NewMockClient(ctrl)
+
+	router, err := client.NewRouter(client.DefaultRoutingConfig("primary"), map[string]client.Client{"primary": primary})
+	require.NoError(t, err)
+
+	primary.EXPECT().PostBankPayment(gomock.Any()).Return(nil, unavailable())
+
+	var bankErr *gatewayerrors.BankError
+	_, err = router.PostBankPayment(&models.PostPaymentBankRequest{})
+	require.ErrorAs(t, err, &bankErr)
+	assert.Equal(t, http.StatusServiceUnavailable, bankErr.StatusCode)
+}
+
+func TestNewRouter_UnknownAcquirer(t *testing.T) {
+	_, err := client.NewRouter(client.DefaultRoutingConfig("missing"), map[string]client.Client{})
+	assert.EqualError(t, err, `route "default" uses unknown acquirer "missing"`)
+}
+
+func TestCardScheme(t *testing.T) {
+	assert.Equal(t, client.SchemeVisa, client.CardScheme("4111111111111111"))
+	assert.Equal(t, client.SchemeMastercard, client.CardScheme("5555555555554444"))
+	assert.Equal(t, client.SchemeMastercard, client.CardScheme("2222405343248877"))
+	assert.Equal(t, client.SchemeAmex, client.CardScheme("378282246310005"))
+	assert.Equal(t, client.SchemeDiscover, client.CardScheme("6011111111111117"))
+	assert.Equal(t, client.SchemeUnknown, client.CardScheme("9999999999999999"))
+}
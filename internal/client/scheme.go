@@ -0,0 +1,37 @@
+package client
+
+import "strconv"
+
+const (
+	SchemeVisa       = "visa"
+	SchemeMastercard = "mastercard"
+	SchemeAmex       = "amex"
+	SchemeDiscover   = "discover"
+	SchemeUnknown    = "unknown"
+)
+
+// CardScheme works out the card scheme from the leading digits of the card number.
+func CardScheme(cardNumber string) string {
+	prefix := func(n int) int {
+		if len(cardNumber) < n {
+			return -1
+		}
+		i, err := strconv.Atoi(cardNumber[:n])
+		if err != nil {
+			return -1
+		}
+		return i
+	}
+
+	switch {
+	case prefix(1) == 4:
+		return SchemeVisa
+	case prefix(2) >= 51 && prefix(2) <= 55, prefix(4) >= 2221 && prefix(4) <= 2720:
+		return SchemeMastercard
+	case prefix(2) == 34, prefix(2) == 37:
+		return SchemeAmex
+	case prefix(4) == 6011, prefix(2) == 65:
+		return SchemeDiscover
+	}
+	return SchemeUnknown
+}
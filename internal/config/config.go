@@ -0,0 +1,213 @@
+package config
+
+/*
+The gateway's settings come from a JSON file, see Config, named by the GATEWAY_CONFIG environment variable.  There are no defaults for anything secret: outside of dev mode a missing setting stops the gateway rather than have it make one up.  Relative paths in the file are taken from the directory the file is in, not from wherever the gateway was started.
+*/
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/auth"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/settlement"
+)
+
+// EnvVar names the settings file.
+const EnvVar = "GATEWAY_CONFIG"
+
+// minSecretSize is the least number of bytes we accept for a secret read from a file.
+const minSecretSize = 32
+
+type Config struct {
+	// Dev is for running the gateway locally, secrets that are missing are generated.
+	Dev bool `json:"dev"`
+	// DataDir is where the gateway keeps what has to survive a restart, like the payment queue journal.
+	DataDir string `json:"data_dir"`
+	// FingerprintKeyFile holds the secret card fingerprints are keyed with.  Changing it makes every card
+	// look new to the velocity limits and the risk rules, and card fingerprint list entries stop matching.
+	FingerprintKeyFile string `json:"fingerprint_key_file"`
+	// KeyringFile holds the keys card data is sealed with, see keyring.File.  It has to be outside of
+	// DataDir, a copy of the data should not come with the keys to it.  Only dev mode generates one.
+	KeyringFile string `json:"keyring_file"`
+	// Admins may call the admin API with their bearer token, see auth.Tokens.  Without any it refuses everyone.
+	Admins auth.Tokens `json:"admins,omitempty"`
+	// Merchants maps a merchant ID to the hash of its API key, merchants send both with basic auth.
+	Merchants auth.Tokens `json:"merchants,omitempty"`
+	// DeclineCodes maps the response codes of an acquirer onto our decline codes, for acquirers that do
+	// not stick to ISO 8583.  It is keyed by acquirer and then by response code.
+	DeclineCodes map[string]map[string]string `json:"decline_codes,omitempty"`
+	// RatesFile holds the exchange rates, see fx.Table for the layout.  Without it every conversion is
+	// refused, a file that is set but cannot be read stops the gateway.
+	RatesFile string `json:"rates_file,omitempty"`
+	// Acquirers are the banks payments can be sent to, keyed by the name routes and decline_codes use.  Each
+	// one has the url of its API and optionally the TLS files to connect with, see certs.ClientConfig.  Without
+	// any every payment goes to the bank simulator.
+	Acquirers map[string]certs.ClientConfig `json:"acquirers,omitempty"`
+	// Routes pick the acquirers for a payment, see client.Route.  They are only needed with more than one
+	// acquirer, a single one gets every payment.
+	Routes []client.Route `json:"routes,omitempty"`
+	// TLSFile holds the TLS settings, see certs.Config for the layout.  Without it everything is plain HTTP,
+	// a file that is set but cannot be read stops the gateway.
+	TLSFile string `json:"tls_file,omitempty"`
+	// MerchantFees gives merchants their own fee rules on top of settlement.DefaultFeeSchedule(), keyed by
+	// merchant ID.
+	MerchantFees map[string][]settlement.FeeRule `json:"merchant_fees,omitempty"`
+	// GRPCAddr is where the gRPC API listens, :9090 when it is not set.
+	GRPCAddr string `json:"grpc_addr,omitempty"`
+}
+
+// Load reads the settings file at path.
+func Load(path string) (Config, error) {
+	if path == "" {
+		return Config{}, fmt.Errorf("no settings file, set %s", EnvVar)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	config.resolve(filepath.Dir(path))
+	if err := config.validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Dev is a dev mode configuration keeping everything in dir, meant for tests.
+func Dev(dir string) Config {
+	config := Config{
+		Dev:                true,
+		DataDir:            "data",
+		FingerprintKeyFile: "fingerprint.key",
+		KeyringFile:        "keyring.json",
+	}
+	config.resolve(dir)
+	return config
+}
+
+func (c *Config) resolve(dir string) {
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	for _, path := range []*string{&c.DataDir, &c.FingerprintKeyFile, &c.KeyringFile, &c.RatesFile, &c.TLSFile} {
+		resolve(path)
+	}
+	for name, acquirer := range c.Acquirers {
+		resolve(&acquirer.CAFile)
+		resolve(&acquirer.CertFile)
+		resolve(&acquirer.KeyFile)
+		c.Acquirers[name] = acquirer
+	}
+}
+
+func (c Config) validate() error {
+	if c.DataDir == "" {
+		return errors.New("data_dir is required")
+	}
+	if c.FingerprintKeyFile == "" {
+		return errors.New("fingerprint_key_file is required")
+	}
+	if c.KeyringFile == "" {
+		return errors.New("keyring_file is required")
+	}
+	if within(c.DataDir, c.KeyringFile) {
+		return errors.New("keyring_file must not be in data_dir")
+	}
+	if err := c.Admins.Validate(); err != nil {
+		return fmt.Errorf("admins: %w", err)
+	}
+	if err := c.Merchants.Validate(); err != nil {
+		return fmt.Errorf("merchants: %w", err)
+	}
+	for name, acquirer := range c.Acquirers {
+		if acquirer.URL == "" {
+			return fmt.Errorf("acquirers: %s has no url", name)
+		}
+	}
+	if len(c.Acquirers) == 0 && len(c.Routes) > 0 {
+		return errors.New("routes need acquirers")
+	}
+	if len(c.Acquirers) > 1 && len(c.Routes) == 0 {
+		return errors.New("routes are required with more than one acquirer")
+	}
+	if len(c.Acquirers) > 0 {
+		// mappings for an acquirer we do not know of would never apply
+		for acquirer := range c.DeclineCodes {
+			if _, ok := c.Acquirers[acquirer]; !ok {
+				return fmt.Errorf("decline_codes: unknown acquirer %s", acquirer)
+			}
+		}
+	}
+	for merchantID, rules := range c.MerchantFees {
+		for _, rule := range rules {
+			if rule.BasisPoints < 0 || rule.Fixed < 0 {
+				return fmt.Errorf("merchant_fees: %s has a negative fee", merchantID)
+			}
+		}
+	}
+	return nil
+}
+
+// within tells if path is dir or somewhere under it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// FingerprintKey reads the key card fingerprints are made with.
+func (c Config) FingerprintKey() ([]byte, error) {
+	return c.secret(c.FingerprintKeyFile)
+}
+
+// secret reads the secret in path, in dev mode a missing one is generated.
+func (c Config) secret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && c.Dev {
+		data, err = generateSecret(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) < minSecretSize {
+		return nil, fmt.Errorf("%s: secret is shorter than %d bytes", path, minSecretSize)
+	}
+	return secret, nil
+}
+
+func generateSecret(path string) ([]byte, error) {
+	random := make([]byte, minSecretSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	data := []byte(hex.EncodeToString(random) + "\n")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	// O_EXCL so two gateways starting at once do not end up with different secrets
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return data, file.Close()
+}
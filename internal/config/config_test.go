@@ -0,0 +1,105 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/config"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/settlement"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, dir, contents string) string {
+	path := filepath.Join(dir, "gateway.json")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	loaded, err := config.Load(writeConfig(t, dir, `{"data_dir":"data","fingerprint_key_file":"secrets/fingerprint.key","keyring_file":"secrets/keyring.json","rates_file":"fx_rates.json","tls_file":"tls.json","grpc_addr":"127.0.0.1:9443"}`))
+	require.NoError(t, err)
+	assert.False(t, loaded.Dev)
+	assert.Equal(t, filepath.Join(dir, "data"), loaded.DataDir)
+	assert.Equal(t, filepath.Join(dir, "secrets", "fingerprint.key"), loaded.FingerprintKeyFile)
+	assert.Equal(t, filepath.Join(dir, "secrets", "keyring.json"), loaded.KeyringFile)
+	assert.Equal(t, filepath.Join(dir, "fx_rates.json"), loaded.RatesFile)
+	assert.Equal(t, filepath.Join(dir, "tls.json"), loaded.TLSFile)
+	assert.Equal(t, "127.0.0.1:9443", loaded.GRPCAddr)
+
+	_, err = config.Load(writeConfig(t, dir, `{"fingerprint_key_file":"fingerprint.key"}`))
+	assert.ErrorContains(t, err, "data_dir")
+
+	_, err = config.Load(writeConfig(t, dir, `{"data_dir":"data"}`))
+	assert.ErrorContains(t, err, "fingerprint_key_file")
+
+	_, err = config.Load(writeConfig(t, dir, `{"data_dir":"data","fingerprint_key_file":"fingerprint.key"}`))
+	assert.ErrorContains(t, err, "keyring_file")
+
+	// the keys do not go with the data they protect
+	_, err = config.Load(writeConfig(t, dir, `{"data_dir":"data","fingerprint_key_file":"fingerprint.key","keyring_file":"data/keyring.json"}`))
+	assert.ErrorContains(t, err, "keyring_file")
+	_, err = config.Load(writeConfig(t, dir, `{"data_dir":"data","fingerprint_key_file":"fingerprint.key","keyring_file":"data-keys/keyring.json"}`))
+	assert.NoError(t, err)
+
+	loaded, err = config.Load(writeConfig(t, dir, `{"data_dir":"data","fingerprint_key_file":"fingerprint.key","keyring_file":"keyring.json","merchant_fees":{"merchant-1":[{"scheme":"visa","basis_points":150,"fixed":20}]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, []settlement.FeeRule{{Scheme: "visa", BasisPoints: 150, Fixed: 20}}, loaded.MerchantFees["merchant-1"])
+	_, err = config.Load(writeConfig(t, dir, `{"data_dir":"data","fingerprint_key_file":"fingerprint.key","keyring_file":"keyring.json","merchant_fees":{"merchant-1":[{"basis_points":-1}]}}`))
+	assert.ErrorContains(t, err, "merchant_fees")
+
+	_, err = config.Load("")
+	assert.ErrorContains(t, err, config.EnvVar)
+}
+
+func TestLoad_Acquirers(t *testing.T) {
+	dir := t.TempDir()
+	base := `"data_dir":"data","fingerprint_key_file":"fingerprint.key","keyring_file":"keyring.json"`
+	loaded, err := config.Load(writeConfig(t, dir, `{`+base+`,
+		"acquirers":{"a":{"url":"https://a.example","ca_file":"certs/a-ca.pem"},"b":{"url":"https://b.example"}},
+		"routes":[{"name":"default","targets":[{"acquirer":"a","weight":1}],"failover":["b"]}],
+		"decline_codes":{"b":{"51":"insufficient_funds"}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "certs", "a-ca.pem"), loaded.Acquirers["a"].CAFile)
+	assert.Equal(t, "https://b.example", loaded.Acquirers["b"].URL)
+	require.Len(t, loaded.Routes, 1)
+	assert.Equal(t, []client.Target{{Acquirer: "a", Weight: 1}}, loaded.Routes[0].Targets)
+	assert.Equal(t, []string{"b"}, loaded.Routes[0].Failover)
+
+	// a single acquirer does not need routes
+	_, err = config.Load(writeConfig(t, dir, `{`+base+`,"acquirers":{"a":{"url":"https://a.example"}}}`))
+	assert.NoError(t, err)
+
+	tests := map[string]string{
+		"routes are required": `"acquirers":{"a":{"url":"https://a.example"},"b":{"url":"https://b.example"}}`,
+		"has no url":          `"acquirers":{"a":{}}`,
+		"routes need":         `"routes":[{"name":"default","targets":[{"acquirer":"a","weight":1}]}]`,
+		"unknown acquirer":    `"acquirers":{"a":{"url":"https://a.example"}},"decline_codes":{"simulator":{"51":"insufficient_funds"}}`,
+	}
+	for want, settings := range tests {
+		_, err = config.Load(writeConfig(t, dir, `{`+base+`,`+settings+`}`))
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestFingerprintKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fingerprint.key")
+
+	// secrets are only generated in dev mode
+	_, err := config.Config{FingerprintKeyFile: path}.FingerprintKey()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	generated, err := config.Dev(dir).FingerprintKey()
+	require.NoError(t, err)
+	again, err := config.Config{FingerprintKeyFile: path}.FingerprintKey()
+	require.NoError(t, err)
+	assert.Equal(t, generated, again)
+
+	require.NoError(t, os.WriteFile(path, []byte("short\n"), 0o600))
+	_, err = config.Config{FingerprintKeyFile: path}.FingerprintKey()
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package csrf
+
+/*
+Forms we serve ourselves are protected with a signed double submit token.  The page sets a random nonce in a cookie and puts the nonce with an HMAC over it and the form's scope in a hidden field.  A post is only accepted when the field matches the cookie and the signature, which a third party site can neither read nor forge.  The cookie is also SameSite=Strict so browsers do not send it along with cross site posts in the first place, and Secure so it never goes out over plain HTTP.  Browsers treat localhost as secure, so the dev setup still works without TLS.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FieldName is the hidden form field the token is expected in.
+const FieldName = "csrf_token"
+
+const (
+	cookieName = "gateway_csrf"
+	nonceSize  = 32
+	cookieTTL  = time.Hour
+)
+
+type Protector struct {
+	key []byte
+}
+
+func New(key []byte) *Protector {
+	return &Protector{key: key}
+}
+
+// NewRandom returns a Protector with a fresh key, tokens it issued do not survive a restart.
+func NewRandom() (*Protector, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return New(key), nil
+}
+
+// Issue sets the cookie for a form of scope served under path and returns the token to embed in it.
+func (p *Protector) Issue(w http.ResponseWriter, path, scope string) (string, error) {
+	b := make([]byte, nonceSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    nonce,
+		Path:     path,
+		MaxAge:   int(cookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nonce + "." + p.sign(nonce, scope), nil
+}
+
+// Verify checks the token posted with a form of scope.
+func (p *Protector) Verify(r *http.Request, scope string) bool {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return false
+	}
+	nonce, signature, ok := strings.Cut(r.PostFormValue(FieldName), ".")
+	if !ok {
+		return false
+	}
+	return hmac.Equal([]byte(nonce), []byte(cookie.Value)) &&
+		hmac.Equal([]byte(signature), []byte(p.sign(nonce, scope)))
+}
+
+func (p *Protector) sign(nonce, scope string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(scope))
+	mac.Write([]byte{0})
+	mac.Write([]byte(nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
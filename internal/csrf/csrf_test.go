@@ -0,0 +1,50 @@
+package csrf_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/csrf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func post(token string, cookies []*http.Cookie) *http.Request {
+	form := url.Values{csrf.FieldName: {token}}
+	req := httptest.NewRequest("POST", "/pay/link-1", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestProtector(t *testing.T) {
+	protector := csrf.New([]byte("key"))
+
+	w := httptest.NewRecorder()
+	token, err := protector.Issue(w, "/pay/link-1", "link-1")
+	require.NoError(t, err)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.True(t, cookies[0].Secure)
+	assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+
+	assert.True(t, protector.Verify(post(token, cookies), "link-1"))
+
+	// the token is bound to the form it was issued for
+	assert.False(t, protector.Verify(post(token, cookies), "link-2"))
+	// and needs the cookie that came with it
+	assert.False(t, protector.Verify(post(token, nil), "link-1"))
+	other := httptest.NewRecorder()
+	otherToken, err := protector.Issue(other, "/pay/link-1", "link-1")
+	require.NoError(t, err)
+	assert.False(t, protector.Verify(post(otherToken, cookies), "link-1"))
+	// tokens signed with another key are refused
+	assert.False(t, csrf.New([]byte("other")).Verify(post(token, cookies), "link-1"))
+	assert.False(t, protector.Verify(post("", cookies), "link-1"))
+}
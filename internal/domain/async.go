@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
+)
+
+type AsyncPaymentService interface {
+	CreateAsync(request *models.PostPaymentHandlerRequest) (*models.PostPaymentResponse, error)
+}
+
+// WithQueue lets payments be authorised in the background by the queue's workers.
+func WithQueue(q *queue.Queue) Option {
+	return func(p *PaymentServiceImpl) {
+		p.queue = q
+	}
+}
+
+// CreateAsync runs the same checks as Create but leaves the bank call to a worker, the payment is
+// returned as processing and can be polled until the bank answered.  queue.ErrQueueFull is returned
+// when the workers cannot keep up.
+func (p *PaymentServiceImpl) CreateAsync(request *models.PostPaymentHandlerRequest) (*models.PostPaymentResponse, error) {
+	paymentResponse, bankRequest, _, err := p.prepare(request)
+	if err != nil || bankRequest == nil {
+		return paymentResponse, err
+	}
+
+	// the shopper has to be challenged first, the callback does the bank call
+	if p.requiresAuthentication(request) {
+		err = p.startAuthentication(paymentResponse, bankRequest, request.ReturnURL)
+		if err != nil {
+			return nil, err
+		}
+		return paymentResponse, nil
+	}
+
+	paymentResponse.PaymentStatus = "processing"
+	err = p.queue.Enqueue(queue.Job{
+		Id:          paymentResponse.Id,
+		Payment:     *paymentResponse,
+		BankRequest: *bankRequest,
+		EnqueuedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// a worker may have beaten us to it, in which case it already published the outcome
+	if p.repo.AddPaymentIfAbsent(*paymentResponse) {
+		p.publish(*paymentResponse)
+	}
+
+	return paymentResponse, nil
+}
+
+// ProcessJob authorises a queued payment.  A payment that never reached a bank fails, any other bank
+// error leaves it unknown for reconciliation since we cannot tell whether it was authorised or not.
+// Neither is retried.
+func (p *PaymentServiceImpl) ProcessJob(job queue.Job) {
+	payment := job.Payment
+	bankRequest := job.BankRequest
+	// recovered jobs come back after a restart with an empty repository
+	p.repo.AddPaymentIfAbsent(payment)
+
+	if job.Started {
+		// the bank may have authorised it before the crash, sending it again could charge the card twice
+		log.Printf("queued payment %s was interrupted, leaving it to reconciliation", payment.Id)
+		payment.PaymentStatus = "unknown"
+		p.storeOutcome(payment)
+		return
+	}
+
+	// the merchant is not part of the bank request on the wire
+	bankRequest.MerchantID = payment.MerchantID
+
+	var profile *models.MerchantProfile
+	if p.merchants != nil {
+		profile = p.merchants.GetProfile(payment.MerchantID)
+	}
+	if err := p.authorise(&payment, &bankRequest, profile); err != nil {
+		var profileErr *gatewayerrors.ProfileError
+		if bankUnavailable(err) || errors.As(err, &profileErr) {
+			log.Printf("queued payment %s failed: %v", payment.Id, err)
+			payment.PaymentStatus = "failed"
+		} else {
+			log.Printf("queued payment %s has an unknown outcome, leaving it to reconciliation: %v", payment.Id, err)
+			payment.PaymentStatus = "unknown"
+		}
+	}
+
+	p.storeOutcome(payment)
+}
@@ -0,0 +1,125 @@
+package domain_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func asyncPayment() *models.PostPaymentHandlerRequest {
+	return &models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+		MerchantID:  "merchant-1",
+	}
+}
+
+func TestCreateAsync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	journal := queue.NewMemoryJournal()
+	repo := repository.NewPaymentsRepository()
+	paymentQueue, err := queue.New(queue.Config{Size: 1, Workers: 1}, journal)
+	require.NoError(t, err)
+	service := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithQueue(paymentQueue))
+
+	response, err := service.CreateAsync(asyncPayment())
+	require.NoError(t, err)
+	assert.Equal(t, "processing", response.PaymentStatus)
+	assert.Equal(t, "processing", repo.GetPayment(response.Id).PaymentStatus)
+
+	_, err = service.CreateAsync(asyncPayment())
+	assert.ErrorIs(t, err, queue.ErrQueueFull)
+
+	jobs, err := journal.Pending()
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+		assert.Equal(t, "merchant-1", request.MerchantID)
+		return &models.PostPaymentBankResponse{Authorised: true, AuthorizationCode: "auth-1"}, nil
+	})
+	service.ProcessJob(jobs[0])
+
+	payment := repo.GetPayment(response.Id)
+	assert.Equal(t, "authorized", payment.PaymentStatus)
+	assert.Equal(t, "auth-1", payment.AuthorizationCode)
+}
+
+func TestProcessJob_BankError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(nil, gatewayerrors.NewBankError(errors.New("unavailable"), http.StatusServiceUnavailable))
+
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient)
+
+	// a job recovered after a restart, the repository has never seen the payment
+	service.ProcessJob(queue.Job{
+		Id:          "payment-1",
+		Payment:     models.PostPaymentResponse{Id: "payment-1", PaymentStatus: "processing", Amount: 100, Currency: "GBP"},
+		BankRequest: models.PostPaymentBankRequest{CardNumber: "2222405343248877", Amount: 100, Currency: "GBP"},
+	})
+
+	payment := repo.GetPayment("payment-1")
+	require.NotNil(t, payment)
+	assert.Equal(t, "failed", payment.PaymentStatus)
+}
+
+func TestProcessJob_TimeoutIsUnknown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(nil, errors.New("timeout"))
+
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient)
+	service.ProcessJob(queue.Job{
+		Id:          "payment-1",
+		Payment:     models.PostPaymentResponse{Id: "payment-1", PaymentStatus: "processing", Amount: 100, Currency: "GBP"},
+		BankRequest: models.PostPaymentBankRequest{CardNumber: "2222405343248877", Amount: 100, Currency: "GBP"},
+	})
+
+	// the bank may have authorised it
+	assert.Equal(t, "unknown", repo.GetPayment("payment-1").PaymentStatus)
+}
+
+func TestProcessJob_InterruptedIsNotResent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// no PostBankPayment expected
+	mockClient := mocks.NewMockClient(ctrl)
+
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient)
+
+	// the gateway died while the bank call was in flight
+	service.ProcessJob(queue.Job{
+		Id:          "payment-1",
+		Payment:     models.PostPaymentResponse{Id: "payment-1", PaymentStatus: "processing", Amount: 100, Currency: "GBP"},
+		BankRequest: models.PostPaymentBankRequest{CardNumber: "2222405343248877", Amount: 100, Currency: "GBP"},
+		Started:     true,
+	})
+
+	payment := repo.GetPayment("payment-1")
+	require.NotNil(t, payment)
+	assert.Equal(t, "unknown", payment.PaymentStatus)
+}
@@ -0,0 +1,234 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// BatchConfig bounds how much work a single batch can put on the bank.
+type BatchConfig struct {
+	// MaxSize is the most payments accepted in one batch.
+	MaxSize int
+	// Concurrency is how many payments of a batch are sent to the bank at once.
+	Concurrency int
+	// SyncLimit is the largest batch answered inline, bigger ones run in the background.
+	SyncLimit int
+}
+
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		MaxSize:     500,
+		Concurrency: 8,
+		SyncLimit:   50,
+	}
+}
+
+type BatchService interface {
+	SubmitBatch(request *models.BatchPaymentRequest, merchantID string, async bool) (*models.PaymentBatch, error)
+}
+
+type BatchServiceImpl struct {
+	payments PaymentService
+	batches  *repository.BatchesRepository
+	config   BatchConfig
+	// payloadKey keys the hashes of items held with their idempotency key, they contain the card number
+	payloadKey []byte
+	now        func() time.Time
+}
+
+func NewBatchServiceImpl(payments PaymentService, batches *repository.BatchesRepository, config BatchConfig) *BatchServiceImpl {
+	return &BatchServiceImpl{
+		payments:   payments,
+		batches:    batches,
+		config:     config,
+		payloadKey: randomFingerprintKey(),
+		now:        time.Now,
+	}
+}
+
+// SubmitBatch creates the payments of the batch, config.Concurrency at a time.  Batches that are
+// asked to be async or are larger than config.SyncLimit come back still processing, the returned
+// batch id can be polled for the results.  Items all come from the merchant's own servers, so they
+// are counted against the merchant and the card but not the client IP, or a batch could never get
+// past the per IP limit.
+func (b *BatchServiceImpl) SubmitBatch(request *models.BatchPaymentRequest, merchantID string, async bool) (*models.PaymentBatch, error) {
+	id := uuid.New().String()
+	if len(request.Payments) == 0 {
+		return nil, gatewayerrors.NewValidationError(errors.New("batch has no payments"), id, "payments")
+	}
+	if len(request.Payments) > b.config.MaxSize {
+		return nil, gatewayerrors.NewValidationError(
+			fmt.Errorf("batch has more than %d payments", b.config.MaxSize),
+			id,
+			"payments",
+		)
+	}
+
+	batch := models.PaymentBatch{
+		Id:         id,
+		MerchantID: merchantID,
+		Status:     models.BatchProcessing,
+		Total:      len(request.Payments),
+		Counts:     map[string]int{},
+		CreatedAt:  b.now().UTC(),
+		Results:    make([]models.BatchItemResult, len(request.Payments)),
+	}
+	for i, item := range request.Payments {
+		batch.Results[i] = models.BatchItemResult{Index: i, IdempotencyKey: item.IdempotencyKey, Status: models.BatchProcessing}
+	}
+	b.batches.AddBatch(batch)
+
+	if async || len(request.Payments) > b.config.SyncLimit {
+		go b.process(id, request.Payments, merchantID)
+		return b.batches.GetBatch(id), nil
+	}
+
+	b.process(id, request.Payments, merchantID)
+	return b.batches.GetBatch(id), nil
+}
+
+func (b *BatchServiceImpl) process(id string, items []models.BatchPaymentItem, merchantID string) {
+	// a key used twice in the same batch is a mistake rather than a retry, only the first one is sent
+	seen := map[string]bool{}
+	duplicate := make([]bool, len(items))
+	for i, item := range items {
+		if item.IdempotencyKey == "" {
+			continue
+		}
+		duplicate[i] = seen[item.IdempotencyKey]
+		seen[item.IdempotencyKey] = true
+	}
+
+	concurrency := b.config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range items {
+		if duplicate[i] {
+			b.batches.SetResult(id, rejected(i, items[i].IdempotencyKey, &models.BatchItemError{
+				Message: "idempotency key is used more than once in the batch",
+				Field:   "idempotency_key",
+			}), b.now().UTC())
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			b.batches.SetResult(id, b.processItem(i, items[i], merchantID), b.now().UTC())
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (b *BatchServiceImpl) processItem(index int, item models.BatchPaymentItem, merchantID string) models.BatchItemResult {
+	key := item.IdempotencyKey
+	if key != "" {
+		previous, reserved, err := b.batches.ReserveKey(merchantID, key, b.payload(item), b.now().UTC())
+		if errors.Is(err, repository.ErrIdempotencyKeyReused) {
+			return rejected(index, key, &models.BatchItemError{
+				Message: "idempotency key was already used for a different payment",
+				Field:   "idempotency_key",
+			})
+		}
+		if previous != nil {
+			previous.Index = index
+			previous.Replayed = true
+			return *previous
+		}
+		if !reserved {
+			return rejected(index, key, &models.BatchItemError{
+				Message: "a payment with this idempotency key is still being processed",
+				Field:   "idempotency_key",
+			})
+		}
+	}
+
+	request := item.PostPaymentHandlerRequest
+	request.MerchantID = merchantID
+	payment, err := b.payments.Create(&request)
+	result := itemResult(index, key, payment, err)
+
+	if key != "" {
+		// rejected items never reached the bank and can be fixed and sent again, anything else is replayed
+		// since a failed item may still have been charged
+		if result.Status == models.BatchItemRejected {
+			b.batches.ReleaseKey(merchantID, key)
+		} else {
+			b.batches.CompleteKey(merchantID, key, result, b.now().UTC())
+		}
+	}
+	return result
+}
+
+// payload identifies the payment of an item, so a key cannot be replayed for another one.
+func (b *BatchServiceImpl) payload(item models.BatchPaymentItem) string {
+	data, err := json.Marshal(item.PostPaymentHandlerRequest)
+	if err != nil {
+		// a plain struct always marshals
+		panic(err)
+	}
+	mac := hmac.New(sha256.New, b.payloadKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func itemResult(index int, key string, payment *models.PostPaymentResponse, err error) models.BatchItemResult {
+	if err == nil {
+		return models.BatchItemResult{
+			Index:          index,
+			IdempotencyKey: key,
+			Status:         payment.PaymentStatus,
+			PaymentId:      payment.Id,
+		}
+	}
+
+	var validationErr *gatewayerrors.ValidationError
+	if errors.As(err, &validationErr) {
+		return rejected(index, key, &models.BatchItemError{Message: validationErr.Error(), Field: validationErr.GetFieldError()})
+	}
+	var profileErr *gatewayerrors.ProfileError
+	if errors.As(err, &profileErr) {
+		return rejected(index, key, &models.BatchItemError{Message: profileErr.Error(), ErrorCode: profileErr.Code})
+	}
+	var limitErr *gatewayerrors.LimitError
+	if errors.As(err, &limitErr) {
+		return rejected(index, key, &models.BatchItemError{Message: "too many payment attempts for this " + limitErr.Scope})
+	}
+
+	log.Printf("batch payment %d failed: %v", index, err)
+	return models.BatchItemResult{
+		Index:          index,
+		IdempotencyKey: key,
+		Status:         models.BatchItemFailed,
+		Error:          &models.BatchItemError{Message: "the payment could not be processed"},
+	}
+}
+
+func rejected(index int, key string, err *models.BatchItemError) models.BatchItemResult {
+	return models.BatchItemResult{
+		Index:          index,
+		IdempotencyKey: key,
+		Status:         models.BatchItemRejected,
+		Error:          err,
+	}
+}
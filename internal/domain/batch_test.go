@@ -0,0 +1,160 @@
+package domain_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func batchItem(amount int, currency, key string) models.BatchPaymentItem {
+	return models.BatchPaymentItem{
+		PostPaymentHandlerRequest: models.PostPaymentHandlerRequest{
+			CardNumber:  2222405343248877,
+			ExpiryMonth: 12,
+			ExpiryYear:  time.Now().Year() + 1,
+			Currency:    currency,
+			Amount:      amount,
+			Cvv:         123,
+		},
+		IdempotencyKey: key,
+	}
+}
+
+func TestSubmitBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+		return &models.PostPaymentBankResponse{Authorised: request.Amount != 200}, nil
+	}).Times(2)
+
+	repo := repository.NewPaymentsRepository()
+	batches := repository.NewBatchesRepository()
+	service := domain.NewBatchServiceImpl(domain.NewPaymentServiceImpl(repo, mockClient), batches, domain.DefaultBatchConfig())
+
+	batch, err := service.SubmitBatch(&models.BatchPaymentRequest{Payments: []models.BatchPaymentItem{
+		batchItem(100, "GBP", "first"),
+		batchItem(200, "GBP", ""),
+		batchItem(100, "XXX", ""),
+		batchItem(100, "GBP", "first"),
+	}}, "merchant-1", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, models.BatchCompleted, batch.Status)
+	assert.Equal(t, 4, batch.Processed)
+	assert.Equal(t, map[string]int{"authorized": 1, "declined": 1, "rejected": 2}, batch.Counts)
+	assert.Equal(t, "authorized", batch.Results[0].Status)
+	assert.Equal(t, "merchant-1", repo.GetPayment(batch.Results[0].PaymentId).MerchantID)
+	assert.Equal(t, "declined", batch.Results[1].Status)
+	assert.Equal(t, "currency", batch.Results[2].Error.Field)
+	assert.Equal(t, "idempotency_key", batch.Results[3].Error.Field)
+
+	// resubmitting the key returns the payment without calling the bank again
+	replay, err := service.SubmitBatch(&models.BatchPaymentRequest{Payments: []models.BatchPaymentItem{
+		batchItem(100, "GBP", "first"),
+	}}, "merchant-1", false)
+	require.NoError(t, err)
+	assert.True(t, replay.Results[0].Replayed)
+	assert.Equal(t, batch.Results[0].PaymentId, replay.Results[0].PaymentId)
+}
+
+func TestSubmitBatch_FailedKeysAreKept(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	// the bank may have authorised the payment before it failed, so it must only be called once
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(nil, gatewayerrors.NewBankError(errors.New("timeout"), http.StatusGatewayTimeout)).Times(1)
+
+	service := domain.NewBatchServiceImpl(domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient), repository.NewBatchesRepository(), domain.DefaultBatchConfig())
+	submit := func(item models.BatchPaymentItem) models.BatchItemResult {
+		batch, err := service.SubmitBatch(&models.BatchPaymentRequest{Payments: []models.BatchPaymentItem{item}}, "merchant-1", false)
+		require.NoError(t, err)
+		return batch.Results[0]
+	}
+
+	assert.Equal(t, models.BatchItemFailed, submit(batchItem(100, "GBP", "first")).Status)
+	retry := submit(batchItem(100, "GBP", "first"))
+	assert.Equal(t, models.BatchItemFailed, retry.Status)
+	assert.True(t, retry.Replayed)
+
+	// the key cannot be used for another payment
+	other := submit(batchItem(500, "GBP", "first"))
+	assert.Equal(t, models.BatchItemRejected, other.Status)
+	assert.Equal(t, "idempotency_key", other.Error.Field)
+}
+
+type blockingPaymentService struct {
+	mu      sync.Mutex
+	current int
+	max     int
+	release chan struct{}
+}
+
+func (s *blockingPaymentService) Create(request *models.PostPaymentHandlerRequest) (*models.PostPaymentResponse, error) {
+	s.mu.Lock()
+	s.current++
+	if s.current > s.max {
+		s.max = s.current
+	}
+	s.mu.Unlock()
+
+	<-s.release
+
+	s.mu.Lock()
+	s.current--
+	s.mu.Unlock()
+	return &models.PostPaymentResponse{Id: "payment", PaymentStatus: "authorized"}, nil
+}
+
+func TestSubmitBatch_AsyncBoundedConcurrency(t *testing.T) {
+	payments := &blockingPaymentService{release: make(chan struct{})}
+	batches := repository.NewBatchesRepository()
+	config := domain.BatchConfig{MaxSize: 10, Concurrency: 2, SyncLimit: 1}
+	service := domain.NewBatchServiceImpl(payments, batches, config)
+
+	items := make([]models.BatchPaymentItem, 6)
+	batch, err := service.SubmitBatch(&models.BatchPaymentRequest{Payments: items}, "merchant-1", false)
+	require.NoError(t, err)
+	assert.Equal(t, models.BatchProcessing, batch.Status)
+	assert.Equal(t, 6, batch.Total)
+
+	var released atomic.Int32
+	go func() {
+		for range items {
+			time.Sleep(5 * time.Millisecond)
+			payments.release <- struct{}{}
+			released.Add(1)
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		return batches.GetBatch(batch.Id).Status == models.BatchCompleted
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(6), released.Load())
+	assert.LessOrEqual(t, payments.max, 2)
+	assert.Equal(t, 6, batches.GetBatch(batch.Id).Counts["authorized"])
+}
+
+func TestSubmitBatch_Size(t *testing.T) {
+	service := domain.NewBatchServiceImpl(nil, repository.NewBatchesRepository(), domain.BatchConfig{MaxSize: 2, Concurrency: 1, SyncLimit: 2})
+
+	var validationError *gatewayerrors.ValidationError
+	_, err := service.SubmitBatch(&models.BatchPaymentRequest{}, "", false)
+	require.ErrorAs(t, err, &validationError)
+	assert.Equal(t, "payments", validationError.GetFieldError())
+
+	_, err = service.SubmitBatch(&models.BatchPaymentRequest{Payments: make([]models.BatchPaymentItem, 3)}, "", false)
+	require.ErrorAs(t, err, &validationError)
+}
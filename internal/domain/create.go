@@ -1,20 +1,46 @@
 package domain
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/events"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/fx"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/risk"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/threeds"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/velocity"
 
 	"github.com/google/uuid"
 )
 
 type Domain struct {
-	PaymentService PaymentService
+	PaymentService        PaymentService
+	ListsService          ListsService
+	ReconciliationService ReconciliationService
+	SettlementService     SettlementService
+	FXService             FXService
+	MerchantsService      MerchantsService
+	ThreeDSService        ThreeDSService
+	AsyncPaymentService   AsyncPaymentService
+	BatchService          BatchService
+	SubscriptionService   SubscriptionService
+	DisputesService       DisputesService
+	PaymentLinksService   PaymentLinksService
+	RetentionService      RetentionService
+	Audit                 *audit.Log
 }
 
 func NewDomain(paymentService PaymentService) *Domain {
@@ -31,45 +57,219 @@ type PaymentServiceImpl struct {
 	repo               *repository.PaymentsRepository
 	PostPaymentService PaymentService
 	client             client.Client
+	riskEngine         *risk.Engine
+	limiter            *velocity.Limiter
+	lists              *repository.ListsRepository
+	binCountries       map[string]string
+	declineCodes       map[string]map[string]string
+	rates              fx.Provider
+	quotes             *repository.QuotesRepository
+	merchants          *repository.MerchantsRepository
+	authenticator      threeds.Authenticator
+	threeDSConfig      threeds.Config
+	callbackBaseURL    string
+	pendingMu          sync.Mutex
+	pending            map[string]pendingAuthentication
+	queue              *queue.Queue
+	events             *events.Broker
+	audit              *audit.Log
+	fingerprintKey     []byte
 }
 
-func NewPaymentServiceImpl(repo *repository.PaymentsRepository, client client.Client) *PaymentServiceImpl {
-	return &PaymentServiceImpl{
-		repo:   repo,
-		client: client,
+// Option configures the optional collaborators of the payment service.
+type Option func(*PaymentServiceImpl)
+
+// WithRiskEngine screens every valid payment before it is sent to the bank.
+func WithRiskEngine(engine *risk.Engine) Option {
+	return func(p *PaymentServiceImpl) {
+		p.riskEngine = engine
+	}
+}
+
+// WithVelocityLimiter refuses payments once a card, merchant or IP has been too busy.
+func WithVelocityLimiter(limiter *velocity.Limiter) Option {
+	return func(p *PaymentServiceImpl) {
+		p.limiter = limiter
+	}
+}
+
+// WithFingerprintKey keys the card fingerprints, everything that compares fingerprints has to use the same
+// key.  Without one the service makes up its own, which is only good enough for tests.
+func WithFingerprintKey(key []byte) Option {
+	return func(p *PaymentServiceImpl) {
+		p.fingerprintKey = key
+	}
+}
+
+func NewPaymentServiceImpl(repo *repository.PaymentsRepository, client client.Client, opts ...Option) *PaymentServiceImpl {
+	p := &PaymentServiceImpl{
+		repo:           repo,
+		client:         client,
+		fingerprintKey: randomFingerprintKey(),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
 func (p *PaymentServiceImpl) Create(request *models.PostPaymentHandlerRequest) (*models.PostPaymentResponse, error) {
+	paymentResponse, bankRequest, profile, err := p.prepare(request)
+	if err != nil || bankRequest == nil {
+		return paymentResponse, err
+	}
+
+	if p.requiresAuthentication(request) {
+		err = p.startAuthentication(paymentResponse, bankRequest, request.ReturnURL)
+		if err != nil {
+			return nil, err
+		}
+		return paymentResponse, nil
+	}
+
+	err = p.authorise(paymentResponse, bankRequest, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	p.repo.AddPayment(*paymentResponse)
+	p.publish(*paymentResponse)
+
+	return paymentResponse, nil
+}
+
+// prepare validates and screens the payment and builds the request for the bank.  Payments that are
+// blocked along the way are stored straight away and come back without a bank request.
+func (p *PaymentServiceImpl) prepare(request *models.PostPaymentHandlerRequest) (*models.PostPaymentResponse, *models.PostPaymentBankRequest, *models.MerchantProfile, error) {
 
 	uuid := uuid.New().String()
 	err := validateCardNumber(strconv.Itoa(request.CardNumber), uuid)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	cardNumber := strconv.Itoa(request.CardNumber)
 
 	expiryDate, err := validateExpiryDate(request.ExpiryMonth, request.ExpiryYear, uuid)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	err = validateCurrencyISO(request.Currency, uuid)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+
+	if !request.Verification || request.Amount != 0 {
+		err = validateAmount(request.Amount, uuid)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
-	err = validateAmount(request.Amount, uuid)
+	// the customer is not there to give the CVV of a stored card
+	cvvString := ""
+	if !isMerchantInitiated(request) || request.Cvv != 0 {
+		err = validateCVV(request.Cvv, uuid)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cvvString = strconv.Itoa(request.Cvv)
+	}
+
+	fingerprint := cardFingerprint(p.fingerprintKey, cardNumber)
+	networkTransactionId, err := p.storedCredential(request, fingerprint, uuid)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	err = validateCVV(request.Cvv, uuid)
+	cardNumberLastFour, err := strconv.Atoi(getLastFourCharacters(cardNumber))
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	cvvString := strconv.Itoa(request.Cvv)
+	paymentResponse := &models.PostPaymentResponse{
+		Id:                 uuid,
+		CardNumberLastFour: cardNumberLastFour,
+		ExpiryMonth:        request.ExpiryMonth,
+		ExpiryYear:         request.ExpiryYear,
+		Currency:           request.Currency,
+		Amount:             request.Amount,
+		MerchantID:         request.MerchantID,
+		RequestID:          request.RequestID,
+		CardFingerprint:    fingerprint,
+		CardScheme:         client.CardScheme(cardNumber),
+		CreatedAt:          time.Now().UTC(),
+
+		Initiator:              request.Initiator,
+		StoredCredentialUsage:  request.StoredCredentialUsage,
+		StoredCredentialReason: request.StoredCredentialReason,
+	}
+	if paymentResponse.Initiator == "" {
+		paymentResponse.Initiator = models.InitiatorCustomer
+	}
+
+	var profile *models.MerchantProfile
+	if p.merchants != nil {
+		profile = p.merchants.GetProfile(request.MerchantID)
+		if err := checkProfile(profile, paymentResponse); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	paymentResponse.CaptureMode = defaultCaptureMode
+	if profile != nil {
+		paymentResponse.CaptureMode = profile.CaptureMode
+	}
+
+	err = p.applyFX(request, paymentResponse)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	allowlisted := false
+	if p.lists != nil {
+		var blockedBy *models.ListEntry
+		allowlisted, blockedBy = p.screenLists(cardNumber, paymentResponse.CardFingerprint, request.Currency)
+		if blockedBy != nil {
+			paymentResponse.PaymentStatus = "blocked"
+			paymentResponse.RiskOutcome = string(risk.OutcomeBlock)
+			paymentResponse.RiskRules = []string{"blocklist_" + blockedBy.Type}
+			p.repo.AddPayment(*paymentResponse)
+			p.publish(*paymentResponse)
+			return paymentResponse, nil, nil, nil
+		}
+	}
+
+	if p.limiter != nil {
+		err = p.limiter.Allow(velocity.Attempt{
+			CardFingerprint: paymentResponse.CardFingerprint,
+			MerchantID:      request.MerchantID,
+			ClientIP:        request.ClientIP,
+			Amount:          request.Amount,
+			Currency:        request.Currency,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if p.riskEngine != nil && !allowlisted {
+		assessment := p.riskEngine.Evaluate(risk.Input{
+			CardFingerprint: paymentResponse.CardFingerprint,
+			BIN:             getBIN(cardNumber),
+			Currency:        request.Currency,
+			Amount:          request.Amount,
+		})
+		paymentResponse.RiskScore = assessment.Score
+		paymentResponse.RiskOutcome = string(assessment.Outcome)
+		paymentResponse.RiskRules = assessment.TriggeredRules
+
+		if assessment.Outcome == risk.OutcomeBlock {
+			paymentResponse.PaymentStatus = "blocked"
+			p.repo.AddPayment(*paymentResponse)
+			p.publish(*paymentResponse)
+			return paymentResponse, nil, nil, nil
+		}
+	}
 
 	PostPaymentBankRequest := &models.PostPaymentBankRequest{
 		CardNumber: cardNumber,
@@ -77,36 +277,91 @@ func (p *PaymentServiceImpl) Create(request *models.PostPaymentHandlerRequest) (
 		Currency:   request.Currency,
 		Amount:     request.Amount,
 		CVV:        cvvString,
-	}
+		MerchantID: request.MerchantID,
 
-	bankResponse, err := p.client.PostBankPayment(PostPaymentBankRequest)
-	if err != nil {
-		return nil, err
+		Initiator:              request.Initiator,
+		StoredCredentialUsage:  request.StoredCredentialUsage,
+		StoredCredentialReason: request.StoredCredentialReason,
+		NetworkTransactionId:   networkTransactionId,
 	}
 
-	cardNumberLastFour, err := strconv.Atoi(getLastFourCharacters(cardNumber))
+	return paymentResponse, PostPaymentBankRequest, profile, nil
+}
+
+// bankUnavailable tells the errors where the payment never reached a bank, only those can be tried
+// again.  Anything else, like a timeout, may have been authorised and is left to reconciliation.
+func bankUnavailable(err error) bool {
+	var bankErr *gatewayerrors.BankError
+	return errors.As(err, &bankErr) && bankErr.StatusCode == http.StatusServiceUnavailable
+}
+
+// storeOutcome writes what came out of authorising payment onto the stored payment and publishes it.
+// Only the outcome is copied, so changes made to the payment in the meantime, like an erasure or a
+// chargeback, are kept.
+func (p *PaymentServiceImpl) storeOutcome(payment models.PostPaymentResponse) (*models.PostPaymentResponse, error) {
+	stored, err := p.repo.ModifyPayment(payment.Id, func(stored *models.PostPaymentResponse) error {
+		stored.PaymentStatus = payment.PaymentStatus
+		stored.DeclineCode = payment.DeclineCode
+		stored.Acquirer = payment.Acquirer
+		stored.AuthorizationCode = payment.AuthorizationCode
+		stored.AcquirerReference = payment.AcquirerReference
+		stored.BankResponseCode = payment.BankResponseCode
+		stored.BankResponseTime = payment.BankResponseTime
+		stored.AuthorizedAt = payment.AuthorizedAt
+		stored.AuthenticationStatus = payment.AuthenticationStatus
+		stored.ECI = payment.ECI
+		if stored.AnonymisedAt == nil {
+			stored.NetworkTransactionId = payment.NetworkTransactionId
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	p.publish(*stored)
+	return stored, nil
+}
 
-	paymentStatus := "declined"
-	if bankResponse.Authorised {
-		paymentStatus = "authorized"
+// authorise sends the payment to the bank and records the answer on payment, it is up to the caller to store it.
+func (p *PaymentServiceImpl) authorise(payment *models.PostPaymentResponse, bankRequest *models.PostPaymentBankRequest, profile *models.MerchantProfile) error {
+	if profile != nil {
+		release, err := p.reserveVolume(profile, payment)
+		if err != nil {
+			return err
+		}
+		// only authorised payments count towards the cap
+		defer func() {
+			if payment.PaymentStatus != "authorized" {
+				release()
+			}
+		}()
 	}
 
-	paymentResponse := &models.PostPaymentResponse{
-		Id:                 uuid,
-		PaymentStatus:      paymentStatus,
-		CardNumberLastFour: cardNumberLastFour,
-		ExpiryMonth:        request.ExpiryMonth,
-		ExpiryYear:         request.ExpiryYear,
-		Currency:           request.Currency,
-		Amount:             request.Amount,
+	bankStart := time.Now()
+	bankResponse, err := p.client.PostBankPayment(bankRequest)
+	if err != nil {
+		return err
 	}
 
-	p.repo.AddPayment(*paymentResponse)
-
-	return paymentResponse, nil
+	payment.Acquirer = bankResponse.Acquirer
+	payment.AuthorizationCode = bankResponse.AuthorizationCode
+	payment.AcquirerReference = bankResponse.AcquirerReference
+	payment.BankResponseCode = bankResponse.ResponseCode
+	payment.BankResponseTime = time.Since(bankStart)
+	// subsequent payments keep pointing at the first one
+	payment.NetworkTransactionId = bankRequest.NetworkTransactionId
+	if payment.NetworkTransactionId == "" {
+		payment.NetworkTransactionId = bankResponse.NetworkTransactionId
+	}
+	payment.PaymentStatus = "declined"
+	if bankResponse.Authorised {
+		authorizedAt := time.Now().UTC()
+		payment.PaymentStatus = "authorized"
+		payment.AuthorizedAt = &authorizedAt
+	} else {
+		payment.DeclineCode = p.mapDeclineCode(bankResponse.Acquirer, bankResponse.ResponseCode)
+	}
+	return nil
 }
 
 func getLastFourCharacters(s string) string {
@@ -116,6 +371,30 @@ func getLastFourCharacters(s string) string {
 	return s[len(s)-4:]
 }
 
+func getBIN(cardNumber string) string {
+	if len(cardNumber) < 6 {
+		return cardNumber
+	}
+	return cardNumber[:6]
+}
+
+// cardFingerprint identifies a card across payments without us having to keep the PAN around.  It is keyed
+// so it cannot be turned back into the card number by hashing every possible one.
+func cardFingerprint(key []byte, cardNumber string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(cardNumber))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomFingerprintKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		// the system has no randomness left, nothing else would work either
+		panic(err)
+	}
+	return key
+}
+
 func validateCardNumber(cardNumber, id string) error {
 	if len(cardNumber) < 14 || len(cardNumber) > 19 {
 		return gatewayerrors.NewValidationError(
@@ -164,6 +443,8 @@ var validCurrencyCodes = map[string]bool{
 	"USD": true,
 	"EUR": true,
 	"GBP": true,
+	"CHF": true,
+	"JPY": true,
 }
 
 func validateCurrencyISO(currency, id string) error {
@@ -178,8 +459,13 @@ func validateCurrencyISO(currency, id string) error {
 	return nil
 }
 
+// maxAmount caps every payment in minor units, merchant profiles can only lower it.  It keeps amounts
+// far enough from the int limits that converting them or adding them up for the volume caps and the
+// settlement batches cannot overflow.
+const maxAmount = 100_000_000_00
+
 func validateAmount(amount int, id string) error {
-	if amount <= 0 {
+	if amount <= 0 || amount > maxAmount {
 		return gatewayerrors.NewValidationError(
 			errors.New("invalid amount"),
 			id,
@@ -1,14 +1,17 @@
 package domain_test
 
 import (
+	"math"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/risk"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -188,6 +191,23 @@ func TestPostPayment_InvalidAmount(t *testing.T) {
 	assert.Equal(t, "amount", validationError.GetFieldError())
 }
 
+func TestPostPayment_AmountAboveCap(t *testing.T) {
+	service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), nil)
+
+	// there is no merchant profile so only the gateway wide cap applies
+	var validationError *gatewayerrors.ValidationError
+	_, err := service.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      math.MaxInt,
+		Cvv:         123,
+	})
+	require.ErrorAs(t, err, &validationError)
+	assert.Equal(t, "amount", validationError.GetFieldError())
+}
+
 func TestPostPayment_NotAuthorized(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -245,3 +265,171 @@ func getLastFourCharacters(t *testing.T, i int) string {
 	require.Equal(t, 16, len(s))
 	return s[len(s)-4:]
 }
+
+func TestPostPayment_BlockedByRiskEngine(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// no expectations, the bank must not be called for a blocked payment
+	mockClient := mocks.NewMockClient(ctrl)
+
+	postPayment := models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+	}
+
+	config := risk.DefaultConfig()
+	config.BlockedBINs = []string{"222240"}
+
+	repo := repository.NewPaymentsRepository()
+	domain := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithRiskEngine(risk.NewEngine(config)))
+
+	response, err := domain.Create(&postPayment)
+	require.NoError(t, err)
+
+	assert.Equal(t, "blocked", response.PaymentStatus)
+	assert.Equal(t, "block", response.RiskOutcome)
+	assert.Equal(t, 100, response.RiskScore)
+	assert.Equal(t, []string{"blocked_bin"}, response.RiskRules)
+	assert.NotEmpty(t, response.CardFingerprint)
+
+	dbPayment := repo.GetPayment(response.Id)
+	assert.Equal(t, "blocked", dbPayment.PaymentStatus)
+}
+
+func TestPostPayment_FingerprintIsKeyed(t *testing.T) {
+	config := risk.DefaultConfig()
+	config.BlockedBINs = []string{"222240"}
+	fingerprint := func(key string) string {
+		service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), nil,
+			domain.WithRiskEngine(risk.NewEngine(config)),
+			domain.WithFingerprintKey([]byte(key)),
+		)
+		// blocked so the bank is never called
+		response, err := service.Create(&models.PostPaymentHandlerRequest{
+			CardNumber:  2222405343248877,
+			ExpiryMonth: 12,
+			ExpiryYear:  time.Now().Year() + 1,
+			Currency:    "GBP",
+			Amount:      100,
+			Cvv:         123,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "blocked", response.PaymentStatus)
+		return response.CardFingerprint
+	}
+
+	assert.Equal(t, fingerprint("key-1"), fingerprint("key-1"))
+	assert.NotEqual(t, fingerprint("key-1"), fingerprint("key-2"))
+	// a plain hash of the card number could be reversed
+	assert.NotEqual(t, "302eb4e48718000aee7c8a864be24acb31385f5cec66865654156d474f75854b", fingerprint("key-1"))
+}
+
+func TestPostPayment_ReviewedByRiskEngine(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	expiryYear := time.Now().Year() + 1
+	postPayment := models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  expiryYear,
+		Currency:    "GBP",
+		Amount:      600000,
+		Cvv:         123,
+	}
+
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{
+		Authorised:        true,
+		AuthorizationCode: "abb53d1a-42dd-4ecc-9a25-dca064d35eb2",
+	}, nil)
+
+	repo := repository.NewPaymentsRepository()
+	domain := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithRiskEngine(risk.NewEngine(risk.DefaultConfig())))
+
+	response, err := domain.Create(&postPayment)
+	require.NoError(t, err)
+
+	assert.Equal(t, "authorized", response.PaymentStatus)
+	assert.Equal(t, "review", response.RiskOutcome)
+	assert.Equal(t, []string{"amount_threshold"}, response.RiskRules)
+}
+
+func TestPostPayment_RecordsAcquirer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	postPayment := models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+		MerchantID:  "merchant-1",
+	}
+
+	mockClient.EXPECT().PostBankPayment(&models.PostPaymentBankRequest{
+		CardNumber: "2222405343248877",
+		ExpiryDate: "12/" + strconv.Itoa(postPayment.ExpiryYear),
+		Currency:   "GBP",
+		Amount:     100,
+		CVV:        "123",
+		MerchantID: "merchant-1",
+	}).Return(&models.PostPaymentBankResponse{
+		Authorised: true,
+		Acquirer:   "secondary",
+	}, nil)
+
+	repo := repository.NewPaymentsRepository()
+	domain := domain.NewPaymentServiceImpl(repo, mockClient)
+
+	response, err := domain.Create(&postPayment)
+	require.NoError(t, err)
+
+	assert.Equal(t, "secondary", response.Acquirer)
+	assert.Equal(t, "merchant-1", response.MerchantID)
+	assert.Equal(t, "secondary", repo.GetPayment(response.Id).Acquirer)
+}
+
+func TestPostPayment_StoresBankReferences(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	postPayment := models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+	}
+
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{
+		Authorised:        true,
+		AuthorizationCode: "abb53d1a-42dd-4ecc-9a25-dca064d35eb2",
+		AcquirerReference: "acq-ref-1",
+		ResponseCode:      "00",
+	}, nil)
+
+	repo := repository.NewPaymentsRepository()
+	domain := domain.NewPaymentServiceImpl(repo, mockClient)
+
+	response, err := domain.Create(&postPayment)
+	require.NoError(t, err)
+
+	assert.Equal(t, "abb53d1a-42dd-4ecc-9a25-dca064d35eb2", response.AuthorizationCode)
+	assert.Equal(t, "acq-ref-1", response.AcquirerReference)
+
+	dbPayment := repo.GetPayment(response.Id)
+	assert.Equal(t, "abb53d1a-42dd-4ecc-9a25-dca064d35eb2", dbPayment.AuthorizationCode)
+	assert.Equal(t, "acq-ref-1", dbPayment.AcquirerReference)
+	assert.Equal(t, "00", dbPayment.BankResponseCode)
+	assert.Positive(t, dbPayment.BankResponseTime)
+}
@@ -0,0 +1,69 @@
+package domain
+
+/*
+Every acquirer has its own idea of response codes, most of them follow the ISO 8583 ones but not all.  We map whatever the bank sends us onto a small set of decline codes so that merchants only have to handle one taxonomy regardless of which acquirer processed the payment.
+*/
+
+import "fmt"
+
+const (
+	DeclineInsufficientFunds    = "insufficient_funds"
+	DeclineDoNotHonour          = "do_not_honour"
+	DeclineStolenCard           = "stolen_card"
+	DeclineExpiredCard          = "expired_card"
+	DeclineSoftDeclineRetryable = "soft_decline_retryable"
+	DeclineAuthenticationFailed = "authentication_failed"
+)
+
+var isoDeclineCodes = map[string]string{
+	"05": DeclineDoNotHonour,
+	"14": DeclineDoNotHonour,
+	"41": DeclineStolenCard,
+	"43": DeclineStolenCard,
+	"51": DeclineInsufficientFunds,
+	"54": DeclineExpiredCard,
+	"33": DeclineExpiredCard,
+	"61": DeclineInsufficientFunds,
+	"91": DeclineSoftDeclineRetryable,
+	"96": DeclineSoftDeclineRetryable,
+	"1A": DeclineSoftDeclineRetryable,
+}
+
+// CheckDeclineCodes makes sure acquirer specific mappings only map onto our own decline codes.
+func CheckDeclineCodes(declineCodes map[string]map[string]string) error {
+	known := map[string]bool{
+		DeclineInsufficientFunds:    true,
+		DeclineDoNotHonour:          true,
+		DeclineStolenCard:           true,
+		DeclineExpiredCard:          true,
+		DeclineSoftDeclineRetryable: true,
+		DeclineAuthenticationFailed: true,
+	}
+	for acquirer, codes := range declineCodes {
+		for responseCode, code := range codes {
+			if !known[code] {
+				return fmt.Errorf("acquirer %s maps %s onto unknown decline code %q", acquirer, responseCode, code)
+			}
+		}
+	}
+	return nil
+}
+
+// WithDeclineCodes adds acquirer specific response code mappings, acquirers without one use the ISO 8583 codes.
+func WithDeclineCodes(declineCodes map[string]map[string]string) Option {
+	return func(p *PaymentServiceImpl) {
+		p.declineCodes = declineCodes
+	}
+}
+
+// mapDeclineCode turns the raw response code of an acquirer into our decline taxonomy,
+// anything we do not recognise is treated as a plain do not honour.
+func (p *PaymentServiceImpl) mapDeclineCode(acquirer, responseCode string) string {
+	if code, ok := p.declineCodes[acquirer][responseCode]; ok {
+		return code
+	}
+	if code, ok := isoDeclineCodes[responseCode]; ok {
+		return code
+	}
+	return DeclineDoNotHonour
+}
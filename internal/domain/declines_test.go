@@ -0,0 +1,95 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPostPayment_DeclineCodes(t *testing.T) {
+	tests := []struct {
+		name         string
+		acquirer     string
+		responseCode string
+		expected     string
+	}{
+		{"InsufficientFunds", "simulator", "51", domain.DeclineInsufficientFunds},
+		{"DoNotHonour", "simulator", "05", domain.DeclineDoNotHonour},
+		{"StolenCard", "simulator", "43", domain.DeclineStolenCard},
+		{"ExpiredCard", "simulator", "54", domain.DeclineExpiredCard},
+		{"SoftDecline", "simulator", "91", domain.DeclineSoftDeclineRetryable},
+		{"UnknownCode", "simulator", "Z9", domain.DeclineDoNotHonour},
+		{"MissingCode", "simulator", "", domain.DeclineDoNotHonour},
+		{"AcquirerSpecificCode", "other-bank", "NSF", domain.DeclineInsufficientFunds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockClient := mocks.NewMockClient(ctrl)
+
+			mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{
+				Authorised:   false,
+				ResponseCode: tt.responseCode,
+				Acquirer:     tt.acquirer,
+			}, nil)
+
+			repo := repository.NewPaymentsRepository()
+			service := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithDeclineCodes(map[string]map[string]string{
+				"other-bank": {"NSF": domain.DeclineInsufficientFunds},
+			}))
+
+			response, err := service.Create(&models.PostPaymentHandlerRequest{
+				CardNumber:  2222405343248878,
+				ExpiryMonth: 12,
+				ExpiryYear:  time.Now().Year() + 1,
+				Currency:    "GBP",
+				Amount:      100,
+				Cvv:         123,
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, "declined", response.PaymentStatus)
+			assert.Equal(t, tt.expected, response.DeclineCode)
+			assert.Equal(t, tt.expected, repo.GetPayment(response.Id).DeclineCode)
+		})
+	}
+}
+
+func TestPostPayment_AuthorizedHasNoDeclineCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{
+		Authorised:   true,
+		ResponseCode: "00",
+	}, nil)
+
+	service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient)
+
+	response, err := service.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, response.DeclineCode)
+}
+
+func TestCheckDeclineCodes(t *testing.T) {
+	assert.NoError(t, domain.CheckDeclineCodes(map[string]map[string]string{"other": {"N7": domain.DeclineStolenCard}}))
+	assert.Error(t, domain.CheckDeclineCodes(map[string]map[string]string{"other": {"N7": "stolen"}}))
+}
@@ -0,0 +1,368 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrDisputeNotFound = errors.New("dispute not found")
+	// ErrDisputeTransition is returned when the dispute is past the point where the change is possible,
+	// for instance adding evidence to a dispute that is already under review.
+	ErrDisputeTransition = errors.New("dispute cannot be changed from its current status")
+)
+
+type DisputeConfig struct {
+	// ResponseWindow is how long merchants have to respond when the acquirer gives no deadline.
+	ResponseWindow time.Duration
+	// MaxEvidenceSize is the largest evidence file in bytes, MaxEvidenceFiles how many a dispute can have.
+	MaxEvidenceSize  int
+	MaxEvidenceFiles int
+	// EvidenceTypes are the accepted content types, they are detected from the file itself.
+	EvidenceTypes []string
+}
+
+func DefaultDisputeConfig() DisputeConfig {
+	return DisputeConfig{
+		ResponseWindow:   7 * 24 * time.Hour,
+		MaxEvidenceSize:  5 << 20,
+		MaxEvidenceFiles: 10,
+		EvidenceTypes:    []string{"application/pdf", "image/png", "image/jpeg", "text/plain"},
+	}
+}
+
+type DisputesService interface {
+	Ingest(notifications []models.DisputeNotification) *models.DisputeIngestResult
+	AddEvidence(id, filename string, content []byte) (*models.Dispute, error)
+	SubmitEvidence(id string) (*models.Dispute, error)
+	AcceptDispute(id string) (*models.Dispute, error)
+}
+
+type DisputesServiceImpl struct {
+	mu       sync.Mutex
+	payments *repository.PaymentsRepository
+	disputes *repository.DisputesRepository
+	config   DisputeConfig
+	audit    *audit.Log
+	now      func() time.Time
+}
+
+func NewDisputesServiceImpl(payments *repository.PaymentsRepository, disputes *repository.DisputesRepository, config DisputeConfig) *DisputesServiceImpl {
+	return &DisputesServiceImpl{
+		payments: payments,
+		disputes: disputes,
+		config:   config,
+		now:      time.Now,
+	}
+}
+
+// WithClock swaps the clock used for deadlines, handy for tests.
+func (d *DisputesServiceImpl) WithClock(now func() time.Time) *DisputesServiceImpl {
+	d.now = now
+	return d
+}
+
+// WithAudit records the changes made by the service itself, chargebacks and expired disputes, in the audit log.
+func (d *DisputesServiceImpl) WithAudit(auditLog *audit.Log) *DisputesServiceImpl {
+	d.audit = auditLog
+	return d
+}
+
+// Ingest applies the acquirer's dispute notifications in order.  Notifications that cannot be applied
+// are reported back and do not stop the others, a notification that was already applied is ignored.
+func (d *DisputesServiceImpl) Ingest(notifications []models.DisputeNotification) *models.DisputeIngestResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := &models.DisputeIngestResult{
+		Disputes: []models.Dispute{},
+		Errors:   []models.DisputeNotificationError{},
+	}
+	for i, notification := range notifications {
+		dispute, err := d.apply(notification)
+		if err != nil {
+			result.Errors = append(result.Errors, models.DisputeNotificationError{
+				Index:             i,
+				AcquirerDisputeId: notification.AcquirerDisputeId,
+				Message:           err.Error(),
+			})
+			continue
+		}
+		if dispute != nil {
+			result.Disputes = append(result.Disputes, *dispute)
+		}
+	}
+	return result
+}
+
+func (d *DisputesServiceImpl) apply(notification models.DisputeNotification) (*models.Dispute, error) {
+	if notification.AcquirerDisputeId == "" {
+		return nil, errors.New("missing acquirer dispute id")
+	}
+	now := d.now().UTC()
+	existing := d.disputes.GetByAcquirerDisputeId(notification.AcquirerDisputeId)
+
+	switch notification.Event {
+	case models.DisputeEventOpened:
+		if existing != nil {
+			return nil, nil
+		}
+		return d.open(notification, now)
+	case models.DisputeEventWon, models.DisputeEventLost:
+		if existing == nil {
+			return nil, errors.New("unknown dispute")
+		}
+		status := models.DisputeWon
+		if notification.Event == models.DisputeEventLost {
+			status = models.DisputeLost
+		}
+		if existing.Status == status {
+			return nil, nil
+		}
+		if err := d.resolve(existing, status, now); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	return nil, fmt.Errorf("unsupported event %q", notification.Event)
+}
+
+func (d *DisputesServiceImpl) open(notification models.DisputeNotification, now time.Time) (*models.Dispute, error) {
+	var payment *models.PostPaymentResponse
+	err := d.payments.ForEachPayment(func(p models.PostPaymentResponse) error {
+		if notification.AcquirerReference != "" && p.AcquirerReference == notification.AcquirerReference {
+			payment = &p
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if payment == nil {
+		return nil, errors.New("no payment with this acquirer reference")
+	}
+	// only authorised payments moved any money that could be charged back
+	if payment.PaymentStatus != "authorized" {
+		return nil, fmt.Errorf("payment %s is %s and cannot be disputed", payment.Id, payment.PaymentStatus)
+	}
+
+	// the dispute is in the currency the merchant is paid in
+	currency, remaining := payment.Currency, payment.Amount
+	if payment.SettlementCurrency != "" {
+		currency, remaining = payment.SettlementCurrency, payment.SettlementAmount
+	}
+	// lost disputes are already taken off, open ones may still be
+	remaining -= payment.ChargebackAmount
+	for _, other := range d.disputes.ListDisputes(payment.MerchantID, "") {
+		if other.PaymentId == payment.Id && other.Status != models.DisputeWon && other.Status != models.DisputeLost {
+			remaining -= other.Amount
+		}
+	}
+	if notification.Currency != "" && notification.Currency != currency {
+		return nil, fmt.Errorf("dispute currency %s does not match the payment currency %s", notification.Currency, currency)
+	}
+	amount := notification.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining {
+		return nil, fmt.Errorf("dispute amount %d does not fit the %d left on the payment", amount, remaining)
+	}
+
+	respondBy := now.Add(d.config.ResponseWindow)
+	if notification.RespondBy != nil {
+		respondBy = notification.RespondBy.UTC()
+	}
+
+	dispute := models.Dispute{
+		Id:                uuid.New().String(),
+		PaymentId:         payment.Id,
+		MerchantID:        payment.MerchantID,
+		AcquirerDisputeId: notification.AcquirerDisputeId,
+		Status:            models.DisputeNeedsResponse,
+		Reason:            notification.Reason,
+		Amount:            amount,
+		Currency:          currency,
+		RespondBy:         respondBy,
+		Evidence:          []models.DisputeEvidence{},
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	d.disputes.AddDispute(dispute)
+	return &dispute, nil
+}
+
+// resolve closes the dispute, a lost dispute is taken off the payment.
+func (d *DisputesServiceImpl) resolve(dispute *models.Dispute, status string, now time.Time) error {
+	switch dispute.Status {
+	case models.DisputeWon, models.DisputeLost:
+		return ErrDisputeTransition
+	}
+
+	if status == models.DisputeLost {
+		payment, err := d.payments.ModifyPayment(dispute.PaymentId, func(payment *models.PostPaymentResponse) error {
+			payment.ChargebackAmount += dispute.Amount
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		recordChange(d.audit, paymentChange(*payment, "payment.chargeback"))
+	}
+
+	dispute.Status = status
+	dispute.ResolvedAt = &now
+	dispute.UpdatedAt = now
+	d.disputes.UpdateDispute(*dispute)
+	return nil
+}
+
+// AddEvidence attaches a file to a dispute that still needs a response.
+func (d *DisputesServiceImpl) AddEvidence(id, filename string, content []byte) (*models.Dispute, error) {
+	return d.update(id, func(dispute *models.Dispute, now time.Time) error {
+		if dispute.Status != models.DisputeNeedsResponse {
+			return ErrDisputeTransition
+		}
+		if len(dispute.Evidence) >= d.config.MaxEvidenceFiles {
+			return gatewayerrors.NewValidationError(
+				fmt.Errorf("a dispute can have at most %d evidence files", d.config.MaxEvidenceFiles),
+				dispute.Id,
+				"file",
+			)
+		}
+		if len(content) == 0 || len(content) > d.config.MaxEvidenceSize {
+			return gatewayerrors.NewValidationError(
+				fmt.Errorf("evidence must be between 1 and %d bytes", d.config.MaxEvidenceSize),
+				dispute.Id,
+				"file",
+			)
+		}
+		contentType, err := d.evidenceType(content)
+		if err != nil {
+			return gatewayerrors.NewValidationError(err, dispute.Id, "file")
+		}
+
+		evidence := models.DisputeEvidence{
+			Id:          uuid.New().String(),
+			Filename:    filepath.Base(filename),
+			ContentType: contentType,
+			Size:        len(content),
+			UploadedAt:  now,
+		}
+		d.disputes.AddEvidenceContent(evidence.Id, content)
+		dispute.Evidence = append(dispute.Evidence, evidence)
+		return nil
+	})
+}
+
+// evidenceType sniffs the content rather than trusting the file name or the client's content type.
+func (d *DisputesServiceImpl) evidenceType(content []byte) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(content))
+	if err != nil {
+		return "", err
+	}
+	for _, allowed := range d.config.EvidenceTypes {
+		if mediaType == allowed {
+			return mediaType, nil
+		}
+	}
+	return "", fmt.Errorf("evidence of type %s is not accepted", mediaType)
+}
+
+// SubmitEvidence sends the evidence to the acquirer, the dispute is then under review until the acquirer decides.
+func (d *DisputesServiceImpl) SubmitEvidence(id string) (*models.Dispute, error) {
+	return d.update(id, func(dispute *models.Dispute, now time.Time) error {
+		if dispute.Status != models.DisputeNeedsResponse || now.After(dispute.RespondBy) {
+			return ErrDisputeTransition
+		}
+		if len(dispute.Evidence) == 0 {
+			return gatewayerrors.NewValidationError(errors.New("evidence is needed to challenge a dispute"), dispute.Id, "evidence")
+		}
+		dispute.Status = models.DisputeUnderReview
+		dispute.SubmittedAt = &now
+		return nil
+	})
+}
+
+// AcceptDispute gives up the dispute, the merchant loses the disputed amount.
+func (d *DisputesServiceImpl) AcceptDispute(id string) (*models.Dispute, error) {
+	return d.update(id, func(dispute *models.Dispute, now time.Time) error {
+		if dispute.Status != models.DisputeNeedsResponse {
+			return ErrDisputeTransition
+		}
+		return d.resolve(dispute, models.DisputeLost, now)
+	})
+}
+
+func (d *DisputesServiceImpl) update(id string, change func(dispute *models.Dispute, now time.Time) error) (*models.Dispute, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dispute := d.disputes.GetDispute(id)
+	if dispute == nil {
+		return nil, ErrDisputeNotFound
+	}
+	now := d.now().UTC()
+	if err := change(dispute, now); err != nil {
+		return nil, err
+	}
+	dispute.UpdatedAt = now
+	d.disputes.UpdateDispute(*dispute)
+	return dispute, nil
+}
+
+// ExpireOverdue loses the disputes the merchant did not respond to in time.
+func (d *DisputesServiceImpl) ExpireOverdue() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now().UTC()
+	for _, id := range d.disputes.Overdue(now) {
+		dispute := d.disputes.GetDispute(id)
+		if dispute == nil {
+			continue
+		}
+		if err := d.resolve(dispute, models.DisputeLost, now); err != nil {
+			log.Printf("could not expire dispute %s: %v", id, err)
+			continue
+		}
+		log.Printf("dispute %s lost, no response before %s", id, dispute.RespondBy.Format(time.RFC3339))
+		recordChange(d.audit, audit.Change{
+			Actor:      audit.ActorSystem,
+			Action:     "dispute.expired",
+			Resource:   "dispute",
+			ResourceID: id,
+			After:      dispute,
+		})
+	}
+}
+
+// Run expires overdue disputes every interval until ctx is cancelled.
+func (d *DisputesServiceImpl) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.ExpireOverdue()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package domain_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDisputesService(clock *fakeClock) (*domain.DisputesServiceImpl, *repository.PaymentsRepository) {
+	payments := repository.NewPaymentsRepository()
+	payments.AddPayment(models.PostPaymentResponse{
+		Id:                "payment-1",
+		PaymentStatus:     "authorized",
+		MerchantID:        "merchant-1",
+		Currency:          "GBP",
+		Amount:            1000,
+		AcquirerReference: "ref-1",
+	})
+	config := domain.DefaultDisputeConfig()
+	config.MaxEvidenceSize = 64
+	config.MaxEvidenceFiles = 2
+	return domain.NewDisputesServiceImpl(payments, repository.NewDisputesRepository(), config).WithClock(clock.Now), payments
+}
+
+func TestDisputes_OnlyAuthorizedPayments(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	service, payments := newDisputesService(clock)
+	payments.AddPayment(models.PostPaymentResponse{
+		Id:                "payment-2",
+		PaymentStatus:     "declined",
+		MerchantID:        "merchant-1",
+		Currency:          "GBP",
+		Amount:            1000,
+		AcquirerReference: "ref-2",
+	})
+
+	result := service.Ingest([]models.DisputeNotification{
+		{AcquirerDisputeId: "acq-1", AcquirerReference: "ref-2", Event: models.DisputeEventOpened, Amount: 400},
+	})
+	assert.Empty(t, result.Disputes)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Message, "declined")
+}
+
+func TestDisputes_Lifecycle(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	service, payments := newDisputesService(clock)
+
+	result := service.Ingest([]models.DisputeNotification{
+		{AcquirerDisputeId: "acq-1", AcquirerReference: "ref-1", Event: models.DisputeEventOpened, Reason: "fraudulent", Amount: 400},
+		// redelivered notifications are ignored
+		{AcquirerDisputeId: "acq-1", AcquirerReference: "ref-1", Event: models.DisputeEventOpened, Amount: 400},
+		{AcquirerDisputeId: "acq-2", AcquirerReference: "unknown", Event: models.DisputeEventOpened},
+		{AcquirerDisputeId: "acq-3", AcquirerReference: "ref-1", Event: models.DisputeEventOpened, Amount: 700},
+		{AcquirerDisputeId: "acq-4", Event: models.DisputeEventLost},
+	})
+	require.Len(t, result.Disputes, 1)
+	require.Len(t, result.Errors, 3)
+	assert.Equal(t, []int{2, 3, 4}, []int{result.Errors[0].Index, result.Errors[1].Index, result.Errors[2].Index})
+
+	dispute := result.Disputes[0]
+	assert.Equal(t, models.DisputeNeedsResponse, dispute.Status)
+	assert.Equal(t, "payment-1", dispute.PaymentId)
+	assert.Equal(t, "merchant-1", dispute.MerchantID)
+	assert.Equal(t, clock.now.Add(7*24*time.Hour), dispute.RespondBy)
+
+	_, err := service.SubmitEvidence(dispute.Id)
+	var validationError *gatewayerrors.ValidationError
+	require.ErrorAs(t, err, &validationError)
+
+	updated, err := service.AddEvidence(dispute.Id, "../receipt.txt", []byte("delivered on the 2nd"))
+	require.NoError(t, err)
+	require.Len(t, updated.Evidence, 1)
+	assert.Equal(t, "receipt.txt", updated.Evidence[0].Filename)
+	assert.Equal(t, "text/plain", updated.Evidence[0].ContentType)
+
+	updated, err = service.SubmitEvidence(dispute.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.DisputeUnderReview, updated.Status)
+
+	_, err = service.AddEvidence(dispute.Id, "late.txt", []byte("too late"))
+	assert.ErrorIs(t, err, domain.ErrDisputeTransition)
+
+	result = service.Ingest([]models.DisputeNotification{{AcquirerDisputeId: "acq-1", Event: models.DisputeEventLost}})
+	require.Empty(t, result.Errors)
+	assert.Equal(t, models.DisputeLost, result.Disputes[0].Status)
+	assert.Equal(t, 400, payments.GetPayment("payment-1").ChargebackAmount)
+
+	// a second dispute can only take what is left of the payment
+	result = service.Ingest([]models.DisputeNotification{{AcquirerDisputeId: "acq-5", AcquirerReference: "ref-1", Event: models.DisputeEventOpened}})
+	require.Empty(t, result.Errors)
+	assert.Equal(t, 600, result.Disputes[0].Amount)
+
+	result = service.Ingest([]models.DisputeNotification{{AcquirerDisputeId: "acq-5", Event: models.DisputeEventWon}})
+	require.Empty(t, result.Errors)
+	assert.Equal(t, 400, payments.GetPayment("payment-1").ChargebackAmount)
+}
+
+func TestDisputes_Evidence(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	service, _ := newDisputesService(clock)
+	dispute := service.Ingest([]models.DisputeNotification{
+		{AcquirerDisputeId: "acq-1", AcquirerReference: "ref-1", Event: models.DisputeEventOpened},
+	}).Disputes[0]
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"Empty", nil},
+		{"TooLarge", []byte(strings.Repeat("a", 65))},
+		{"Executable", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff")},
+		{"HTML", []byte("<html><body>not evidence</body></html>")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var validationError *gatewayerrors.ValidationError
+			_, err := service.AddEvidence(dispute.Id, "evidence.pdf", tt.content)
+			require.ErrorAs(t, err, &validationError)
+			assert.Equal(t, "file", validationError.GetFieldError())
+		})
+	}
+
+	_, err := service.AddEvidence(dispute.Id, "one.pdf", []byte("%PDF-1.4 one"))
+	require.NoError(t, err)
+	_, err = service.AddEvidence(dispute.Id, "two.png", []byte("\x89PNG\x0d\x0a\x1a\x0a two"))
+	require.NoError(t, err)
+	_, err = service.AddEvidence(dispute.Id, "three.txt", []byte("three"))
+	assert.Error(t, err)
+}
+
+func TestDisputes_DeadlinePassed(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	service, payments := newDisputesService(clock)
+	respondBy := clock.now.Add(48 * time.Hour)
+	dispute := service.Ingest([]models.DisputeNotification{
+		{AcquirerDisputeId: "acq-1", AcquirerReference: "ref-1", Event: models.DisputeEventOpened, RespondBy: &respondBy},
+	}).Disputes[0]
+
+	service.ExpireOverdue()
+	assert.Zero(t, payments.GetPayment("payment-1").ChargebackAmount)
+
+	_, err := service.AddEvidence(dispute.Id, "receipt.txt", []byte("receipt"))
+	require.NoError(t, err)
+
+	clock.now = respondBy.Add(time.Minute)
+	_, err = service.SubmitEvidence(dispute.Id)
+	assert.ErrorIs(t, err, domain.ErrDisputeTransition)
+
+	service.ExpireOverdue()
+	assert.Equal(t, 1000, payments.GetPayment("payment-1").ChargebackAmount)
+
+	_, err = service.AcceptDispute(dispute.Id)
+	assert.ErrorIs(t, err, domain.ErrDisputeTransition)
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"log"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/events"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// WithEvents publishes every payment status change to broker.
+func WithEvents(broker *events.Broker) Option {
+	return func(p *PaymentServiceImpl) {
+		p.events = broker
+	}
+}
+
+// WithAudit records every payment status change in the audit log.
+func WithAudit(auditLog *audit.Log) Option {
+	return func(p *PaymentServiceImpl) {
+		p.audit = auditLog
+	}
+}
+
+func (p *PaymentServiceImpl) publish(payment models.PostPaymentResponse) {
+	if p.events != nil {
+		p.events.Publish(events.FromPayment(payment))
+	}
+	p.recordPayment(payment)
+}
+
+func (p *PaymentServiceImpl) recordPayment(payment models.PostPaymentResponse) {
+	recordChange(p.audit, paymentChange(payment, ""))
+}
+
+// paymentChange describes a change to payment for the audit log.  Payments change on behalf of their
+// merchant, the entries carry the request that created the payment so they can be traced back to it.
+// The card details are left out, the log is append only so nothing in it could be erased later on.
+func paymentChange(payment models.PostPaymentResponse, action string) audit.Change {
+	actor := payment.MerchantID
+	if actor == "" {
+		actor = "anonymous"
+	}
+	return audit.Change{
+		Actor:      actor,
+		RequestID:  payment.RequestID,
+		Action:     action,
+		Resource:   "payment",
+		ResourceID: payment.Id,
+		After:      anonymise(payment),
+	}
+}
+
+// recordChange adds change to the audit log.  The change has already been made by then so a failure
+// is only logged.
+func recordChange(auditLog *audit.Log, change audit.Change) {
+	if _, err := auditLog.Record(change); err != nil {
+		log.Printf("could not audit %s %s: %v", change.Resource, change.ResourceID, err)
+	}
+}
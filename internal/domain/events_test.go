@@ -0,0 +1,89 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/events"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPostPayment_PublishesStatusChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: false, ResponseCode: "51"}, nil)
+
+	journal := queue.NewMemoryJournal()
+	paymentQueue, err := queue.New(queue.Config{Size: 1, Workers: 1}, journal)
+	require.NoError(t, err)
+	broker := events.NewBroker(10)
+	service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient, domain.WithQueue(paymentQueue), domain.WithEvents(broker))
+
+	subscription, _, _ := broker.Subscribe(events.ForMerchant("merchant-1"), 0)
+	defer subscription.Close()
+
+	payment, err := service.CreateAsync(asyncPayment())
+	require.NoError(t, err)
+	jobs, err := journal.Pending()
+	require.NoError(t, err)
+	service.ProcessJob(jobs[0])
+
+	processing := <-subscription.C
+	assert.Equal(t, payment.Id, processing.PaymentId)
+	assert.Equal(t, "processing", processing.Status)
+
+	declined := <-subscription.C
+	assert.Equal(t, "declined", declined.Status)
+	assert.Equal(t, domain.DeclineInsufficientFunds, declined.DeclineCode)
+}
+
+func TestPostPayment_AuditsStatusChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+
+	journal := queue.NewMemoryJournal()
+	paymentQueue, err := queue.New(queue.Config{Size: 1, Workers: 1}, journal)
+	require.NoError(t, err)
+	auditLog := audit.NewLog()
+	service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient, domain.WithQueue(paymentQueue), domain.WithAudit(auditLog))
+
+	request := asyncPayment()
+	request.RequestID = "req-1"
+	payment, err := service.CreateAsync(request)
+	require.NoError(t, err)
+	jobs, err := journal.Pending()
+	require.NoError(t, err)
+	service.ProcessJob(jobs[0])
+
+	entries, err := auditLog.Entries(audit.Query{Resource: "payment", ResourceID: payment.Id})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "payment.created", entries[0].Action)
+	assert.Equal(t, "merchant-1", entries[0].Actor)
+	assert.Equal(t, "req-1", entries[0].RequestID)
+	assert.Contains(t, string(entries[0].After), `"payment_status":"processing"`)
+	assert.Equal(t, "payment.updated", entries[1].Action)
+	assert.Contains(t, string(entries[1].Before), `"payment_status":"processing"`)
+	assert.Contains(t, string(entries[1].After), `"payment_status":"authorized"`)
+	// card details never make it into the log, it cannot be erased later on
+	for _, entry := range entries {
+		var logged models.PostPaymentResponse
+		require.NoError(t, json.Unmarshal(entry.After, &logged))
+		assert.Zero(t, logged.CardNumberLastFour)
+		assert.Zero(t, logged.ExpiryMonth)
+		assert.Zero(t, logged.ExpiryYear)
+		assert.Empty(t, logged.NetworkTransactionId)
+	}
+	assert.NotEqual(t, 0, payment.CardNumberLastFour)
+}
@@ -0,0 +1,125 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/fx"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// DefaultQuoteTTL is how long a quoted rate stays locked.
+const DefaultQuoteTTL = 15 * time.Minute
+
+// WithFX lets payments be converted into a settlement currency, either at the live rate
+// or at a rate locked earlier through a quote.
+func WithFX(rates fx.Provider, quotes *repository.QuotesRepository) Option {
+	return func(p *PaymentServiceImpl) {
+		p.rates = rates
+		p.quotes = quotes
+	}
+}
+
+// applyFX fills in the settlement side of the payment, payments without a settlement currency
+// or quote are left alone.
+func (p *PaymentServiceImpl) applyFX(request *models.PostPaymentHandlerRequest, payment *models.PostPaymentResponse) error {
+	if request.QuoteId == "" && (request.SettlementCurrency == "" || request.SettlementCurrency == request.Currency) {
+		return nil
+	}
+	if p.rates == nil {
+		return gatewayerrors.NewValidationError(errors.New("currency conversion is not available"), payment.Id, "settlement_currency")
+	}
+
+	if request.QuoteId != "" {
+		quote := p.quotes.GetQuote(request.QuoteId)
+		if quote == nil || quote.MerchantID != request.MerchantID {
+			return gatewayerrors.NewValidationError(errors.New("unknown quote"), payment.Id, "quote_id")
+		}
+		if !time.Now().Before(quote.ExpiresAt) {
+			return gatewayerrors.NewValidationError(errors.New("quote expired"), payment.Id, "quote_id")
+		}
+		if quote.From != request.Currency || (request.SettlementCurrency != "" && quote.To != request.SettlementCurrency) {
+			return gatewayerrors.NewValidationError(errors.New("quote is for a different currency pair"), payment.Id, "quote_id")
+		}
+
+		rate, err := fx.ParseRate(quote.Rate)
+		if err != nil {
+			return err
+		}
+		payment.SettlementCurrency = quote.To
+		payment.SettlementAmount = fx.Convert(request.Amount, quote.From, quote.To, rate)
+		payment.FXRate = quote.Rate
+		payment.FXQuoteId = quote.Id
+		return nil
+	}
+
+	rate, err := p.rates.Rate(request.Currency, request.SettlementCurrency)
+	if err != nil {
+		return gatewayerrors.NewValidationError(err, payment.Id, "settlement_currency")
+	}
+	payment.SettlementCurrency = request.SettlementCurrency
+	payment.SettlementAmount = fx.Convert(request.Amount, request.Currency, request.SettlementCurrency, rate)
+	payment.FXRate = fx.FormatRate(rate)
+	return nil
+}
+
+type FXService interface {
+	Quote(request *models.FXQuoteRequest, merchantID string) (*models.FXQuote, error)
+}
+
+type FXServiceImpl struct {
+	rates  fx.Provider
+	quotes *repository.QuotesRepository
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewFXServiceImpl(rates fx.Provider, quotes *repository.QuotesRepository, ttl time.Duration) *FXServiceImpl {
+	return &FXServiceImpl{
+		rates:  rates,
+		quotes: quotes,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// WithClock swaps the clock used to stamp quotes, handy for tests.
+func (s *FXServiceImpl) WithClock(now func() time.Time) *FXServiceImpl {
+	s.now = now
+	return s
+}
+
+// Quote locks the current rate between the two currencies for the merchant.
+func (s *FXServiceImpl) Quote(request *models.FXQuoteRequest, merchantID string) (*models.FXQuote, error) {
+	id := uuid.New().String()
+	if request.Amount < 0 {
+		return nil, gatewayerrors.NewValidationError(errors.New("invalid amount"), id, "amount")
+	}
+
+	rate, err := s.rates.Rate(request.From, request.To)
+	if err != nil {
+		return nil, gatewayerrors.NewValidationError(err, id, "currency")
+	}
+
+	now := s.now().UTC()
+	quote := models.FXQuote{
+		Id:         id,
+		MerchantID: merchantID,
+		From:       request.From,
+		To:         request.To,
+		Rate:       fx.FormatRate(rate),
+		Amount:     request.Amount,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.ttl),
+	}
+	if request.Amount > 0 {
+		quote.ConvertedAmount = fx.Convert(request.Amount, request.From, request.To, rate)
+	}
+	s.quotes.AddQuote(quote)
+
+	return &quote, nil
+}
@@ -0,0 +1,130 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/fx"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPostPayment_LockedRate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+
+	rates, err := fx.NewTable("USD", map[string]string{"GBP": "0.8", "JPY": "150"})
+	require.NoError(t, err)
+	quotes := repository.NewQuotesRepository()
+	fxService := domain.NewFXServiceImpl(rates, quotes, domain.DefaultQuoteTTL)
+
+	quote, err := fxService.Quote(&models.FXQuoteRequest{From: "JPY", To: "GBP", Amount: 1000}, "merchant-1")
+	require.NoError(t, err)
+	assert.Equal(t, "0.00533333", quote.Rate)
+	assert.Equal(t, 533, quote.ConvertedAmount)
+
+	// the rate moving after the quote must not change the payment
+	rates, err = fx.NewTable("USD", map[string]string{"GBP": "0.5", "JPY": "150"})
+	require.NoError(t, err)
+
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithFX(rates, quotes))
+
+	response, err := service.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "JPY",
+		Amount:      1000,
+		Cvv:         123,
+		QuoteId:     quote.Id,
+		MerchantID:  "merchant-1",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "JPY", response.Currency)
+	assert.Equal(t, 1000, response.Amount)
+	assert.Equal(t, "GBP", response.SettlementCurrency)
+	assert.Equal(t, 533, response.SettlementAmount)
+	assert.Equal(t, quote.Rate, response.FXRate)
+	assert.Equal(t, quote.Id, response.FXQuoteId)
+}
+
+func TestPostPayment_LiveRate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+
+	rates, err := fx.NewTable("USD", map[string]string{"EUR": "0.9"})
+	require.NoError(t, err)
+
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithFX(rates, repository.NewQuotesRepository()))
+
+	response, err := service.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:         2222405343248877,
+		ExpiryMonth:        12,
+		ExpiryYear:         time.Now().Year() + 1,
+		Currency:           "USD",
+		Amount:             1005,
+		Cvv:                123,
+		SettlementCurrency: "EUR",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 905, response.SettlementAmount)
+	assert.Equal(t, "0.90000000", response.FXRate)
+	assert.Empty(t, response.FXQuoteId)
+}
+
+func TestPostPayment_InvalidQuote(t *testing.T) {
+	rates, err := fx.NewTable("USD", map[string]string{"GBP": "0.8"})
+	require.NoError(t, err)
+	quotes := repository.NewQuotesRepository()
+	quotes.AddQuote(models.FXQuote{Id: "expired", MerchantID: "merchant-1", From: "USD", To: "GBP", Rate: "0.8", ExpiresAt: time.Now().Add(-time.Minute)})
+	quotes.AddQuote(models.FXQuote{Id: "other-merchant", MerchantID: "merchant-2", From: "USD", To: "GBP", Rate: "0.8", ExpiresAt: time.Now().Add(time.Minute)})
+	quotes.AddQuote(models.FXQuote{Id: "other-pair", MerchantID: "merchant-1", From: "EUR", To: "GBP", Rate: "0.8", ExpiresAt: time.Now().Add(time.Minute)})
+
+	tests := []struct {
+		quoteId string
+		message string
+	}{
+		{quoteId: "missing", message: "unknown quote"},
+		{quoteId: "expired", message: "quote expired"},
+		{quoteId: "other-merchant", message: "unknown quote"},
+		{quoteId: "other-pair", message: "quote is for a different currency pair"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.quoteId, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mocks.NewMockClient(ctrl), domain.WithFX(rates, quotes))
+
+			_, err := service.Create(&models.PostPaymentHandlerRequest{
+				CardNumber:  2222405343248877,
+				ExpiryMonth: 12,
+				ExpiryYear:  time.Now().Year() + 1,
+				Currency:    "USD",
+				Amount:      100,
+				Cvv:         123,
+				QuoteId:     tt.quoteId,
+				MerchantID:  "merchant-1",
+			})
+
+			var validationErr *gatewayerrors.ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, "quote_id", validationErr.Field)
+			assert.Equal(t, tt.message, validationErr.Error())
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/risk"
+)
+
+// WithLists checks every payment against the operator managed block and allow lists,
+// binCountries is used to work out the issuing country of the card.
+func WithLists(lists *repository.ListsRepository, binCountries map[string]string) Option {
+	return func(p *PaymentServiceImpl) {
+		p.lists = lists
+		p.binCountries = binCountries
+	}
+}
+
+// screenLists reports whether the card is allowlisted and the block entry that matched, if any.  Allow
+// entries only spare a trusted card the risk engine, a block always wins so that an operator can stop a
+// card whatever else is on the lists.
+func (p *PaymentServiceImpl) screenLists(cardNumber, fingerprint, currency string) (bool, *models.ListEntry) {
+	now := time.Now()
+	country := risk.LookupBINCountry(p.binCountries, getBIN(cardNumber))
+
+	matches := p.lists.MatchBIN(cardNumber, now)
+	matches = append(matches, p.lists.Match(models.ListEntryCardFingerprint, fingerprint, now)...)
+	matches = append(matches, p.lists.Match(models.ListEntryCurrency, currency, now)...)
+	if country != "" {
+		matches = append(matches, p.lists.Match(models.ListEntryCountry, country, now)...)
+	}
+
+	allowlisted := false
+	var blockedBy *models.ListEntry
+	for i := range matches {
+		if matches[i].List == models.ListAllow {
+			allowlisted = true
+		} else if blockedBy == nil {
+			blockedBy = &matches[i]
+		}
+	}
+	return allowlisted, blockedBy
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type ListsService interface {
+	AddEntry(request *models.ListEntryRequest, actor string) (*models.ListEntry, error)
+	DeleteEntry(id, actor string) error
+}
+
+type ListsServiceImpl struct {
+	repo *repository.ListsRepository
+}
+
+func NewListsServiceImpl(repo *repository.ListsRepository) *ListsServiceImpl {
+	return &ListsServiceImpl{
+		repo: repo,
+	}
+}
+
+var (
+	fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	currencyPattern    = regexp.MustCompile(`^[A-Z]{3}$`)
+	countryPattern     = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+func (l *ListsServiceImpl) AddEntry(request *models.ListEntryRequest, actor string) (*models.ListEntry, error) {
+	id := uuid.New().String()
+	now := time.Now().UTC()
+
+	if request.List != models.ListBlock && request.List != models.ListAllow {
+		return nil, gatewayerrors.NewValidationError(errors.New("list must be block or allow"), id, "list")
+	}
+
+	value := strings.TrimSpace(request.Value)
+	switch request.Type {
+	case models.ListEntryCardFingerprint:
+		value = strings.ToLower(value)
+		if !fingerprintPattern.MatchString(value) {
+			return nil, gatewayerrors.NewValidationError(errors.New("invalid card fingerprint"), id, "value")
+		}
+	case models.ListEntryCurrency:
+		value = strings.ToUpper(value)
+		if !currencyPattern.MatchString(value) {
+			return nil, gatewayerrors.NewValidationError(errors.New("invalid currency"), id, "value")
+		}
+	case models.ListEntryCountry:
+		value = strings.ToUpper(value)
+		if !countryPattern.MatchString(value) {
+			return nil, gatewayerrors.NewValidationError(errors.New("invalid country"), id, "value")
+		}
+	case models.ListEntryBINRange:
+		value = ""
+		if _, _, err := repository.ParseBINRange(request.BINStart, request.BINEnd); err != nil {
+			return nil, gatewayerrors.NewValidationError(err, id, "bin_start")
+		}
+	default:
+		return nil, gatewayerrors.NewValidationError(errors.New("unsupported list entry type"), id, "type")
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		return nil, gatewayerrors.NewValidationError(errors.New("expiry in past"), id, "expires_at")
+	}
+
+	entry := models.ListEntry{
+		Id:        id,
+		List:      request.List,
+		Type:      request.Type,
+		Value:     value,
+		Reason:    request.Reason,
+		CreatedBy: actor,
+		CreatedAt: now,
+		ExpiresAt: request.ExpiresAt,
+	}
+	if request.Type == models.ListEntryBINRange {
+		entry.BINStart = request.BINStart
+		entry.BINEnd = request.BINEnd
+		if entry.BINEnd == "" {
+			entry.BINEnd = entry.BINStart
+		}
+	}
+
+	if err := l.repo.AddEntry(entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (l *ListsServiceImpl) DeleteEntry(id, actor string) error {
+	return l.repo.DeleteEntry(id, actor, time.Now().UTC())
+}
@@ -0,0 +1,138 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/risk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPostPayment_BlockedByList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	lists := repository.NewListsRepository()
+	listsService := domain.NewListsServiceImpl(lists)
+	_, err := listsService.AddEntry(&models.ListEntryRequest{
+		List:   models.ListBlock,
+		Type:   models.ListEntryCountry,
+		Value:  "gb",
+		Reason: "testing",
+	}, "alice")
+	require.NoError(t, err)
+
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithLists(lists, risk.DefaultConfig().BINCountries))
+
+	response, err := service.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "blocked", response.PaymentStatus)
+	assert.Equal(t, []string{"blocklist_country"}, response.RiskRules)
+}
+
+func TestPostPayment_AllowlistSkipsRiskEngine(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+
+	lists := repository.NewListsRepository()
+	listsService := domain.NewListsServiceImpl(lists)
+	_, err := listsService.AddEntry(&models.ListEntryRequest{List: models.ListAllow, Type: models.ListEntryBINRange, BINStart: "222240"}, "alice")
+	require.NoError(t, err)
+
+	riskConfig := risk.DefaultConfig()
+	riskConfig.BlockedBINs = []string{"222240"}
+
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(
+		repo,
+		mockClient,
+		domain.WithLists(lists, riskConfig.BINCountries),
+		domain.WithRiskEngine(risk.NewEngine(riskConfig)),
+	)
+
+	response, err := service.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "authorized", response.PaymentStatus)
+	assert.Empty(t, response.RiskOutcome)
+}
+
+func TestPostPayment_BlockWinsOverAllowlist(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	lists := repository.NewListsRepository()
+	listsService := domain.NewListsServiceImpl(lists)
+	_, err := listsService.AddEntry(&models.ListEntryRequest{List: models.ListBlock, Type: models.ListEntryCurrency, Value: "GBP"}, "alice")
+	require.NoError(t, err)
+	_, err = listsService.AddEntry(&models.ListEntryRequest{List: models.ListAllow, Type: models.ListEntryBINRange, BINStart: "222240"}, "alice")
+	require.NoError(t, err)
+
+	service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient, domain.WithLists(lists, risk.DefaultConfig().BINCountries))
+	response, err := service.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "blocked", response.PaymentStatus)
+	assert.Equal(t, []string{"blocklist_currency"}, response.RiskRules)
+}
+
+func TestListsService_AddEntryValidation(t *testing.T) {
+	service := domain.NewListsServiceImpl(repository.NewListsRepository())
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		request models.ListEntryRequest
+		field   string
+	}{
+		{"UnknownList", models.ListEntryRequest{List: "grey", Type: models.ListEntryCurrency, Value: "GBP"}, "list"},
+		{"UnknownType", models.ListEntryRequest{List: models.ListBlock, Type: "email", Value: "a@b.c"}, "type"},
+		{"BadFingerprint", models.ListEntryRequest{List: models.ListBlock, Type: models.ListEntryCardFingerprint, Value: "abc"}, "value"},
+		{"BadCountry", models.ListEntryRequest{List: models.ListBlock, Type: models.ListEntryCountry, Value: "GBR"}, "value"},
+		{"BadBINRange", models.ListEntryRequest{List: models.ListBlock, Type: models.ListEntryBINRange, BINStart: "5", BINEnd: "4"}, "bin_start"},
+		{"ExpiryInPast", models.ListEntryRequest{List: models.ListBlock, Type: models.ListEntryCurrency, Value: "GBP", ExpiresAt: &past}, "expires_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var validationError *gatewayerrors.ValidationError
+			_, err := service.AddEntry(&tt.request, "alice")
+			require.ErrorAs(t, err, &validationError)
+			assert.Equal(t, tt.field, validationError.GetFieldError())
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+)
+
+// Error codes returned to merchants when a payment breaks their profile.
+const (
+	ErrorCodeAmountBelowMinimum   = "amount_below_minimum"
+	ErrorCodeAmountAboveMaximum   = "amount_above_maximum"
+	ErrorCodeCurrencyNotAllowed   = "currency_not_allowed"
+	ErrorCodeCardSchemeNotAllowed = "card_scheme_not_allowed"
+	ErrorCodeDailyVolumeExceeded  = "daily_volume_exceeded"
+	defaultCaptureMode            = models.CaptureAuto
+)
+
+var knownCardSchemes = []string{client.SchemeVisa, client.SchemeMastercard, client.SchemeAmex, client.SchemeDiscover}
+
+// WithMerchantProfiles enforces the per merchant amount limits, currencies, card schemes and daily caps.
+func WithMerchantProfiles(merchants *repository.MerchantsRepository) Option {
+	return func(p *PaymentServiceImpl) {
+		p.merchants = merchants
+	}
+}
+
+// checkProfile rejects payments the merchant's profile does not allow, merchants without a profile
+// are not restricted.
+func checkProfile(profile *models.MerchantProfile, payment *models.PostPaymentResponse) error {
+	if profile == nil {
+		return nil
+	}
+
+	if len(profile.Currencies) > 0 && !slices.Contains(profile.Currencies, payment.Currency) {
+		return gatewayerrors.NewProfileError(fmt.Errorf("currency %s is not allowed", payment.Currency), payment.Id, ErrorCodeCurrencyNotAllowed)
+	}
+	if len(profile.CardSchemes) > 0 && !slices.Contains(profile.CardSchemes, payment.CardScheme) {
+		return gatewayerrors.NewProfileError(fmt.Errorf("card scheme %s is not allowed", payment.CardScheme), payment.Id, ErrorCodeCardSchemeNotAllowed)
+	}
+
+	limit := profile.AmountLimits[payment.Currency]
+	// card verifications are for no amount at all
+	if limit.Min > 0 && payment.Amount > 0 && payment.Amount < limit.Min {
+		return gatewayerrors.NewProfileError(fmt.Errorf("amount is below the minimum of %d", limit.Min), payment.Id, ErrorCodeAmountBelowMinimum)
+	}
+	if limit.Max > 0 && payment.Amount > limit.Max {
+		return gatewayerrors.NewProfileError(fmt.Errorf("amount is above the maximum of %d", limit.Max), payment.Id, ErrorCodeAmountAboveMaximum)
+	}
+	return nil
+}
+
+// reserveVolume counts the payment against the merchant's daily cap for its currency, the returned
+// func gives the volume back when the payment does not go through.
+func (p *PaymentServiceImpl) reserveVolume(profile *models.MerchantProfile, payment *models.PostPaymentResponse) (func(), error) {
+	limit, ok := profile.DailyVolumeCaps[payment.Currency]
+	if !ok {
+		return func() {}, nil
+	}
+
+	day := payment.CreatedAt.Format(time.DateOnly)
+	if !p.merchants.ReserveVolume(payment.MerchantID, payment.Currency, day, payment.Amount, limit) {
+		return nil, gatewayerrors.NewProfileError(errors.New("daily volume cap reached"), payment.Id, ErrorCodeDailyVolumeExceeded)
+	}
+	return func() {
+		p.merchants.ReleaseVolume(payment.MerchantID, payment.Currency, day, payment.Amount)
+	}, nil
+}
+
+type MerchantsService interface {
+	PutProfile(profile *models.MerchantProfile, actor string) (*models.MerchantProfile, error)
+	DeleteProfile(merchantID string) error
+}
+
+type MerchantsServiceImpl struct {
+	repo *repository.MerchantsRepository
+}
+
+func NewMerchantsServiceImpl(repo *repository.MerchantsRepository) *MerchantsServiceImpl {
+	return &MerchantsServiceImpl{
+		repo: repo,
+	}
+}
+
+// PutProfile validates and replaces the whole profile of the merchant.
+func (m *MerchantsServiceImpl) PutProfile(profile *models.MerchantProfile, actor string) (*models.MerchantProfile, error) {
+	id := profile.MerchantID
+	if strings.TrimSpace(profile.MerchantID) == "" {
+		return nil, gatewayerrors.NewValidationError(errors.New("missing merchant id"), id, "merchant_id")
+	}
+
+	for _, currency := range profile.Currencies {
+		if !validCurrencyCodes[currency] {
+			return nil, gatewayerrors.NewValidationError(fmt.Errorf("unsupported currency %s", currency), id, "currencies")
+		}
+	}
+	for _, scheme := range profile.CardSchemes {
+		if !slices.Contains(knownCardSchemes, scheme) {
+			return nil, gatewayerrors.NewValidationError(fmt.Errorf("unknown card scheme %s", scheme), id, "card_schemes")
+		}
+	}
+	for currency, limit := range profile.AmountLimits {
+		if !validCurrencyCodes[currency] {
+			return nil, gatewayerrors.NewValidationError(fmt.Errorf("unsupported currency %s", currency), id, "amount_limits")
+		}
+		if limit.Min < 0 || limit.Max < 0 || (limit.Max > 0 && limit.Min > limit.Max) {
+			return nil, gatewayerrors.NewValidationError(fmt.Errorf("invalid amount limit for %s", currency), id, "amount_limits")
+		}
+	}
+	for currency, limit := range profile.DailyVolumeCaps {
+		if !validCurrencyCodes[currency] {
+			return nil, gatewayerrors.NewValidationError(fmt.Errorf("unsupported currency %s", currency), id, "daily_volume_caps")
+		}
+		if limit <= 0 {
+			return nil, gatewayerrors.NewValidationError(fmt.Errorf("invalid daily volume cap for %s", currency), id, "daily_volume_caps")
+		}
+	}
+
+	switch profile.CaptureMode {
+	case "":
+		profile.CaptureMode = defaultCaptureMode
+	case models.CaptureAuto, models.CaptureManual:
+	default:
+		return nil, gatewayerrors.NewValidationError(errors.New("capture mode must be auto or manual"), id, "capture_mode")
+	}
+
+	if err := validateRetention(profile.Retention, id); err != nil {
+		return nil, err
+	}
+
+	profile.UpdatedBy = actor
+	profile.UpdatedAt = time.Now().UTC()
+	m.repo.PutProfile(*profile)
+
+	return profile, nil
+}
+
+func (m *MerchantsServiceImpl) DeleteProfile(merchantID string) error {
+	return m.repo.DeleteProfile(merchantID)
+}
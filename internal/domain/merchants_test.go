@@ -0,0 +1,115 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func profilePayment(amount int, currency string) *models.PostPaymentHandlerRequest {
+	return &models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    currency,
+		Amount:      amount,
+		Cvv:         123,
+		MerchantID:  "merchant-1",
+	}
+}
+
+func TestPostPayment_MerchantProfile(t *testing.T) {
+	merchants := repository.NewMerchantsRepository()
+	_, err := domain.NewMerchantsServiceImpl(merchants).PutProfile(&models.MerchantProfile{
+		MerchantID:   "merchant-1",
+		AmountLimits: map[string]models.AmountLimit{"GBP": {Min: 100, Max: 1000}},
+		Currencies:   []string{"GBP", "EUR"},
+		CardSchemes:  []string{"mastercard"},
+		CaptureMode:  models.CaptureManual,
+	}, "alice")
+	require.NoError(t, err)
+
+	visa := profilePayment(500, "GBP")
+	visa.CardNumber = 4111111111111111
+
+	tests := []struct {
+		name    string
+		request *models.PostPaymentHandlerRequest
+		code    string
+	}{
+		{name: "below minimum", request: profilePayment(99, "GBP"), code: domain.ErrorCodeAmountBelowMinimum},
+		{name: "above maximum", request: profilePayment(1001, "GBP"), code: domain.ErrorCodeAmountAboveMaximum},
+		{name: "currency", request: profilePayment(500, "USD"), code: domain.ErrorCodeCurrencyNotAllowed},
+		{name: "card scheme", request: visa, code: domain.ErrorCodeCardSchemeNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mocks.NewMockClient(ctrl), domain.WithMerchantProfiles(merchants))
+
+			_, err := service.Create(tt.request)
+
+			var profileErr *gatewayerrors.ProfileError
+			require.True(t, errors.As(err, &profileErr))
+			assert.Equal(t, tt.code, profileErr.Code)
+		})
+	}
+
+	t.Run("allowed payment takes the capture mode", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		mockClient := mocks.NewMockClient(ctrl)
+		mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+		service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient, domain.WithMerchantProfiles(merchants))
+
+		response, err := service.Create(profilePayment(500, "EUR"))
+		require.NoError(t, err)
+		assert.Equal(t, models.CaptureManual, response.CaptureMode)
+	})
+}
+
+func TestPostPayment_DailyVolumeCap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	merchants := repository.NewMerchantsRepository()
+	_, err := domain.NewMerchantsServiceImpl(merchants).PutProfile(&models.MerchantProfile{
+		MerchantID:      "merchant-1",
+		DailyVolumeCaps: map[string]int{"GBP": 1000},
+	}, "alice")
+	require.NoError(t, err)
+	service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient, domain.WithMerchantProfiles(merchants))
+
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+	_, err = service.Create(profilePayment(600, "GBP"))
+	require.NoError(t, err)
+
+	// a decline gives its volume back
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: false}, nil)
+	response, err := service.Create(profilePayment(400, "GBP"))
+	require.NoError(t, err)
+	assert.Equal(t, "declined", response.PaymentStatus)
+
+	_, err = service.Create(profilePayment(401, "GBP"))
+	var profileErr *gatewayerrors.ProfileError
+	require.True(t, errors.As(err, &profileErr))
+	assert.Equal(t, domain.ErrorCodeDailyVolumeExceeded, profileErr.Code)
+
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+	_, err = service.Create(profilePayment(400, "GBP"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1000, merchants.Volume("merchant-1", "GBP", time.Now().UTC().Format(time.DateOnly)))
+}
@@ -0,0 +1,181 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultLinkTTL is how long a payment link can be used when the merchant gives no expiry.
+	DefaultLinkTTL = 24 * time.Hour
+	maxLinkTTL     = 30 * 24 * time.Hour
+)
+
+type PaymentLinksService interface {
+	CreateLink(request *models.PaymentLinkRequest) (*models.PaymentLink, error)
+	GetLink(id string) *models.PaymentLink
+	Pay(id string, card models.HostedCard) (*models.PaymentLink, *models.PostPaymentResponse, error)
+	CompleteAuthentication(id string) (*models.PaymentLink, *models.PostPaymentResponse, error)
+}
+
+type PaymentLinksServiceImpl struct {
+	payments       PaymentService
+	authentication ThreeDSService
+	links          *repository.PaymentLinksRepository
+	baseURL        string
+	now            func() time.Time
+}
+
+// NewPaymentLinksServiceImpl makes links to the hosted payment page served under baseURL, payments that
+// need 3-D Secure are completed through authentication.
+func NewPaymentLinksServiceImpl(payments PaymentService, authentication ThreeDSService, links *repository.PaymentLinksRepository, baseURL string) *PaymentLinksServiceImpl {
+	return &PaymentLinksServiceImpl{
+		payments:       payments,
+		authentication: authentication,
+		links:          links,
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		now:            time.Now,
+	}
+}
+
+// WithClock swaps the clock used for expiry, handy for tests.
+func (l *PaymentLinksServiceImpl) WithClock(now func() time.Time) *PaymentLinksServiceImpl {
+	l.now = now
+	return l
+}
+
+// PageURL is where the shopper pays the link.
+func (l *PaymentLinksServiceImpl) PageURL(id string) string {
+	return fmt.Sprintf("%s/pay/%s", l.baseURL, id)
+}
+
+func (l *PaymentLinksServiceImpl) CreateLink(request *models.PaymentLinkRequest) (*models.PaymentLink, error) {
+	id := uuid.New().String()
+	if err := validateCurrencyISO(request.Currency, id); err != nil {
+		return nil, err
+	}
+	if err := validateAmount(request.Amount, id); err != nil {
+		return nil, err
+	}
+	if err := validateRedirectURL(request.SuccessURL, id, "success_url"); err != nil {
+		return nil, err
+	}
+	if err := validateRedirectURL(request.FailureURL, id, "failure_url"); err != nil {
+		return nil, err
+	}
+
+	now := l.now().UTC()
+	expiresAt := now.Add(DefaultLinkTTL)
+	if request.ExpiresAt != nil {
+		expiresAt = request.ExpiresAt.UTC()
+		if !expiresAt.After(now) || expiresAt.Sub(now) > maxLinkTTL {
+			return nil, gatewayerrors.NewValidationError(errors.New("expiry must be in the next 30 days"), id, "expires_at")
+		}
+	}
+
+	link := models.PaymentLink{
+		Id:          id,
+		MerchantID:  request.MerchantID,
+		Status:      models.PaymentLinkActive,
+		URL:         l.PageURL(id),
+		Amount:      request.Amount,
+		Currency:    request.Currency,
+		Description: request.Description,
+		SuccessURL:  request.SuccessURL,
+		FailureURL:  request.FailureURL,
+		ExpiresAt:   expiresAt,
+		CreatedAt:   now,
+	}
+	l.links.AddLink(link)
+	return &link, nil
+}
+
+func (l *PaymentLinksServiceImpl) GetLink(id string) *models.PaymentLink {
+	return l.links.GetLink(id, l.now())
+}
+
+// Pay makes the link's payment with the card the shopper entered.  A link only ever makes one payment,
+// whatever its outcome, but a card that is rejected before reaching the bank leaves the link for the
+// shopper to try again.  Any other error keeps the link claimed, the bank may have taken the payment.
+func (l *PaymentLinksServiceImpl) Pay(id string, card models.HostedCard) (*models.PaymentLink, *models.PostPaymentResponse, error) {
+	link, err := l.links.ClaimLink(id, l.now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payment, err := l.payments.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:  card.CardNumber,
+		ExpiryMonth: card.ExpiryMonth,
+		ExpiryYear:  card.ExpiryYear,
+		Cvv:         card.Cvv,
+		Currency:    link.Currency,
+		Amount:      link.Amount,
+		MerchantID:  link.MerchantID,
+		ClientIP:    card.ClientIP,
+		ReturnURL:   l.PageURL(id) + "/return",
+	})
+	if err != nil {
+		var validationErr *gatewayerrors.ValidationError
+		var profileErr *gatewayerrors.ProfileError
+		if errors.As(err, &validationErr) || errors.As(err, &profileErr) {
+			l.links.ReleaseLink(id)
+		}
+		return link, nil, err
+	}
+
+	return l.links.CompleteLink(id, payment.Id, l.now().UTC()), payment, nil
+}
+
+// CompleteAuthentication resumes the link's payment when the shopper comes back from 3-D Secure.
+func (l *PaymentLinksServiceImpl) CompleteAuthentication(id string) (*models.PaymentLink, *models.PostPaymentResponse, error) {
+	link := l.links.GetLink(id, l.now())
+	if link == nil || link.PaymentId == "" {
+		return nil, nil, repository.ErrPaymentLinkNotFound
+	}
+	if l.authentication == nil {
+		return link, nil, ErrNotPendingAuthentication
+	}
+
+	payment, err := l.authentication.CompleteAuthentication(link.PaymentId)
+	if err != nil {
+		return link, nil, err
+	}
+	return link, payment, nil
+}
+
+// LinkResultURL is where the shopper is sent once the link's payment has an outcome.
+func LinkResultURL(link *models.PaymentLink, payment *models.PostPaymentResponse) string {
+	target := link.FailureURL
+	if payment != nil && payment.PaymentStatus == "authorized" {
+		target = link.SuccessURL
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	query := u.Query()
+	query.Set("payment_link_id", link.Id)
+	if payment != nil {
+		query.Set("payment_id", payment.Id)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func validateRedirectURL(value, id, field string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return gatewayerrors.NewValidationError(errors.New("must be an absolute http or https URL"), id, field)
+	}
+	return nil
+}
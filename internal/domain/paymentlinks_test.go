@@ -0,0 +1,150 @@
+package domain_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func linkRequest() *models.PaymentLinkRequest {
+	return &models.PaymentLinkRequest{
+		Amount:     2500,
+		Currency:   "GBP",
+		SuccessURL: "https://shop.example.com/thanks",
+		FailureURL: "https://shop.example.com/sorry",
+		MerchantID: "merchant-1",
+	}
+}
+
+func hostedCard() models.HostedCard {
+	return models.HostedCard{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Cvv:         123,
+	}
+}
+
+func newPaymentLinksService(mockClient *mocks.MockClient, clock *fakeClock) *domain.PaymentLinksServiceImpl {
+	payments := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient)
+	return domain.NewPaymentLinksServiceImpl(payments, payments, repository.NewPaymentLinksRepository(), "https://pay.example.com/").WithClock(clock.Now)
+}
+
+func TestPaymentLinks_CreateValidation(t *testing.T) {
+	clock := &fakeClock{now: time.Now().UTC()}
+	service := newPaymentLinksService(nil, clock)
+
+	tests := map[string]struct {
+		modify func(*models.PaymentLinkRequest)
+		field  string
+	}{
+		"relative success url": {func(r *models.PaymentLinkRequest) { r.SuccessURL = "/thanks" }, "success_url"},
+		"script failure url":   {func(r *models.PaymentLinkRequest) { r.FailureURL = "javascript:alert(1)" }, "failure_url"},
+		"expiry in the past": {func(r *models.PaymentLinkRequest) {
+			past := clock.now.Add(-time.Minute)
+			r.ExpiresAt = &past
+		}, "expires_at"},
+		"expiry too far out": {func(r *models.PaymentLinkRequest) {
+			later := clock.now.Add(31 * 24 * time.Hour)
+			r.ExpiresAt = &later
+		}, "expires_at"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			request := linkRequest()
+			tt.modify(request)
+			_, err := service.CreateLink(request)
+			var validationErr *gatewayerrors.ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, tt.field, validationErr.GetFieldError())
+		})
+	}
+
+	link, err := service.CreateLink(linkRequest())
+	require.NoError(t, err)
+	assert.Equal(t, "https://pay.example.com/pay/"+link.Id, link.URL)
+	assert.Equal(t, models.PaymentLinkActive, link.Status)
+	assert.Equal(t, clock.now.Add(domain.DefaultLinkTTL), link.ExpiresAt)
+}
+
+func TestPaymentLinks_SingleUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+		assert.Equal(t, 2500, request.Amount)
+		assert.Equal(t, "GBP", request.Currency)
+		return &models.PostPaymentBankResponse{Authorised: true}, nil
+	})
+
+	clock := &fakeClock{now: time.Now().UTC()}
+	service := newPaymentLinksService(mockClient, clock)
+	link, err := service.CreateLink(linkRequest())
+	require.NoError(t, err)
+
+	// a card that fails validation leaves the link open for another go
+	bad := hostedCard()
+	bad.ExpiryMonth = 13
+	_, _, err = service.Pay(link.Id, bad)
+	var validationErr *gatewayerrors.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, models.PaymentLinkActive, service.GetLink(link.Id).Status)
+
+	paid, payment, err := service.Pay(link.Id, hostedCard())
+	require.NoError(t, err)
+	assert.Equal(t, "authorized", payment.PaymentStatus)
+	assert.Equal(t, models.PaymentLinkCompleted, paid.Status)
+	assert.Equal(t, payment.Id, paid.PaymentId)
+
+	result, err := url.Parse(domain.LinkResultURL(paid, payment))
+	require.NoError(t, err)
+	assert.Equal(t, "/thanks", result.Path)
+	assert.Equal(t, payment.Id, result.Query().Get("payment_id"))
+
+	_, _, err = service.Pay(link.Id, hostedCard())
+	assert.ErrorIs(t, err, repository.ErrPaymentLinkUsed)
+}
+
+func TestPaymentLinks_BankErrorKeepsLink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(nil, gatewayerrors.NewBankError(errors.New("timeout"), http.StatusGatewayTimeout))
+
+	service := newPaymentLinksService(mockClient, &fakeClock{now: time.Now().UTC()})
+	link, err := service.CreateLink(linkRequest())
+	require.NoError(t, err)
+
+	// the bank may have taken the payment, so the shopper cannot pay again
+	_, _, err = service.Pay(link.Id, hostedCard())
+	require.Error(t, err)
+	assert.Equal(t, models.PaymentLinkProcessing, service.GetLink(link.Id).Status)
+	_, _, err = service.Pay(link.Id, hostedCard())
+	assert.ErrorIs(t, err, repository.ErrPaymentLinkUsed)
+}
+
+func TestPaymentLinks_Expiry(t *testing.T) {
+	clock := &fakeClock{now: time.Now().UTC()}
+	service := newPaymentLinksService(nil, clock)
+	link, err := service.CreateLink(linkRequest())
+	require.NoError(t, err)
+
+	clock.now = link.ExpiresAt.Add(time.Second)
+	assert.Equal(t, models.PaymentLinkExpired, service.GetLink(link.Id).Status)
+	_, _, err = service.Pay(link.Id, hostedCard())
+	assert.ErrorIs(t, err, repository.ErrPaymentLinkExpired)
+
+	_, _, err = service.Pay("missing", hostedCard())
+	assert.ErrorIs(t, err, repository.ErrPaymentLinkNotFound)
+}
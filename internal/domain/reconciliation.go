@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"io"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/reconciliation"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type ReconciliationRequest struct {
+	Format   string
+	Acquirer string
+	From     *time.Time
+	To       *time.Time
+}
+
+type ReconciliationService interface {
+	Reconcile(file io.Reader, request ReconciliationRequest) (*models.ReconciliationReport, error)
+}
+
+type ReconciliationServiceImpl struct {
+	payments *repository.PaymentsRepository
+	reports  *repository.ReconciliationsRepository
+}
+
+func NewReconciliationServiceImpl(payments *repository.PaymentsRepository, reports *repository.ReconciliationsRepository) *ReconciliationServiceImpl {
+	return &ReconciliationServiceImpl{
+		payments: payments,
+		reports:  reports,
+	}
+}
+
+// Reconcile parses an acquirer settlement file and matches it against the authorised payments of that acquirer
+// created between From (inclusive) and To (exclusive).
+func (s *ReconciliationServiceImpl) Reconcile(file io.Reader, request ReconciliationRequest) (*models.ReconciliationReport, error) {
+	id := uuid.New().String()
+
+	lines, err := reconciliation.Parse(file, request.Format)
+	if err != nil {
+		return nil, gatewayerrors.NewValidationError(err, id, "file")
+	}
+
+	expected := []models.PostPaymentResponse{}
+	err = s.payments.ForEachPayment(func(payment models.PostPaymentResponse) error {
+		if payment.PaymentStatus != "authorized" {
+			return nil
+		}
+		if request.Acquirer != "" && payment.Acquirer != request.Acquirer {
+			return nil
+		}
+		if request.From != nil && payment.CreatedAt.Before(*request.From) {
+			return nil
+		}
+		if request.To != nil && !payment.CreatedAt.Before(*request.To) {
+			return nil
+		}
+		expected = append(expected, payment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := reconciliation.Reconcile(lines, expected)
+	report.Id = id
+	report.Acquirer = request.Acquirer
+	report.From = request.From
+	report.To = request.To
+	report.CreatedAt = time.Now().UTC()
+
+	s.reports.AddReport(report)
+	return &report, nil
+}
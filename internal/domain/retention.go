@@ -0,0 +1,294 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/risk"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/velocity"
+)
+
+// minRetentionDays keeps payments around until they are settled and the schemes no longer allow a
+// chargeback, which can come in up to about 120 days after the payment.
+const minRetentionDays = 120
+
+// ErrErasurePending refuses an erasure while one of the card's payments is still going, its card
+// details are in the queue journal or waiting for 3-D Secure and would be written back once it is done.
+var ErrErasurePending = errors.New("the card has payments that are still pending, try again once they are done")
+
+func validateRetention(policy *models.RetentionPolicy, id string) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.Days < minRetentionDays {
+		return gatewayerrors.NewValidationError(fmt.Errorf("payments must be retained for at least %d days", minRetentionDays), id, "retention.days")
+	}
+	switch policy.Action {
+	case "":
+		policy.Action = models.RetentionAnonymise
+	case models.RetentionAnonymise, models.RetentionDelete:
+	default:
+		return gatewayerrors.NewValidationError(errors.New("retention action must be anonymise or delete"), id, "retention.action")
+	}
+	return nil
+}
+
+// anonymise scrubs everything that identifies the card holder from payment and leaves what the books need.
+func anonymise(payment models.PostPaymentResponse) models.PostPaymentResponse {
+	payment.CardNumberLastFour = 0
+	payment.ExpiryMonth = 0
+	payment.ExpiryYear = 0
+	payment.CardFingerprint = ""
+	payment.NetworkTransactionId = ""
+	payment.ThreeDSTransactionId = ""
+	payment.ChallengeURL = ""
+	return payment
+}
+
+type RetentionService interface {
+	// ApplyRetention anonymises or deletes the payments past their merchant's retention policy.
+	ApplyRetention(dryRun bool, actor string) (*models.RetentionReport, error)
+	Erase(request *models.ErasureRequest, actor string) (*models.ErasureReport, error)
+}
+
+type RetentionServiceImpl struct {
+	mu        sync.Mutex
+	payments  *repository.PaymentsRepository
+	merchants *repository.MerchantsRepository
+	disputes  *repository.DisputesRepository
+	audit     *audit.Log
+	now       func() time.Time
+	// fingerprintKey has to be the one the payments were made with to erase by card number
+	fingerprintKey []byte
+
+	// the rest of what is kept about a card, see WithCardData
+	subscriptions *SubscriptionServiceImpl
+	lists         *repository.ListsRepository
+	limiter       *velocity.Limiter
+	riskEngine    *risk.Engine
+}
+
+func NewRetentionServiceImpl(payments *repository.PaymentsRepository, merchants *repository.MerchantsRepository) *RetentionServiceImpl {
+	return &RetentionServiceImpl{
+		payments:       payments,
+		merchants:      merchants,
+		now:            time.Now,
+		fingerprintKey: randomFingerprintKey(),
+	}
+}
+
+// WithClock swaps the clock used to work out which payments are past retention, handy for tests.
+func (s *RetentionServiceImpl) WithClock(now func() time.Time) *RetentionServiceImpl {
+	s.now = now
+	return s
+}
+
+// WithFingerprintKey is the key of the payment service, see WithFingerprintKey there.
+func (s *RetentionServiceImpl) WithFingerprintKey(key []byte) *RetentionServiceImpl {
+	s.fingerprintKey = key
+	return s
+}
+
+// WithCardData lets erasures reach the card's subscriptions, list entries and the velocity and risk
+// state kept by its fingerprint.  Any of them can be nil.
+func (s *RetentionServiceImpl) WithCardData(
+	subscriptions *SubscriptionServiceImpl,
+	lists *repository.ListsRepository,
+	limiter *velocity.Limiter,
+	riskEngine *risk.Engine,
+) *RetentionServiceImpl {
+	s.subscriptions = subscriptions
+	s.lists = lists
+	s.limiter = limiter
+	s.riskEngine = riskEngine
+	return s
+}
+
+// WithDisputes leaves the payments with an open dispute alone until it is won or lost, the merchant
+// still needs them to answer it.
+func (s *RetentionServiceImpl) WithDisputes(disputes *repository.DisputesRepository) *RetentionServiceImpl {
+	s.disputes = disputes
+	return s
+}
+
+// WithAudit records every payment anonymised, deleted or erased in the audit log.
+func (s *RetentionServiceImpl) WithAudit(auditLog *audit.Log) *RetentionServiceImpl {
+	s.audit = auditLog
+	return s
+}
+
+func (s *RetentionServiceImpl) ApplyRetention(dryRun bool, actor string) (*models.RetentionReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC()
+	policies := map[string]models.RetentionPolicy{}
+	for _, profile := range s.merchants.ListProfiles() {
+		if profile.Retention != nil {
+			policies[profile.MerchantID] = *profile.Retention
+		}
+	}
+
+	disputed := map[string]bool{}
+	if s.disputes != nil {
+		disputed = s.disputes.OpenPaymentIds()
+	}
+
+	report := &models.RetentionReport{DryRun: dryRun, RunAt: now, Anonymised: []string{}, Deleted: []string{}}
+	err := s.payments.ForEachPayment(func(payment models.PostPaymentResponse) error {
+		policy, ok := policies[payment.MerchantID]
+		if !ok || !payment.CreatedAt.Before(now.AddDate(0, 0, -policy.Days)) || disputed[payment.Id] {
+			return nil
+		}
+		switch {
+		case policy.Action == models.RetentionDelete:
+			report.Deleted = append(report.Deleted, payment.Id)
+		case payment.AnonymisedAt == nil:
+			report.Anonymised = append(report.Anonymised, payment.Id)
+		}
+		return nil
+	})
+	if err != nil || dryRun {
+		return report, err
+	}
+
+	for _, id := range report.Anonymised {
+		s.anonymise(id, now, "payment.anonymised", actor)
+	}
+	for _, id := range report.Deleted {
+		if s.payments.DeletePayment(id) {
+			recordChange(s.audit, audit.Change{Actor: actor, Resource: "payment", ResourceID: id})
+		}
+	}
+	return report, nil
+}
+
+// Erase scrubs the card holder's personal data from their payments and subscriptions.  Amounts,
+// currencies and statuses are kept so the merchant's totals and settlements do not change.  List
+// entries and the velocity and risk state are shared by every merchant, so they are only erased when
+// the erasure is not limited to one.
+func (s *RetentionServiceImpl) Erase(request *models.ErasureRequest, actor string) (*models.ErasureReport, error) {
+	fingerprint := request.CardFingerprint
+	switch {
+	case request.CardNumber != "" && fingerprint != "":
+		return nil, gatewayerrors.NewValidationError(errors.New("give either a card number or a card fingerprint"), "", "card_number")
+	case request.CardNumber != "":
+		fingerprint = cardFingerprint(s.fingerprintKey, request.CardNumber)
+	case fingerprint == "":
+		return nil, gatewayerrors.NewValidationError(errors.New("missing card number or card fingerprint"), "", "card_number")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &models.ErasureReport{
+		DryRun:          request.DryRun,
+		ErasedAt:        s.now().UTC(),
+		PaymentIds:      []string{},
+		SubscriptionIds: []string{},
+		ListEntryIds:    []string{},
+	}
+	pending := false
+	err := s.payments.ForEachPayment(func(payment models.PostPaymentResponse) error {
+		if payment.CardFingerprint == fingerprint && (request.MerchantID == "" || payment.MerchantID == request.MerchantID) {
+			report.PaymentIds = append(report.PaymentIds, payment.Id)
+			pending = pending || payment.PaymentStatus == "processing" || payment.PaymentStatus == "pending_authentication"
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrErasurePending
+	}
+
+	if s.subscriptions != nil {
+		report.SubscriptionIds = s.subscriptions.EraseCard(report.PaymentIds, request.DryRun)
+	}
+	global := request.MerchantID == ""
+	if global && s.lists != nil {
+		for _, entry := range s.lists.ListEntries("") {
+			if entry.Type == models.ListEntryCardFingerprint && entry.Value == fingerprint {
+				report.ListEntryIds = append(report.ListEntryIds, entry.Id)
+			}
+		}
+	}
+	if request.DryRun {
+		return report, nil
+	}
+
+	for _, id := range report.PaymentIds {
+		s.anonymise(id, report.ErasedAt, "payment.erased", actor)
+	}
+	for _, id := range report.SubscriptionIds {
+		recordChange(s.audit, audit.Change{Actor: actor, Action: "subscription.erased", Resource: "subscription", ResourceID: id})
+	}
+	if global {
+		s.forget(fingerprint, report, actor)
+	}
+	return report, nil
+}
+
+// forget drops the card from the state every merchant shares.
+func (s *RetentionServiceImpl) forget(fingerprint string, report *models.ErasureReport, actor string) {
+	if s.lists != nil {
+		for _, id := range report.ListEntryIds {
+			if err := s.lists.DeleteEntry(id, actor, report.ErasedAt); err == nil {
+				recordChange(s.audit, audit.Change{Actor: actor, Action: "list_entry.erased", Resource: "list_entry", ResourceID: id})
+			}
+		}
+		s.lists.ForgetValue(models.ListEntryCardFingerprint, fingerprint)
+	}
+	if s.limiter != nil {
+		if err := s.limiter.Forget(fingerprint); err != nil {
+			log.Printf("could not erase the velocity state of a card: %v", err)
+		}
+	}
+	if s.riskEngine != nil {
+		s.riskEngine.Forget(fingerprint)
+	}
+}
+
+func (s *RetentionServiceImpl) anonymise(id string, now time.Time, action, actor string) {
+	anonymised, err := s.payments.ModifyPayment(id, func(payment *models.PostPaymentResponse) error {
+		*payment = anonymise(*payment)
+		payment.AnonymisedAt = &now
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	change := paymentChange(*anonymised, action)
+	change.Actor = actor
+	recordChange(s.audit, change)
+}
+
+// Run applies the retention policies every interval until ctx is cancelled.
+func (s *RetentionServiceImpl) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.ApplyRetention(false, audit.ActorSystem)
+		if err != nil {
+			log.Printf("retention run failed: %v", err)
+		} else if len(report.Anonymised)+len(report.Deleted) > 0 {
+			log.Printf("retention anonymised %d and deleted %d payments", len(report.Anonymised), len(report.Deleted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/risk"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/velocity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func retentionPayment(id, merchantID, fingerprint string, createdAt time.Time) models.PostPaymentResponse {
+	return models.PostPaymentResponse{
+		Id:                   id,
+		PaymentStatus:        "authorized",
+		MerchantID:           merchantID,
+		CardNumberLastFour:   8877,
+		ExpiryMonth:          4,
+		ExpiryYear:           2030,
+		CardFingerprint:      fingerprint,
+		CardScheme:           "visa",
+		NetworkTransactionId: "nti-" + id,
+		Currency:             "GBP",
+		Amount:               1000,
+		CreatedAt:            createdAt,
+	}
+}
+
+func TestRetention_ApplyRetention(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)}
+	payments := repository.NewPaymentsRepository()
+	old := clock.now.AddDate(0, 0, -200)
+	payments.AddPayment(retentionPayment("anonymise-old", "merchant-1", "fp-1", old))
+	payments.AddPayment(retentionPayment("anonymise-new", "merchant-1", "fp-1", clock.now.AddDate(0, 0, -10)))
+	payments.AddPayment(retentionPayment("delete-old", "merchant-2", "fp-2", old))
+	payments.AddPayment(retentionPayment("keep-forever", "merchant-3", "fp-3", old))
+	payments.AddPayment(retentionPayment("disputed", "merchant-2", "fp-2", old))
+	payments.AddPayment(retentionPayment("dispute-lost", "merchant-2", "fp-2", old))
+	disputes := repository.NewDisputesRepository()
+	disputes.AddDispute(models.Dispute{Id: "dispute-1", PaymentId: "disputed", Status: models.DisputeUnderReview})
+	disputes.AddDispute(models.Dispute{Id: "dispute-2", PaymentId: "dispute-lost", Status: models.DisputeLost})
+
+	merchants := repository.NewMerchantsRepository()
+	merchantsService := domain.NewMerchantsServiceImpl(merchants)
+	_, err := merchantsService.PutProfile(&models.MerchantProfile{MerchantID: "merchant-1", Retention: &models.RetentionPolicy{Days: 180}}, "admin")
+	require.NoError(t, err)
+	_, err = merchantsService.PutProfile(&models.MerchantProfile{MerchantID: "merchant-2", Retention: &models.RetentionPolicy{Days: 180, Action: models.RetentionDelete}}, "admin")
+	require.NoError(t, err)
+
+	auditLog := audit.NewLog()
+	service := domain.NewRetentionServiceImpl(payments, merchants).WithClock(clock.Now).WithAudit(auditLog).WithDisputes(disputes)
+
+	report, err := service.ApplyRetention(true, "admin")
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{"anonymise-old"}, report.Anonymised)
+	// the payment with an open dispute is kept until it is decided
+	assert.ElementsMatch(t, []string{"delete-old", "dispute-lost"}, report.Deleted)
+	// a dry run changes nothing
+	assert.Equal(t, "fp-1", payments.GetPayment("anonymise-old").CardFingerprint)
+	assert.NotNil(t, payments.GetPayment("delete-old"))
+	entries, err := auditLog.Entries(audit.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	report, err = service.ApplyRetention(false, audit.ActorSystem)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"anonymise-old"}, report.Anonymised)
+
+	anonymised := payments.GetPayment("anonymise-old")
+	assert.Empty(t, anonymised.CardFingerprint)
+	assert.Empty(t, anonymised.NetworkTransactionId)
+	assert.Zero(t, anonymised.CardNumberLastFour)
+	assert.Zero(t, anonymised.ExpiryYear)
+	assert.Equal(t, 1000, anonymised.Amount)
+	assert.Equal(t, "authorized", anonymised.PaymentStatus)
+	assert.Equal(t, clock.now, *anonymised.AnonymisedAt)
+	assert.Nil(t, payments.GetPayment("delete-old"))
+	assert.NotNil(t, payments.GetPayment("disputed"))
+	assert.Equal(t, "fp-1", payments.GetPayment("anonymise-new").CardFingerprint)
+	assert.Equal(t, "fp-3", payments.GetPayment("keep-forever").CardFingerprint)
+
+	entries, err = auditLog.Entries(audit.Query{Actor: audit.ActorSystem})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "payment.anonymised", entries[0].Action)
+	assert.Equal(t, "payment.deleted", entries[1].Action)
+	assert.Equal(t, "payment.deleted", entries[2].Action)
+
+	// payments already anonymised are left alone
+	report, err = service.ApplyRetention(false, audit.ActorSystem)
+	require.NoError(t, err)
+	assert.Empty(t, report.Anonymised)
+	assert.Empty(t, report.Deleted)
+}
+
+func TestRetention_InvalidPolicy(t *testing.T) {
+	merchantsService := domain.NewMerchantsServiceImpl(repository.NewMerchantsRepository())
+	for _, policy := range []models.RetentionPolicy{{Days: 90}, {Days: 180, Action: "shred"}} {
+		_, err := merchantsService.PutProfile(&models.MerchantProfile{MerchantID: "merchant-1", Retention: &policy}, "admin")
+		var validationError *gatewayerrors.ValidationError
+		assert.ErrorAs(t, err, &validationError)
+	}
+}
+
+func TestRetention_Erase(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)}
+	payments := repository.NewPaymentsRepository()
+	// the fingerprint of 2222405343248877 with the key below
+	fingerprint := "2769367e4ff1b6c1ec5adaaaf770d83fc11b2d3d9032c3d99c3b66e86a24c35a"
+	payments.AddPayment(retentionPayment("payment-1", "merchant-1", fingerprint, clock.now))
+	payments.AddPayment(retentionPayment("payment-2", "merchant-2", fingerprint, clock.now))
+	payments.AddPayment(retentionPayment("other-card", "merchant-1", "fp-other", clock.now))
+	service := domain.NewRetentionServiceImpl(payments, repository.NewMerchantsRepository()).
+		WithClock(clock.Now).
+		WithFingerprintKey([]byte("fingerprint-key"))
+
+	report, err := service.Erase(&models.ErasureRequest{CardFingerprint: fingerprint, MerchantID: "merchant-1", DryRun: true}, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"payment-1"}, report.PaymentIds)
+	assert.Equal(t, fingerprint, payments.GetPayment("payment-1").CardFingerprint)
+
+	report, err = service.Erase(&models.ErasureRequest{CardNumber: "2222405343248877"}, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"payment-1", "payment-2"}, report.PaymentIds)
+	for _, id := range report.PaymentIds {
+		payment := payments.GetPayment(id)
+		assert.Empty(t, payment.CardFingerprint)
+		assert.Equal(t, 1000, payment.Amount)
+	}
+	assert.Equal(t, "fp-other", payments.GetPayment("other-card").CardFingerprint)
+
+	_, err = service.Erase(&models.ErasureRequest{}, "admin")
+	var validationError *gatewayerrors.ValidationError
+	assert.ErrorAs(t, err, &validationError)
+}
+
+func TestRetention_EraseCardData(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)}
+	fingerprint := "fp-1"
+	payments := repository.NewPaymentsRepository()
+	payments.AddPayment(retentionPayment("payment-1", "merchant-1", fingerprint, clock.now))
+
+	subscriptionsRepo := repository.NewSubscriptionsRepository()
+	next := clock.now.AddDate(0, 1, 0)
+	subscriptionsRepo.AddSubscription(models.Subscription{
+		Id:                  "sub-1",
+		MerchantID:          "merchant-1",
+		Status:              models.SubscriptionActive,
+		CardNumber:          2222405343248877,
+		CardNumberLastFour:  8877,
+		ExpiryMonth:         4,
+		ExpiryYear:          2030,
+		NextChargeAt:        &next,
+		CredentialPaymentId: "payment-1",
+	})
+	subscriptions := domain.NewSubscriptionServiceImpl(nil, subscriptionsRepo, domain.DefaultDunningConfig()).WithClock(clock.Now)
+
+	lists := repository.NewListsRepository()
+	require.NoError(t, lists.AddEntry(models.ListEntry{Id: "entry-1", List: models.ListBlock, Type: models.ListEntryCardFingerprint, Value: fingerprint}))
+
+	limiter := velocity.NewLimiter(velocity.NewMemoryStore(), velocity.Limit{Scope: velocity.ScopeCard, Window: time.Hour, MaxCount: 1})
+	require.NoError(t, limiter.Allow(velocity.Attempt{CardFingerprint: fingerprint}))
+	riskEngine := risk.NewEngineWithRules(1, 2, risk.NewVelocityRule(1, time.Hour, 1))
+	riskEngine.Evaluate(risk.Input{CardFingerprint: fingerprint})
+
+	service := domain.NewRetentionServiceImpl(payments, repository.NewMerchantsRepository()).
+		WithClock(clock.Now).
+		WithCardData(subscriptions, lists, limiter, riskEngine)
+
+	report, err := service.Erase(&models.ErasureRequest{CardFingerprint: fingerprint}, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sub-1"}, report.SubscriptionIds)
+	assert.Equal(t, []string{"entry-1"}, report.ListEntryIds)
+
+	subscription := subscriptionsRepo.GetSubscription("sub-1")
+	assert.Equal(t, models.SubscriptionCancelled, subscription.Status)
+	assert.Zero(t, subscription.CardNumber)
+	assert.Zero(t, subscription.CardNumberLastFour)
+	assert.Nil(t, lists.GetEntry("entry-1"))
+	for _, entry := range lists.Audit() {
+		assert.Empty(t, entry.Entry.Value)
+	}
+	// the card starts over with the velocity limits and the risk rules
+	assert.NoError(t, limiter.Allow(velocity.Attempt{CardFingerprint: fingerprint}))
+	assert.Equal(t, risk.OutcomeAllow, riskEngine.Evaluate(risk.Input{CardFingerprint: fingerprint}).Outcome)
+}
+
+func TestRetention_ErasePending(t *testing.T) {
+	payments := repository.NewPaymentsRepository()
+	payment := retentionPayment("payment-1", "merchant-1", "fp-1", time.Now())
+	payment.PaymentStatus = "processing"
+	payments.AddPayment(payment)
+	service := domain.NewRetentionServiceImpl(payments, repository.NewMerchantsRepository())
+
+	// the worker would write the card details back once the bank answers
+	_, err := service.Erase(&models.ErasureRequest{CardFingerprint: "fp-1"}, "admin")
+	assert.ErrorIs(t, err, domain.ErrErasurePending)
+	assert.Equal(t, "fp-1", payments.GetPayment("payment-1").CardFingerprint)
+}
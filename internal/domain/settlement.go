@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/settlement"
+
+	"github.com/google/uuid"
+)
+
+type SettlementService interface {
+	RunBatches(day time.Time) ([]models.SettlementBatch, error)
+}
+
+type SettlementServiceImpl struct {
+	mu          sync.Mutex
+	payments    *repository.PaymentsRepository
+	settlements *repository.SettlementsRepository
+	fees        settlement.FeeSchedule
+	lastSettled time.Time
+	now         func() time.Time
+}
+
+func NewSettlementServiceImpl(payments *repository.PaymentsRepository, settlements *repository.SettlementsRepository, fees settlement.FeeSchedule) *SettlementServiceImpl {
+	return &SettlementServiceImpl{
+		payments:    payments,
+		settlements: settlements,
+		fees:        fees,
+		now:         time.Now,
+	}
+}
+
+// WithClock swaps the clock used to decide which days are due, handy for tests.
+func (s *SettlementServiceImpl) WithClock(now func() time.Time) *SettlementServiceImpl {
+	s.now = now
+	return s
+}
+
+// RunBatches settles what of the payments authorised up to the end of day is not in a batch yet, running
+// it twice for the same day only picks up what was missed or refunded since the first time.
+func (s *SettlementServiceImpl) RunBatches(day time.Time) ([]models.SettlementBatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.runBatches(day)
+}
+
+func (s *SettlementServiceImpl) runBatches(day time.Time) ([]models.SettlementBatch, error) {
+	payments := []models.PostPaymentResponse{}
+	err := s.payments.ForEachPayment(func(payment models.PostPaymentResponse) error {
+		payments = append(payments, payment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	batches := settlement.Build(payments, day, s.fees, s.settlements.Settled)
+	for i := range batches {
+		batches[i].Id = uuid.New().String()
+		batches[i].CreatedAt = s.now().UTC()
+		s.settlements.AddBatch(batches[i])
+	}
+	return batches, nil
+}
+
+// RunDue settles every day up to and including yesterday that has not been settled by this process yet.
+func (s *SettlementServiceImpl) RunDue() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC()
+	yesterday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -1)
+
+	day := yesterday
+	if !s.lastSettled.IsZero() {
+		day = s.lastSettled.AddDate(0, 0, 1)
+	}
+
+	for ; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+		batches, err := s.runBatches(day)
+		if err != nil {
+			return err
+		}
+		log.Printf("settled %s into %d batches", day.Format(time.DateOnly), len(batches))
+		s.lastSettled = day
+	}
+	return nil
+}
+
+// Run checks for due settlement days every interval until ctx is cancelled.
+func (s *SettlementServiceImpl) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunDue(); err != nil {
+			log.Printf("settlement run failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
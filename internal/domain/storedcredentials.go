@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"errors"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// isMerchantInitiated tells payments the customer is not present for, they carry no CVV and are out
+// of scope for strong customer authentication.
+func isMerchantInitiated(request *models.PostPaymentHandlerRequest) bool {
+	return request.Initiator == models.InitiatorMerchant
+}
+
+// storedCredential checks that the initiator and stored credential flags make sense together and finds
+// the network transaction id a subsequent payment has to send.  fingerprint is the card of the payment,
+// an earlier payment can only be used with the same card.
+func (p *PaymentServiceImpl) storedCredential(request *models.PostPaymentHandlerRequest, fingerprint, id string) (string, error) {
+	switch request.Initiator {
+	case "", models.InitiatorCustomer, models.InitiatorMerchant:
+	default:
+		return "", gatewayerrors.NewValidationError(errors.New("initiator must be customer or merchant"), id, "initiator")
+	}
+
+	switch request.StoredCredentialUsage {
+	case "", models.StoredCredentialFirst, models.StoredCredentialSubsequent:
+	default:
+		return "", gatewayerrors.NewValidationError(errors.New("stored credential usage must be first or subsequent"), id, "stored_credential_usage")
+	}
+
+	switch request.StoredCredentialReason {
+	case "", models.StoredCredentialRecurring, models.StoredCredentialInstallment, models.StoredCredentialUnscheduled:
+	default:
+		return "", gatewayerrors.NewValidationError(
+			errors.New("stored credential reason must be recurring, installment or unscheduled"),
+			id,
+			"stored_credential_reason",
+		)
+	}
+
+	if request.StoredCredentialReason != "" && request.StoredCredentialUsage == "" {
+		return "", gatewayerrors.NewValidationError(errors.New("a reason needs a stored credential usage"), id, "stored_credential_usage")
+	}
+
+	// the merchant can only start a payment with a card the customer agreed to have stored
+	if isMerchantInitiated(request) {
+		if request.StoredCredentialUsage != models.StoredCredentialSubsequent {
+			return "", gatewayerrors.NewValidationError(
+				errors.New("merchant initiated payments must be a subsequent use of a stored credential"),
+				id,
+				"stored_credential_usage",
+			)
+		}
+		if request.StoredCredentialReason == "" {
+			return "", gatewayerrors.NewValidationError(errors.New("merchant initiated payments need a reason"), id, "stored_credential_reason")
+		}
+	}
+
+	if request.StoredCredentialUsage != models.StoredCredentialSubsequent {
+		if request.PreviousPaymentId != "" || request.NetworkTransactionId != "" {
+			return "", gatewayerrors.NewValidationError(errors.New("only subsequent payments refer to an earlier one"), id, "previous_payment_id")
+		}
+		return "", nil
+	}
+
+	if request.PreviousPaymentId == "" {
+		if request.NetworkTransactionId == "" {
+			return "", gatewayerrors.NewValidationError(
+				errors.New("subsequent payments need a previous payment or a network transaction id"),
+				id,
+				"previous_payment_id",
+			)
+		}
+		// a made up network transaction id would skip the CVV and 3-D Secure, so only merchants moving
+		// their stored cards over may send one
+		if !p.credentialMigration(request.MerchantID) {
+			return "", gatewayerrors.NewValidationError(
+				errors.New("network transaction ids are only accepted from merchants migrating stored cards"),
+				id,
+				"network_transaction_id",
+			)
+		}
+		return request.NetworkTransactionId, nil
+	}
+
+	previous := p.repo.GetPayment(request.PreviousPaymentId)
+	if previous == nil || previous.MerchantID != request.MerchantID || previous.CardFingerprint != fingerprint {
+		return "", gatewayerrors.NewValidationError(errors.New("previous payment not found for this card"), id, "previous_payment_id")
+	}
+	// the customer has to have been there with the card once, a chain of merchant initiated payments
+	// proves nothing
+	if previous.Initiator != models.InitiatorCustomer {
+		return "", gatewayerrors.NewValidationError(errors.New("previous payment was not customer initiated"), id, "previous_payment_id")
+	}
+	if previous.PaymentStatus != "authorized" || previous.NetworkTransactionId == "" {
+		return "", gatewayerrors.NewValidationError(
+			errors.New("previous payment was not authorised with a network transaction id"),
+			id,
+			"previous_payment_id",
+		)
+	}
+	return previous.NetworkTransactionId, nil
+}
+
+// credentialMigration tells if the merchant's profile allows raw network transaction ids.
+func (p *PaymentServiceImpl) credentialMigration(merchantID string) bool {
+	if p.merchants == nil || merchantID == "" {
+		return false
+	}
+	profile := p.merchants.GetProfile(merchantID)
+	return profile != nil && profile.CredentialMigration
+}
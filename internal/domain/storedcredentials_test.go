@@ -0,0 +1,180 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/threeds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func storedCredentialPayment() *models.PostPaymentHandlerRequest {
+	return &models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "EUR",
+		Amount:      5000,
+		Cvv:         123,
+		MerchantID:  "merchant-1",
+	}
+}
+
+func TestPostPayment_StoredCredential(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+			assert.Equal(t, models.StoredCredentialFirst, request.StoredCredentialUsage)
+			assert.Empty(t, request.NetworkTransactionId)
+			return &models.PostPaymentBankResponse{Authorised: true, NetworkTransactionId: "ntid-1"}, nil
+		}),
+		mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+			assert.Equal(t, models.InitiatorMerchant, request.Initiator)
+			assert.Equal(t, models.StoredCredentialUnscheduled, request.StoredCredentialReason)
+			assert.Equal(t, "ntid-1", request.NetworkTransactionId)
+			assert.Empty(t, request.CVV)
+			return &models.PostPaymentBankResponse{Authorised: true, NetworkTransactionId: "ntid-2"}, nil
+		}),
+	)
+
+	// the first payment is challenged, merchant initiated ones cannot be
+	simulator := threeds.NewSimulator("http://gateway")
+	service := domain.NewPaymentServiceImpl(
+		repository.NewPaymentsRepository(),
+		mockClient,
+		domain.WithThreeDS(simulator, threeds.DefaultConfig(), "http://gateway"),
+	)
+
+	first := storedCredentialPayment()
+	first.StoredCredentialUsage = models.StoredCredentialFirst
+	first.StoredCredentialReason = models.StoredCredentialUnscheduled
+	pending, err := service.Create(first)
+	require.NoError(t, err)
+	require.Equal(t, "pending_authentication", pending.PaymentStatus)
+	_, err = simulator.Complete(pending.ThreeDSTransactionId, "1234")
+	require.NoError(t, err)
+	authorised, err := service.CompleteAuthentication(pending.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "ntid-1", authorised.NetworkTransactionId)
+	assert.Equal(t, models.InitiatorCustomer, authorised.Initiator)
+
+	subsequent := storedCredentialPayment()
+	subsequent.Cvv = 0
+	subsequent.Initiator = models.InitiatorMerchant
+	subsequent.StoredCredentialUsage = models.StoredCredentialSubsequent
+	subsequent.StoredCredentialReason = models.StoredCredentialUnscheduled
+	subsequent.PreviousPaymentId = authorised.Id
+	payment, err := service.Create(subsequent)
+	require.NoError(t, err)
+	assert.Equal(t, "authorized", payment.PaymentStatus)
+	// the network transaction id of the first payment is kept for the next ones
+	assert.Equal(t, "ntid-1", payment.NetworkTransactionId)
+
+	// only a customer initiated payment can be pointed at
+	subsequent.PreviousPaymentId = payment.Id
+	var validationError *gatewayerrors.ValidationError
+	_, err = service.Create(subsequent)
+	require.ErrorAs(t, err, &validationError)
+	assert.Equal(t, "previous_payment_id", validationError.GetFieldError())
+}
+
+func TestPostPayment_StoredCredentialMigration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+		assert.Equal(t, "ntid-external", request.NetworkTransactionId)
+		return &models.PostPaymentBankResponse{Authorised: true}, nil
+	})
+
+	merchants := repository.NewMerchantsRepository()
+	service := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient, domain.WithMerchantProfiles(merchants))
+
+	request := storedCredentialPayment()
+	request.Cvv = 0
+	request.Initiator = models.InitiatorMerchant
+	request.StoredCredentialUsage = models.StoredCredentialSubsequent
+	request.StoredCredentialReason = models.StoredCredentialRecurring
+	request.NetworkTransactionId = "ntid-external"
+
+	var validationError *gatewayerrors.ValidationError
+	_, err := service.Create(request)
+	require.ErrorAs(t, err, &validationError)
+	assert.Equal(t, "network_transaction_id", validationError.GetFieldError())
+
+	merchants.PutProfile(models.MerchantProfile{MerchantID: "merchant-1", CaptureMode: models.CaptureAuto, CredentialMigration: true})
+	payment, err := service.Create(request)
+	require.NoError(t, err)
+	assert.Equal(t, "authorized", payment.PaymentStatus)
+}
+
+func TestPostPayment_StoredCredentialValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := repository.NewPaymentsRepository()
+	repo.AddPayment(models.PostPaymentResponse{
+		Id:                   "other-merchant",
+		PaymentStatus:        "authorized",
+		MerchantID:           "merchant-2",
+		NetworkTransactionId: "ntid-1",
+	})
+	service := domain.NewPaymentServiceImpl(repo, mocks.NewMockClient(ctrl))
+
+	tests := []struct {
+		name   string
+		change func(request *models.PostPaymentHandlerRequest)
+		field  string
+	}{
+		{"UnknownInitiator", func(r *models.PostPaymentHandlerRequest) { r.Initiator = "shopper" }, "initiator"},
+		{"UnknownUsage", func(r *models.PostPaymentHandlerRequest) { r.StoredCredentialUsage = "second" }, "stored_credential_usage"},
+		{"UnknownReason", func(r *models.PostPaymentHandlerRequest) {
+			r.StoredCredentialUsage = models.StoredCredentialFirst
+			r.StoredCredentialReason = "subscription"
+		}, "stored_credential_reason"},
+		{"ReasonWithoutUsage", func(r *models.PostPaymentHandlerRequest) { r.StoredCredentialReason = models.StoredCredentialRecurring }, "stored_credential_usage"},
+		{"MerchantInitiatedFirst", func(r *models.PostPaymentHandlerRequest) {
+			r.Initiator = models.InitiatorMerchant
+			r.StoredCredentialUsage = models.StoredCredentialFirst
+			r.StoredCredentialReason = models.StoredCredentialRecurring
+		}, "stored_credential_usage"},
+		{"MerchantInitiatedWithoutReason", func(r *models.PostPaymentHandlerRequest) {
+			r.Initiator = models.InitiatorMerchant
+			r.StoredCredentialUsage = models.StoredCredentialSubsequent
+			r.NetworkTransactionId = "ntid-1"
+		}, "stored_credential_reason"},
+		{"CustomerInitiatedWithoutCVV", func(r *models.PostPaymentHandlerRequest) { r.Cvv = 0 }, "cvv"},
+		{"SubsequentWithoutReference", func(r *models.PostPaymentHandlerRequest) {
+			r.StoredCredentialUsage = models.StoredCredentialSubsequent
+		}, "previous_payment_id"},
+		{"FirstWithReference", func(r *models.PostPaymentHandlerRequest) {
+			r.StoredCredentialUsage = models.StoredCredentialFirst
+			r.NetworkTransactionId = "ntid-1"
+		}, "previous_payment_id"},
+		{"PreviousPaymentOfAnotherMerchant", func(r *models.PostPaymentHandlerRequest) {
+			r.StoredCredentialUsage = models.StoredCredentialSubsequent
+			r.PreviousPaymentId = "other-merchant"
+		}, "previous_payment_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := storedCredentialPayment()
+			tt.change(request)
+
+			var validationError *gatewayerrors.ValidationError
+			_, err := service.Create(request)
+			require.ErrorAs(t, err, &validationError)
+			assert.Equal(t, tt.field, validationError.GetFieldError())
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrSubscriptionTransition is returned when a subscription cannot go to the requested status,
+	// for instance resuming a cancelled one.
+	ErrSubscriptionTransition = errors.New("subscription cannot be changed from its current status")
+	// ErrCardNotVerified is returned when the bank did not accept the card a subscription was set up with.
+	ErrCardNotVerified = errors.New("card could not be verified")
+)
+
+// DunningConfig decides how declined renewals are retried.
+type DunningConfig struct {
+	// Retries are the delays before each retry of a declined charge, once they run out the
+	// subscription is left unpaid.
+	Retries []time.Duration
+	// SoftDeclines are the decline codes worth retrying, anything else leaves the subscription unpaid straight away.
+	SoftDeclines []string
+}
+
+func DefaultDunningConfig() DunningConfig {
+	return DunningConfig{
+		Retries:      []time.Duration{24 * time.Hour, 3 * 24 * time.Hour, 7 * 24 * time.Hour},
+		SoftDeclines: []string{DeclineInsufficientFunds, DeclineSoftDeclineRetryable},
+	}
+}
+
+func (d DunningConfig) isSoft(declineCode string) bool {
+	for _, code := range d.SoftDeclines {
+		if code == declineCode {
+			return true
+		}
+	}
+	return false
+}
+
+type SubscriptionService interface {
+	CreateSubscription(request *models.SubscriptionRequest) (*models.Subscription, error)
+	PauseSubscription(id string) (*models.Subscription, error)
+	ResumeSubscription(id string) (*models.Subscription, error)
+	CancelSubscription(id string) (*models.Subscription, error)
+}
+
+type SubscriptionServiceImpl struct {
+	mu            sync.Mutex
+	payments      PaymentService
+	subscriptions *repository.SubscriptionsRepository
+	dunning       DunningConfig
+	now           func() time.Time
+}
+
+func NewSubscriptionServiceImpl(payments PaymentService, subscriptions *repository.SubscriptionsRepository, dunning DunningConfig) *SubscriptionServiceImpl {
+	return &SubscriptionServiceImpl{
+		payments:      payments,
+		subscriptions: subscriptions,
+		dunning:       dunning,
+		now:           time.Now,
+	}
+}
+
+// WithClock swaps the clock used to schedule and make the charges, handy for tests.
+func (s *SubscriptionServiceImpl) WithClock(now func() time.Time) *SubscriptionServiceImpl {
+	s.now = now
+	return s
+}
+
+func (s *SubscriptionServiceImpl) CreateSubscription(request *models.SubscriptionRequest) (*models.Subscription, error) {
+	id := uuid.New().String()
+	if err := validateCardNumber(strconv.Itoa(request.CardNumber), id); err != nil {
+		return nil, err
+	}
+	if _, err := validateExpiryDate(request.ExpiryMonth, request.ExpiryYear, id); err != nil {
+		return nil, err
+	}
+	if err := validateCurrencyISO(request.Currency, id); err != nil {
+		return nil, err
+	}
+	if err := validateAmount(request.Amount, id); err != nil {
+		return nil, err
+	}
+	if err := validateCVV(request.Cvv, id); err != nil {
+		return nil, err
+	}
+
+	switch request.Interval {
+	case models.IntervalDay, models.IntervalWeek, models.IntervalMonth, models.IntervalYear:
+	default:
+		return nil, gatewayerrors.NewValidationError(errors.New("interval must be day, week, month or year"), id, "interval")
+	}
+	intervalCount := request.IntervalCount
+	if intervalCount == 0 {
+		intervalCount = 1
+	}
+	if intervalCount < 0 {
+		return nil, gatewayerrors.NewValidationError(errors.New("interval count must be positive"), id, "interval_count")
+	}
+	if request.TrialDays < 0 {
+		return nil, gatewayerrors.NewValidationError(errors.New("trial days must not be negative"), id, "trial_days")
+	}
+
+	now := s.now().UTC()
+	trialEnd := now.AddDate(0, 0, request.TrialDays)
+	anchor := trialEnd
+	if request.AnchorDate != nil {
+		anchor = request.AnchorDate.UTC()
+		if anchor.Before(trialEnd) {
+			return nil, gatewayerrors.NewValidationError(errors.New("anchor date is before the end of the trial"), id, "anchor_date")
+		}
+	}
+
+	cardNumber := strconv.Itoa(request.CardNumber)
+	lastFour, err := strconv.Atoi(getLastFourCharacters(cardNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	// the customer is here now, so the card is verified with its CVV once and every charge after that is
+	// merchant initiated and refers to the verification
+	verification, err := s.payments.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:             request.CardNumber,
+		ExpiryMonth:            request.ExpiryMonth,
+		ExpiryYear:             request.ExpiryYear,
+		Currency:               request.Currency,
+		Cvv:                    request.Cvv,
+		MerchantID:             request.MerchantID,
+		Initiator:              models.InitiatorCustomer,
+		StoredCredentialUsage:  models.StoredCredentialFirst,
+		StoredCredentialReason: models.StoredCredentialRecurring,
+		Verification:           true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if verification.PaymentStatus != "authorized" || verification.NetworkTransactionId == "" {
+		return nil, ErrCardNotVerified
+	}
+
+	subscription := models.Subscription{
+		Id:                 id,
+		MerchantID:         request.MerchantID,
+		Status:             models.SubscriptionActive,
+		Currency:           request.Currency,
+		Amount:             request.Amount,
+		Interval:           request.Interval,
+		IntervalCount:      intervalCount,
+		AnchorDate:         anchor,
+		CardNumberLastFour: lastFour,
+		ExpiryMonth:        request.ExpiryMonth,
+		ExpiryYear:         request.ExpiryYear,
+		NextChargeAt:       &anchor,
+		PaymentIds:         []string{},
+		CreatedAt:          now,
+
+		CardNumber:          request.CardNumber,
+		CredentialPaymentId: verification.Id,
+	}
+	if request.TrialDays > 0 {
+		subscription.Status = models.SubscriptionTrialing
+		subscription.TrialEnd = &trialEnd
+	}
+
+	s.subscriptions.AddSubscription(subscription)
+	return &subscription, nil
+}
+
+// PauseSubscription stops charging the subscription until it is resumed.
+func (s *SubscriptionServiceImpl) PauseSubscription(id string) (*models.Subscription, error) {
+	return s.update(id, func(subscription *models.Subscription, now time.Time) error {
+		switch subscription.Status {
+		case models.SubscriptionCancelled, models.SubscriptionPaused:
+			return ErrSubscriptionTransition
+		}
+		subscription.Status = models.SubscriptionPaused
+		subscription.PausedAt = &now
+		subscription.NextChargeAt = nil
+		return nil
+	})
+}
+
+// ResumeSubscription starts charging a paused or unpaid subscription again.  Cycles that fell inside
+// the pause are skipped rather than charged, an unpaid cycle is charged again straight away.
+func (s *SubscriptionServiceImpl) ResumeSubscription(id string) (*models.Subscription, error) {
+	return s.update(id, func(subscription *models.Subscription, now time.Time) error {
+		switch subscription.Status {
+		case models.SubscriptionUnpaid:
+			subscription.NextChargeAt = &now
+		case models.SubscriptionPaused:
+			for chargeDate(subscription, subscription.Cycle).Before(now) {
+				subscription.Cycle++
+			}
+			next := chargeDate(subscription, subscription.Cycle)
+			subscription.NextChargeAt = &next
+		default:
+			return ErrSubscriptionTransition
+		}
+		subscription.Status = models.SubscriptionActive
+		subscription.RetryCount = 0
+		subscription.PausedAt = nil
+		return nil
+	})
+}
+
+func (s *SubscriptionServiceImpl) CancelSubscription(id string) (*models.Subscription, error) {
+	return s.update(id, func(subscription *models.Subscription, now time.Time) error {
+		if subscription.Status == models.SubscriptionCancelled {
+			return ErrSubscriptionTransition
+		}
+		subscription.Status = models.SubscriptionCancelled
+		subscription.CancelledAt = &now
+		subscription.NextChargeAt = nil
+		return nil
+	})
+}
+
+// EraseCard cancels the subscriptions whose card was verified by one of the payments and scrubs their
+// card, for when the card holder asks to be erased.  It returns the ids of the subscriptions, with
+// dryRun they are only looked up.
+func (s *SubscriptionServiceImpl) EraseCard(paymentIds []string, dryRun bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC()
+	erased := []string{}
+	for _, subscription := range s.subscriptions.ListSubscriptions("") {
+		if !slices.Contains(paymentIds, subscription.CredentialPaymentId) {
+			continue
+		}
+		erased = append(erased, subscription.Id)
+		if dryRun {
+			continue
+		}
+		if subscription.Status != models.SubscriptionCancelled {
+			subscription.Status = models.SubscriptionCancelled
+			subscription.CancelledAt = &now
+			subscription.NextChargeAt = nil
+		}
+		subscription.CardNumber = 0
+		subscription.CardNumberLastFour = 0
+		subscription.ExpiryMonth = 0
+		subscription.ExpiryYear = 0
+		s.subscriptions.UpdateSubscription(subscription)
+	}
+	return erased
+}
+
+func (s *SubscriptionServiceImpl) update(id string, change func(subscription *models.Subscription, now time.Time) error) (*models.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription := s.subscriptions.GetSubscription(id)
+	if subscription == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err := change(subscription, s.now().UTC()); err != nil {
+		return nil, err
+	}
+	s.subscriptions.UpdateSubscription(*subscription)
+	return subscription, nil
+}
+
+// RunDue charges every subscription whose next charge is due.
+func (s *SubscriptionServiceImpl) RunDue() {
+	for _, id := range s.subscriptions.Due(s.now()) {
+		s.chargeDue(id)
+	}
+}
+
+// Run charges the due subscriptions every interval until ctx is cancelled.
+func (s *SubscriptionServiceImpl) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunDue()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SubscriptionServiceImpl) chargeDue(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC()
+	subscription := s.subscriptions.GetSubscription(id)
+	// paused or cancelled since Due was called
+	if subscription == nil || subscription.NextChargeAt == nil || subscription.NextChargeAt.After(now) {
+		return
+	}
+
+	request := &models.PostPaymentHandlerRequest{
+		CardNumber:             subscription.CardNumber,
+		ExpiryMonth:            subscription.ExpiryMonth,
+		ExpiryYear:             subscription.ExpiryYear,
+		Currency:               subscription.Currency,
+		Amount:                 subscription.Amount,
+		MerchantID:             subscription.MerchantID,
+		Initiator:              models.InitiatorMerchant,
+		StoredCredentialUsage:  models.StoredCredentialSubsequent,
+		StoredCredentialReason: models.StoredCredentialRecurring,
+		PreviousPaymentId:      subscription.CredentialPaymentId,
+	}
+
+	payment, err := s.payments.Create(request)
+	if payment != nil {
+		subscription.PaymentIds = append(subscription.PaymentIds, payment.Id)
+	}
+
+	switch {
+	case err == nil && payment.PaymentStatus == "authorized":
+		subscription.Status = models.SubscriptionActive
+		subscription.RetryCount = 0
+		subscription.Cycle++
+		next := chargeDate(subscription, subscription.Cycle)
+		subscription.NextChargeAt = &next
+	case s.retryable(payment, err) && subscription.RetryCount < len(s.dunning.Retries):
+		log.Printf("subscription %s charge declined, retrying: %v", id, err)
+		next := now.Add(s.dunning.Retries[subscription.RetryCount])
+		subscription.Status = models.SubscriptionPastDue
+		subscription.RetryCount++
+		subscription.NextChargeAt = &next
+	default:
+		log.Printf("subscription %s left unpaid: %v", id, err)
+		subscription.Status = models.SubscriptionUnpaid
+		subscription.NextChargeAt = nil
+	}
+
+	s.subscriptions.UpdateSubscription(*subscription)
+}
+
+// retryable tells soft declines and errors reaching the bank apart from declines that will not
+// go away, such as a stolen card or a card we refuse to charge.
+func (s *SubscriptionServiceImpl) retryable(payment *models.PostPaymentResponse, err error) bool {
+	if err != nil {
+		var bankErr *gatewayerrors.BankError
+		var limitErr *gatewayerrors.LimitError
+		return errors.As(err, &bankErr) || errors.As(err, &limitErr)
+	}
+	return payment.PaymentStatus == "declined" && s.dunning.isSoft(payment.DeclineCode)
+}
+
+// chargeDate is when cycle is due.  Monthly and yearly subscriptions anchored on a day some months do
+// not have are charged on the last day of those months.
+func chargeDate(subscription *models.Subscription, cycle int) time.Time {
+	anchor := subscription.AnchorDate
+	steps := cycle * subscription.IntervalCount
+	switch subscription.Interval {
+	case models.IntervalDay:
+		return anchor.AddDate(0, 0, steps)
+	case models.IntervalWeek:
+		return anchor.AddDate(0, 0, 7*steps)
+	case models.IntervalYear:
+		return addMonths(anchor, 12*steps)
+	default:
+		return addMonths(anchor, steps)
+	}
+}
+
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return first.AddDate(0, 0, day-1)
+}
@@ -0,0 +1,270 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func subscriptionRequest(interval string) *models.SubscriptionRequest {
+	return &models.SubscriptionRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Cvv:         123,
+		Currency:    "GBP",
+		Amount:      999,
+		Interval:    interval,
+		MerchantID:  "merchant-1",
+	}
+}
+
+func newSubscriptionService(t *testing.T, mockClient *mocks.MockClient, clock *fakeClock) (*domain.SubscriptionServiceImpl, *repository.SubscriptionsRepository) {
+	subscriptions := repository.NewSubscriptionsRepository()
+	payments := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient)
+	dunning := domain.DunningConfig{
+		Retries:      []time.Duration{time.Hour, 2 * time.Hour},
+		SoftDeclines: []string{domain.DeclineInsufficientFunds},
+	}
+	return domain.NewSubscriptionServiceImpl(payments, subscriptions, dunning).WithClock(clock.Now), subscriptions
+}
+
+// expectVerification expects the card check made when a subscription is created, with the CVV and
+// for no amount.
+func expectVerification(t *testing.T, mockClient *mocks.MockClient) *gomock.Call {
+	return mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+		assert.Equal(t, models.InitiatorCustomer, request.Initiator)
+		assert.Equal(t, models.StoredCredentialFirst, request.StoredCredentialUsage)
+		assert.Equal(t, "123", request.CVV)
+		assert.Equal(t, 0, request.Amount)
+		return &models.PostPaymentBankResponse{Authorised: true, NetworkTransactionId: "ntid-1"}, nil
+	})
+}
+
+func TestSubscription_ChargesOnSchedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	gomock.InOrder(
+		expectVerification(t, mockClient),
+		mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+			assert.Equal(t, models.InitiatorMerchant, request.Initiator)
+			assert.Equal(t, models.StoredCredentialSubsequent, request.StoredCredentialUsage)
+			assert.Equal(t, models.StoredCredentialRecurring, request.StoredCredentialReason)
+			assert.Equal(t, "ntid-1", request.NetworkTransactionId)
+			assert.Empty(t, request.CVV)
+			assert.Equal(t, 999, request.Amount)
+			return &models.PostPaymentBankResponse{Authorised: true, NetworkTransactionId: "ntid-2"}, nil
+		}).Times(2),
+	)
+
+	clock := &fakeClock{now: time.Now().UTC()}
+	service, subscriptions := newSubscriptionService(t, mockClient, clock)
+
+	request := subscriptionRequest(models.IntervalMonth)
+	request.TrialDays = 7
+	subscription, err := service.CreateSubscription(request)
+	require.NoError(t, err)
+	assert.Equal(t, models.SubscriptionTrialing, subscription.Status)
+
+	// nothing is due during the trial
+	service.RunDue()
+	assert.Empty(t, subscriptions.GetSubscription(subscription.Id).PaymentIds)
+
+	clock.now = clock.now.AddDate(0, 0, 7)
+	service.RunDue()
+	charged := subscriptions.GetSubscription(subscription.Id)
+	assert.Equal(t, models.SubscriptionActive, charged.Status)
+	assert.Len(t, charged.PaymentIds, 1)
+	assert.Equal(t, 1, charged.Cycle)
+	assert.True(t, charged.NextChargeAt.After(clock.now))
+
+	// running again before the next cycle does not charge twice
+	service.RunDue()
+	assert.Len(t, subscriptions.GetSubscription(subscription.Id).PaymentIds, 1)
+
+	clock.now = *charged.NextChargeAt
+	service.RunDue()
+	assert.Len(t, subscriptions.GetSubscription(subscription.Id).PaymentIds, 2)
+}
+
+func TestSubscription_Dunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	gomock.InOrder(
+		expectVerification(t, mockClient),
+		mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{ResponseCode: "51"}, nil).Times(3),
+	)
+
+	clock := &fakeClock{now: time.Now().UTC()}
+	service, subscriptions := newSubscriptionService(t, mockClient, clock)
+
+	subscription, err := service.CreateSubscription(subscriptionRequest(models.IntervalWeek))
+	require.NoError(t, err)
+
+	service.RunDue()
+	pastDue := subscriptions.GetSubscription(subscription.Id)
+	assert.Equal(t, models.SubscriptionPastDue, pastDue.Status)
+	assert.Equal(t, 1, pastDue.RetryCount)
+	assert.Equal(t, clock.now.Add(time.Hour), *pastDue.NextChargeAt)
+
+	clock.now = clock.now.Add(time.Hour)
+	service.RunDue()
+	assert.Equal(t, 2, subscriptions.GetSubscription(subscription.Id).RetryCount)
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	service.RunDue()
+	unpaid := subscriptions.GetSubscription(subscription.Id)
+	assert.Equal(t, models.SubscriptionUnpaid, unpaid.Status)
+	assert.Nil(t, unpaid.NextChargeAt)
+	assert.Len(t, unpaid.PaymentIds, 3)
+}
+
+func TestSubscription_HardDeclineIsNotRetried(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	gomock.InOrder(
+		expectVerification(t, mockClient),
+		mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{ResponseCode: "41"}, nil),
+	)
+
+	clock := &fakeClock{now: time.Now().UTC()}
+	service, subscriptions := newSubscriptionService(t, mockClient, clock)
+
+	subscription, err := service.CreateSubscription(subscriptionRequest(models.IntervalWeek))
+	require.NoError(t, err)
+
+	service.RunDue()
+	assert.Equal(t, models.SubscriptionUnpaid, subscriptions.GetSubscription(subscription.Id).Status)
+}
+
+func TestSubscription_PauseResumeCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	expectVerification(t, mockClient)
+
+	clock := &fakeClock{now: time.Date(2030, 1, 31, 9, 0, 0, 0, time.UTC)}
+	service, subscriptions := newSubscriptionService(t, mockClient, clock)
+
+	request := subscriptionRequest(models.IntervalMonth)
+	request.TrialDays = 1
+	subscription, err := service.CreateSubscription(request)
+	require.NoError(t, err)
+
+	paused, err := service.PauseSubscription(subscription.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.SubscriptionPaused, paused.Status)
+	assert.Nil(t, paused.NextChargeAt)
+
+	// paused subscriptions are not charged
+	clock.now = time.Date(2030, 3, 10, 9, 0, 0, 0, time.UTC)
+	service.RunDue()
+	assert.Empty(t, subscriptions.GetSubscription(subscription.Id).PaymentIds)
+
+	// the cycles missed during the pause are skipped, the anchor is the 1st of February
+	resumed, err := service.ResumeSubscription(subscription.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.SubscriptionActive, resumed.Status)
+	assert.Equal(t, time.Date(2030, 4, 1, 9, 0, 0, 0, time.UTC), *resumed.NextChargeAt)
+	assert.Equal(t, 2, resumed.Cycle)
+
+	_, err = service.ResumeSubscription(subscription.Id)
+	assert.ErrorIs(t, err, domain.ErrSubscriptionTransition)
+
+	cancelled, err := service.CancelSubscription(subscription.Id)
+	require.NoError(t, err)
+	assert.Equal(t, models.SubscriptionCancelled, cancelled.Status)
+
+	_, err = service.ResumeSubscription(subscription.Id)
+	assert.ErrorIs(t, err, domain.ErrSubscriptionTransition)
+
+	_, err = service.PauseSubscription("unknown")
+	assert.ErrorIs(t, err, domain.ErrSubscriptionNotFound)
+}
+
+func TestSubscription_MonthEndAnchor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	// the verification and two charges
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true, NetworkTransactionId: "ntid-1"}, nil).Times(3)
+
+	clock := &fakeClock{now: time.Now().UTC()}
+	service, subscriptions := newSubscriptionService(t, mockClient, clock)
+
+	request := subscriptionRequest(models.IntervalMonth)
+	anchor := time.Date(clock.now.Year()+1, 1, 31, 0, 0, 0, 0, time.UTC)
+	request.AnchorDate = &anchor
+	subscription, err := service.CreateSubscription(request)
+	require.NoError(t, err)
+
+	clock.now = anchor
+	service.RunDue()
+	february := subscriptions.GetSubscription(subscription.Id).NextChargeAt
+	assert.Equal(t, time.February, february.Month())
+	assert.Equal(t, time.Date(anchor.Year(), 3, 0, 0, 0, 0, 0, time.UTC), *february)
+
+	clock.now = *february
+	service.RunDue()
+	assert.Equal(t, time.Date(anchor.Year(), 3, 31, 0, 0, 0, 0, time.UTC), *subscriptions.GetSubscription(subscription.Id).NextChargeAt)
+}
+
+func TestSubscription_CardNotVerified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{ResponseCode: "05"}, nil)
+
+	service, subscriptions := newSubscriptionService(t, mockClient, &fakeClock{now: time.Now().UTC()})
+
+	_, err := service.CreateSubscription(subscriptionRequest(models.IntervalMonth))
+	assert.ErrorIs(t, err, domain.ErrCardNotVerified)
+	assert.Empty(t, subscriptions.ListSubscriptions("merchant-1"))
+}
+
+func TestSubscription_Validation(t *testing.T) {
+	service := domain.NewSubscriptionServiceImpl(nil, repository.NewSubscriptionsRepository(), domain.DefaultDunningConfig())
+
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name   string
+		change func(request *models.SubscriptionRequest)
+		field  string
+	}{
+		{"Interval", func(r *models.SubscriptionRequest) { r.Interval = "fortnight" }, "interval"},
+		{"IntervalCount", func(r *models.SubscriptionRequest) { r.IntervalCount = -1 }, "interval_count"},
+		{"AnchorInPast", func(r *models.SubscriptionRequest) { r.AnchorDate = &past }, "anchor_date"},
+		{"Amount", func(r *models.SubscriptionRequest) { r.Amount = 0 }, "amount"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := subscriptionRequest(models.IntervalMonth)
+			tt.change(request)
+
+			var validationError *gatewayerrors.ValidationError
+			_, err := service.CreateSubscription(request)
+			require.ErrorAs(t, err, &validationError)
+			assert.Equal(t, tt.field, validationError.GetFieldError())
+		})
+	}
+}
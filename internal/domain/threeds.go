@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/threeds"
+)
+
+// authenticationTimeout is how long the shopper has to complete a challenge, after that the card
+// details we kept for the authorisation are thrown away.
+const authenticationTimeout = 10 * time.Minute
+
+var (
+	ErrPaymentNotFound          = repository.ErrPaymentNotFound
+	ErrNotPendingAuthentication = errors.New("payment is not pending authentication")
+)
+
+type ThreeDSService interface {
+	CompleteAuthentication(paymentID string) (*models.PostPaymentResponse, error)
+}
+
+// pendingAuthentication keeps what we need to authorise the payment once the shopper comes back.
+type pendingAuthentication struct {
+	bankRequest *models.PostPaymentBankRequest
+	expiresAt   time.Time
+}
+
+// WithThreeDS sends payments that config requires to be authenticated through 3-D Secure first,
+// shoppers are sent back to callbackBaseURL once they completed the challenge.
+func WithThreeDS(authenticator threeds.Authenticator, config threeds.Config, callbackBaseURL string) Option {
+	return func(p *PaymentServiceImpl) {
+		p.authenticator = authenticator
+		p.threeDSConfig = config
+		p.callbackBaseURL = strings.TrimSuffix(callbackBaseURL, "/")
+		p.pending = map[string]pendingAuthentication{}
+	}
+}
+
+func (p *PaymentServiceImpl) requiresAuthentication(request *models.PostPaymentHandlerRequest) bool {
+	return p.authenticator != nil && !isMerchantInitiated(request) && p.threeDSConfig.Required(request.Currency, request.Amount)
+}
+
+// CallbackURL is where the ACS sends the shopper back to for the payment.
+func (p *PaymentServiceImpl) CallbackURL(paymentID string) string {
+	return fmt.Sprintf("%s/api/payments/%s/3ds/callback", p.callbackBaseURL, paymentID)
+}
+
+// startAuthentication sends the shopper to the challenge, they come back to returnURL or to our
+// callback when it is empty.
+func (p *PaymentServiceImpl) startAuthentication(payment *models.PostPaymentResponse, bankRequest *models.PostPaymentBankRequest, returnURL string) error {
+	if returnURL == "" {
+		returnURL = p.CallbackURL(payment.Id)
+	}
+	session, err := p.authenticator.Start(threeds.Request{
+		PaymentId:  payment.Id,
+		CardNumber: bankRequest.CardNumber,
+		Amount:     bankRequest.Amount,
+		Currency:   bankRequest.Currency,
+		ReturnURL:  returnURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	payment.PaymentStatus = "pending_authentication"
+	payment.ChallengeURL = session.ChallengeURL
+	payment.ThreeDSTransactionId = session.TransactionId
+
+	p.pendingMu.Lock()
+	p.pending[payment.Id] = pendingAuthentication{
+		bankRequest: bankRequest,
+		expiresAt:   time.Now().Add(authenticationTimeout),
+	}
+	p.pendingMu.Unlock()
+
+	p.repo.AddPayment(*payment)
+	p.publish(*payment)
+	return nil
+}
+
+// ExpireAuthentications declines the payments of shoppers that never came back from the challenge and
+// throws away the card details kept for them.
+func (p *PaymentServiceImpl) ExpireAuthentications() {
+	now := time.Now()
+	expired := []string{}
+	p.pendingMu.Lock()
+	for id, pending := range p.pending {
+		if now.After(pending.expiresAt) {
+			delete(p.pending, id)
+			expired = append(expired, id)
+		}
+	}
+	p.pendingMu.Unlock()
+
+	for _, id := range expired {
+		if abandoned := p.repo.GetPayment(id); abandoned != nil {
+			p.failAuthentication(abandoned, "")
+		}
+	}
+}
+
+// RunAuthenticationExpiry expires abandoned challenges every interval until ctx is cancelled, so the
+// card number and CVV are not kept any longer than authenticationTimeout.
+func (p *PaymentServiceImpl) RunAuthenticationExpiry(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.ExpireAuthentications()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CompleteAuthentication fetches the outcome of the challenge and, when the shopper was authenticated,
+// authorises the payment with the authentication data.  Failed or abandoned challenges decline the payment.
+func (p *PaymentServiceImpl) CompleteAuthentication(paymentID string) (*models.PostPaymentResponse, error) {
+	payment := p.repo.GetPayment(paymentID)
+	if payment == nil {
+		return nil, ErrPaymentNotFound
+	}
+
+	p.pendingMu.Lock()
+	pending, ok := p.pending[paymentID]
+	delete(p.pending, paymentID)
+	p.pendingMu.Unlock()
+	if !ok {
+		return nil, ErrNotPendingAuthentication
+	}
+	if time.Now().After(pending.expiresAt) {
+		return p.failAuthentication(payment, ""), nil
+	}
+
+	result, err := p.authenticator.Result(payment.ThreeDSTransactionId)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Succeeded() {
+		return p.failAuthentication(payment, result.Status), nil
+	}
+
+	payment.AuthenticationStatus = result.Status
+	payment.ECI = result.ECI
+	pending.bankRequest.ECI = result.ECI
+	pending.bankRequest.CAVV = result.CAVV
+	pending.bankRequest.ThreeDSTransactionId = result.TransactionId
+
+	var profile *models.MerchantProfile
+	if p.merchants != nil {
+		profile = p.merchants.GetProfile(payment.MerchantID)
+	}
+	if err := p.authorise(payment, pending.bankRequest, profile); err != nil {
+		var profileErr *gatewayerrors.ProfileError
+		switch {
+		case bankUnavailable(err):
+			// nothing reached a bank, put it back so the shopper can retry the callback
+			p.pendingMu.Lock()
+			p.pending[paymentID] = pending
+			p.pendingMu.Unlock()
+			return nil, err
+		case errors.As(err, &profileErr):
+			payment.PaymentStatus = "declined"
+			payment.DeclineCode = profileErr.Code
+		default:
+			// the bank may have authorised it, a retried callback could charge the card twice
+			log.Printf("authorising payment %s after 3-D Secure failed, leaving it to reconciliation: %v", paymentID, err)
+			payment.PaymentStatus = "unknown"
+		}
+	}
+
+	return p.storeOutcome(*payment)
+}
+
+func (p *PaymentServiceImpl) failAuthentication(payment *models.PostPaymentResponse, status string) *models.PostPaymentResponse {
+	if status == "" {
+		status = threeds.StatusUnavailable
+	}
+	payment.PaymentStatus = "declined"
+	payment.AuthenticationStatus = status
+	payment.DeclineCode = DeclineAuthenticationFailed
+	stored, err := p.storeOutcome(*payment)
+	if err != nil {
+		// removed while the challenge was going on
+		return payment
+	}
+	return stored
+}
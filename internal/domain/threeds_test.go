@@ -0,0 +1,136 @@
+package domain_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/threeds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func euroPayment(amount int) *models.PostPaymentHandlerRequest {
+	return &models.PostPaymentHandlerRequest{
+		CardNumber:  4111111111111111,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "EUR",
+		Amount:      amount,
+		Cvv:         123,
+	}
+}
+
+func TestPostPayment_ThreeDSChallenge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+
+	simulator := threeds.NewSimulator("http://gateway.test")
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithThreeDS(simulator, threeds.DefaultConfig(), "http://gateway.test"))
+
+	response, err := service.Create(euroPayment(5000))
+	require.NoError(t, err)
+	assert.Equal(t, "pending_authentication", response.PaymentStatus)
+	assert.NotEmpty(t, response.ChallengeURL)
+	assert.Equal(t, "pending_authentication", repo.GetPayment(response.Id).PaymentStatus)
+
+	returnURL, err := simulator.Complete(response.ThreeDSTransactionId, threeds.SimulatorCode)
+	require.NoError(t, err)
+	assert.Equal(t, "http://gateway.test/api/payments/"+response.Id+"/3ds/callback", returnURL)
+
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+		assert.Equal(t, "4111111111111111", request.CardNumber)
+		assert.Equal(t, "05", request.ECI)
+		assert.NotEmpty(t, request.CAVV)
+		assert.Equal(t, response.ThreeDSTransactionId, request.ThreeDSTransactionId)
+		return &models.PostPaymentBankResponse{Authorised: true}, nil
+	})
+
+	completed, err := service.CompleteAuthentication(response.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "authorized", completed.PaymentStatus)
+	assert.Equal(t, threeds.StatusAuthenticated, completed.AuthenticationStatus)
+	assert.Equal(t, "authorized", repo.GetPayment(response.Id).PaymentStatus)
+
+	_, err = service.CompleteAuthentication(response.Id)
+	assert.ErrorIs(t, err, domain.ErrNotPendingAuthentication)
+}
+
+func TestPostPayment_ThreeDSFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	simulator := threeds.NewSimulator("http://gateway.test")
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mocks.NewMockClient(ctrl), domain.WithThreeDS(simulator, threeds.DefaultConfig(), "http://gateway.test"))
+
+	response, err := service.Create(euroPayment(5000))
+	require.NoError(t, err)
+	_, err = simulator.Complete(response.ThreeDSTransactionId, "0000")
+	require.NoError(t, err)
+
+	completed, err := service.CompleteAuthentication(response.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "declined", completed.PaymentStatus)
+	assert.Equal(t, domain.DeclineAuthenticationFailed, completed.DeclineCode)
+	assert.Equal(t, threeds.StatusFailed, completed.AuthenticationStatus)
+}
+
+func TestPostPayment_ThreeDSLowValueExemption(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+
+	service := domain.NewPaymentServiceImpl(
+		repository.NewPaymentsRepository(),
+		mockClient,
+		domain.WithThreeDS(threeds.NewSimulator("http://gateway.test"), threeds.DefaultConfig(), "http://gateway.test"),
+	)
+
+	response, err := service.Create(euroPayment(2500))
+	require.NoError(t, err)
+	assert.Equal(t, "authorized", response.PaymentStatus)
+	assert.Empty(t, response.ChallengeURL)
+}
+
+func TestPostPayment_ThreeDSBankErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(nil, gatewayerrors.NewBankError(errors.New("unavailable"), http.StatusServiceUnavailable)),
+		mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(nil, errors.New("timeout")),
+	)
+
+	simulator := threeds.NewSimulator("http://gateway.test")
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithThreeDS(simulator, threeds.DefaultConfig(), "http://gateway.test"))
+
+	response, err := service.Create(euroPayment(5000))
+	require.NoError(t, err)
+	_, err = simulator.Complete(response.ThreeDSTransactionId, threeds.SimulatorCode)
+	require.NoError(t, err)
+
+	// the bank was not reached, so the callback can be tried again
+	_, err = service.CompleteAuthentication(response.Id)
+	require.Error(t, err)
+	assert.Equal(t, "pending_authentication", repo.GetPayment(response.Id).PaymentStatus)
+
+	// a timeout may have been authorised, it is not sent again
+	completed, err := service.CompleteAuthentication(response.Id)
+	require.NoError(t, err)
+	assert.Equal(t, "unknown", completed.PaymentStatus)
+	assert.Equal(t, "unknown", repo.GetPayment(response.Id).PaymentStatus)
+	_, err = service.CompleteAuthentication(response.Id)
+	assert.ErrorIs(t, err, domain.ErrNotPendingAuthentication)
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// subscriberBuffer is how far a subscriber can fall behind before it is dropped.  A dropped client
+// reconnects with Last-Event-ID and catches up from the history.
+const subscriberBuffer = 64
+
+// Event is a payment changing status, Id increases with every event so clients can resume after it.
+type Event struct {
+	Id          uint64    `json:"id"`
+	PaymentId   string    `json:"payment_id"`
+	MerchantID  string    `json:"merchant_id,omitempty"`
+	Status      string    `json:"status"`
+	DeclineCode string    `json:"decline_code,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// FromPayment describes the current status of payment, the broker fills in the id.
+func FromPayment(payment models.PostPaymentResponse) Event {
+	return Event{
+		PaymentId:   payment.Id,
+		MerchantID:  payment.MerchantID,
+		Status:      payment.PaymentStatus,
+		DeclineCode: payment.DeclineCode,
+		At:          time.Now().UTC(),
+	}
+}
+
+type Filter func(Event) bool
+
+func ForPayment(paymentID string) Filter {
+	return func(e Event) bool { return e.PaymentId == paymentID }
+}
+
+func ForMerchant(merchantID string) Filter {
+	return func(e Event) bool { return e.MerchantID == merchantID }
+}
+
+type Subscription struct {
+	C      chan Event
+	filter Filter
+	broker *Broker
+	closed bool
+}
+
+// Close stops the subscription, it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.unsubscribe(s)
+}
+
+// Broker fans payment events out to subscribers and keeps the most recent ones for resuming.
+type Broker struct {
+	mu          sync.Mutex
+	lastId      uint64
+	history     []Event
+	historySize int
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		historySize: historySize,
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastId++
+	event.Id = b.lastId
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for s := range b.subscribers {
+		if !s.filter(event) {
+			continue
+		}
+		select {
+		case s.C <- event:
+		default:
+			b.unsubscribe(s)
+		}
+	}
+}
+
+// Subscribe returns the events after lastEventID still in the history together with a subscription
+// for everything that follows, both are taken under one lock so nothing falls in between.  resumed is
+// false when lastEventID is not in the history, because it has been pushed out or was handed out
+// before a restart, and the replay may be missing events.
+func (b *Broker) Subscribe(filter Filter, lastEventID uint64) (subscription *Subscription, replay []Event, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	replay = []Event{}
+	if lastEventID > 0 {
+		resumed = lastEventID <= b.lastId && (len(b.history) == 0 || b.history[0].Id <= lastEventID+1)
+		for _, event := range b.history {
+			if event.Id > lastEventID && filter(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	s := &Subscription{
+		C:      make(chan Event, subscriberBuffer),
+		filter: filter,
+		broker: b,
+	}
+	b.subscribers[s] = struct{}{}
+	return s, replay, resumed
+}
+
+// Subscribers is the number of open subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+func (b *Broker) unsubscribe(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(b.subscribers, s)
+	close(s.C)
+}
@@ -0,0 +1,74 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	broker := events.NewBroker(3)
+
+	broker.Publish(events.Event{PaymentId: "p-1", MerchantID: "m-1", Status: "processing"})
+	broker.Publish(events.Event{PaymentId: "p-2", MerchantID: "m-2", Status: "processing"})
+
+	subscription, replay, _ := broker.Subscribe(events.ForMerchant("m-1"), 0)
+	assert.Empty(t, replay, "nothing is replayed without a last event id")
+
+	broker.Publish(events.Event{PaymentId: "p-2", MerchantID: "m-2", Status: "authorized"})
+	broker.Publish(events.Event{PaymentId: "p-1", MerchantID: "m-1", Status: "authorized"})
+
+	event := <-subscription.C
+	assert.Equal(t, uint64(4), event.Id)
+	assert.Equal(t, "authorized", event.Status)
+	assert.Empty(t, subscription.C)
+
+	subscription.Close()
+	subscription.Close()
+	assert.Equal(t, 0, broker.Subscribers())
+}
+
+func TestBroker_Replay(t *testing.T) {
+	broker := events.NewBroker(3)
+	for _, status := range []string{"processing", "pending_authentication", "authorized", "captured"} {
+		broker.Publish(events.Event{PaymentId: "p-1", Status: status})
+	}
+
+	subscription, replay, resumed := broker.Subscribe(events.ForPayment("p-1"), 2)
+	defer subscription.Close()
+
+	assert.True(t, resumed)
+	require.Len(t, replay, 2)
+	assert.Equal(t, "authorized", replay[0].Status)
+	assert.Equal(t, uint64(4), replay[1].Id)
+
+	_, replay, resumed = broker.Subscribe(events.ForPayment("p-1"), 4)
+	assert.True(t, resumed)
+	assert.Empty(t, replay)
+
+	// event 2 has been pushed out of the history
+	broker.Publish(events.Event{PaymentId: "p-1", Status: "refunded"})
+	_, _, resumed = broker.Subscribe(events.ForPayment("p-1"), 1)
+	assert.False(t, resumed)
+	// an id from before a restart
+	_, _, resumed = broker.Subscribe(events.ForPayment("p-1"), 9)
+	assert.False(t, resumed)
+}
+
+func TestBroker_DropsSlowSubscribers(t *testing.T) {
+	broker := events.NewBroker(10)
+	subscription, _, _ := broker.Subscribe(events.ForPayment("p-1"), 0)
+
+	for i := 0; i < 100; i++ {
+		broker.Publish(events.Event{PaymentId: "p-1", Status: "processing"})
+	}
+	assert.Equal(t, 0, broker.Subscribers())
+
+	count := 0
+	for range subscription.C {
+		count++
+	}
+	assert.Less(t, count, 100, "the channel is closed once the subscriber fell behind")
+}
@@ -0,0 +1,33 @@
+package fx
+
+import (
+	"math/big"
+)
+
+// Convert turns amount minor units of from into minor units of to at rate, taking the different
+// number of decimal places of each currency into account.  Halves are rounded away from zero.
+func Convert(amount int, from, to string, rate *big.Rat) int {
+	value := new(big.Rat).SetInt64(int64(amount))
+	value.Mul(value, rate)
+	value.Mul(value, new(big.Rat).SetInt(pow10(MinorUnits(to))))
+	value.Quo(value, new(big.Rat).SetInt(pow10(MinorUnits(from))))
+
+	return int(round(value).Int64())
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func round(value *big.Rat) *big.Int {
+	// (2|n| + d) / 2d truncated is |n|/d rounded half up
+	num := new(big.Int).Abs(value.Num())
+	den := value.Denom()
+	num.Mul(num, big.NewInt(2))
+	num.Add(num, den)
+	num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+	if value.Sign() < 0 {
+		num.Neg(num)
+	}
+	return num
+}
@@ -0,0 +1,23 @@
+package fx
+
+// minorUnits lists the ISO 4217 currencies that do not have two decimal places.
+var minorUnits = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"TND": 3,
+	"VND": 0,
+}
+
+// MinorUnits is the number of decimal places amounts in currency are expressed in.
+func MinorUnits(currency string) int {
+	if units, ok := minorUnits[currency]; ok {
+		return units
+	}
+	return 2
+}
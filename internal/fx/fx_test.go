@@ -0,0 +1,76 @@
+package fx_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/fx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int
+		from   string
+		to     string
+		rate   string
+		want   int
+	}{
+		{name: "same units", amount: 10000, from: "GBP", to: "EUR", rate: "1.1645", want: 11645},
+		{name: "rounds half up", amount: 1, from: "GBP", to: "EUR", rate: "1.5", want: 2},
+		{name: "rounds down", amount: 1, from: "GBP", to: "EUR", rate: "1.49", want: 1},
+		{name: "to zero decimals", amount: 1050, from: "USD", to: "JPY", rate: "151.20", want: 1588},
+		{name: "from zero decimals", amount: 1588, from: "JPY", to: "USD", rate: "0.00661376", want: 1050},
+		{name: "to three decimals", amount: 10000, from: "USD", to: "BHD", rate: "0.376", want: 37600},
+		{name: "negative rounds away from zero", amount: -1, from: "GBP", to: "EUR", rate: "1.5", want: -2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := fx.ParseRate(tt.rate)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, fx.Convert(tt.amount, tt.from, tt.to, rate))
+		})
+	}
+}
+
+func TestTable_CrossRate(t *testing.T) {
+	table, err := fx.NewTable("USD", map[string]string{"GBP": "0.8", "EUR": "0.9"})
+	require.NoError(t, err)
+
+	rate, err := table.Rate("GBP", "EUR")
+	require.NoError(t, err)
+	assert.Equal(t, "1.12500000", fx.FormatRate(rate))
+
+	rate, err = table.Rate("EUR", "GBP")
+	require.NoError(t, err)
+	assert.Equal(t, "0.88888889", fx.FormatRate(rate))
+
+	_, err = table.Rate("GBP", "JPY")
+	assert.ErrorIs(t, err, fx.ErrUnsupportedPair)
+
+	_, err = fx.NewTable("USD", map[string]string{"GBP": "-1"})
+	assert.Error(t, err)
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"base":"USD","rates":{"GBP":"0.8"}}`), 0o600))
+
+	provider, err := fx.NewFileProvider(path)
+	require.NoError(t, err)
+	rate, err := provider.Rate("USD", "GBP")
+	require.NoError(t, err)
+	assert.Equal(t, "0.80000000", fx.FormatRate(rate))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"base":"USD","rates":{"GBP":"0.75"}}`), 0o600))
+	require.NoError(t, provider.Reload())
+	rate, err = provider.Rate("USD", "GBP")
+	require.NoError(t, err)
+	assert.Equal(t, "0.75000000", fx.FormatRate(rate))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rates":{}}`), 0o600))
+	assert.Error(t, provider.Reload())
+}
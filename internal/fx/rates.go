@@ -0,0 +1,122 @@
+package fx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+)
+
+// rateDecimals is the precision rates are quoted and stored with.
+const rateDecimals = 8
+
+var ErrUnsupportedPair = errors.New("unsupported currency pair")
+
+// Provider returns how many units of to one unit of from buys.
+type Provider interface {
+	Rate(from, to string) (*big.Rat, error)
+}
+
+// Table holds the rates of every currency against a single base currency, cross rates are
+// worked out through the base.
+type Table struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+
+	parsed map[string]*big.Rat
+}
+
+func NewTable(base string, rates map[string]string) (*Table, error) {
+	t := &Table{Base: base, Rates: rates}
+	if err := t.parse(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Table) parse() error {
+	t.parsed = map[string]*big.Rat{t.Base: big.NewRat(1, 1)}
+	for currency, value := range t.Rates {
+		rate, err := ParseRate(value)
+		if err != nil {
+			return fmt.Errorf("rate for %s: %w", currency, err)
+		}
+		t.parsed[currency] = rate
+	}
+	return nil
+}
+
+func (t *Table) Rate(from, to string) (*big.Rat, error) {
+	fromRate, ok := t.parsed[from]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrUnsupportedPair, from, to)
+	}
+	toRate, ok := t.parsed[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrUnsupportedPair, from, to)
+	}
+	rate := new(big.Rat).Quo(toRate, fromRate)
+
+	// round to the precision we quote so the stored rate is exactly the one we used
+	return ParseRate(FormatRate(rate))
+}
+
+// FileProvider serves the rates from a JSON file shaped like Table, Reload picks up a new file.
+type FileProvider struct {
+	mu    sync.RWMutex
+	path  string
+	table *Table
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	p := &FileProvider{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileProvider) Reload() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+
+	table := &Table{}
+	if err := json.Unmarshal(data, table); err != nil {
+		return fmt.Errorf("invalid rates file %s: %w", p.path, err)
+	}
+	if table.Base == "" {
+		return fmt.Errorf("invalid rates file %s: missing base currency", p.path)
+	}
+	if err := table.parse(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.table = table
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *FileProvider) Rate(from, to string) (*big.Rat, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.table.Rate(from, to)
+}
+
+// ParseRate reads a decimal rate such as "1.17", floats are never used for money.
+func ParseRate(value string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(value)
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid rate %q", value)
+	}
+	return rate, nil
+}
+
+func FormatRate(rate *big.Rat) string {
+	return rate.FloatString(rateDecimals)
+}
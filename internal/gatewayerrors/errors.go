@@ -1,5 +1,7 @@
 package gatewayerrors
 
+import "time"
+
 /*
 Pretty much what it says on the tin, here I created some custom errors for our service so that we could create specific types that we could check against in the handler and also keep some additional info.
 
@@ -48,3 +50,41 @@ func NewValidationError(err error, id, field string) *ValidationError {
 		ID:    id,
 	}
 }
+
+type LimitError struct {
+	Err        error
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (le *LimitError) Error() string {
+	return le.Err.Error()
+}
+
+func NewLimitError(err error, scope string, retryAfter time.Duration) *LimitError {
+	return &LimitError{
+		Err:        err,
+		Scope:      scope,
+		RetryAfter: retryAfter,
+	}
+}
+
+// ProfileError is returned when a payment breaks one of the rules in the merchant's profile,
+// Code tells the merchant which one.
+type ProfileError struct {
+	Err  error
+	Code string
+	ID   string
+}
+
+func (pe *ProfileError) Error() string {
+	return pe.Err.Error()
+}
+
+func NewProfileError(err error, id, code string) *ProfileError {
+	return &ProfileError{
+		Err:  err,
+		Code: code,
+		ID:   id,
+	}
+}
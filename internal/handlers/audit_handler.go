@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+type AuditHandler struct {
+	storage *audit.Log
+}
+
+func NewAuditHandler(storage *audit.Log) *AuditHandler {
+	return &AuditHandler{
+		storage: storage,
+	}
+}
+
+// ListHandler returns the audit log oldest first, filtered by resource, resource_id, actor and action.
+// Pages are followed with after, the seq of the last entry seen.
+func (h *AuditHandler) ListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		q := audit.Query{
+			Resource:   query.Get("resource"),
+			ResourceID: query.Get("resource_id"),
+			Actor:      query.Get("actor"),
+			Action:     query.Get("action"),
+			Limit:      defaultAuditPageSize,
+		}
+		if value := query.Get("after"); value != "" {
+			after, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid after"})
+				return
+			}
+			q.AfterSeq = after
+		}
+		if value := query.Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxAuditPageSize {
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "limit must be between 1 and " + strconv.Itoa(maxAuditPageSize)})
+				return
+			}
+			q.Limit = limit
+		}
+
+		entries, err := h.storage.Entries(q)
+		if err != nil {
+			log.Printf("could not read the audit log: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+	}
+}
+
+// RequestID is the id given to the request by the request id middleware, empty when there is none.
+func RequestID(r *http.Request) string {
+	return middleware.GetReqID(r.Context())
+}
+
+// recordChange adds a change made by the request to the audit log.  The change has already been made
+// by then so a failure is only logged.
+func recordChange(r *http.Request, auditLog *audit.Log, change audit.Change) {
+	change.Actor = Actor(r)
+	change.RequestID = RequestID(r)
+	if _, err := auditLog.Record(change); err != nil {
+		log.Printf("could not audit %s %s: %v", change.Resource, change.ResourceID, err)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditHandler(t *testing.T) {
+	auditLog := audit.NewLog()
+	storage := repository.NewMerchantsRepository()
+	merchants := handlers.NewMerchantsHandler(storage, &domain.Domain{
+		MerchantsService: domain.NewMerchantsServiceImpl(storage),
+		Audit:            auditLog,
+	})
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Put("/api/admin/merchants/{id}", merchants.PutHandler())
+	r.Delete("/api/admin/merchants/{id}", merchants.DeleteHandler())
+	r.Get("/api/admin/audit", handlers.NewAuditHandler(auditLog).ListHandler())
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		req = req.WithContext(handlers.WithActor(req.Context(), "alice"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	put := httptest.NewRequest("PUT", "/api/admin/merchants/merchant-1", strings.NewReader(`{"currencies": ["GBP"]}`))
+	put.Header.Set(middleware.RequestIDHeader, "req-1")
+	require.Equal(t, http.StatusOK, serve(put).Code)
+	require.Equal(t, http.StatusNoContent, serve(httptest.NewRequest("DELETE", "/api/admin/merchants/merchant-1", nil)).Code)
+	// failed changes are not recorded
+	require.Equal(t, http.StatusNotFound, serve(httptest.NewRequest("DELETE", "/api/admin/merchants/merchant-1", nil)).Code)
+
+	w := serve(httptest.NewRequest("GET", "/api/admin/audit?resource=merchant&resource_id=merchant-1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var entries []models.AuditEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&entries))
+	require.Len(t, entries, 2)
+	assert.Equal(t, "merchant.created", entries[0].Action)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.Equal(t, "req-1", entries[0].RequestID)
+	assert.Equal(t, "merchant.deleted", entries[1].Action)
+	assert.NotEmpty(t, entries[1].RequestID)
+	assert.Contains(t, string(entries[1].Before), `"GBP"`)
+	assert.NoError(t, audit.Verify(entries))
+
+	w = serve(httptest.NewRequest("GET", "/api/admin/audit?after=1&limit=10", nil))
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, uint64(2), entries[0].Seq)
+
+	assert.Equal(t, http.StatusBadRequest, serve(httptest.NewRequest("GET", "/api/admin/audit?limit=0", nil)).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(httptest.NewRequest("GET", "/api/admin/audit?after=x", nil)).Code)
+}
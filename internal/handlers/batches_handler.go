@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type BatchesHandler struct {
+	storage *repository.BatchesRepository
+	domain  *domain.Domain
+}
+
+func NewBatchesHandler(storage *repository.BatchesRepository, domain *domain.Domain) *BatchesHandler {
+	return &BatchesHandler{
+		storage: storage,
+		domain:  domain,
+	}
+}
+
+// PostHandler submits a batch of payments.  Small batches are answered with every item's result,
+// async or large ones with 202 and a Location to poll.
+func (h *BatchesHandler) PostHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		var request models.BatchPaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("Error decoding request body: %v", err)
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid batch"})
+			return
+		}
+
+		for i := range request.Payments {
+			request.Payments[i].RequestID = RequestID(r)
+		}
+
+		async := preferAsync(r)
+		batch, err := h.domain.BatchService.SubmitBatch(&request, merchantID, async)
+		if err != nil {
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.Error()})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// the payments are recorded one by one as they are made, this only says who sent them together
+		recordChange(r, h.domain.Audit, audit.Change{Action: "batch.submitted", Resource: "batch", ResourceID: batch.Id, After: batch})
+		if async {
+			w.Header().Set("Preference-Applied", "respond-async")
+		}
+		if batch.Status == models.BatchProcessing {
+			w.Header().Set("Location", "/api/payments/batch/"+batch.Id)
+			writeJSON(w, http.StatusAccepted, batch)
+			return
+		}
+		writeJSON(w, http.StatusOK, batch)
+	}
+}
+
+// GetHandler returns the progress and results of a batch, merchants can only see their own batches.
+func (h *BatchesHandler) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		batch := h.storage.GetBatch(chi.URLParam(r, "id"))
+		if batch == nil || batch.MerchantID != merchantID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, batch)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/velocity"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestBatchesHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil).Times(2)
+
+	batches := repository.NewBatchesRepository()
+	paymentService := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient)
+	auditLog := audit.NewLog()
+	h := handlers.NewBatchesHandler(batches, &domain.Domain{
+		BatchService: domain.NewBatchServiceImpl(paymentService, batches, domain.DefaultBatchConfig()),
+		Audit:        auditLog,
+	})
+
+	r := chi.NewRouter()
+	r.Post("/api/payments/batch", h.PostHandler())
+	r.Get("/api/payments/batch/{id}", h.GetHandler())
+
+	item := `{"card_number":2222405343248877,"expiry_month":12,"expiry_year":` + time.Now().AddDate(1, 0, 0).Format("2006") + `,"currency":"GBP","amount":100,"cvv":123}`
+	body := `{"payments":[` + item + `,` + item + `]}`
+
+	req := httptest.NewRequest("POST", "/api/payments/batch", strings.NewReader(body))
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var batch models.PaymentBatch
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&batch))
+	assert.Equal(t, models.BatchCompleted, batch.Status)
+	assert.Equal(t, 2, batch.Counts["authorized"])
+	entries, err := auditLog.Entries(audit.Query{Action: "batch.submitted"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, batch.Id, entries[0].ResourceID)
+	assert.Equal(t, "merchant-1", entries[0].Actor)
+
+	req = httptest.NewRequest("GET", "/api/payments/batch/"+batch.Id, nil)
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/api/payments/batch/"+batch.Id, nil)
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-2"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = httptest.NewRequest("POST", "/api/payments/batch", strings.NewReader(`{"payments":[]}`))
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/payments/batch/"+batch.Id, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestBatchesHandler_NotLimitedByIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil).Times(40)
+
+	limiter := velocity.NewLimiter(velocity.NewMemoryStore(), velocity.DefaultLimits()...)
+	batches := repository.NewBatchesRepository()
+	paymentService := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient, domain.WithVelocityLimiter(limiter))
+	h := handlers.NewBatchesHandler(batches, &domain.Domain{
+		BatchService: domain.NewBatchServiceImpl(paymentService, batches, domain.DefaultBatchConfig()),
+	})
+
+	// more items than the per IP limit allows in a minute, each with its own card
+	items := make([]string, 40)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"card_number":%d,"expiry_month":12,"expiry_year":%d,"currency":"GBP","amount":100,"cvv":123}`, 2222405343248800+i, time.Now().Year()+1)
+	}
+	req := httptest.NewRequest("POST", "/api/payments/batch", strings.NewReader(`{"payments":[`+strings.Join(items, ",")+`]}`))
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1"))
+	w := httptest.NewRecorder()
+	h.PostHandler()(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var batch models.PaymentBatch
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&batch))
+	assert.Equal(t, map[string]int{"authorized": 40}, batch.Counts)
+}
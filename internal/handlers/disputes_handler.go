@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxEvidenceUpload caps the request body of an evidence upload, the domain enforces the real file limit.
+const maxEvidenceUpload = 16 << 20
+
+type DisputesHandler struct {
+	storage *repository.DisputesRepository
+	domain  *domain.Domain
+}
+
+func NewDisputesHandler(storage *repository.DisputesRepository, domain *domain.Domain) *DisputesHandler {
+	return &DisputesHandler{
+		storage: storage,
+		domain:  domain,
+	}
+}
+
+// ListHandler returns the calling merchant's disputes, closest deadline first, optionally for a single status.
+func (h *DisputesHandler) ListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, h.storage.ListDisputes(merchantID, r.URL.Query().Get("status")))
+	}
+}
+
+// GetHandler returns a dispute, merchants can only see their own disputes.
+func (h *DisputesHandler) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dispute := h.find(w, r)
+		if dispute == nil {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, dispute)
+	}
+}
+
+// EvidenceHandler uploads an evidence file sent as the "file" field of a multipart form.
+func (h *DisputesHandler) EvidenceHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dispute := h.find(w, r)
+		if dispute == nil {
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxEvidenceUpload)
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			log.Printf("Error reading evidence: %v", err)
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "expected a multipart form with a file field"})
+			return
+		}
+		defer file.Close()
+		content, err := io.ReadAll(file)
+		if err != nil {
+			log.Printf("Error reading evidence: %v", err)
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "could not read the file"})
+			return
+		}
+
+		h.write(w, r, dispute, func() (*models.Dispute, error) {
+			return h.domain.DisputesService.AddEvidence(dispute.Id, header.Filename, content)
+		})
+	}
+}
+
+func (h *DisputesHandler) SubmitHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dispute := h.find(w, r)
+		if dispute == nil {
+			return
+		}
+
+		h.write(w, r, dispute, func() (*models.Dispute, error) {
+			return h.domain.DisputesService.SubmitEvidence(dispute.Id)
+		})
+	}
+}
+
+func (h *DisputesHandler) AcceptHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dispute := h.find(w, r)
+		if dispute == nil {
+			return
+		}
+
+		h.write(w, r, dispute, func() (*models.Dispute, error) {
+			return h.domain.DisputesService.AcceptDispute(dispute.Id)
+		})
+	}
+}
+
+// NotificationsHandler takes the acquirer's dispute notifications as a JSON array, the way the
+// simulated acquirer would post them.
+func (h *DisputesHandler) NotificationsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var notifications []models.DisputeNotification
+		if err := json.NewDecoder(r.Body).Decode(&notifications); err != nil {
+			log.Printf("Error decoding request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		result := h.domain.DisputesService.Ingest(notifications)
+		for _, dispute := range result.Disputes {
+			recordChange(r, h.domain.Audit, audit.Change{Resource: "dispute", ResourceID: dispute.Id, After: dispute})
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (h *DisputesHandler) write(w http.ResponseWriter, r *http.Request, dispute *models.Dispute, change func() (*models.Dispute, error)) {
+	updated, err := change()
+	var validationErr *gatewayerrors.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		log.Printf("validation error on field: %v", validationErr.GetFieldError())
+		writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.Error()})
+	case errors.Is(err, domain.ErrDisputeNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, domain.ErrDisputeTransition):
+		writeJSON(w, http.StatusConflict, HandlerErrorResponse{Message: "dispute is " + dispute.Status})
+	case err != nil:
+		log.Printf("Unsupported error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		recordChange(r, h.domain.Audit, audit.Change{Resource: "dispute", ResourceID: updated.Id, After: updated})
+		writeJSON(w, http.StatusOK, updated)
+	}
+}
+
+// find returns the dispute in the URL when it belongs to the calling merchant, otherwise it answers the
+// request itself and returns nil.
+func (h *DisputesHandler) find(w http.ResponseWriter, r *http.Request) *models.Dispute {
+	merchantID, ok := callerMerchant(w, r)
+	if !ok {
+		return nil
+	}
+	dispute := h.storage.GetDispute(chi.URLParam(r, "id"))
+	if dispute == nil || dispute.MerchantID != merchantID {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	return dispute
+}
@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisputesHandler(t *testing.T) {
+	payments := repository.NewPaymentsRepository()
+	payments.AddPayment(models.PostPaymentResponse{
+		Id:                "payment-1",
+		PaymentStatus:     "authorized",
+		MerchantID:        "merchant-1",
+		Currency:          "GBP",
+		Amount:            1000,
+		AcquirerReference: "ref-1",
+	})
+	disputes := repository.NewDisputesRepository()
+	h := handlers.NewDisputesHandler(disputes, &domain.Domain{
+		DisputesService: domain.NewDisputesServiceImpl(payments, disputes, domain.DefaultDisputeConfig()),
+	})
+
+	r := chi.NewRouter()
+	r.Get("/api/disputes", h.ListHandler())
+	r.Get("/api/disputes/{id}", h.GetHandler())
+	r.Post("/api/disputes/{id}/evidence", h.EvidenceHandler())
+	r.Post("/api/disputes/{id}/submit", h.SubmitHandler())
+	r.Post("/api/disputes/{id}/accept", h.AcceptHandler())
+	r.Post("/api/admin/disputes/notifications", h.NotificationsHandler())
+
+	serve := func(req *http.Request, merchantID string) *httptest.ResponseRecorder {
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), merchantID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	notifications := `[{"acquirer_dispute_id":"acq-1","acquirer_reference":"ref-1","event":"opened","reason":"not_received"}]`
+	w := serve(httptest.NewRequest("POST", "/api/admin/disputes/notifications", strings.NewReader(notifications)), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var result models.DisputeIngestResult
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	require.Len(t, result.Disputes, 1)
+	id := result.Disputes[0].Id
+
+	w = serve(httptest.NewRequest("GET", "/api/disputes?status=needs_response", nil), "merchant-1")
+	var listed []models.Dispute
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+	assert.Len(t, listed, 1)
+	assert.Equal(t, http.StatusNotFound, serve(httptest.NewRequest("GET", "/api/disputes/"+id, nil), "merchant-2").Code)
+
+	// submitting without evidence is refused
+	assert.Equal(t, http.StatusBadRequest, serve(httptest.NewRequest("POST", "/api/disputes/"+id+"/submit", nil), "merchant-1").Code)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "tracking.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("delivered and signed for"))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+	req := httptest.NewRequest("POST", "/api/disputes/"+id+"/evidence", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w = serve(req, "merchant-1")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(httptest.NewRequest("POST", "/api/disputes/"+id+"/submit", nil), "merchant-1")
+	require.Equal(t, http.StatusOK, w.Code)
+	var dispute models.Dispute
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&dispute))
+	assert.Equal(t, models.DisputeUnderReview, dispute.Status)
+
+	assert.Equal(t, http.StatusConflict, serve(httptest.NewRequest("POST", "/api/disputes/"+id+"/accept", nil), "merchant-1").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(httptest.NewRequest("POST", "/api/disputes/"+id+"/evidence", strings.NewReader("raw")), "merchant-1").Code)
+}
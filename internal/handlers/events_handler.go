@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/events"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// DefaultHeartbeat keeps idle streams from being closed by proxies.
+const DefaultHeartbeat = 15 * time.Second
+
+// pendingStatuses are the statuses a payment can still move on from.
+var pendingStatuses = map[string]bool{
+	"processing":             true,
+	"pending_authentication": true,
+}
+
+type EventsHandler struct {
+	storage   *repository.PaymentsRepository
+	broker    *events.Broker
+	heartbeat time.Duration
+}
+
+func NewEventsHandler(storage *repository.PaymentsRepository, broker *events.Broker, heartbeat time.Duration) *EventsHandler {
+	return &EventsHandler{
+		storage:   storage,
+		broker:    broker,
+		heartbeat: heartbeat,
+	}
+}
+
+// PaymentHandler streams the status changes of a single payment as Server-Sent Events.  A new stream
+// starts with the current status, so does a resumed one whose Last-Event-ID is no longer in the
+// history.  The stream is closed once the payment reached its final status.
+func (h *EventsHandler) PaymentHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		payment := h.storage.GetPayment(chi.URLParam(r, "id"))
+		if payment == nil || payment.MerchantID != merchantID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		lastEventID, ok := parseLastEventID(w, r)
+		if !ok {
+			return
+		}
+
+		// subscribe before reading the status again so a change in between is not missed
+		subscription, replay, resumed := h.broker.Subscribe(events.ForPayment(payment.Id), lastEventID)
+		defer subscription.Close()
+		if !resumed {
+			if current := h.storage.GetPayment(payment.Id); current != nil {
+				current := events.FromPayment(*current)
+				replay = append([]events.Event{current}, replay...)
+			}
+		}
+
+		h.stream(w, r, subscription, replay, func(e events.Event) bool { return !pendingStatuses[e.Status] })
+	}
+}
+
+// MerchantHandler streams the status changes of every payment of the calling merchant.
+func (h *EventsHandler) MerchantHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+
+		lastEventID, ok := parseLastEventID(w, r)
+		if !ok {
+			return
+		}
+
+		subscription, replay, _ := h.broker.Subscribe(events.ForMerchant(merchantID), lastEventID)
+		defer subscription.Close()
+
+		h.stream(w, r, subscription, replay, func(events.Event) bool { return false })
+	}
+}
+
+func (h *EventsHandler) stream(w http.ResponseWriter, r *http.Request, subscription *events.Subscription, replay []events.Event, last func(events.Event) bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+		if last(event) {
+			flusher.Flush()
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-subscription.C:
+			if !ok {
+				// we fell too far behind, the client resumes from its last event id
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+			if last(event) {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent leaves the id out for events that are not in the broker's history, like the current
+// status a stream starts with, so they do not move the client's Last-Event-ID.
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode event: %v", err)
+		return err
+	}
+	if event.Id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.Id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: payment.status\ndata: %s\n\n", data)
+	return err
+}
+
+func parseLastEventID(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid Last-Event-ID"})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,184 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/events"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sseMessage struct {
+	id    string
+	event events.Event
+}
+
+// readSSE reads messages from the stream until it ends, comments are passed to onComment.
+func readSSE(t *testing.T, resp *http.Response, messages chan<- sseMessage, onComment func(string)) {
+	scanner := bufio.NewScanner(resp.Body)
+	var message sseMessage
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if message.event.PaymentId != "" {
+				messages <- message
+			}
+			message = sseMessage{}
+		case strings.HasPrefix(line, ":"):
+			onComment(line)
+		case strings.HasPrefix(line, "id: "):
+			message.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &message.event))
+		}
+	}
+	close(messages)
+}
+
+// asMerchant makes every request of a test server one of merchantID's.
+func asMerchant(merchantID string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(handlers.WithMerchantID(r.Context(), merchantID)))
+		})
+	}
+}
+
+func TestEventsHandler_Payment(t *testing.T) {
+	repo := repository.NewPaymentsRepository()
+	repo.AddPayment(models.PostPaymentResponse{Id: "p-1", PaymentStatus: "processing", MerchantID: "m-1"})
+	broker := events.NewBroker(100)
+	eventsHandler := handlers.NewEventsHandler(repo, broker, 10*time.Millisecond)
+
+	r := chi.NewRouter()
+	r.Use(asMerchant("m-1"))
+	r.Get("/api/payments/{id}/events", eventsHandler.PaymentHandler())
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/payments/p-1/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	messages := make(chan sseMessage, 10)
+	heartbeats := make(chan struct{}, 100)
+	go readSSE(t, resp, messages, func(string) { heartbeats <- struct{}{} })
+
+	first := <-messages
+	assert.Empty(t, first.id, "the current status does not carry an id")
+	assert.Equal(t, "processing", first.event.Status)
+
+	select {
+	case <-heartbeats:
+	case <-time.After(time.Second):
+		t.Fatal("no heartbeat")
+	}
+
+	broker.Publish(events.Event{PaymentId: "p-2", Status: "authorized"})
+	broker.Publish(events.Event{PaymentId: "p-1", Status: "authorized"})
+
+	final := <-messages
+	assert.Equal(t, "2", final.id)
+	assert.Equal(t, "authorized", final.event.Status)
+
+	_, open := <-messages
+	assert.False(t, open, "the stream ends with the final status")
+	assert.Eventually(t, func() bool { return broker.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestEventsHandler_Resume(t *testing.T) {
+	repo := repository.NewPaymentsRepository()
+	repo.AddPayment(models.PostPaymentResponse{Id: "p-1", PaymentStatus: "declined", MerchantID: "m-1"})
+	broker := events.NewBroker(100)
+	broker.Publish(events.Event{PaymentId: "p-1", Status: "processing"})
+	broker.Publish(events.Event{PaymentId: "p-1", Status: "declined"})
+	eventsHandler := handlers.NewEventsHandler(repo, broker, time.Minute)
+
+	r := chi.NewRouter()
+	r.Get("/api/payments/{id}/events", eventsHandler.PaymentHandler())
+
+	req := httptest.NewRequest("GET", "/api/payments/p-1/events", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest("GET", "/api/payments/p-1/events", nil)
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "m-1"))
+	req.Header.Set("Last-Event-ID", "1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.True(t, strings.HasPrefix(w.Body.String(), "id: 2\nevent: payment.status\n"))
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "data: "))
+
+	// an id the broker does not know of, like one from before a restart, gets the current status
+	req = httptest.NewRequest("GET", "/api/payments/p-1/events", nil)
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "m-1"))
+	req.Header.Set("Last-Event-ID", "50")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.True(t, strings.HasPrefix(w.Body.String(), "event: payment.status\n"))
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "data: "))
+	assert.Contains(t, w.Body.String(), `"status":"declined"`)
+
+	req = httptest.NewRequest("GET", "/api/payments/p-1/events", nil)
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "m-1"))
+	req.Header.Set("Last-Event-ID", "nope")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("GET", "/api/payments/p-1/events", nil)
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "someone-else"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestEventsHandler_Merchant(t *testing.T) {
+	broker := events.NewBroker(100)
+	eventsHandler := handlers.NewEventsHandler(repository.NewPaymentsRepository(), broker, time.Minute)
+
+	w := httptest.NewRecorder()
+	eventsHandler.MerchantHandler()(w, httptest.NewRequest("GET", "/api/events", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/api/events", nil).WithContext(handlers.WithMerchantID(ctx, "m-1"))
+	w = httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		eventsHandler.MerchantHandler()(w, req)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, time.Millisecond)
+	broker.Publish(events.Event{PaymentId: "p-1", MerchantID: "m-1", Status: "authorized"})
+	broker.Publish(events.Event{PaymentId: "p-2", MerchantID: "m-2", Status: "authorized"})
+	broker.Publish(events.Event{PaymentId: "p-3", MerchantID: "m-1", Status: "declined"})
+
+	// the client going away ends the stream and drops the subscription
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, 0, broker.Subscribers())
+
+	body := w.Body.String()
+	assert.Contains(t, body, `"payment_id":"p-1"`)
+	assert.Contains(t, body, `"payment_id":"p-3"`)
+	assert.NotContains(t, body, `"payment_id":"p-2"`)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+type FXHandler struct {
+	domain *domain.Domain
+}
+
+func NewFXHandler(domain *domain.Domain) *FXHandler {
+	return &FXHandler{
+		domain: domain,
+	}
+}
+
+// QuoteHandler locks a rate for the calling merchant, the quote id can then be sent with a payment.
+func (h *FXHandler) QuoteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.FXQuoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("Error decoding request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		quote, err := h.domain.FXService.Quote(&request, MerchantIDFromContext(r.Context()))
+		if err != nil {
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.Error()})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, quote)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ListsHandler struct {
+	storage *repository.ListsRepository
+	domain  *domain.Domain
+}
+
+func NewListsHandler(storage *repository.ListsRepository, domain *domain.Domain) *ListsHandler {
+	return &ListsHandler{
+		storage: storage,
+		domain:  domain,
+	}
+}
+
+// GetHandler returns the block and allow list entries, optionally filtered by the list query parameter.
+func (h *ListsHandler) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, h.storage.ListEntries(r.URL.Query().Get("list")))
+	}
+}
+
+// AuditHandler returns every change that has been made to the lists.
+func (h *ListsHandler) AuditHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, h.storage.Audit())
+	}
+}
+
+func (h *ListsHandler) PostHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.ListEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("Error decoding request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		entry, err := h.domain.ListsService.AddEntry(&request, Actor(r))
+		if err != nil {
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				log.Printf("validation error on field: %v", validationErr.GetFieldError())
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.Error()})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		recordChange(r, h.domain.Audit, audit.Change{Resource: "list_entry", ResourceID: entry.Id, After: entry})
+		writeJSON(w, http.StatusCreated, entry)
+	}
+}
+
+func (h *ListsHandler) DeleteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		err := h.domain.ListsService.DeleteEntry(id, Actor(r))
+		if errors.Is(err, repository.ErrListEntryNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		recordChange(r, h.domain.Audit, audit.Change{Resource: "list_entry", ResourceID: id})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Actor is who made a change, the admin the request was authenticated as or otherwise its merchant.
+func Actor(r *http.Request) string {
+	if actor, _ := r.Context().Value(actorKey{}).(string); actor != "" {
+		return actor
+	}
+	if merchantID := MerchantIDFromContext(r.Context()); merchantID != "" {
+		return merchantID
+	}
+	return "anonymous"
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set(contentTypeHeader, jsonContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
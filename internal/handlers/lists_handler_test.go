@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListsHandler(t *testing.T) {
+	repo := repository.NewListsRepository()
+	lists := handlers.NewListsHandler(repo, &domain.Domain{
+		ListsService: domain.NewListsServiceImpl(repo),
+	})
+
+	r := chi.NewRouter()
+	r.Get("/api/admin/lists", lists.GetHandler())
+	r.Get("/api/admin/lists/audit", lists.AuditHandler())
+	r.Post("/api/admin/lists", lists.PostHandler())
+	r.Delete("/api/admin/lists/{id}", lists.DeleteHandler())
+
+	body, err := json.Marshal(&models.ListEntryRequest{
+		List:     models.ListBlock,
+		Type:     models.ListEntryBINRange,
+		BINStart: "400000",
+		BINEnd:   "400099",
+		Reason:   "compromised issuer",
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/admin/lists", bytes.NewBuffer(body))
+	req = req.WithContext(handlers.WithActor(req.Context(), "alice"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created models.ListEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "alice", created.CreatedBy)
+	assert.Equal(t, "400099", created.BINEnd)
+
+	req = httptest.NewRequest("GET", "/api/admin/lists?list=block", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var entries []models.ListEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, created.Id, entries[0].Id)
+
+	req = httptest.NewRequest("DELETE", "/api/admin/lists/"+created.Id, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/admin/lists/"+created.Id, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = httptest.NewRequest("GET", "/api/admin/lists/audit", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var audit []models.ListAuditEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&audit))
+	require.Len(t, audit, 2)
+	assert.Equal(t, "deleted", audit[1].Action)
+	assert.Equal(t, "anonymous", audit[1].Actor)
+}
+
+func TestListsHandler_ValidationError(t *testing.T) {
+	repo := repository.NewListsRepository()
+	lists := handlers.NewListsHandler(repo, &domain.Domain{
+		ListsService: domain.NewListsServiceImpl(repo),
+	})
+
+	r := chi.NewRouter()
+	r.Post("/api/admin/lists", lists.PostHandler())
+
+	body, err := json.Marshal(&models.ListEntryRequest{List: models.ListBlock, Type: models.ListEntryCurrency, Value: "pounds"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/api/admin/lists", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response handlers.HandlerErrorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid currency", response.Message)
+}
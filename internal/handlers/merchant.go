@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type merchantIDKey struct{}
+
+type actorKey struct{}
+
+// WithMerchantID stores the merchant the request was made on behalf of.
+func WithMerchantID(ctx context.Context, merchantID string) context.Context {
+	return context.WithValue(ctx, merchantIDKey{}, merchantID)
+}
+
+// MerchantIDFromContext returns the merchant for the request or an empty string when there is none.
+func MerchantIDFromContext(ctx context.Context) string {
+	merchantID, _ := ctx.Value(merchantIDKey{}).(string)
+	return merchantID
+}
+
+// callerMerchant returns the merchant the request was made on behalf of, for the routes that only make
+// sense for a merchant.  Without one it answers 401 and reports false, the handler has nothing left to do.
+func callerMerchant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	merchantID := MerchantIDFromContext(r.Context())
+	if merchantID == "" {
+		writeJSON(w, http.StatusUnauthorized, HandlerErrorResponse{Message: "a merchant is required"})
+		return "", false
+	}
+	return merchantID, true
+}
+
+// ClientIP is the address the request came from, proxies are not trusted so X-Forwarded-For is ignored.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// WithActor stores the verified admin the request was made by.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type MerchantsHandler struct {
+	storage *repository.MerchantsRepository
+	domain  *domain.Domain
+}
+
+func NewMerchantsHandler(storage *repository.MerchantsRepository, domain *domain.Domain) *MerchantsHandler {
+	return &MerchantsHandler{
+		storage: storage,
+		domain:  domain,
+	}
+}
+
+func (h *MerchantsHandler) ListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, h.storage.ListProfiles())
+	}
+}
+
+func (h *MerchantsHandler) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profile := h.storage.GetProfile(chi.URLParam(r, "id"))
+		if profile == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, profile)
+	}
+}
+
+// PutHandler replaces the profile of the merchant in the URL.
+func (h *MerchantsHandler) PutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var profile models.MerchantProfile
+		if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+			log.Printf("Error decoding request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		profile.MerchantID = chi.URLParam(r, "id")
+
+		updated, err := h.domain.MerchantsService.PutProfile(&profile, Actor(r))
+		if err != nil {
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				log.Printf("validation error on field: %v", validationErr.GetFieldError())
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.Error()})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		recordChange(r, h.domain.Audit, audit.Change{Resource: "merchant", ResourceID: updated.MerchantID, After: updated})
+		writeJSON(w, http.StatusOK, updated)
+	}
+}
+
+func (h *MerchantsHandler) DeleteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		err := h.domain.MerchantsService.DeleteProfile(id)
+		if errors.Is(err, repository.ErrMerchantProfileNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		recordChange(r, h.domain.Audit, audit.Change{Resource: "merchant", ResourceID: id})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerchantsHandler(t *testing.T) {
+	storage := repository.NewMerchantsRepository()
+	merchants := handlers.NewMerchantsHandler(storage, &domain.Domain{
+		MerchantsService: domain.NewMerchantsServiceImpl(storage),
+	})
+
+	r := chi.NewRouter()
+	r.Get("/api/admin/merchants", merchants.ListHandler())
+	r.Get("/api/admin/merchants/{id}", merchants.GetHandler())
+	r.Put("/api/admin/merchants/{id}", merchants.PutHandler())
+	r.Delete("/api/admin/merchants/{id}", merchants.DeleteHandler())
+
+	body := `{"amount_limits": {"GBP": {"min": 100, "max": 50000}}, "currencies": ["GBP"], "card_schemes": ["visa"], "daily_volume_caps": {"GBP": 1000000}}`
+	req := httptest.NewRequest("PUT", "/api/admin/merchants/merchant-1", strings.NewReader(body))
+	req = req.WithContext(handlers.WithActor(req.Context(), "alice"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var profile models.MerchantProfile
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&profile))
+	assert.Equal(t, "merchant-1", profile.MerchantID)
+	assert.Equal(t, models.CaptureAuto, profile.CaptureMode)
+	assert.Equal(t, "alice", profile.UpdatedBy)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/admin/merchants/merchant-1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&profile))
+	assert.Equal(t, models.AmountLimit{Min: 100, Max: 50000}, profile.AmountLimits["GBP"])
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/admin/merchants", nil))
+	var profiles []models.MerchantProfile
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&profiles))
+	assert.Len(t, profiles, 1)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/admin/merchants/merchant-1", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/admin/merchants/merchant-1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMerchantsHandler_ValidationError(t *testing.T) {
+	storage := repository.NewMerchantsRepository()
+	merchants := handlers.NewMerchantsHandler(storage, &domain.Domain{
+		MerchantsService: domain.NewMerchantsServiceImpl(storage),
+	})
+
+	r := chi.NewRouter()
+	r.Put("/api/admin/merchants/{id}", merchants.PutHandler())
+
+	tests := map[string]string{
+		"unknown currency":     `{"currencies": ["XXX"]}`,
+		"unknown scheme":       `{"card_schemes": ["diners"]}`,
+		"min above max":        `{"amount_limits": {"GBP": {"min": 500, "max": 100}}}`,
+		"zero volume cap":      `{"daily_volume_caps": {"GBP": 0}}`,
+		"unknown capture mode": `{"capture_mode": "later"}`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("PUT", "/api/admin/merchants/merchant-1", strings.NewReader(body)))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+	assert.Empty(t, storage.ListProfiles())
+}
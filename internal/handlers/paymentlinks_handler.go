@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/csrf"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/fx"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PaymentLinksHandler struct {
+	storage *repository.PaymentLinksRepository
+	domain  *domain.Domain
+	csrf    *csrf.Protector
+}
+
+func NewPaymentLinksHandler(storage *repository.PaymentLinksRepository, domain *domain.Domain, csrf *csrf.Protector) *PaymentLinksHandler {
+	return &PaymentLinksHandler{
+		storage: storage,
+		domain:  domain,
+		csrf:    csrf,
+	}
+}
+
+func (h *PaymentLinksHandler) PostHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		var request models.PaymentLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("Error decoding request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		request.MerchantID = merchantID
+
+		link, err := h.domain.PaymentLinksService.CreateLink(&request)
+		if err != nil {
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				log.Printf("validation error on field: %v", validationErr.GetFieldError())
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.GetFieldError() + ": " + validationErr.Error()})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		recordChange(r, h.domain.Audit, audit.Change{Resource: "payment_link", ResourceID: link.Id, After: link})
+		w.Header().Set("Location", "/api/payment-links/"+link.Id)
+		writeJSON(w, http.StatusCreated, link)
+	}
+}
+
+// GetHandler returns a payment link, merchants can only see their own links.
+func (h *PaymentLinksHandler) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		link := h.domain.PaymentLinksService.GetLink(chi.URLParam(r, "id"))
+		if link == nil || link.MerchantID != merchantID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, link)
+	}
+}
+
+type hostedPage struct {
+	Link      *models.PaymentLink
+	Amount    string
+	CSRFField string
+	CSRFToken string
+	Error     string
+	Closed    string
+}
+
+var hostedPageTemplate = template.Must(template.New("pay").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Payment</title>
+<style>body{font-family:sans-serif;max-width:24rem;margin:2rem auto}label{display:block;margin-top:1rem}input{width:100%}</style>
+</head>
+<body>
+{{if .Closed}}
+<p>{{.Closed}}</p>
+{{else}}
+<h1>Pay {{.Amount}} {{.Link.Currency}}</h1>
+{{with .Link.Description}}<p>{{.}}</p>{{end}}
+{{with .Error}}<p role="alert">{{.}}</p>{{end}}
+<form method="post" autocomplete="on">
+<input type="hidden" name="{{.CSRFField}}" value="{{.CSRFToken}}">
+<label>Card number <input name="card_number" inputmode="numeric" autocomplete="cc-number" required></label>
+<label>Expiry month <input name="expiry_month" inputmode="numeric" autocomplete="cc-exp-month" required></label>
+<label>Expiry year <input name="expiry_year" inputmode="numeric" autocomplete="cc-exp-year" required></label>
+<label>CVV <input name="cvv" inputmode="numeric" autocomplete="cc-csc" required></label>
+<button type="submit">Pay</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// PageHandler serves the hosted card form for a link.
+func (h *PaymentLinksHandler) PageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link := h.domain.PaymentLinksService.GetLink(chi.URLParam(r, "id"))
+		if link == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if link.Status != models.PaymentLinkActive {
+			h.renderClosed(w, link)
+			return
+		}
+
+		h.render(w, r, http.StatusOK, link, "")
+	}
+}
+
+// SubmitHandler takes the card from the hosted form and makes the payment, the shopper is then sent to
+// the 3-D Secure challenge or back to the merchant.
+func (h *PaymentLinksHandler) SubmitHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if !h.csrf.Verify(r, id) {
+			http.Error(w, "This form has expired, please reload the page.", http.StatusForbidden)
+			return
+		}
+
+		link, payment, err := h.domain.PaymentLinksService.Pay(id, parseHostedCard(r))
+		switch {
+		case errors.Is(err, repository.ErrPaymentLinkNotFound):
+			http.NotFound(w, r)
+			return
+		case errors.Is(err, repository.ErrPaymentLinkUsed), errors.Is(err, repository.ErrPaymentLinkExpired):
+			h.renderClosed(w, h.domain.PaymentLinksService.GetLink(id))
+			return
+		case err != nil:
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				h.render(w, r, http.StatusUnprocessableEntity, link, "Please check the "+strings.ReplaceAll(validationErr.GetFieldError(), "_", " ")+".")
+				return
+			}
+			var profileErr *gatewayerrors.ProfileError
+			if errors.As(err, &profileErr) {
+				h.render(w, r, http.StatusUnprocessableEntity, link, "This card cannot be used for this payment.")
+				return
+			}
+			// the bank may have taken the payment, so the link stays used rather than risk a second one
+			log.Printf("hosted payment failed: %v", err)
+			h.writePage(w, http.StatusServiceUnavailable, hostedPage{
+				Link:   link,
+				Closed: "We could not confirm the payment, please check with the merchant before paying again.",
+			})
+			return
+		}
+
+		if payment.PaymentStatus == "pending_authentication" {
+			http.Redirect(w, r, payment.ChallengeURL, http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, domain.LinkResultURL(link, payment), http.StatusSeeOther)
+	}
+}
+
+// ReturnHandler is where 3-D Secure sends the shopper back to, it finishes the payment and sends them on to the merchant.
+func (h *PaymentLinksHandler) ReturnHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, payment, err := h.domain.PaymentLinksService.CompleteAuthentication(chi.URLParam(r, "id"))
+		if errors.Is(err, repository.ErrPaymentLinkNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("completing hosted payment failed: %v", err)
+			payment = nil
+		}
+
+		http.Redirect(w, r, domain.LinkResultURL(link, payment), http.StatusSeeOther)
+	}
+}
+
+func (h *PaymentLinksHandler) render(w http.ResponseWriter, r *http.Request, status int, link *models.PaymentLink, message string) {
+	token, err := h.csrf.Issue(w, "/pay/"+link.Id, link.Id)
+	if err != nil {
+		log.Printf("could not issue csrf token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writePage(w, status, hostedPage{
+		Link:      link,
+		Amount:    formatMinorUnits(link.Amount, link.Currency),
+		CSRFField: csrf.FieldName,
+		CSRFToken: token,
+		Error:     message,
+	})
+}
+
+func (h *PaymentLinksHandler) renderClosed(w http.ResponseWriter, link *models.PaymentLink) {
+	message := "This payment link has already been used."
+	if link.Status == models.PaymentLinkExpired {
+		message = "This payment link has expired."
+	}
+	h.writePage(w, http.StatusGone, hostedPage{Link: link, Closed: message})
+}
+
+// writePage sends the page with headers that keep card details out of caches and the form out of frames.
+func (h *PaymentLinksHandler) writePage(w http.ResponseWriter, status int, page hostedPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	if err := hostedPageTemplate.Execute(w, page); err != nil {
+		log.Printf("Failed to render hosted page: %v", err)
+	}
+}
+
+// parseHostedCard reads the card from the form, spaces in the card number are allowed.  Fields that are
+// not numbers are left at zero for validation to reject.
+func parseHostedCard(r *http.Request) models.HostedCard {
+	number := func(name string) int {
+		n, _ := strconv.Atoi(strings.ReplaceAll(r.PostFormValue(name), " ", ""))
+		return n
+	}
+	return models.HostedCard{
+		CardNumber:  number("card_number"),
+		ExpiryMonth: number("expiry_month"),
+		ExpiryYear:  number("expiry_year"),
+		Cvv:         number("cvv"),
+		ClientIP:    ClientIP(r),
+	}
+}
+
+// formatMinorUnits shows an amount in minor units with as many decimals as the currency has.
+func formatMinorUnits(amount int, currency string) string {
+	digits := fx.MinorUnits(currency)
+	if digits == 0 {
+		return strconv.Itoa(amount)
+	}
+	return fmt.Sprintf("%d.%0*d", amount/pow10(digits), digits, amount%pow10(digits))
+}
+
+func pow10(n int) int {
+	p := 1
+	for range n {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/csrf"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+var csrfFieldPattern = regexp.MustCompile(`name="` + csrf.FieldName + `" value="([^"]+)"`)
+
+func TestPaymentLinksHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+
+	links := repository.NewPaymentLinksRepository()
+	payments := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient)
+	auditLog := audit.NewLog()
+	h := handlers.NewPaymentLinksHandler(links, &domain.Domain{
+		PaymentLinksService: domain.NewPaymentLinksServiceImpl(payments, payments, links, "https://pay.example.com"),
+		Audit:               auditLog,
+	}, csrf.New([]byte("key")))
+
+	r := chi.NewRouter()
+	r.Post("/api/payment-links", h.PostHandler())
+	r.Get("/api/payment-links/{id}", h.GetHandler())
+	r.Get("/pay/{id}", h.PageHandler())
+	r.Post("/pay/{id}", h.SubmitHandler())
+
+	serve := func(req *http.Request, merchantID string) *httptest.ResponseRecorder {
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), merchantID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	body := `{"amount":1250,"currency":"GBP","success_url":"https://shop.example.com/thanks","failure_url":"https://shop.example.com/sorry"}`
+	w := serve(httptest.NewRequest("POST", "/api/payment-links", strings.NewReader(body)), "merchant-1")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var link models.PaymentLink
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&link))
+	assert.Equal(t, "/api/payment-links/"+link.Id, w.Header().Get("Location"))
+	assert.Equal(t, http.StatusNotFound, serve(httptest.NewRequest("GET", "/api/payment-links/"+link.Id, nil), "merchant-2").Code)
+	entries, err := auditLog.Entries(audit.Query{Resource: "payment_link"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "payment_link.created", entries[0].Action)
+	assert.Equal(t, link.Id, entries[0].ResourceID)
+
+	page := serve(httptest.NewRequest("GET", "/pay/"+link.Id, nil), "")
+	require.Equal(t, http.StatusOK, page.Code)
+	assert.Equal(t, "no-store", page.Header().Get("Cache-Control"))
+	assert.Equal(t, "DENY", page.Header().Get("X-Frame-Options"))
+	assert.Contains(t, page.Body.String(), "12.50 GBP")
+	match := csrfFieldPattern.FindStringSubmatch(page.Body.String())
+	require.Len(t, match, 2)
+	cookies := page.Result().Cookies()
+
+	submit := func(token string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		form := url.Values{
+			csrf.FieldName: {token},
+			"card_number":  {"2222 4053 4324 8877"},
+			"expiry_month": {"12"},
+			"expiry_year":  {strconv.Itoa(time.Now().Year() + 1)},
+			"cvv":          {"123"},
+		}
+		req := httptest.NewRequest("POST", "/pay/"+link.Id, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return serve(req, "")
+	}
+
+	// a post from another site has neither the cookie nor a valid token
+	assert.Equal(t, http.StatusForbidden, submit("forged", nil).Code)
+	assert.Equal(t, http.StatusForbidden, submit(match[1], nil).Code)
+
+	w = submit(match[1], cookies)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "shop.example.com", redirect.Host)
+	assert.Equal(t, "/thanks", redirect.Path)
+	assert.Equal(t, link.Id, redirect.Query().Get("payment_link_id"))
+
+	// the link cannot be paid twice
+	assert.Equal(t, http.StatusGone, serve(httptest.NewRequest("GET", "/pay/"+link.Id, nil), "").Code)
+	assert.Equal(t, http.StatusGone, submit(match[1], cookies).Code)
+
+	w = serve(httptest.NewRequest("GET", "/api/payment-links/"+link.Id, nil), "merchant-1")
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&link))
+	assert.Equal(t, models.PaymentLinkCompleted, link.Status)
+	assert.Equal(t, redirect.Query().Get("payment_id"), link.PaymentId)
+
+	// yen have no minor unit
+	body = `{"amount":1250,"currency":"JPY","success_url":"https://shop.example.com/thanks","failure_url":"https://shop.example.com/sorry"}`
+	w = serve(httptest.NewRequest("POST", "/api/payment-links", strings.NewReader(body)), "merchant-1")
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&link))
+	assert.Contains(t, serve(httptest.NewRequest("GET", "/pay/"+link.Id, nil), "").Body.String(), "1250 JPY")
+}
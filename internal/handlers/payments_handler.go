@@ -4,11 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
 
 	"github.com/go-chi/chi/v5"
@@ -37,7 +41,7 @@ func NewPaymentsHandler(storage *repository.PaymentsRepository, domain *domain.D
 
 // GetHandler returns an http.HandlerFunc that handles HTTP GET requests.
 // It retrieves a payment record by its ID from the storage.
-// The ID is expected to be part of the URL.
+// The ID is expected to be part of the URL.  Merchants can only see their own payments.
 func (h *PaymentsHandler) GetHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
@@ -47,21 +51,35 @@ func (h *PaymentsHandler) GetHandler() http.HandlerFunc {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
 		payment := h.storage.GetPayment(id)
 
-		if payment == nil {
+		// other merchants' payments are not found rather than forbidden, so ids cannot be probed
+		if payment == nil || payment.MerchantID != merchantID {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 
 		paymentResponse := models.GetPaymentHandlerResponse{
-			Id:                 payment.Id,
-			Status:             payment.PaymentStatus,
-			LastFourCardDigits: payment.CardNumberLastFour,
-			ExpiryMonth:        payment.ExpiryMonth,
-			ExpiryYear:         payment.ExpiryYear,
-			Currency:           payment.Currency,
-			Amount:             payment.Amount,
+			Id:                   payment.Id,
+			Status:               payment.PaymentStatus,
+			LastFourCardDigits:   payment.CardNumberLastFour,
+			ExpiryMonth:          payment.ExpiryMonth,
+			ExpiryYear:           payment.ExpiryYear,
+			Currency:             payment.Currency,
+			Amount:               payment.Amount,
+			AuthorizationCode:    payment.AuthorizationCode,
+			AcquirerReference:    payment.AcquirerReference,
+			DeclineCode:          payment.DeclineCode,
+			SettlementCurrency:   payment.SettlementCurrency,
+			SettlementAmount:     payment.SettlementAmount,
+			FXRate:               payment.FXRate,
+			ChallengeURL:         payment.ChallengeURL,
+			NetworkTransactionId: payment.NetworkTransactionId,
+			ChargebackAmount:     payment.ChargebackAmount,
 		}
 
 		w.Header().Set(contentTypeHeader, jsonContentType)
@@ -85,9 +103,29 @@ func (ph *PaymentsHandler) PostHandler() http.HandlerFunc {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-
-		domainResponse, err := ph.domain.PaymentService.Create(&paymentRequest)
+		paymentRequest.MerchantID = MerchantIDFromContext(r.Context())
+		paymentRequest.ClientIP = ClientIP(r)
+		paymentRequest.RequestID = RequestID(r)
+
+		// clients opt in to async processing with the RFC 7240 Prefer header
+		async := ph.domain.AsyncPaymentService != nil && preferAsync(r)
+
+		var domainResponse *models.PostPaymentResponse
+		var err error
+		if async {
+			domainResponse, err = ph.domain.AsyncPaymentService.CreateAsync(&paymentRequest)
+		} else {
+			domainResponse, err = ph.domain.PaymentService.Create(&paymentRequest)
+		}
 		if err != nil {
+			if errors.Is(err, queue.ErrQueueFull) {
+				log.Printf("rejecting payment: %v", err)
+				w.Header().Set("Retry-After", "1")
+				writeJSON(w, http.StatusServiceUnavailable, HandlerErrorResponse{
+					Message: "Too many payments are being processed. Please try again later.",
+				})
+				return
+			}
 			var bankErr *gatewayerrors.BankError
 			if errors.As(err, &bankErr) && bankErr.StatusCode == http.StatusServiceUnavailable {
 				log.Printf("Error processing payment: %v", err)
@@ -103,6 +141,37 @@ func (ph *PaymentsHandler) PostHandler() http.HandlerFunc {
 				return
 
 			}
+			var limitErr *gatewayerrors.LimitError
+			if errors.As(err, &limitErr) {
+				log.Printf("velocity limit tripped: %v", err)
+				errorResponse := HandlerErrorResponse{
+					Message: "Too many payment attempts for this " + limitErr.Scope + ". Please try again later.",
+				}
+				w.Header().Set(contentTypeHeader, jsonContentType)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+				w.WriteHeader(http.StatusTooManyRequests)
+				if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
+					log.Printf("Failed to encode error response: %v", err)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				return
+			}
+			var profileErr *gatewayerrors.ProfileError
+			if errors.As(err, &profileErr) {
+				log.Printf("payment breaks merchant profile: %v", err)
+				errorResponse := &models.PostPayment400Response{
+					Id:            profileErr.ID,
+					PaymentStatus: "rejected",
+					ErrorCode:     profileErr.Code,
+				}
+				w.Header().Set(contentTypeHeader, jsonContentType)
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
+					log.Printf("Failed to encode error response: %v", err)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				return
+			}
 			var validationErr *gatewayerrors.ValidationError
 			if errors.As(err, &validationErr) {
 				log.Printf("validation error on field: %v", validationErr.GetFieldError())
@@ -124,10 +193,60 @@ func (ph *PaymentsHandler) PostHandler() http.HandlerFunc {
 			return
 		}
 
+		status := http.StatusOK
+		if async {
+			w.Header().Set("Preference-Applied", "respond-async")
+			if domainResponse.PaymentStatus == "processing" {
+				w.Header().Set("Location", "/api/payments/"+domainResponse.Id)
+				status = http.StatusAccepted
+			}
+		}
+
 		w.Header().Set(contentTypeHeader, jsonContentType)
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(status)
 		if err := json.NewEncoder(w).Encode(domainResponse); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	}
 }
+
+func preferAsync(r *http.Request) bool {
+	for _, value := range r.Header.Values("Prefer") {
+		for _, preference := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CallbackHandler is where the shopper lands after the 3-D Secure challenge, it resumes the payment.
+func (ph *PaymentsHandler) CallbackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payment, err := ph.domain.ThreeDSService.CompleteAuthentication(chi.URLParam(r, "id"))
+		if err != nil {
+			if errors.Is(err, domain.ErrPaymentNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, domain.ErrNotPendingAuthentication) {
+				writeJSON(w, http.StatusConflict, HandlerErrorResponse{Message: err.Error()})
+				return
+			}
+			var bankErr *gatewayerrors.BankError
+			if errors.As(err, &bankErr) && bankErr.StatusCode == http.StatusServiceUnavailable {
+				log.Printf("Error processing payment: %v", err)
+				writeJSON(w, http.StatusServiceUnavailable, HandlerErrorResponse{
+					Message: "The acquiring bank is currently unavailable. Please try again later.",
+				})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, payment)
+	}
+}
@@ -8,13 +8,17 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
+	clientmocks "github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain/mocks"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/threeds"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -31,6 +35,7 @@ func TestGetPaymentHandler(t *testing.T) {
 		ExpiryYear:         2035,
 		Currency:           "GBP",
 		Amount:             100,
+		MerchantID:         "merchant-1",
 	}
 	ps := repository.NewPaymentsRepository()
 	ps.AddPayment(savedPayment)
@@ -64,6 +69,7 @@ func TestGetPaymentHandler(t *testing.T) {
 		// Create a new HTTP request for testing
 		req, err := http.NewRequest("GET", "/api/payments/test-id", nil)
 		require.NoError(t, err)
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1"))
 
 		// Create a new HTTP request recorder for recording the response
 		w := httptest.NewRecorder()
@@ -85,6 +91,7 @@ func TestGetPaymentHandler(t *testing.T) {
 		// Create a new HTTP request for testing with a non-existing payment ID
 		req, err := http.NewRequest("GET", "/api/payments/NonExistingID", nil)
 		require.NoError(t, err)
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1"))
 
 		// Create a new HTTP request recorder for recording the response
 		w := httptest.NewRecorder()
@@ -94,6 +101,20 @@ func TestGetPaymentHandler(t *testing.T) {
 		// Check the HTTP status code in the response
 		assert.Equal(t, w.Code, http.StatusNotFound)
 	})
+	t.Run("OtherMerchant", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/payments/test-id", nil)
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-2"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("Anonymous", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/payments/test-id", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
 }
 
 func TestPostPaymentHandler(t *testing.T) {
@@ -456,3 +477,208 @@ func getLastFourCharacters(t *testing.T, i int) string {
 	require.Equal(t, 16, len(s))
 	return s[len(s)-4:]
 }
+
+func TestPostPaymentHandler_VelocityLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockPaymentService := mocks.NewMockPaymentService(ctrl)
+	defer ctrl.Finish()
+
+	mockDomain := &domain.Domain{
+		PaymentService: mockPaymentService,
+	}
+
+	payments := handlers.NewPaymentsHandler(nil, mockDomain)
+
+	r := chi.NewRouter()
+	r.Post("/api/payments", payments.PostHandler())
+
+	postPayment := &models.PostPaymentHandlerRequest{
+		CardNumber:  2222405343248877,
+		ExpiryMonth: 4,
+		ExpiryYear:  2025,
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         123,
+		ClientIP:    "192.0.2.1",
+	}
+
+	body, err := json.Marshal(postPayment)
+	require.NoError(t, err)
+
+	mockedError := gatewayerrors.NewLimitError(errors.New("card count limit exceeded"), "card", 1500*time.Millisecond)
+	mockPaymentService.EXPECT().Create(postPayment).Return(nil, mockedError)
+
+	req := httptest.NewRequest("POST", "/api/payments", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	var response handlers.HandlerErrorResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, "Too many payment attempts for this card. Please try again later.", response.Message)
+}
+
+func TestGetPaymentHandler_BankReferences(t *testing.T) {
+	ps := repository.NewPaymentsRepository()
+	ps.AddPayment(models.PostPaymentResponse{
+		Id:                 "test-id",
+		PaymentStatus:      "authorized",
+		CardNumberLastFour: 1234,
+		ExpiryMonth:        10,
+		ExpiryYear:         2035,
+		Currency:           "GBP",
+		Amount:             100,
+		AuthorizationCode:  "auth-code",
+		AcquirerReference:  "acq-ref",
+		BankResponseCode:   "00",
+		BankResponseTime:   150 * time.Millisecond,
+		MerchantID:         "merchant-1",
+	})
+
+	payments := handlers.NewPaymentsHandler(ps, nil)
+
+	r := chi.NewRouter()
+	r.Get("/api/payments/{id}", payments.GetHandler())
+
+	req := httptest.NewRequest("GET", "/api/payments/test-id", nil)
+	req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response map[string]any
+	err := json.NewDecoder(w.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, "auth-code", response["authorization_code"])
+	assert.Equal(t, "acq-ref", response["acquirer_reference"])
+	assert.NotContains(t, response, "bank_response_code")
+}
+
+func TestPostPaymentHandler_ProfileError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockPaymentService := mocks.NewMockPaymentService(ctrl)
+	defer ctrl.Finish()
+
+	payments := handlers.NewPaymentsHandler(nil, &domain.Domain{PaymentService: mockPaymentService})
+
+	r := chi.NewRouter()
+	r.Post("/api/payments", payments.PostHandler())
+
+	mockedError := gatewayerrors.NewProfileError(errors.New("amount is above the maximum of 100"), "payment-id", domain.ErrorCodeAmountAboveMaximum)
+	mockPaymentService.EXPECT().Create(gomock.Any()).Return(nil, mockedError)
+
+	req := httptest.NewRequest("POST", "/api/payments", bytes.NewBufferString(`{"amount": 1000}`))
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	var response models.PostPayment400Response
+	err := json.NewDecoder(w.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "payment-id", response.Id)
+	assert.Equal(t, "rejected", response.PaymentStatus)
+	assert.Equal(t, domain.ErrorCodeAmountAboveMaximum, response.ErrorCode)
+}
+
+func TestThreeDSCallbackHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := clientmocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{Authorised: true}, nil)
+
+	simulator := threeds.NewSimulator("http://gateway.test")
+	repo := repository.NewPaymentsRepository()
+	service := domain.NewPaymentServiceImpl(repo, mockClient, domain.WithThreeDS(simulator, threeds.DefaultConfig(), "http://gateway.test"))
+	payments := handlers.NewPaymentsHandler(repo, &domain.Domain{PaymentService: service, ThreeDSService: service})
+
+	r := chi.NewRouter()
+	r.Get("/api/payments/{id}/3ds/callback", payments.CallbackHandler())
+
+	payment, err := service.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:  4111111111111111,
+		ExpiryMonth: 12,
+		ExpiryYear:  time.Now().Year() + 1,
+		Currency:    "EUR",
+		Amount:      5000,
+		Cvv:         123,
+	})
+	require.NoError(t, err)
+	_, err = simulator.Complete(payment.ThreeDSTransactionId, threeds.SimulatorCode)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/payments/"+payment.Id+"/3ds/callback", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.PostPaymentResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "authorized", response.PaymentStatus)
+	assert.Equal(t, "05", response.ECI)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/payments/"+payment.Id+"/3ds/callback", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/payments/missing/3ds/callback", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPostPaymentHandler_Async(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := repository.NewPaymentsRepository()
+	paymentQueue, err := queue.New(queue.Config{Size: 1, Workers: 1}, queue.NewMemoryJournal())
+	require.NoError(t, err)
+	service := domain.NewPaymentServiceImpl(repo, clientmocks.NewMockClient(ctrl), domain.WithQueue(paymentQueue))
+	payments := handlers.NewPaymentsHandler(repo, &domain.Domain{PaymentService: service, AsyncPaymentService: service})
+
+	r := chi.NewRouter()
+	r.Post("/api/payments", payments.PostHandler())
+	r.Get("/api/payments/{id}", payments.GetHandler())
+
+	post := func() *httptest.ResponseRecorder {
+		body, err := json.Marshal(&models.PostPaymentHandlerRequest{
+			CardNumber:  2222405343248877,
+			ExpiryMonth: 12,
+			ExpiryYear:  time.Now().Year() + 1,
+			Currency:    "GBP",
+			Amount:      100,
+			Cvv:         123,
+		})
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", "/api/payments", bytes.NewBuffer(body))
+		req.Header.Set("Prefer", "respond-async, wait=0")
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post()
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "respond-async", w.Header().Get("Preference-Applied"))
+
+	var response models.PostPaymentResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "processing", response.PaymentStatus)
+	assert.Equal(t, "/api/payments/"+response.Id, w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/payments/"+response.Id, nil)
+	r.ServeHTTP(w, req.WithContext(handlers.WithMerchantID(req.Context(), "merchant-1")))
+	var polled models.GetPaymentHandlerResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&polled))
+	assert.Equal(t, "processing", polled.Status)
+
+	w = post()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/reconciliation"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxSettlementFileSize keeps a single upload from eating all of our memory.
+const maxSettlementFileSize = 50 << 20
+
+type ReconciliationHandler struct {
+	storage *repository.ReconciliationsRepository
+	domain  *domain.Domain
+}
+
+func NewReconciliationHandler(storage *repository.ReconciliationsRepository, domain *domain.Domain) *ReconciliationHandler {
+	return &ReconciliationHandler{
+		storage: storage,
+		domain:  domain,
+	}
+}
+
+// PostHandler reconciles the settlement file in the request body, the format, acquirer
+// and the from/to dates (YYYY-MM-DD) are taken from the query string.
+func (h *ReconciliationHandler) PostHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		request := domain.ReconciliationRequest{
+			Format:   query.Get("format"),
+			Acquirer: query.Get("acquirer"),
+		}
+		if request.Format == "" {
+			request.Format = reconciliation.FormatCSV
+		}
+
+		var err error
+		if request.From, err = parseDate(query.Get("from")); err != nil {
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid from date"})
+			return
+		}
+		if request.To, err = parseDate(query.Get("to")); err != nil {
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid to date"})
+			return
+		}
+
+		report, err := h.domain.ReconciliationService.Reconcile(http.MaxBytesReader(w, r.Body, maxSettlementFileSize), request)
+		if err != nil {
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				log.Printf("invalid settlement file: %v", err)
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.Error()})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		recordChange(r, h.domain.Audit, audit.Change{Resource: "reconciliation", ResourceID: report.Id, After: report})
+		writeJSON(w, http.StatusCreated, report)
+	}
+}
+
+func (h *ReconciliationHandler) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := h.storage.GetReport(chi.URLParam(r, "id"))
+		if report == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
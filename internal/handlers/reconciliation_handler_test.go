@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconciliationHandler(t *testing.T) {
+	payments := repository.NewPaymentsRepository()
+	payments.AddPayment(models.PostPaymentResponse{
+		Id:                "in-range",
+		PaymentStatus:     "authorized",
+		Amount:            100,
+		Currency:          "GBP",
+		Acquirer:          "simulator",
+		AcquirerReference: "ref-1",
+		CreatedAt:         time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+	})
+	payments.AddPayment(models.PostPaymentResponse{
+		Id:                "next-day",
+		PaymentStatus:     "authorized",
+		Amount:            100,
+		Currency:          "GBP",
+		Acquirer:          "simulator",
+		AcquirerReference: "ref-2",
+		CreatedAt:         time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+	})
+	payments.AddPayment(models.PostPaymentResponse{
+		Id:                "declined",
+		PaymentStatus:     "declined",
+		Amount:            100,
+		Currency:          "GBP",
+		Acquirer:          "simulator",
+		AcquirerReference: "ref-3",
+		CreatedAt:         time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+	})
+
+	reports := repository.NewReconciliationsRepository()
+	reconciliations := handlers.NewReconciliationHandler(reports, &domain.Domain{
+		ReconciliationService: domain.NewReconciliationServiceImpl(payments, reports),
+	})
+
+	r := chi.NewRouter()
+	r.Post("/api/admin/reconciliations", reconciliations.PostHandler())
+	r.Get("/api/admin/reconciliations/{id}", reconciliations.GetHandler())
+
+	file := "acquirer_reference,amount,currency\nref-1,100,GBP\n"
+	req := httptest.NewRequest("POST", "/api/admin/reconciliations?acquirer=simulator&from=2024-01-01&to=2024-01-02", strings.NewReader(file))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var report models.ReconciliationReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, models.ReconciliationSummary{Matched: 1}, report.Summary)
+	assert.Equal(t, "in-range", report.Matched[0].PaymentId)
+
+	req = httptest.NewRequest("GET", "/api/admin/reconciliations/"+report.Id, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/api/admin/reconciliations/unknown", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReconciliationHandler_InvalidFile(t *testing.T) {
+	reports := repository.NewReconciliationsRepository()
+	reconciliations := handlers.NewReconciliationHandler(reports, &domain.Domain{
+		ReconciliationService: domain.NewReconciliationServiceImpl(repository.NewPaymentsRepository(), reports),
+	})
+
+	r := chi.NewRouter()
+	r.Post("/api/admin/reconciliations", reconciliations.PostHandler())
+
+	req := httptest.NewRequest("POST", "/api/admin/reconciliations?format=fixed", strings.NewReader("too short\n"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("POST", "/api/admin/reconciliations?from=yesterday", strings.NewReader(""))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
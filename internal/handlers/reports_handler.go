@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/reporting"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+)
+
+type ReportsHandler struct {
+	storage *repository.PaymentsRepository
+}
+
+func NewReportsHandler(storage *repository.PaymentsRepository) *ReportsHandler {
+	return &ReportsHandler{
+		storage: storage,
+	}
+}
+
+// PaymentsExportHandler streams the payments for a merchant and date range as CSV or JSON Lines.
+// Query parameters are format (csv or jsonl), merchant, from and to (YYYY-MM-DD, to is exclusive) and columns.
+func (h *ReportsHandler) PaymentsExportHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		format := query.Get("format")
+		contentType := ""
+		switch format {
+		case "", reporting.FormatCSV:
+			format = reporting.FormatCSV
+			contentType = "text/csv"
+		case reporting.FormatJSONL:
+			contentType = "application/x-ndjson"
+		default:
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "unsupported format"})
+			return
+		}
+
+		columns, err := reporting.ParseColumns(query.Get("columns"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: err.Error()})
+			return
+		}
+
+		filter := reporting.Filter{MerchantID: query.Get("merchant")}
+		if filter.From, err = parseDate(query.Get("from")); err != nil {
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid from date"})
+			return
+		}
+		if filter.To, err = parseDate(query.Get("to")); err != nil {
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid to date"})
+			return
+		}
+
+		w.Header().Set(contentTypeHeader, contentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=payments."+format)
+		w.WriteHeader(http.StatusOK)
+
+		// the status has already gone out, all we can do is log and cut the export short
+		if err := reporting.Export(w, h.storage, format, columns, filter); err != nil {
+			log.Printf("payments export failed: %v", err)
+		}
+	}
+}
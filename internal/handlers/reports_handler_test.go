@@ -0,0 +1,38 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentsExportHandler(t *testing.T) {
+	ps := repository.NewPaymentsRepository()
+	ps.AddPayment(models.PostPaymentResponse{Id: "test-id", PaymentStatus: "authorized", Amount: 100, Currency: "GBP"})
+
+	reports := handlers.NewReportsHandler(ps)
+
+	r := chi.NewRouter()
+	r.Get("/api/admin/reports/payments", reports.PaymentsExportHandler())
+
+	req := httptest.NewRequest("GET", "/api/admin/reports/payments?format=csv&columns=id,amount", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "id,amount\ntest-id,100\n\ncurrency,status,count,amount\nGBP,authorized,1,100\n", w.Body.String())
+
+	for _, query := range []string{"format=xml", "columns=cvv", "from=yesterday"} {
+		req = httptest.NewRequest("GET", "/api/admin/reports/payments?"+query, nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
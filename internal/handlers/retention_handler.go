@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// RetentionHandler runs the retention policies and erasures on demand, the changes are audited by the domain.
+type RetentionHandler struct {
+	domain *domain.Domain
+}
+
+func NewRetentionHandler(domain *domain.Domain) *RetentionHandler {
+	return &RetentionHandler{
+		domain: domain,
+	}
+}
+
+// RunHandler applies the merchants' retention policies now, with dry_run=true it only reports what
+// would be anonymised and deleted.
+func (h *RetentionHandler) RunHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dryRun := false
+		if value := r.URL.Query().Get("dry_run"); value != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(value); err != nil {
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid dry_run"})
+				return
+			}
+		}
+
+		report, err := h.domain.RetentionService.ApplyRetention(dryRun, Actor(r))
+		if err != nil {
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+// EraseHandler scrubs a card holder's personal data from their payments.
+func (h *RetentionHandler) EraseHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request models.ErasureRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("Error decoding request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		report, err := h.domain.RetentionService.Erase(&request, Actor(r))
+		if err != nil {
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				log.Printf("validation error on field: %v", validationErr.GetFieldError())
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.Error()})
+				return
+			}
+			if errors.Is(err, domain.ErrErasurePending) {
+				writeJSON(w, http.StatusConflict, HandlerErrorResponse{Message: err.Error()})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, report)
+	}
+}
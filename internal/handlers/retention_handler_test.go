@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionHandler(t *testing.T) {
+	payments := repository.NewPaymentsRepository()
+	payments.AddPayment(models.PostPaymentResponse{
+		Id:              "payment-1",
+		MerchantID:      "merchant-1",
+		PaymentStatus:   "authorized",
+		CardFingerprint: "fp-1",
+		Amount:          1000,
+		Currency:        "GBP",
+		CreatedAt:       time.Now().AddDate(-1, 0, 0),
+	})
+	merchants := repository.NewMerchantsRepository()
+	merchants.PutProfile(models.MerchantProfile{MerchantID: "merchant-1", Retention: &models.RetentionPolicy{Days: 180, Action: models.RetentionDelete}})
+
+	retention := handlers.NewRetentionHandler(&domain.Domain{
+		RetentionService: domain.NewRetentionServiceImpl(payments, merchants),
+	})
+	r := chi.NewRouter()
+	r.Post("/api/admin/retention/run", retention.RunHandler())
+	r.Post("/api/admin/erasures", retention.EraseHandler())
+
+	t.Run("erasure dry run", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/admin/erasures", strings.NewReader(`{"card_fingerprint":"fp-1","dry_run":true}`)))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var report models.ErasureReport
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+		assert.True(t, report.DryRun)
+		assert.Equal(t, []string{"payment-1"}, report.PaymentIds)
+	})
+
+	t.Run("erasure without a card", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/admin/erasures", strings.NewReader(`{}`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("retention dry run", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/admin/retention/run?dry_run=true", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var report models.RetentionReport
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+		assert.Equal(t, []string{"payment-1"}, report.Deleted)
+		assert.NotNil(t, payments.GetPayment("payment-1"))
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/admin/retention/run", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Nil(t, payments.GetPayment("payment-1"))
+	})
+
+	t.Run("invalid dry run", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/admin/retention/run?dry_run=maybe", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SettlementsHandler struct {
+	storage *repository.SettlementsRepository
+	domain  *domain.Domain
+}
+
+func NewSettlementsHandler(storage *repository.SettlementsRepository, domain *domain.Domain) *SettlementsHandler {
+	return &SettlementsHandler{
+		storage: storage,
+		domain:  domain,
+	}
+}
+
+// ListHandler returns the settlement batches of the calling merchant, optionally for a single date (YYYY-MM-DD).
+func (h *SettlementsHandler) ListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		date := r.URL.Query().Get("date")
+		if _, err := parseDate(date); err != nil {
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid date"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, h.storage.ListBatches(merchantID, date))
+	}
+}
+
+// GetHandler returns a settlement batch with its lines, merchants can only see their own batches.
+func (h *SettlementsHandler) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		batch := h.storage.GetBatch(chi.URLParam(r, "id"))
+		if batch == nil || batch.MerchantID != merchantID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, batch)
+	}
+}
+
+// RunHandler builds the batches for the given date, defaulting to yesterday (UTC).
+func (h *SettlementsHandler) RunHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date, err := parseDate(r.URL.Query().Get("date"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: "invalid date"})
+			return
+		}
+		if date == nil {
+			yesterday := time.Now().UTC().AddDate(0, 0, -1)
+			date = &yesterday
+		}
+
+		batches, err := h.domain.SettlementService.RunBatches(*date)
+		if err != nil {
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for _, batch := range batches {
+			recordChange(r, h.domain.Audit, audit.Change{Resource: "settlement", ResourceID: batch.Id, After: batch})
+		}
+		writeJSON(w, http.StatusCreated, batches)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/settlement"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettlementsHandler(t *testing.T) {
+	payments := repository.NewPaymentsRepository()
+	for _, merchantID := range []string{"m-1", "m-2"} {
+		payments.AddPayment(models.PostPaymentResponse{
+			Id:            merchantID + "-payment",
+			MerchantID:    merchantID,
+			PaymentStatus: "authorized",
+			Amount:        10000,
+			Currency:      "GBP",
+			CardScheme:    "visa",
+			CreatedAt:     time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		})
+	}
+
+	storage := repository.NewSettlementsRepository()
+	settlements := handlers.NewSettlementsHandler(storage, &domain.Domain{
+		SettlementService: domain.NewSettlementServiceImpl(payments, storage, settlement.DefaultFeeSchedule()),
+	})
+
+	r := chi.NewRouter()
+	r.Post("/api/admin/settlements/run", settlements.RunHandler())
+	r.Get("/api/settlements", settlements.ListHandler())
+	r.Get("/api/settlements/{id}", settlements.GetHandler())
+
+	run := func() []models.SettlementBatch {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/api/admin/settlements/run?date=2024-01-01", nil))
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var batches []models.SettlementBatch
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&batches))
+		return batches
+	}
+
+	batches := run()
+	require.Len(t, batches, 2)
+	assert.Equal(t, 9680, batches[0].Net)
+
+	t.Run("running the same day again does not settle twice", func(t *testing.T) {
+		assert.Empty(t, run())
+	})
+
+	t.Run("merchants only see their own batches", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/settlements?date=2024-01-01", nil)
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), "m-1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var listed []models.SettlementBatch
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+		require.Len(t, listed, 1)
+		assert.Equal(t, "m-1", listed[0].MerchantID)
+		assert.Empty(t, listed[0].Lines)
+
+		other := batches[1]
+		req = httptest.NewRequest("GET", "/api/settlements/"+other.Id, nil)
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), "m-1"))
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("a merchant is required", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/settlements?date=2024-01-01", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/settlements/"+batches[0].Id, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("get returns the lines", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/settlements/"+batches[0].Id, nil)
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), "m-1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var batch models.SettlementBatch
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&batch))
+		require.Len(t, batch.Lines, 1)
+		assert.Equal(t, "m-1-payment", batch.Lines[0].PaymentId)
+		assert.Equal(t, 320, batch.Lines[0].Fee)
+	})
+
+	t.Run("a refund of a settled payment goes into the next batch", func(t *testing.T) {
+		_, err := payments.ModifyPayment("m-1-payment", func(payment *models.PostPaymentResponse) error {
+			payment.PaymentStatus = "refunded"
+			return nil
+		})
+		require.NoError(t, err)
+
+		refunds := run()
+		require.Len(t, refunds, 1)
+		require.Len(t, refunds[0].Lines, 1)
+		assert.Equal(t, models.SettlementLineRefund, refunds[0].Lines[0].Type)
+		assert.Equal(t, -10000, refunds[0].Lines[0].Amount)
+		assert.Empty(t, run())
+	})
+
+	t.Run("invalid date", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/settlements?date=yesterday", nil)
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), "m-1"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SubscriptionsHandler struct {
+	storage *repository.SubscriptionsRepository
+	domain  *domain.Domain
+}
+
+func NewSubscriptionsHandler(storage *repository.SubscriptionsRepository, domain *domain.Domain) *SubscriptionsHandler {
+	return &SubscriptionsHandler{
+		storage: storage,
+		domain:  domain,
+	}
+}
+
+func (h *SubscriptionsHandler) PostHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		var request models.SubscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("Error decoding request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		request.MerchantID = merchantID
+
+		subscription, err := h.domain.SubscriptionService.CreateSubscription(&request)
+		if err != nil {
+			var validationErr *gatewayerrors.ValidationError
+			if errors.As(err, &validationErr) {
+				log.Printf("validation error on field: %v", validationErr.GetFieldError())
+				writeJSON(w, http.StatusBadRequest, HandlerErrorResponse{Message: validationErr.Error()})
+				return
+			}
+			var profileErr *gatewayerrors.ProfileError
+			if errors.Is(err, domain.ErrCardNotVerified) || errors.As(err, &profileErr) {
+				writeJSON(w, http.StatusUnprocessableEntity, HandlerErrorResponse{Message: err.Error()})
+				return
+			}
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		recordChange(r, h.domain.Audit, audit.Change{Resource: "subscription", ResourceID: subscription.Id, After: subscription})
+		w.Header().Set("Location", "/api/subscriptions/"+subscription.Id)
+		writeJSON(w, http.StatusCreated, subscription)
+	}
+}
+
+// ListHandler returns the subscriptions of the calling merchant.
+func (h *SubscriptionsHandler) ListHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, ok := callerMerchant(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, h.storage.ListSubscriptions(merchantID))
+	}
+}
+
+// GetHandler returns a subscription, merchants can only see their own subscriptions.
+func (h *SubscriptionsHandler) GetHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription := h.find(w, r)
+		if subscription == nil {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, subscription)
+	}
+}
+
+func (h *SubscriptionsHandler) PauseHandler() http.HandlerFunc {
+	return h.transition("subscription.paused", func(id string) (*models.Subscription, error) {
+		return h.domain.SubscriptionService.PauseSubscription(id)
+	})
+}
+
+func (h *SubscriptionsHandler) ResumeHandler() http.HandlerFunc {
+	return h.transition("subscription.resumed", func(id string) (*models.Subscription, error) {
+		return h.domain.SubscriptionService.ResumeSubscription(id)
+	})
+}
+
+func (h *SubscriptionsHandler) CancelHandler() http.HandlerFunc {
+	return h.transition("subscription.cancelled", func(id string) (*models.Subscription, error) {
+		return h.domain.SubscriptionService.CancelSubscription(id)
+	})
+}
+
+// transition makes the change to the subscription in the URL and records it in the audit log as action.
+func (h *SubscriptionsHandler) transition(action string, change func(id string) (*models.Subscription, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscription := h.find(w, r)
+		if subscription == nil {
+			return
+		}
+
+		updated, err := change(subscription.Id)
+		switch {
+		case errors.Is(err, domain.ErrSubscriptionNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, domain.ErrSubscriptionTransition):
+			writeJSON(w, http.StatusConflict, HandlerErrorResponse{Message: "subscription is " + subscription.Status})
+		case err != nil:
+			log.Printf("Unsupported error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			recordChange(r, h.domain.Audit, audit.Change{Action: action, Resource: "subscription", ResourceID: updated.Id, After: updated})
+			writeJSON(w, http.StatusOK, updated)
+		}
+	}
+}
+
+// find returns the subscription in the URL when it belongs to the calling merchant, otherwise it answers the
+// request itself and returns nil.
+func (h *SubscriptionsHandler) find(w http.ResponseWriter, r *http.Request) *models.Subscription {
+	merchantID, ok := callerMerchant(w, r)
+	if !ok {
+		return nil
+	}
+	subscription := h.storage.GetSubscription(chi.URLParam(r, "id"))
+	if subscription == nil || subscription.MerchantID != merchantID {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	return subscription
+}
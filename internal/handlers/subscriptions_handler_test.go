@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/audit"
+	clientmocks "github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSubscriptionsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := clientmocks.NewMockClient(ctrl)
+	// the card is verified when the subscription is created, the second card is declined
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).DoAndReturn(func(request *models.PostPaymentBankRequest) (*models.PostPaymentBankResponse, error) {
+		return &models.PostPaymentBankResponse{Authorised: request.CardNumber == "2222405343248877", NetworkTransactionId: "ntid-1"}, nil
+	}).Times(2)
+
+	subscriptions := repository.NewSubscriptionsRepository()
+	payments := domain.NewPaymentServiceImpl(repository.NewPaymentsRepository(), mockClient)
+	auditLog := audit.NewLog()
+	h := handlers.NewSubscriptionsHandler(subscriptions, &domain.Domain{
+		SubscriptionService: domain.NewSubscriptionServiceImpl(payments, subscriptions, domain.DefaultDunningConfig()),
+		Audit:               auditLog,
+	})
+
+	r := chi.NewRouter()
+	r.Post("/api/subscriptions", h.PostHandler())
+	r.Get("/api/subscriptions", h.ListHandler())
+	r.Get("/api/subscriptions/{id}", h.GetHandler())
+	r.Post("/api/subscriptions/{id}/resume", h.ResumeHandler())
+	r.Post("/api/subscriptions/{id}/cancel", h.CancelHandler())
+
+	serve := func(method, target, body, merchantID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(handlers.WithMerchantID(req.Context(), merchantID))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	body := `{"card_number":2222405343248877,"expiry_month":12,"expiry_year":` + strconv.Itoa(time.Now().Year()+1) +
+		`,"cvv":123,"currency":"GBP","amount":999,"interval":"month","trial_days":14}`
+	w := serve("POST", "/api/subscriptions", body, "merchant-1")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "2222405343248877")
+
+	var subscription models.Subscription
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&subscription))
+	assert.Equal(t, models.SubscriptionTrialing, subscription.Status)
+	assert.Equal(t, 8877, subscription.CardNumberLastFour)
+
+	assert.Equal(t, http.StatusOK, serve("GET", "/api/subscriptions/"+subscription.Id, "", "merchant-1").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/api/subscriptions/"+subscription.Id, "", "merchant-2").Code)
+	assert.Equal(t, http.StatusNotFound, serve("POST", "/api/subscriptions/"+subscription.Id+"/cancel", "", "merchant-2").Code)
+
+	w = serve("GET", "/api/subscriptions", "", "merchant-2")
+	assert.JSONEq(t, "[]", w.Body.String())
+
+	assert.Equal(t, http.StatusConflict, serve("POST", "/api/subscriptions/"+subscription.Id+"/resume", "", "merchant-1").Code)
+	assert.Equal(t, http.StatusOK, serve("POST", "/api/subscriptions/"+subscription.Id+"/cancel", "", "merchant-1").Code)
+
+	entries, err := auditLog.Entries(audit.Query{Resource: "subscription", ResourceID: subscription.Id})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "subscription.created", entries[0].Action)
+	assert.Equal(t, "merchant-1", entries[0].Actor)
+	assert.NotContains(t, string(entries[0].After), "2222405343248877")
+	assert.Equal(t, "subscription.cancelled", entries[1].Action)
+
+	w = serve("POST", "/api/subscriptions", `{"interval":"month"}`, "merchant-1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve("POST", "/api/subscriptions", strings.Replace(body, "2222405343248877", "2222405343248878", 1), "merchant-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
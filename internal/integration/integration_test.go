@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/api"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/auth"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/config"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
 	"github.com/google/uuid"
@@ -19,7 +21,9 @@ import (
 
 func TestPostGetPaymentHandler_Integration(t *testing.T) {
 	ctx := context.Background()
-	api := api.New()
+	cfg := config.Dev(t.TempDir())
+	cfg.Merchants = auth.Tokens{"merchant-1": auth.Hash("secret")}
+	api := api.New(cfg)
 
 	go func() {
 		api.Run(ctx, ":8090")
@@ -39,6 +43,7 @@ func TestPostGetPaymentHandler_Integration(t *testing.T) {
 
 	req, err := http.NewRequest("POST", "http://localhost:8090/api/payments", bytes.NewBuffer(body))
 	require.NoError(t, err)
+	req.SetBasicAuth("merchant-1", "secret")
 
 	resp, err := http.DefaultClient.Do(req)
 	require.NoError(t, err)
@@ -64,6 +69,7 @@ func TestPostGetPaymentHandler_Integration(t *testing.T) {
 
 	reqGet, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:8090/api/payments/%s", response.Id), bytes.NewBuffer(body))
 	require.NoError(t, err)
+	reqGet.SetBasicAuth("merchant-1", "secret")
 
 	respGet, err := http.DefaultClient.Do(reqGet)
 	require.NoError(t, err)
@@ -83,7 +89,7 @@ func TestPostGetPaymentHandler_Integration(t *testing.T) {
 
 func TestPostPaymentHandler_IntegrationCardNumberValidationError(t *testing.T) {
 	ctx := context.Background()
-	api := api.New()
+	api := api.New(config.Dev(t.TempDir()))
 
 	go func() {
 		api.Run(ctx, ":8090")
@@ -119,7 +125,7 @@ func TestPostPaymentHandler_IntegrationCardNumberValidationError(t *testing.T) {
 
 func TestPostPaymentHandler_IntegrationBankError(t *testing.T) {
 	ctx := context.Background()
-	api := api.New()
+	api := api.New(config.Dev(t.TempDir()))
 
 	go func() {
 		api.Run(ctx, ":8090")
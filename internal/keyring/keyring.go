@@ -0,0 +1,386 @@
+package keyring
+
+/*
+Sensitive fields are encrypted with envelope encryption.  Every value gets its own random data key which encrypts it with AES-256-GCM, the data key is in turn encrypted (wrapped) with the primary key of the keyring.  The sealed value carries the id of the key that wrapped its data key, so older values still open after the keyring has moved on to a new primary key.  Rotating only has to rewrap the data keys, the values themselves are never decrypted for it.
+
+The keyring lives in a local JSON file that only the gateway can read, the keys command of the CLI generates and rotates it.  The gateway picks up a rotated file while running.
+*/
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sealedVersion = "v1"
+	keySize       = 32
+)
+
+var (
+	ErrUnknownKey = errors.New("sealed with a key that is not in the keyring")
+	ErrMalformed  = errors.New("malformed sealed value")
+)
+
+type Key struct {
+	Id        string    `json:"id"`
+	Secret    []byte    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// File is the layout of the keyring file, values are wrapped with the Primary key.
+type File struct {
+	Primary string `json:"primary"`
+	Keys    []Key  `json:"keys"`
+}
+
+func newKey() (Key, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, keySize)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+	return Key{Id: hex.EncodeToString(id), Secret: secret, CreatedAt: time.Now().UTC()}, nil
+}
+
+// Generate writes a new keyring with a single key to path, an existing keyring is never overwritten.
+func Generate(path string) (Key, error) {
+	if _, err := os.Stat(path); err == nil {
+		return Key{}, fmt.Errorf("%s already exists", path)
+	}
+	key, err := newKey()
+	if err != nil {
+		return Key{}, err
+	}
+	return key, write(path, File{Primary: key.Id, Keys: []Key{key}})
+}
+
+// Rotate adds a new key to the keyring at path and makes it the primary one.  The old keys stay so
+// values wrapped with them can still be opened until they have been rewrapped.
+func Rotate(path string) (Key, error) {
+	file, err := read(path)
+	if err != nil {
+		return Key{}, err
+	}
+	key, err := newKey()
+	if err != nil {
+		return Key{}, err
+	}
+	file.Keys = append(file.Keys, key)
+	file.Primary = key.Id
+	return key, write(path, file)
+}
+
+// List returns the keys in the keyring at path and the id of the primary one.
+func List(path string) (File, error) {
+	return read(path)
+}
+
+func read(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, validate(file)
+}
+
+func validate(file File) error {
+	hasPrimary := false
+	for _, key := range file.Keys {
+		if len(key.Secret) != keySize {
+			return fmt.Errorf("key %s is %d bytes, expected %d", key.Id, len(key.Secret), keySize)
+		}
+		if key.Id == "" || strings.Contains(key.Id, ":") {
+			return fmt.Errorf("invalid key id %q", key.Id)
+		}
+		hasPrimary = hasPrimary || key.Id == file.Primary
+	}
+	if !hasPrimary {
+		return fmt.Errorf("primary key %q is not in the keyring", file.Primary)
+	}
+	return nil
+}
+
+// write replaces the keyring through a temporary file so a reader never sees half a keyring.
+func write(path string, file File) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Keyring seals and opens values with the keys from a keyring file.
+type Keyring struct {
+	mu      sync.RWMutex
+	path    string
+	modTime time.Time
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// Open loads the keyring file at path.
+func Open(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if _, err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// New returns a keyring that is only kept in memory, handy for tests.
+func New(file File) (*Keyring, error) {
+	k := &Keyring{}
+	if err := k.load(file); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the keyring file again when it changed since it was last read, it reports whether it did.
+func (k *Keyring) Reload() (bool, error) {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return false, err
+	}
+	k.mu.RLock()
+	unchanged := info.ModTime().Equal(k.modTime)
+	k.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	file, err := read(k.path)
+	if err != nil {
+		return false, err
+	}
+	if err := k.load(file); err != nil {
+		return false, err
+	}
+	k.mu.Lock()
+	k.modTime = info.ModTime()
+	k.mu.Unlock()
+	return true, nil
+}
+
+func (k *Keyring) load(file File) error {
+	if err := validate(file); err != nil {
+		return err
+	}
+	keys := map[string]cipher.AEAD{}
+	for _, key := range file.Keys {
+		aead, err := newAEAD(key.Secret)
+		if err != nil {
+			return err
+		}
+		keys[key.Id] = aead
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.primary = file.Primary
+	k.keys = keys
+	return nil
+}
+
+// Primary is the id of the key new values are wrapped with.
+func (k *Keyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.primary
+}
+
+// Seal encrypts plaintext.  The same context has to be given to Unseal, it ties the value to the
+// record and field it was sealed for so it cannot be moved to another one.
+func (k *Keyring) Seal(plaintext, context []byte) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, plaintext, context)
+	if err != nil {
+		return "", err
+	}
+
+	k.mu.RLock()
+	keyID, kek := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+	wrapped, err := seal(kek, dataKey, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	return format(keyID, wrapped, ciphertext), nil
+}
+
+// Unseal decrypts a value sealed with any key still in the keyring.
+func (k *Keyring) Unseal(sealed string, context []byte) ([]byte, error) {
+	keyID, wrapped, ciphertext, err := parse(sealed)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, ciphertext, context)
+}
+
+// Rewrap wraps the data key of sealed with the primary key, values already wrapped with it come back as they are.
+func (k *Keyring) Rewrap(sealed string) (string, error) {
+	keyID, wrapped, ciphertext, err := parse(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	k.mu.RLock()
+	primary, kek := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+	if keyID == primary {
+		return sealed, nil
+	}
+
+	dataKey, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err = seal(kek, dataKey, []byte(primary))
+	if err != nil {
+		return "", err
+	}
+	return format(primary, wrapped, ciphertext), nil
+}
+
+// Current reports whether sealed is wrapped with the primary key.
+func (k *Keyring) Current(sealed string) bool {
+	keyID, _, _, err := parse(sealed)
+	return err == nil && keyID == k.Primary()
+}
+
+func (k *Keyring) unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	kek, ok := k.keys[keyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return open(kek, wrapped, []byte(keyID))
+}
+
+// Rewrapper is a store of sealed values that can move them over to the primary key of its keyring.
+type Rewrapper interface {
+	Rewrap() (int, error)
+}
+
+// Run reloads the keyring file every interval and has stores rewrap their values with the primary key,
+// so a rotated keyring is picked up and applied without a restart.
+func (k *Keyring) Run(ctx context.Context, interval time.Duration, stores ...Rewrapper) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if changed, err := k.Reload(); err != nil {
+				log.Printf("could not reload keyring: %v", err)
+			} else if changed {
+				log.Printf("keyring reloaded, primary key %s", k.Primary())
+			}
+			for _, store := range stores {
+				n, err := store.Rewrap()
+				if err != nil {
+					log.Printf("rewrapping failed after %d values: %v", n, err)
+				} else if n > 0 {
+					log.Printf("rewrapped %d values with key %s", n, k.Primary())
+				}
+			}
+		}
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns the nonce followed by the ciphertext.
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// format lays a sealed value out as v1:<key id>:<wrapped data key>:<ciphertext>.
+func format(keyID string, wrapped, ciphertext []byte) string {
+	return strings.Join([]string{
+		sealedVersion,
+		keyID,
+		base64.RawStdEncoding.EncodeToString(wrapped),
+		base64.RawStdEncoding.EncodeToString(ciphertext),
+	}, ":")
+}
+
+func parse(sealed string) (string, []byte, []byte, error) {
+	parts := strings.Split(sealed, ":")
+	if len(parts) != 4 || parts[0] != sealedVersion {
+		return "", nil, nil, ErrMalformed
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[1], wrapped, ciphertext, nil
+}
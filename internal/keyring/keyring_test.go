@@ -0,0 +1,92 @@
+package keyring_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring_SealUnseal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	key, err := keyring.Generate(path)
+	require.NoError(t, err)
+	k, err := keyring.Open(path)
+	require.NoError(t, err)
+
+	sealed, err := k.Seal([]byte("4242"), []byte("payment:1"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "v1:"+key.Id+":"))
+	assert.NotContains(t, sealed, "4242")
+
+	plaintext, err := k.Unseal(sealed, []byte("payment:1"))
+	require.NoError(t, err)
+	assert.Equal(t, "4242", string(plaintext))
+
+	// a value copied over to another record does not open
+	_, err = k.Unseal(sealed, []byte("payment:2"))
+	assert.Error(t, err)
+
+	_, err = k.Unseal("4242", []byte("payment:1"))
+	assert.ErrorIs(t, err, keyring.ErrMalformed)
+
+	// the file is only readable by the gateway and never overwritten
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	_, err = keyring.Generate(path)
+	assert.Error(t, err)
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	old, err := keyring.Generate(path)
+	require.NoError(t, err)
+	k, err := keyring.Open(path)
+	require.NoError(t, err)
+	sealed, err := k.Seal([]byte("4242"), []byte("payment:1"))
+	require.NoError(t, err)
+
+	changed, err := k.Reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	key, err := keyring.Rotate(path)
+	require.NoError(t, err)
+	// make sure the modification time moves on even on coarse file systems
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	changed, err = k.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, key.Id, k.Primary())
+	assert.False(t, k.Current(sealed))
+
+	// values wrapped with the old key still open and are rewrapped without touching the ciphertext
+	rewrapped, err := k.Rewrap(sealed)
+	require.NoError(t, err)
+	assert.True(t, k.Current(rewrapped))
+	assert.Equal(t, sealed[strings.LastIndex(sealed, ":"):], rewrapped[strings.LastIndex(rewrapped, ":"):])
+	plaintext, err := k.Unseal(rewrapped, []byte("payment:1"))
+	require.NoError(t, err)
+	assert.Equal(t, "4242", string(plaintext))
+
+	file, err := keyring.List(path)
+	require.NoError(t, err)
+	assert.Equal(t, key.Id, file.Primary)
+	assert.Len(t, file.Keys, 2)
+
+	// once the old key is dropped the values still wrapped with it no longer open
+	file.Keys = file.Keys[1:]
+	onlyNew, err := keyring.New(file)
+	require.NoError(t, err)
+	_, err = onlyNew.Unseal(sealed, []byte("payment:1"))
+	assert.ErrorIs(t, err, keyring.ErrUnknownKey)
+	assert.Contains(t, err.Error(), old.Id)
+}
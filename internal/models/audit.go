@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is one change in the audit log.  Before and After are the resource as it was and as it
+// became, Before is null for a resource that was just created and After for one that was removed.
+// Hash covers every other field including PrevHash, the hash of the entry before it.
+type AuditEntry struct {
+	Seq        uint64          `json:"seq"`
+	At         time.Time       `json:"at"`
+	Actor      string          `json:"actor"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Action     string          `json:"action"`
+	Resource   string          `json:"resource"`
+	ResourceID string          `json:"resource_id,omitempty"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+const (
+	BatchProcessing = "processing"
+	BatchCompleted  = "completed"
+
+	// BatchItemRejected is the status of items that never became a payment, see BatchItemResult.Error.
+	BatchItemRejected = "rejected"
+	// BatchItemFailed is the status of items the bank could not be reached for.
+	BatchItemFailed = "failed"
+)
+
+type BatchPaymentItem struct {
+	PostPaymentHandlerRequest
+
+	// IdempotencyKey makes resubmitting the item return the payment it created the first time.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+type BatchPaymentRequest struct {
+	Payments []BatchPaymentItem `json:"payments"`
+}
+
+type BatchItemError struct {
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// BatchItemResult only keeps the id of the payment an item made, the payment itself is fetched from
+// /api/payments/{id} so batches do not hold a second copy of it.
+type BatchItemResult struct {
+	Index          int             `json:"index"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+	Status         string          `json:"status"`
+	PaymentId      string          `json:"payment_id,omitempty"`
+	Error          *BatchItemError `json:"error,omitempty"`
+	// Replayed is set when the idempotency key had already been used and the earlier result is returned.
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+type PaymentBatch struct {
+	Id          string            `json:"id"`
+	MerchantID  string            `json:"merchant_id,omitempty"`
+	Status      string            `json:"status"`
+	Total       int               `json:"total"`
+	Processed   int               `json:"processed"`
+	Counts      map[string]int    `json:"counts"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	Results     []BatchItemResult `json:"results"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+const (
+	DisputeNeedsResponse = "needs_response"
+	DisputeUnderReview   = "under_review"
+	DisputeWon           = "won"
+	DisputeLost          = "lost"
+)
+
+// Events the acquirer sends about a dispute.
+const (
+	DisputeEventOpened = "opened"
+	DisputeEventWon    = "won"
+	DisputeEventLost   = "lost"
+)
+
+type DisputeNotification struct {
+	AcquirerDisputeId string `json:"acquirer_dispute_id"`
+	AcquirerReference string `json:"acquirer_reference"`
+	Event             string `json:"event"`
+	Reason            string `json:"reason,omitempty"`
+	// Amount defaults to what is left of the payment, RespondBy to the configured response window.
+	Amount    int        `json:"amount,omitempty"`
+	Currency  string     `json:"currency,omitempty"`
+	RespondBy *time.Time `json:"respond_by,omitempty"`
+}
+
+type DisputeNotificationError struct {
+	Index             int    `json:"index"`
+	AcquirerDisputeId string `json:"acquirer_dispute_id,omitempty"`
+	Message           string `json:"message"`
+}
+
+type DisputeIngestResult struct {
+	Disputes []Dispute                  `json:"disputes"`
+	Errors   []DisputeNotificationError `json:"errors"`
+}
+
+type DisputeEvidence struct {
+	Id          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+type Dispute struct {
+	Id                string            `json:"id"`
+	PaymentId         string            `json:"payment_id"`
+	MerchantID        string            `json:"merchant_id,omitempty"`
+	AcquirerDisputeId string            `json:"acquirer_dispute_id"`
+	Status            string            `json:"status"`
+	Reason            string            `json:"reason,omitempty"`
+	Amount            int               `json:"amount"`
+	Currency          string            `json:"currency"`
+	RespondBy         time.Time         `json:"respond_by"`
+	Evidence          []DisputeEvidence `json:"evidence"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+	SubmittedAt       *time.Time        `json:"submitted_at,omitempty"`
+	ResolvedAt        *time.Time        `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type FXQuoteRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int    `json:"amount,omitempty"`
+}
+
+// FXQuote locks Rate for payments from From (presentment) to To (settlement) until ExpiresAt.
+type FXQuote struct {
+	Id              string    `json:"id"`
+	MerchantID      string    `json:"merchant_id,omitempty"`
+	From            string    `json:"from"`
+	To              string    `json:"to"`
+	Rate            string    `json:"rate"`
+	Amount          int       `json:"amount,omitempty"`
+	ConvertedAmount int       `json:"converted_amount,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+const (
+	ListBlock = "block"
+	ListAllow = "allow"
+
+	ListEntryCardFingerprint = "card_fingerprint"
+	ListEntryBINRange        = "bin_range"
+	ListEntryCurrency        = "currency"
+	ListEntryCountry         = "country"
+)
+
+type ListEntryRequest struct {
+	List      string     `json:"list"`
+	Type      string     `json:"type"`
+	Value     string     `json:"value"`
+	BINStart  string     `json:"bin_start,omitempty"`
+	BINEnd    string     `json:"bin_end,omitempty"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type ListEntry struct {
+	Id        string     `json:"id"`
+	List      string     `json:"list"`
+	Type      string     `json:"type"`
+	Value     string     `json:"value,omitempty"`
+	BINStart  string     `json:"bin_start,omitempty"`
+	BINEnd    string     `json:"bin_end,omitempty"`
+	Reason    string     `json:"reason"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type ListAuditEntry struct {
+	Action string    `json:"action"`
+	Actor  string    `json:"actor"`
+	At     time.Time `json:"at"`
+	Entry  ListEntry `json:"entry"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+const (
+	CaptureAuto   = "auto"
+	CaptureManual = "manual"
+)
+
+// AmountLimit bounds a single payment in minor units, zero means no bound.
+type AmountLimit struct {
+	Min int `json:"min,omitempty"`
+	Max int `json:"max,omitempty"`
+}
+
+// MerchantProfile holds the per merchant payment rules, empty fields do not restrict anything.
+type MerchantProfile struct {
+	MerchantID      string                 `json:"merchant_id"`
+	AmountLimits    map[string]AmountLimit `json:"amount_limits,omitempty"`
+	Currencies      []string               `json:"currencies,omitempty"`
+	CardSchemes     []string               `json:"card_schemes,omitempty"`
+	DailyVolumeCaps map[string]int         `json:"daily_volume_caps,omitempty"`
+	CaptureMode     string                 `json:"capture_mode"`
+	Retention       *RetentionPolicy       `json:"retention,omitempty"`
+	// CredentialMigration lets the merchant send the network transaction id of a card first used
+	// outside the gateway, everybody else has to point at a payment made here.
+	CredentialMigration bool      `json:"credential_migration,omitempty"`
+	UpdatedBy           string    `json:"updated_by"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 /*
 
 If I had more time I would completely split out the models used in the handlers from the models used throughout the program.  Because I dont like the presentation tier being tied to implementation, for example in the PostPayment handler I am just reusing PostPaymentResponse for the happy path and possible a new validation error.
@@ -13,16 +15,51 @@ type PostPaymentHandlerRequest struct {
 	Currency    string `json:"currency"`
 	Amount      int    `json:"amount"`
 	Cvv         int    `json:"cvv"`
+
+	// SettlementCurrency asks for the payment to be converted at the live rate, QuoteId
+	// converts it at a previously locked rate instead.
+	SettlementCurrency string `json:"settlement_currency,omitempty"`
+	QuoteId            string `json:"quote_id,omitempty"`
+
+	// Initiator says who started the payment, it defaults to the customer.  Payments made with card
+	// details stored for later use say whether this is the first or a subsequent use and why they are
+	// stored.  Subsequent uses point at an earlier payment with the card, or give the network
+	// transaction id of one made elsewhere.
+	Initiator              string `json:"initiator,omitempty"`
+	StoredCredentialUsage  string `json:"stored_credential_usage,omitempty"`
+	StoredCredentialReason string `json:"stored_credential_reason,omitempty"`
+	PreviousPaymentId      string `json:"previous_payment_id,omitempty"`
+	NetworkTransactionId   string `json:"network_transaction_id,omitempty"`
+
+	// MerchantID and ClientIP come from the HTTP request rather than the body.
+	MerchantID string `json:"-"`
+	ClientIP   string `json:"-"`
+	// ReturnURL is where 3-D Secure sends the shopper back to for payments made on our own pages.
+	ReturnURL string `json:"-"`
+	// RequestID identifies the API request for the audit log.
+	RequestID string `json:"-"`
+	// Verification checks the card with an authorisation for no amount, only the gateway makes them
+	// itself to set up a stored credential.
+	Verification bool `json:"-"`
 }
 
 type GetPaymentHandlerResponse struct {
-	Id                 string `json:"id"`
-	Status             string `json:"status"`
-	LastFourCardDigits int    `json:"last_four_card_digits"`
-	ExpiryMonth        int    `json:"expiry_month"`
-	ExpiryYear         int    `json:"expiry_year"`
-	Currency           string `json:"currency"`
-	Amount             int    `json:"amount"`
+	Id                   string `json:"id"`
+	Status               string `json:"status"`
+	LastFourCardDigits   int    `json:"last_four_card_digits"`
+	ExpiryMonth          int    `json:"expiry_month"`
+	ExpiryYear           int    `json:"expiry_year"`
+	Currency             string `json:"currency"`
+	Amount               int    `json:"amount"`
+	AuthorizationCode    string `json:"authorization_code,omitempty"`
+	AcquirerReference    string `json:"acquirer_reference,omitempty"`
+	DeclineCode          string `json:"decline_code,omitempty"`
+	SettlementCurrency   string `json:"settlement_currency,omitempty"`
+	SettlementAmount     int    `json:"settlement_amount,omitempty"`
+	FXRate               string `json:"fx_rate,omitempty"`
+	ChallengeURL         string `json:"challenge_url,omitempty"`
+	NetworkTransactionId string `json:"network_transaction_id,omitempty"`
+	ChargebackAmount     int    `json:"chargeback_amount,omitempty"`
 }
 
 type PostPaymentRequest struct {
@@ -35,13 +72,52 @@ type PostPaymentRequest struct {
 }
 
 type PostPaymentResponse struct {
-	Id                 string `json:"id"`
-	PaymentStatus      string `json:"payment_status"`
-	CardNumberLastFour int    `json:"card_number_last_four"`
-	ExpiryMonth        int    `json:"expiry_month"`
-	ExpiryYear         int    `json:"expiry_year"`
-	Currency           string `json:"currency"`
-	Amount             int    `json:"amount"`
+	Id                     string `json:"id"`
+	PaymentStatus          string `json:"payment_status"`
+	CardNumberLastFour     int    `json:"card_number_last_four"`
+	ExpiryMonth            int    `json:"expiry_month"`
+	ExpiryYear             int    `json:"expiry_year"`
+	Currency               string `json:"currency"`
+	Amount                 int    `json:"amount"`
+	MerchantID             string `json:"merchant_id,omitempty"`
+	CardScheme             string `json:"card_scheme,omitempty"`
+	Acquirer               string `json:"acquirer,omitempty"`
+	AuthorizationCode      string `json:"authorization_code,omitempty"`
+	AcquirerReference      string `json:"acquirer_reference,omitempty"`
+	DeclineCode            string `json:"decline_code,omitempty"`
+	SettlementCurrency     string `json:"settlement_currency,omitempty"`
+	SettlementAmount       int    `json:"settlement_amount,omitempty"`
+	FXRate                 string `json:"fx_rate,omitempty"`
+	FXQuoteId              string `json:"fx_quote_id,omitempty"`
+	CaptureMode            string `json:"capture_mode,omitempty"`
+	ChallengeURL           string `json:"challenge_url,omitempty"`
+	AuthenticationStatus   string `json:"authentication_status,omitempty"`
+	ECI                    string `json:"eci,omitempty"`
+	Initiator              string `json:"initiator,omitempty"`
+	StoredCredentialUsage  string `json:"stored_credential_usage,omitempty"`
+	StoredCredentialReason string `json:"stored_credential_reason,omitempty"`
+	NetworkTransactionId   string `json:"network_transaction_id,omitempty"`
+	// ChargebackAmount is what the merchant lost to disputes, settlement takes it off the next batch.
+	ChargebackAmount int       `json:"chargeback_amount,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	// AuthorizedAt is when the bank authorised the payment, it is what settlement goes by.
+	AuthorizedAt *time.Time `json:"authorized_at,omitempty"`
+	// AnonymisedAt is when the card details were scrubbed from the payment, by retention or erasure.
+	AnonymisedAt *time.Time `json:"anonymised_at,omitempty"`
+
+	// The raw bank answer is kept for support and reconciliation but not shown to merchants.
+	BankResponseCode string        `json:"-"`
+	BankResponseTime time.Duration `json:"-"`
+
+	// The fingerprint and the screening are kept from merchants, they would only help to get around them.
+	CardFingerprint string   `json:"-"`
+	RiskScore       int      `json:"-"`
+	RiskOutcome     string   `json:"-"`
+	RiskRules       []string `json:"-"`
+
+	ThreeDSTransactionId string `json:"-"`
+	// RequestID is the API request that created the payment.
+	RequestID string `json:"-"`
 }
 
 type GetPaymentResponse struct {
@@ -60,14 +136,37 @@ type PostPaymentBankRequest struct {
 	Currency   string `json:"currency"`
 	Amount     int    `json:"amount"`
 	CVV        string `json:"cvv"`
+
+	// Authentication data from 3-D Secure, only present when the shopper was challenged.
+	ECI                  string `json:"eci,omitempty"`
+	CAVV                 string `json:"cavv,omitempty"`
+	ThreeDSTransactionId string `json:"three_ds_transaction_id,omitempty"`
+
+	// Stored credential flags, the network transaction id is the one of the first payment with the card.
+	Initiator              string `json:"initiator,omitempty"`
+	StoredCredentialUsage  string `json:"stored_credential_usage,omitempty"`
+	StoredCredentialReason string `json:"stored_credential_reason,omitempty"`
+	NetworkTransactionId   string `json:"network_transaction_id,omitempty"`
+
+	// MerchantID is only used to route the payment and is not sent to the bank.
+	MerchantID string `json:"-"`
 }
 
 type PostPaymentBankResponse struct {
 	Authorised        bool   `json:"authorized"`
 	AuthorizationCode string `json:"authorization_code"`
+	AcquirerReference string `json:"acquirer_reference"`
+	ResponseCode      string `json:"response_code"`
+	// NetworkTransactionId is the scheme's reference for the payment, later payments with a stored
+	// card send it back to link them to the first one.
+	NetworkTransactionId string `json:"network_transaction_id,omitempty"`
+
+	// Acquirer is filled in by the router with the name of the acquirer that answered.
+	Acquirer string `json:"-"`
 }
 
 type PostPayment400Response struct {
 	Id            string `json:"id"`
 	PaymentStatus string `json:"payment_status"`
+	ErrorCode     string `json:"error_code,omitempty"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	PaymentLinkActive     = "active"
+	PaymentLinkProcessing = "processing"
+	PaymentLinkCompleted  = "completed"
+	PaymentLinkExpired    = "expired"
+)
+
+type PaymentLinkRequest struct {
+	Amount      int    `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description,omitempty"`
+	// The shopper is sent to SuccessURL once the payment is authorised and to FailureURL otherwise.
+	SuccessURL string `json:"success_url"`
+	FailureURL string `json:"failure_url"`
+	// ExpiresAt defaults to a day after the link was made.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	MerchantID string `json:"-"`
+}
+
+type PaymentLink struct {
+	Id          string     `json:"id"`
+	MerchantID  string     `json:"merchant_id,omitempty"`
+	Status      string     `json:"status"`
+	URL         string     `json:"url"`
+	Amount      int        `json:"amount"`
+	Currency    string     `json:"currency"`
+	Description string     `json:"description,omitempty"`
+	SuccessURL  string     `json:"success_url"`
+	FailureURL  string     `json:"failure_url"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	PaymentId   string     `json:"payment_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// HostedCard is what the shopper types into the hosted payment page.
+type HostedCard struct {
+	CardNumber  int
+	ExpiryMonth int
+	ExpiryYear  int
+	Cvv         int
+	ClientIP    string
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+type SettlementLine struct {
+	Line              int    `json:"line"`
+	AcquirerReference string `json:"acquirer_reference,omitempty"`
+	AuthorizationCode string `json:"authorization_code,omitempty"`
+	Amount            int    `json:"amount"`
+	Currency          string `json:"currency"`
+}
+
+type ReconciliationItem struct {
+	PaymentId         string `json:"payment_id,omitempty"`
+	Line              int    `json:"line,omitempty"`
+	AcquirerReference string `json:"acquirer_reference,omitempty"`
+	AuthorizationCode string `json:"authorization_code,omitempty"`
+	ExpectedAmount    int    `json:"expected_amount,omitempty"`
+	ExpectedCurrency  string `json:"expected_currency,omitempty"`
+	SettledAmount     int    `json:"settled_amount,omitempty"`
+	SettledCurrency   string `json:"settled_currency,omitempty"`
+}
+
+type ReconciliationSummary struct {
+	Matched        int `json:"matched"`
+	Missing        int `json:"missing"`
+	Unexpected     int `json:"unexpected"`
+	AmountMismatch int `json:"amount_mismatch"`
+}
+
+type ReconciliationReport struct {
+	Id             string                `json:"id"`
+	Acquirer       string                `json:"acquirer,omitempty"`
+	From           *time.Time            `json:"from,omitempty"`
+	To             *time.Time            `json:"to,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	Summary        ReconciliationSummary `json:"summary"`
+	Matched        []ReconciliationItem  `json:"matched"`
+	Missing        []ReconciliationItem  `json:"missing"`
+	Unexpected     []ReconciliationItem  `json:"unexpected"`
+	AmountMismatch []ReconciliationItem  `json:"amount_mismatch"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// What a retention policy does to the payments it is past.
+const (
+	RetentionAnonymise = "anonymise"
+	RetentionDelete    = "delete"
+)
+
+// RetentionPolicy limits how long a merchant's payments are kept in full.  Anonymised payments keep their
+// amounts, currencies and statuses so totals and settlements still add up, deleted payments are gone.
+// Merchants without a policy keep their payments forever.
+type RetentionPolicy struct {
+	Days   int    `json:"days"`
+	Action string `json:"action"`
+}
+
+// RetentionReport lists the payments a retention run acted on, or would have on a dry run.
+type RetentionReport struct {
+	DryRun     bool      `json:"dry_run"`
+	RunAt      time.Time `json:"run_at"`
+	Anonymised []string  `json:"anonymised"`
+	Deleted    []string  `json:"deleted"`
+}
+
+// ErasureRequest asks for the personal data of a card holder to be scrubbed from their payments.  The
+// card is given either by number or by the card_fingerprint of its payments.
+type ErasureRequest struct {
+	CardNumber      string `json:"card_number,omitempty"`
+	CardFingerprint string `json:"card_fingerprint,omitempty"`
+	// MerchantID limits the erasure to the payments made with one merchant.
+	MerchantID string `json:"merchant_id,omitempty"`
+	DryRun     bool   `json:"dry_run,omitempty"`
+}
+
+type ErasureReport struct {
+	DryRun          bool      `json:"dry_run"`
+	ErasedAt        time.Time `json:"erased_at"`
+	PaymentIds      []string  `json:"payment_ids"`
+	SubscriptionIds []string  `json:"subscription_ids"`
+	ListEntryIds    []string  `json:"list_entry_ids"`
+}
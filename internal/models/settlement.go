@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+const (
+	SettlementLineSale   = "sale"
+	SettlementLineRefund = "refund"
+	// SettlementLineChargeback takes what the merchant lost to disputes off the batch.
+	SettlementLineChargeback = "chargeback"
+)
+
+type SettlementBatchLine struct {
+	PaymentId string `json:"payment_id"`
+	Type      string `json:"type"`
+	Scheme    string `json:"scheme,omitempty"`
+	Amount    int    `json:"amount"`
+	Fee       int    `json:"fee"`
+	Net       int    `json:"net"`
+}
+
+type SettlementBatch struct {
+	Id         string                `json:"id"`
+	MerchantID string                `json:"merchant_id"`
+	Currency   string                `json:"currency"`
+	Date       string                `json:"date"`
+	Gross      int                   `json:"gross"`
+	Fees       int                   `json:"fees"`
+	Net        int                   `json:"net"`
+	Count      int                   `json:"count"`
+	CreatedAt  time.Time             `json:"created_at"`
+	Lines      []SettlementBatchLine `json:"lines,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+const (
+	InitiatorCustomer = "customer"
+	InitiatorMerchant = "merchant"
+
+	StoredCredentialFirst      = "first"
+	StoredCredentialSubsequent = "subsequent"
+
+	StoredCredentialRecurring   = "recurring"
+	StoredCredentialInstallment = "installment"
+	StoredCredentialUnscheduled = "unscheduled"
+)
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+const (
+	SubscriptionTrialing  = "trialing"
+	SubscriptionActive    = "active"
+	SubscriptionPastDue   = "past_due"
+	SubscriptionUnpaid    = "unpaid"
+	SubscriptionPaused    = "paused"
+	SubscriptionCancelled = "cancelled"
+)
+
+type SubscriptionRequest struct {
+	CardNumber  int    `json:"card_number"`
+	ExpiryMonth int    `json:"expiry_month"`
+	ExpiryYear  int    `json:"expiry_year"`
+	Cvv         int    `json:"cvv"`
+	Currency    string `json:"currency"`
+	Amount      int    `json:"amount"`
+
+	Interval      string `json:"interval"`
+	IntervalCount int    `json:"interval_count,omitempty"`
+	// AnchorDate is when the first charge is made, it defaults to the end of the trial.
+	AnchorDate *time.Time `json:"anchor_date,omitempty"`
+	TrialDays  int        `json:"trial_days,omitempty"`
+
+	MerchantID string `json:"-"`
+}
+
+type Subscription struct {
+	Id                 string     `json:"id"`
+	MerchantID         string     `json:"merchant_id,omitempty"`
+	Status             string     `json:"status"`
+	Currency           string     `json:"currency"`
+	Amount             int        `json:"amount"`
+	Interval           string     `json:"interval"`
+	IntervalCount      int        `json:"interval_count"`
+	AnchorDate         time.Time  `json:"anchor_date"`
+	TrialEnd           *time.Time `json:"trial_end,omitempty"`
+	CardNumberLastFour int        `json:"card_number_last_four"`
+	ExpiryMonth        int        `json:"expiry_month"`
+	ExpiryYear         int        `json:"expiry_year"`
+	// Cycle is the billing cycle the next charge is for, counting from 0 at the anchor date.
+	Cycle        int        `json:"cycle"`
+	NextChargeAt *time.Time `json:"next_charge_at,omitempty"`
+	// RetryCount is how many dunning retries were made for the current cycle.
+	RetryCount  int        `json:"retry_count"`
+	PaymentIds  []string   `json:"payment_ids"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PausedAt    *time.Time `json:"paused_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+
+	// the card number is kept sealed because the acquirer needs it with every charge, the charges are
+	// merchant initiated and refer to the verification made when the subscription was created, so the
+	// CVV is never kept
+	CardNumber          int    `json:"-"`
+	CredentialPaymentId string `json:"-"`
+}
@@ -0,0 +1,258 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+)
+
+// Journal keeps queued jobs somewhere that survives a restart until they have been processed.  Pending
+// reports the jobs that were started but never removed with Job.Started set.
+type Journal interface {
+	Append(job Job) error
+	Start(id string) error
+	Remove(id string) error
+	Pending() ([]Job, error)
+}
+
+// FileJournal writes every job to its own file in dir and deletes it once the job is done.  A started
+// job gets an empty marker file next to it.
+// The files hold card details so the directory is only readable by the gateway, with a keyring the jobs
+// are sealed as well.
+type FileJournal struct {
+	dir     string
+	keyring *keyring.Keyring
+}
+
+// journalJob is a job as it is written, with the fields of the payment that are kept out of its JSON.
+type journalJob struct {
+	Job
+	CardFingerprint string   `json:"card_fingerprint,omitempty"`
+	RiskScore       int      `json:"risk_score,omitempty"`
+	RiskOutcome     string   `json:"risk_outcome,omitempty"`
+	RiskRules       []string `json:"risk_rules,omitempty"`
+}
+
+func newJournalJob(job Job) journalJob {
+	return journalJob{
+		Job:             job,
+		CardFingerprint: job.Payment.CardFingerprint,
+		RiskScore:       job.Payment.RiskScore,
+		RiskOutcome:     job.Payment.RiskOutcome,
+		RiskRules:       job.Payment.RiskRules,
+	}
+}
+
+func (j journalJob) job() Job {
+	job := j.Job
+	job.Payment.CardFingerprint = j.CardFingerprint
+	job.Payment.RiskScore = j.RiskScore
+	job.Payment.RiskOutcome = j.RiskOutcome
+	job.Payment.RiskRules = j.RiskRules
+	return job
+}
+
+// journalFile is the content of a job file, a sealed job only shows its id and when it was queued.
+type journalFile struct {
+	journalJob
+	Sealed string `json:"sealed,omitempty"`
+}
+
+func NewFileJournal(dir string) (*FileJournal, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileJournal{dir: dir}, nil
+}
+
+// WithKeyring seals the jobs written from now on.  Jobs are short lived so they are not rewrapped, the
+// keys they were sealed with only have to stay in the keyring until the queue has drained.
+func (j *FileJournal) WithKeyring(k *keyring.Keyring) *FileJournal {
+	j.keyring = k
+	return j
+}
+
+func jobContext(id string) []byte {
+	return []byte("job:" + id)
+}
+
+func (j *FileJournal) path(id string) string {
+	return filepath.Join(j.dir, id+".json")
+}
+
+func (j *FileJournal) startedPath(id string) string {
+	return filepath.Join(j.dir, id+".started")
+}
+
+// Append writes the job to a temporary file first so a crash never leaves half a job behind.  The file
+// and the directory are synced before it returns, the payment is accepted once the job is on disk.
+func (j *FileJournal) Append(job Job) error {
+	data, err := json.Marshal(newJournalJob(job))
+	if err != nil {
+		return err
+	}
+	if j.keyring != nil {
+		sealed, err := j.keyring.Seal(data, jobContext(job.Id))
+		if err != nil {
+			return err
+		}
+		data, err = json.Marshal(journalFile{journalJob: journalJob{Job: Job{Id: job.Id, EnqueuedAt: job.EnqueuedAt}}, Sealed: sealed})
+		if err != nil {
+			return err
+		}
+	}
+
+	tmp := j.path(job.Id) + ".tmp"
+	if err := writeSynced(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path(job.Id)); err != nil {
+		return err
+	}
+	return j.syncDir()
+}
+
+// Start leaves the marker before the bank is called, it is synced so a crash right after cannot lose it.
+func (j *FileJournal) Start(id string) error {
+	if err := writeSynced(j.startedPath(id), nil); err != nil {
+		return err
+	}
+	return j.syncDir()
+}
+
+func writeSynced(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir makes new and renamed files in the journal survive a crash.
+func (j *FileJournal) syncDir() error {
+	dir, err := os.Open(j.dir)
+	if err != nil {
+		return err
+	}
+	if err := dir.Sync(); err != nil {
+		dir.Close()
+		return err
+	}
+	return dir.Close()
+}
+
+// Remove deletes the job before its marker, a marker left on its own is ignored.
+func (j *FileJournal) Remove(id string) error {
+	for _, path := range []string{j.path(id), j.startedPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending returns the jobs that were never finished, oldest first.
+func (j *FileJournal) Pending() ([]Job, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []Job{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(j.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var file journalFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("invalid job file %s: %w", entry.Name(), err)
+		}
+		if file.Sealed != "" {
+			if j.keyring == nil {
+				return nil, fmt.Errorf("job file %s is sealed but there is no keyring", entry.Name())
+			}
+			plaintext, err := j.keyring.Unseal(file.Sealed, jobContext(file.Id))
+			if err != nil {
+				return nil, fmt.Errorf("could not unseal job file %s: %w", entry.Name(), err)
+			}
+			if err := json.Unmarshal(plaintext, &file.journalJob); err != nil {
+				return nil, fmt.Errorf("invalid job file %s: %w", entry.Name(), err)
+			}
+		}
+		job := file.job()
+		if _, err := os.Stat(j.startedPath(job.Id)); err == nil {
+			job.Started = true
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].EnqueuedAt.Before(jobs[b].EnqueuedAt) })
+	return jobs, nil
+}
+
+// MemoryJournal does not survive a restart, it is meant for tests.
+type MemoryJournal struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{jobs: map[string]Job{}}
+}
+
+func (j *MemoryJournal) Start(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if job, ok := j.jobs[id]; ok {
+		job.Started = true
+		j.jobs[id] = job
+	}
+	return nil
+}
+
+func (j *MemoryJournal) Append(job Job) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.jobs[job.Id] = job
+	return nil
+}
+
+func (j *MemoryJournal) Remove(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.jobs, id)
+	return nil
+}
+
+func (j *MemoryJournal) Pending() ([]Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	jobs := []Job{}
+	for _, job := range j.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].EnqueuedAt.Before(jobs[b].EnqueuedAt) })
+	return jobs, nil
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+var ErrQueueFull = errors.New("payment queue is full")
+
+// Job is a payment waiting for its bank call.  The payment itself is kept on the job so it can be
+// restored after a restart, when the in memory repository has lost it.
+type Job struct {
+	Id          string                        `json:"id"`
+	Payment     models.PostPaymentResponse    `json:"payment"`
+	BankRequest models.PostPaymentBankRequest `json:"bank_request"`
+	EnqueuedAt  time.Time                     `json:"enqueued_at"`
+	// Started is set on recovered jobs that a worker had already picked up, the bank may or may not
+	// have seen them so they must not be sent again.
+	Started bool `json:"-"`
+}
+
+type Config struct {
+	Size    int
+	Workers int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Size:    1000,
+		Workers: 16,
+	}
+}
+
+// Queue is a bounded queue of payments worked off by a fixed pool of workers.
+type Queue struct {
+	config    Config
+	journal   Journal
+	jobs      chan Job
+	recovered []Job
+}
+
+// New reads back the jobs a previous run left in the journal, they are processed first once Run starts.
+func New(config Config, journal Journal) (*Queue, error) {
+	recovered, err := journal.Pending()
+	if err != nil {
+		return nil, err
+	}
+	if len(recovered) > 0 {
+		log.Printf("recovered %d queued payments", len(recovered))
+	}
+
+	return &Queue{
+		config:    config,
+		journal:   journal,
+		jobs:      make(chan Job, config.Size),
+		recovered: recovered,
+	}, nil
+}
+
+// Enqueue journals the job and hands it to the workers, it never blocks and returns ErrQueueFull
+// when the workers are too far behind.
+func (q *Queue) Enqueue(job Job) error {
+	if len(q.jobs) >= cap(q.jobs) {
+		return ErrQueueFull
+	}
+	if err := q.journal.Append(job); err != nil {
+		return err
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		// lost the race for the last slot
+		if err := q.journal.Remove(job.Id); err != nil {
+			log.Printf("could not remove job %s from the journal: %v", job.Id, err)
+		}
+		return ErrQueueFull
+	}
+}
+
+// Len is the number of jobs waiting for a worker.
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+// Run works off the queue with handle until ctx is cancelled, starting with the recovered jobs.
+// Jobs are marked as started in the journal before handle is called and removed once it returns.
+func (q *Queue) Run(ctx context.Context, handle func(Job)) error {
+	var wg sync.WaitGroup
+	for i := 0; i < q.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.jobs:
+					if err := q.journal.Start(job.Id); err != nil {
+						log.Printf("could not mark job %s as started in the journal: %v", job.Id, err)
+					}
+					handle(job)
+					if err := q.journal.Remove(job.Id); err != nil {
+						log.Printf("could not remove job %s from the journal: %v", job.Id, err)
+					}
+				}
+			}
+		}()
+	}
+
+	// recovered jobs may not all fit so feed them in as the workers make room
+	for _, job := range q.recovered {
+		select {
+		case <-ctx.Done():
+		case q.jobs <- job:
+		}
+	}
+
+	q.recovered = nil
+
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,155 @@
+package queue_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func job(id string, at time.Time) queue.Job {
+	return queue.Job{
+		Id:          id,
+		Payment:     models.PostPaymentResponse{Id: id, PaymentStatus: "processing", CardFingerprint: "fp", RiskScore: 40},
+		BankRequest: models.PostPaymentBankRequest{CardNumber: "2222405343248877", CVV: "123"},
+		EnqueuedAt:  at,
+	}
+}
+
+func TestQueue_Backpressure(t *testing.T) {
+	journal := queue.NewMemoryJournal()
+	q, err := queue.New(queue.Config{Size: 2, Workers: 1}, journal)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, q.Enqueue(job("1", now)))
+	require.NoError(t, q.Enqueue(job("2", now)))
+	assert.ErrorIs(t, q.Enqueue(job("3", now)), queue.ErrQueueFull)
+
+	pending, err := journal.Pending()
+	require.NoError(t, err)
+	assert.Len(t, pending, 2, "rejected jobs are not journaled")
+}
+
+func TestQueue_Run(t *testing.T) {
+	journal := queue.NewMemoryJournal()
+	q, err := queue.New(queue.Config{Size: 10, Workers: 3}, journal)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	handled := []string{}
+	done := make(chan struct{}, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error)
+	go func() {
+		finished <- q.Run(ctx, func(job queue.Job) {
+			mu.Lock()
+			handled = append(handled, job.Id)
+			mu.Unlock()
+			done <- struct{}{}
+		})
+	}()
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, q.Enqueue(job(id, time.Now())))
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("jobs were not processed")
+		}
+	}
+
+	cancel()
+	require.NoError(t, <-finished)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, handled)
+
+	// give the workers a moment to clear the journal after the last handle returned
+	assert.Eventually(t, func() bool {
+		pending, err := journal.Pending()
+		return err == nil && len(pending) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestQueue_RecoversJournal(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := queue.NewFileJournal(dir)
+	require.NoError(t, err)
+
+	now := time.Now()
+	first, err := queue.New(queue.Config{Size: 10, Workers: 1}, journal)
+	require.NoError(t, err)
+	require.NoError(t, first.Enqueue(job("older", now)))
+	require.NoError(t, first.Enqueue(job("newer", now.Add(time.Second))))
+	require.NoError(t, first.Enqueue(job("started", now.Add(2*time.Second))))
+	// the first process dies while the bank call for the last job was in flight
+	require.NoError(t, journal.Start("started"))
+
+	journal, err = queue.NewFileJournal(dir)
+	require.NoError(t, err)
+	second, err := queue.New(queue.Config{Size: 1, Workers: 1}, journal)
+	require.NoError(t, err)
+
+	handled := make(chan queue.Job, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = second.Run(ctx, func(job queue.Job) { handled <- job }) }()
+
+	for _, want := range []string{"older", "newer", "started"} {
+		select {
+		case got := <-handled:
+			assert.Equal(t, want, got.Id)
+			assert.Equal(t, want == "started", got.Started)
+			assert.Equal(t, "123", got.BankRequest.CVV)
+			// not part of the payment's JSON but needed once it is restored
+			assert.Equal(t, "fp", got.Payment.CardFingerprint)
+			assert.Equal(t, 40, got.Payment.RiskScore)
+		case <-time.After(time.Second):
+			t.Fatal("recovered job was not processed")
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		pending, err := journal.Pending()
+		return err == nil && len(pending) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFileJournal_Keyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	_, err := keyring.Generate(path)
+	require.NoError(t, err)
+	k, err := keyring.Open(path)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	journal, err := queue.NewFileJournal(dir)
+	require.NoError(t, err)
+	journal.WithKeyring(k)
+	require.NoError(t, journal.Append(job("sealed", time.Now())))
+
+	contents, err := os.ReadFile(filepath.Join(dir, "sealed.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), "2222405343248877")
+
+	pending, err := journal.Pending()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "123", pending[0].BankRequest.CVV)
+
+	// a journal without the keyring cannot read the job back
+	plain, err := queue.NewFileJournal(dir)
+	require.NoError(t, err)
+	_, err = plain.Pending()
+	assert.Error(t, err)
+}
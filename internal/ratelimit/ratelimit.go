@@ -0,0 +1,187 @@
+package ratelimit
+
+/*
+A token bucket per caller and route stops a single client from saturating the gateway, and through us the acquiring bank.  Each bucket holds up to Burst tokens and refills at Rate tokens a second, a request takes one token and is turned away with a 429 when the bucket is empty.
+
+Throttled requests are counted per route in the ratelimit_throttled_total expvar, which is served on /debug/vars.
+*/
+
+import (
+	"expvar"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets is how many buckets we keep before sweeping the ones that have refilled.
+const maxIdleBuckets = 10000
+
+var throttled = expvar.NewMap("ratelimit_throttled_total")
+
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+type Config struct {
+	Default Rule
+	Routes  map[string]Rule
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Default: Rule{Rate: 20, Burst: 40},
+		Routes: map[string]Rule{
+			"payments.create": {Rate: 10, Burst: 20},
+			"payments.batch":  {Rate: 1, Burst: 5},
+			"payments.hosted": {Rate: 1, Burst: 5},
+			"admin":           {Rate: 5, Burst: 10},
+		},
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rule   Rule
+}
+
+// Limiter hands out tokens, key decides who a request is counted against.
+type Limiter struct {
+	mu      sync.Mutex
+	config  Config
+	key     func(r *http.Request) string
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewLimiter(config Config, key func(r *http.Request) string) *Limiter {
+	return &Limiter{
+		config:  config,
+		key:     key,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// WithClock swaps the clock used by the limiter, handy for tests.
+func (l *Limiter) WithClock(now func() time.Time) *Limiter {
+	l.now = now
+	return l
+}
+
+func (l *Limiter) rule(route string) Rule {
+	if rule, ok := l.config.Routes[route]; ok {
+		return rule
+	}
+	return l.config.Default
+}
+
+// Middleware limits the wrapped handler using the rule configured for route.
+func (l *Limiter) Middleware(route string) func(http.Handler) http.Handler {
+	rule := l.rule(route)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, remaining, retryAfter, reset := l.take(route+"|"+l.key(r), rule)
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(rule.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+
+			if !allowed {
+				throttled.Add(route, 1)
+				w.Header().Set("Retry-After", strconv.Itoa(seconds(retryAfter)))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"message":"Too many requests. Please try again later."}` + "\n"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Allow takes a token for key on route for callers that are not HTTP handlers, like the gRPC API.
+// It returns how long until the next token when the call is turned away.
+func (l *Limiter) Allow(route, key string) (bool, time.Duration) {
+	allowed, _, retryAfter, _ := l.take(route+"|"+key, l.rule(route))
+	if !allowed {
+		throttled.Add(route, 1)
+	}
+	return allowed, retryAfter
+}
+
+// Key counts a call against the merchant, or the client IP for anonymous callers.  The REST and the gRPC
+// API both use it so a merchant has one budget across them.
+func Key(merchantID, clientIP string) string {
+	if merchantID != "" {
+		return "merchant:" + merchantID
+	}
+	return "ip:" + clientIP
+}
+
+// take removes a token from the bucket for key, it returns whether the request may go ahead,
+// the whole tokens left, how long until the next token and how long until the bucket is full again.
+func (l *Limiter) take(key string, rule Rule) (bool, int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets) > maxIdleBuckets {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now, rule: rule}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.last).Seconds()*rule.Rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	retryAfter := time.Duration(0)
+	if b.tokens < 1 {
+		retryAfter = rateDuration(1-b.tokens, rule.Rate)
+	}
+	reset := rateDuration(float64(rule.Burst)-b.tokens, rule.Rate)
+
+	return allowed, int(b.tokens), retryAfter, reset
+}
+
+// sweep forgets buckets that would have refilled by now, they are recreated full on the next request.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last).Seconds()*b.rule.Rate+b.tokens >= float64(b.rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func rateDuration(tokens, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / rate * float64(time.Second))
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Throttled returns how many requests have been turned away on route.
+func Throttled(route string) int64 {
+	if v, ok := throttled.Get(route).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
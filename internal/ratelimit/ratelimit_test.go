@@ -0,0 +1,81 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Middleware(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	config := ratelimit.Config{
+		Default: ratelimit.Rule{Rate: 100, Burst: 100},
+		Routes: map[string]ratelimit.Rule{
+			"test.route": {Rate: 1, Burst: 2},
+		},
+	}
+	limiter := ratelimit.NewLimiter(config, func(r *http.Request) string {
+		return r.Header.Get("X-Caller")
+	}).WithClock(func() time.Time { return now })
+
+	handler := limiter.Middleware("test.route")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	call := func(caller string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Caller", caller)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	before := ratelimit.Throttled("test.route")
+
+	w := call("a")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+
+	w = call("a")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = call("a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, before+1, ratelimit.Throttled("test.route"))
+
+	// another caller has its own bucket
+	assert.Equal(t, http.StatusOK, call("b").Code)
+
+	// a token is back after a second
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, call("a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, call("a").Code)
+}
+
+func TestLimiter_DefaultRule(t *testing.T) {
+	config := ratelimit.Config{Default: ratelimit.Rule{Rate: 1, Burst: 1}}
+	limiter := ratelimit.NewLimiter(config, func(r *http.Request) string { return "caller" })
+
+	handler := limiter.Middleware("unconfigured")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
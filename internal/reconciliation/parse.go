@@ -0,0 +1,158 @@
+package reconciliation
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+const (
+	FormatCSV        = "csv"
+	FormatFixedWidth = "fixed"
+)
+
+const (
+	fieldAcquirerReference = "acquirer_reference"
+	fieldAuthorizationCode = "authorization_code"
+	fieldAmount            = "amount"
+	fieldCurrency          = "currency"
+)
+
+// Field is a column of a fixed width file, Start is zero based.
+type Field struct {
+	Name   string
+	Start  int
+	Length int
+}
+
+type Layout []Field
+
+// DefaultLayout is the fixed width record our simulator acquirer would send: two 36 character references,
+// a 12 digit zero padded amount and the currency.
+func DefaultLayout() Layout {
+	return Layout{
+		{Name: fieldAcquirerReference, Start: 0, Length: 36},
+		{Name: fieldAuthorizationCode, Start: 36, Length: 36},
+		{Name: fieldAmount, Start: 72, Length: 12},
+		{Name: fieldCurrency, Start: 84, Length: 3},
+	}
+}
+
+func Parse(r io.Reader, format string) ([]models.SettlementLine, error) {
+	switch format {
+	case FormatCSV:
+		return ParseCSV(r)
+	case FormatFixedWidth:
+		return ParseFixedWidth(r, DefaultLayout())
+	}
+	return nil, fmt.Errorf("unsupported settlement file format %q", format)
+}
+
+// ParseCSV reads a settlement file with a header row, columns may come in any order and unknown ones are ignored.
+func ParseCSV(r io.Reader) ([]models.SettlementLine, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []models.SettlementLine{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{fieldAmount, fieldCurrency} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing %s column", required)
+		}
+	}
+
+	lines := []models.SettlementLine{}
+	for lineNumber := 2; ; lineNumber++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		values := map[string]string{}
+		for name, i := range columns {
+			if i < len(record) {
+				values[name] = strings.TrimSpace(record[i])
+			}
+		}
+
+		line, err := toLine(lineNumber, values)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+func ParseFixedWidth(r io.Reader, layout Layout) ([]models.SettlementLine, error) {
+	lines := []models.SettlementLine{}
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		record := scanner.Text()
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+
+		values := map[string]string{}
+		for _, field := range layout {
+			if field.Start >= len(record) {
+				continue
+			}
+			end := field.Start + field.Length
+			if end > len(record) {
+				end = len(record)
+			}
+			values[field.Name] = strings.TrimSpace(record[field.Start:end])
+		}
+
+		line, err := toLine(lineNumber, values)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+func toLine(lineNumber int, values map[string]string) (models.SettlementLine, error) {
+	if values[fieldAcquirerReference] == "" && values[fieldAuthorizationCode] == "" {
+		return models.SettlementLine{}, fmt.Errorf("line %d: %w", lineNumber, errors.New("needs an acquirer reference or authorization code"))
+	}
+
+	amount, err := strconv.Atoi(values[fieldAmount])
+	if err != nil {
+		return models.SettlementLine{}, fmt.Errorf("line %d: invalid amount %q", lineNumber, values[fieldAmount])
+	}
+
+	return models.SettlementLine{
+		Line:              lineNumber,
+		AcquirerReference: values[fieldAcquirerReference],
+		AuthorizationCode: values[fieldAuthorizationCode],
+		Amount:            amount,
+		Currency:          strings.ToUpper(values[fieldCurrency]),
+	}, nil
+}
@@ -0,0 +1,92 @@
+package reconciliation
+
+/*
+Reconciliation compares what we think we authorised with what the acquirer says it settled.  A settlement line is matched to a payment by the acquirer reference first and the authorization code second, each payment can only be matched once.
+
+Every line ends up in one of four buckets: matched, amount mismatch (found the payment but the amount or currency differs), unexpected (no payment we know of) and missing (payments we authorised that the acquirer did not settle).
+*/
+
+import (
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// Reconcile matches the settlement lines against the payments we expect to be settled.
+func Reconcile(lines []models.SettlementLine, expected []models.PostPaymentResponse) models.ReconciliationReport {
+	report := models.ReconciliationReport{
+		Matched:        []models.ReconciliationItem{},
+		Missing:        []models.ReconciliationItem{},
+		Unexpected:     []models.ReconciliationItem{},
+		AmountMismatch: []models.ReconciliationItem{},
+	}
+
+	byReference := map[string]int{}
+	byAuthorizationCode := map[string]int{}
+	for i, payment := range expected {
+		if payment.AcquirerReference != "" {
+			byReference[payment.AcquirerReference] = i
+		}
+		if payment.AuthorizationCode != "" {
+			byAuthorizationCode[payment.AuthorizationCode] = i
+		}
+	}
+
+	used := make([]bool, len(expected))
+	for _, line := range lines {
+		i, ok := byReference[line.AcquirerReference]
+		if !ok || line.AcquirerReference == "" || used[i] {
+			i, ok = byAuthorizationCode[line.AuthorizationCode]
+			ok = ok && line.AuthorizationCode != "" && !used[i]
+		}
+
+		if !ok {
+			report.Unexpected = append(report.Unexpected, models.ReconciliationItem{
+				Line:              line.Line,
+				AcquirerReference: line.AcquirerReference,
+				AuthorizationCode: line.AuthorizationCode,
+				SettledAmount:     line.Amount,
+				SettledCurrency:   line.Currency,
+			})
+			continue
+		}
+
+		used[i] = true
+		payment := expected[i]
+		item := models.ReconciliationItem{
+			PaymentId:         payment.Id,
+			Line:              line.Line,
+			AcquirerReference: payment.AcquirerReference,
+			AuthorizationCode: payment.AuthorizationCode,
+			ExpectedAmount:    payment.Amount,
+			ExpectedCurrency:  payment.Currency,
+			SettledAmount:     line.Amount,
+			SettledCurrency:   line.Currency,
+		}
+
+		if payment.Amount != line.Amount || payment.Currency != line.Currency {
+			report.AmountMismatch = append(report.AmountMismatch, item)
+		} else {
+			report.Matched = append(report.Matched, item)
+		}
+	}
+
+	for i, payment := range expected {
+		if used[i] {
+			continue
+		}
+		report.Missing = append(report.Missing, models.ReconciliationItem{
+			PaymentId:         payment.Id,
+			AcquirerReference: payment.AcquirerReference,
+			AuthorizationCode: payment.AuthorizationCode,
+			ExpectedAmount:    payment.Amount,
+			ExpectedCurrency:  payment.Currency,
+		})
+	}
+
+	report.Summary = models.ReconciliationSummary{
+		Matched:        len(report.Matched),
+		Missing:        len(report.Missing),
+		Unexpected:     len(report.Unexpected),
+		AmountMismatch: len(report.AmountMismatch),
+	}
+	return report
+}
@@ -0,0 +1,92 @@
+package reconciliation_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/reconciliation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSV(t *testing.T) {
+	file := "currency, amount, acquirer_reference, authorization_code, settlement_date\n" +
+		"GBP, 100, ref-1, auth-1, 2024-01-01\n" +
+		"eur, 250, , auth-2, 2024-01-01\n"
+
+	lines, err := reconciliation.Parse(strings.NewReader(file), reconciliation.FormatCSV)
+	require.NoError(t, err)
+
+	assert.Equal(t, []models.SettlementLine{
+		{Line: 2, AcquirerReference: "ref-1", AuthorizationCode: "auth-1", Amount: 100, Currency: "GBP"},
+		{Line: 3, AuthorizationCode: "auth-2", Amount: 250, Currency: "EUR"},
+	}, lines)
+}
+
+func TestParseCSV_Errors(t *testing.T) {
+	_, err := reconciliation.ParseCSV(strings.NewReader("acquirer_reference,currency\nref-1,GBP\n"))
+	assert.EqualError(t, err, "missing amount column")
+
+	_, err = reconciliation.ParseCSV(strings.NewReader("acquirer_reference,amount,currency\nref-1,ten,GBP\n"))
+	assert.EqualError(t, err, `line 2: invalid amount "ten"`)
+
+	_, err = reconciliation.ParseCSV(strings.NewReader("acquirer_reference,amount,currency\n,10,GBP\n"))
+	assert.EqualError(t, err, "line 2: needs an acquirer reference or authorization code")
+}
+
+func TestParseFixedWidth(t *testing.T) {
+	file := fmt.Sprintf("%-36s%-36s%012d%s\n", "ref-1", "auth-1", 100, "GBP") +
+		"\n" +
+		fmt.Sprintf("%-36s%-36s%012d%s\n", "ref-2", "", 2500, "USD")
+
+	lines, err := reconciliation.Parse(strings.NewReader(file), reconciliation.FormatFixedWidth)
+	require.NoError(t, err)
+
+	assert.Equal(t, []models.SettlementLine{
+		{Line: 1, AcquirerReference: "ref-1", AuthorizationCode: "auth-1", Amount: 100, Currency: "GBP"},
+		{Line: 3, AcquirerReference: "ref-2", Amount: 2500, Currency: "USD"},
+	}, lines)
+}
+
+func TestParse_UnsupportedFormat(t *testing.T) {
+	_, err := reconciliation.Parse(strings.NewReader(""), "xlsx")
+	assert.EqualError(t, err, `unsupported settlement file format "xlsx"`)
+}
+
+func TestReconcile(t *testing.T) {
+	expected := []models.PostPaymentResponse{
+		{Id: "matched", AcquirerReference: "ref-1", AuthorizationCode: "auth-1", Amount: 100, Currency: "GBP"},
+		{Id: "by-auth-code", AcquirerReference: "ref-2", AuthorizationCode: "auth-2", Amount: 200, Currency: "GBP"},
+		{Id: "mismatch", AcquirerReference: "ref-3", AuthorizationCode: "auth-3", Amount: 300, Currency: "GBP"},
+		{Id: "missing", AcquirerReference: "ref-4", AuthorizationCode: "auth-4", Amount: 400, Currency: "GBP"},
+	}
+	lines := []models.SettlementLine{
+		{Line: 1, AcquirerReference: "ref-1", Amount: 100, Currency: "GBP"},
+		{Line: 2, AuthorizationCode: "auth-2", Amount: 200, Currency: "GBP"},
+		{Line: 3, AcquirerReference: "ref-3", Amount: 299, Currency: "GBP"},
+		{Line: 4, AcquirerReference: "ref-9", Amount: 900, Currency: "GBP"},
+		// settling the same payment twice is unexpected
+		{Line: 5, AcquirerReference: "ref-1", Amount: 100, Currency: "GBP"},
+	}
+
+	report := reconciliation.Reconcile(lines, expected)
+
+	assert.Equal(t, models.ReconciliationSummary{Matched: 2, Missing: 1, Unexpected: 2, AmountMismatch: 1}, report.Summary)
+	assert.Equal(t, "matched", report.Matched[0].PaymentId)
+	assert.Equal(t, "by-auth-code", report.Matched[1].PaymentId)
+	assert.Equal(t, "missing", report.Missing[0].PaymentId)
+	assert.Equal(t, 4, report.Unexpected[0].Line)
+	assert.Equal(t, 5, report.Unexpected[1].Line)
+	assert.Equal(t, models.ReconciliationItem{
+		PaymentId:         "mismatch",
+		Line:              3,
+		AcquirerReference: "ref-3",
+		AuthorizationCode: "auth-3",
+		ExpectedAmount:    300,
+		ExpectedCurrency:  "GBP",
+		SettledAmount:     299,
+		SettledCurrency:   "GBP",
+	}, report.AmountMismatch[0])
+}
@@ -0,0 +1,75 @@
+package reporting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// Column is a single field of an export.
+type Column struct {
+	name  string
+	value func(payment models.PostPaymentResponse) any
+}
+
+var allColumns = []Column{
+	{"id", func(p models.PostPaymentResponse) any { return p.Id }},
+	{"created_at", func(p models.PostPaymentResponse) any { return p.CreatedAt.Format(time.RFC3339) }},
+	{"merchant_id", func(p models.PostPaymentResponse) any { return p.MerchantID }},
+	{"status", func(p models.PostPaymentResponse) any { return p.PaymentStatus }},
+	{"amount", func(p models.PostPaymentResponse) any { return p.Amount }},
+	{"currency", func(p models.PostPaymentResponse) any { return p.Currency }},
+	{"card_last_four", func(p models.PostPaymentResponse) any { return fmt.Sprintf("%04d", p.CardNumberLastFour) }},
+	{"acquirer", func(p models.PostPaymentResponse) any { return p.Acquirer }},
+	{"authorization_code", func(p models.PostPaymentResponse) any { return p.AuthorizationCode }},
+	{"acquirer_reference", func(p models.PostPaymentResponse) any { return p.AcquirerReference }},
+	{"decline_code", func(p models.PostPaymentResponse) any { return p.DeclineCode }},
+	{"bank_response_code", func(p models.PostPaymentResponse) any { return p.BankResponseCode }},
+	{"bank_response_time_ms", func(p models.PostPaymentResponse) any { return p.BankResponseTime.Milliseconds() }},
+	{"risk_score", func(p models.PostPaymentResponse) any { return p.RiskScore }},
+	{"risk_outcome", func(p models.PostPaymentResponse) any { return p.RiskOutcome }},
+	{"card_fingerprint", func(p models.PostPaymentResponse) any { return p.CardFingerprint }},
+}
+
+// DefaultColumns is what finance asked for, every other column has to be requested explicitly.
+var DefaultColumns = []string{"id", "created_at", "merchant_id", "status", "amount", "currency", "card_last_four", "acquirer", "authorization_code", "acquirer_reference", "decline_code"}
+
+// ParseColumns turns a comma separated list of column names into columns, an empty list gives the defaults.
+func ParseColumns(list string) ([]Column, error) {
+	names := DefaultColumns
+	if strings.TrimSpace(list) != "" {
+		names = strings.Split(list, ",")
+	}
+
+	selected := []Column{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, c := range allColumns {
+			if c.name == name {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	return selected, nil
+}
+
+func (c Column) text(payment models.PostPaymentResponse) string {
+	switch v := c.value(payment).(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return fmt.Sprint(c.value(payment))
+}
@@ -0,0 +1,165 @@
+package reporting
+
+/*
+Exports stream straight from the repository to the writer a page at a time, so memory use depends on the page size and the number of currency/status pairs rather than on how many payments are exported.
+
+CSV exports end with an empty line followed by a totals table, JSON Lines exports end with a single {"totals": [...]} line.
+*/
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+
+	pageSize = 500
+)
+
+type Filter struct {
+	MerchantID string
+	From       *time.Time
+	To         *time.Time
+}
+
+func (f Filter) matches(payment models.PostPaymentResponse) bool {
+	if f.MerchantID != "" && payment.MerchantID != f.MerchantID {
+		return false
+	}
+	if f.From != nil && payment.CreatedAt.Before(*f.From) {
+		return false
+	}
+	if f.To != nil && !payment.CreatedAt.Before(*f.To) {
+		return false
+	}
+	return true
+}
+
+type Total struct {
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+	Count    int    `json:"count"`
+	Amount   int    `json:"amount"`
+}
+
+type rowWriter interface {
+	header(columns []Column) error
+	row(columns []Column, payment models.PostPaymentResponse) error
+	totals(totals []Total) error
+}
+
+// Export writes the payments matching filter to w in the given format.
+func Export(w io.Writer, repo *repository.PaymentsRepository, format string, columns []Column, filter Filter) error {
+	var writer rowWriter
+	switch format {
+	case FormatCSV:
+		writer = &csvWriter{w: csv.NewWriter(w)}
+	case FormatJSONL:
+		writer = &jsonlWriter{encoder: json.NewEncoder(w)}
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+
+	if err := writer.header(columns); err != nil {
+		return err
+	}
+
+	totals := map[[2]string]*Total{}
+	for offset := 0; ; offset += pageSize {
+		page := repo.Page(offset, pageSize)
+		for _, payment := range page {
+			if !filter.matches(payment) {
+				continue
+			}
+			if err := writer.row(columns, payment); err != nil {
+				return err
+			}
+
+			key := [2]string{payment.Currency, payment.PaymentStatus}
+			if totals[key] == nil {
+				totals[key] = &Total{Currency: payment.Currency, Status: payment.PaymentStatus}
+			}
+			totals[key].Count++
+			totals[key].Amount += payment.Amount
+		}
+		if len(page) < pageSize {
+			break
+		}
+	}
+
+	sorted := []Total{}
+	for _, total := range totals {
+		sorted = append(sorted, *total)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Currency != sorted[j].Currency {
+			return sorted[i].Currency < sorted[j].Currency
+		}
+		return sorted[i].Status < sorted[j].Status
+	})
+
+	return writer.totals(sorted)
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) header(columns []Column) error {
+	names := []string{}
+	for _, column := range columns {
+		names = append(names, column.name)
+	}
+	return c.w.Write(names)
+}
+
+func (c *csvWriter) row(columns []Column, payment models.PostPaymentResponse) error {
+	values := []string{}
+	for _, column := range columns {
+		values = append(values, column.text(payment))
+	}
+	if err := c.w.Write(values); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) totals(totals []Total) error {
+	c.w.Write([]string{})
+	c.w.Write([]string{"currency", "status", "count", "amount"})
+	for _, total := range totals {
+		c.w.Write([]string{total.Currency, total.Status, fmt.Sprint(total.Count), fmt.Sprint(total.Amount)})
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonlWriter) header(columns []Column) error {
+	return nil
+}
+
+func (j *jsonlWriter) row(columns []Column, payment models.PostPaymentResponse) error {
+	values := map[string]any{}
+	for _, column := range columns {
+		values[column.name] = column.value(payment)
+	}
+	return j.encoder.Encode(values)
+}
+
+func (j *jsonlWriter) totals(totals []Total) error {
+	return j.encoder.Encode(map[string][]Total{"totals": totals})
+}
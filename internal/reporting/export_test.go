@@ -0,0 +1,97 @@
+package reporting_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/reporting"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seed(t *testing.T) *repository.PaymentsRepository {
+	t.Helper()
+
+	repo := repository.NewPaymentsRepository()
+	day := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	repo.AddPayment(models.PostPaymentResponse{Id: "p1", MerchantID: "m1", PaymentStatus: "authorized", Amount: 100, Currency: "GBP", CardNumberLastFour: 42, CreatedAt: day})
+	repo.AddPayment(models.PostPaymentResponse{Id: "p2", MerchantID: "m1", PaymentStatus: "authorized", Amount: 250, Currency: "GBP", CreatedAt: day})
+	repo.AddPayment(models.PostPaymentResponse{Id: "p3", MerchantID: "m1", PaymentStatus: "declined", Amount: 50, Currency: "EUR", CreatedAt: day})
+	repo.AddPayment(models.PostPaymentResponse{Id: "p4", MerchantID: "m2", PaymentStatus: "authorized", Amount: 999, Currency: "GBP", CreatedAt: day})
+	repo.AddPayment(models.PostPaymentResponse{Id: "p5", MerchantID: "m1", PaymentStatus: "authorized", Amount: 999, Currency: "GBP", CreatedAt: day.AddDate(0, 0, 1)})
+	return repo
+}
+
+func TestExport_CSV(t *testing.T) {
+	repo := seed(t)
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	columns, err := reporting.ParseColumns("id,status,amount,currency,card_last_four")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	err = reporting.Export(&out, repo, reporting.FormatCSV, columns, reporting.Filter{MerchantID: "m1", From: &from, To: &to})
+	require.NoError(t, err)
+
+	expected := "id,status,amount,currency,card_last_four\n" +
+		"p1,authorized,100,GBP,0042\n" +
+		"p2,authorized,250,GBP,0000\n" +
+		"p3,declined,50,EUR,0000\n" +
+		"\n" +
+		"currency,status,count,amount\n" +
+		"EUR,declined,1,50\n" +
+		"GBP,authorized,2,350\n"
+	assert.Equal(t, expected, out.String())
+}
+
+func TestExport_JSONL(t *testing.T) {
+	repo := seed(t)
+
+	columns, err := reporting.ParseColumns("id,amount")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	err = reporting.Export(&out, repo, reporting.FormatJSONL, columns, reporting.Filter{MerchantID: "m2"})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"id": "p4", "amount": 999}`, lines[0])
+	assert.JSONEq(t, `{"totals": [{"currency": "GBP", "status": "authorized", "count": 1, "amount": 999}]}`, lines[1])
+}
+
+func TestExport_ManyPages(t *testing.T) {
+	repo := repository.NewPaymentsRepository()
+	for i := 0; i < 1234; i++ {
+		repo.AddPayment(models.PostPaymentResponse{Id: fmt.Sprint(i), PaymentStatus: "authorized", Amount: 1, Currency: "GBP"})
+	}
+
+	columns, err := reporting.ParseColumns("id")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, reporting.Export(&out, repo, reporting.FormatJSONL, columns, reporting.Filter{}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 1235)
+
+	var totals map[string][]reporting.Total
+	require.NoError(t, json.Unmarshal([]byte(lines[1234]), &totals))
+	assert.Equal(t, 1234, totals["totals"][0].Count)
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, err := reporting.ParseColumns("")
+	require.NoError(t, err)
+	assert.Len(t, columns, len(reporting.DefaultColumns))
+
+	_, err = reporting.ParseColumns("id,cvv")
+	assert.EqualError(t, err, `unknown column "cvv"`)
+}
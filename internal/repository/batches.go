@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different payment")
+
+// BatchTTL is how long a completed batch can be polled and its idempotency keys replayed.
+const BatchTTL = 24 * time.Hour
+
+// batchSweepInterval is how often expired batches and keys are dropped.
+const batchSweepInterval = time.Minute
+
+type idempotencyEntry struct {
+	// payload identifies the item the key was first used with
+	payload   string
+	done      bool
+	result    models.BatchItemResult
+	expiresAt time.Time
+}
+
+type BatchesRepository struct {
+	mu        sync.RWMutex
+	batches   map[string]models.PaymentBatch
+	keys      map[string]idempotencyEntry
+	nextSweep time.Time
+}
+
+func NewBatchesRepository() *BatchesRepository {
+	return &BatchesRepository{
+		batches: map[string]models.PaymentBatch{},
+		keys:    map[string]idempotencyEntry{},
+	}
+}
+
+func (br *BatchesRepository) AddBatch(batch models.PaymentBatch) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	br.sweep(batch.CreatedAt)
+	br.batches[batch.Id] = batch
+}
+
+func (br *BatchesRepository) GetBatch(id string) *models.PaymentBatch {
+	br.mu.RLock()
+	defer br.mu.RUnlock()
+
+	batch, ok := br.batches[id]
+	if !ok {
+		return nil
+	}
+	// results are written to in place while the batch runs
+	batch.Results = append([]models.BatchItemResult(nil), batch.Results...)
+	counts := make(map[string]int, len(batch.Counts))
+	for status, count := range batch.Counts {
+		counts[status] = count
+	}
+	batch.Counts = counts
+	return &batch
+}
+
+// SetResult records the outcome of an item, the batch is completed once every item has one.
+func (br *BatchesRepository) SetResult(id string, result models.BatchItemResult, now time.Time) bool {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	batch, ok := br.batches[id]
+	if !ok || result.Index < 0 || result.Index >= len(batch.Results) {
+		return false
+	}
+
+	batch.Results[result.Index] = result
+	batch.Processed++
+	batch.Counts[result.Status]++
+	if batch.Processed == batch.Total {
+		batch.Status = models.BatchCompleted
+		batch.CompletedAt = &now
+	}
+	br.batches[id] = batch
+	return true
+}
+
+// ReserveKey claims an idempotency key for the merchant and the item identified by payload.  When the
+// key was used before the earlier result is returned instead, and a key that is still being processed
+// can be neither claimed nor replayed.  A key sent with another payload is ErrIdempotencyKeyReused.
+// Keys are free again BatchTTL after their item completed.
+func (br *BatchesRepository) ReserveKey(merchantID, key, payload string, now time.Time) (previous *models.BatchItemResult, reserved bool, err error) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	br.sweep(now)
+	entry, ok := br.keys[idempotencyKey(merchantID, key)]
+	if !ok || (entry.done && now.After(entry.expiresAt)) {
+		br.keys[idempotencyKey(merchantID, key)] = idempotencyEntry{payload: payload}
+		return nil, true, nil
+	}
+	if entry.payload != payload {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+	if !entry.done {
+		return nil, false, nil
+	}
+	result := entry.result
+	return &result, false, nil
+}
+
+// CompleteKey stores the result to replay for a reserved key.
+func (br *BatchesRepository) CompleteKey(merchantID, key string, result models.BatchItemResult, now time.Time) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	entry := br.keys[idempotencyKey(merchantID, key)]
+	entry.done = true
+	entry.result = result
+	entry.expiresAt = now.Add(BatchTTL)
+	br.keys[idempotencyKey(merchantID, key)] = entry
+}
+
+// ReleaseKey frees a reserved key so the item can be sent again.
+func (br *BatchesRepository) ReleaseKey(merchantID, key string) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	delete(br.keys, idempotencyKey(merchantID, key))
+}
+
+func idempotencyKey(merchantID, key string) string {
+	return merchantID + "\x00" + key
+}
+
+// sweep drops the batches that completed and the keys that were completed more than BatchTTL ago, at most
+// once every batchSweepInterval.  Batches still running and keys still reserved are kept.
+func (br *BatchesRepository) sweep(now time.Time) {
+	if now.Before(br.nextSweep) {
+		return
+	}
+	for id, batch := range br.batches {
+		if batch.CompletedAt != nil && now.Sub(*batch.CompletedAt) > BatchTTL {
+			delete(br.batches, id)
+		}
+	}
+	for key, entry := range br.keys {
+		if entry.done && now.After(entry.expiresAt) {
+			delete(br.keys, key)
+		}
+	}
+	br.nextSweep = now.Add(batchSweepInterval)
+}
@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchesRepository_Expiry(t *testing.T) {
+	repo := repository.NewBatchesRepository()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	repo.AddBatch(models.PaymentBatch{
+		Id:        "batch-1",
+		Status:    models.BatchProcessing,
+		Total:     1,
+		Counts:    map[string]int{},
+		CreatedAt: now,
+		Results:   make([]models.BatchItemResult, 1),
+	})
+	_, reserved, err := repo.ReserveKey("merchant-1", "key-1", "payload", now)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	result := models.BatchItemResult{Index: 0, Status: "authorized", PaymentId: "payment-1"}
+	repo.CompleteKey("merchant-1", "key-1", result, now)
+	require.True(t, repo.SetResult("batch-1", result, now))
+
+	// still replayed within the TTL
+	previous, _, err := repo.ReserveKey("merchant-1", "key-1", "payload", now.Add(time.Hour))
+	require.NoError(t, err)
+	require.NotNil(t, previous)
+	assert.Equal(t, "payment-1", previous.PaymentId)
+
+	later := now.Add(repository.BatchTTL + time.Minute)
+	repo.AddBatch(models.PaymentBatch{Id: "batch-2", Status: models.BatchProcessing, Counts: map[string]int{}, CreatedAt: later})
+	assert.Nil(t, repo.GetBatch("batch-1"))
+	assert.NotNil(t, repo.GetBatch("batch-2"))
+
+	// the key can be used again, even for another payment
+	previous, reserved, err = repo.ReserveKey("merchant-1", "key-1", "other payload", later)
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+	assert.True(t, reserved)
+}
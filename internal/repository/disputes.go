@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+type DisputesRepository struct {
+	mu         sync.RWMutex
+	disputes   map[string]models.Dispute
+	byAcquirer map[string]string
+	evidence   map[string][]byte
+}
+
+func NewDisputesRepository() *DisputesRepository {
+	return &DisputesRepository{
+		disputes:   map[string]models.Dispute{},
+		byAcquirer: map[string]string{},
+		evidence:   map[string][]byte{},
+	}
+}
+
+func (dr *DisputesRepository) AddDispute(dispute models.Dispute) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	dr.disputes[dispute.Id] = dispute
+	dr.byAcquirer[dispute.AcquirerDisputeId] = dispute.Id
+}
+
+func (dr *DisputesRepository) UpdateDispute(dispute models.Dispute) bool {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	if _, ok := dr.disputes[dispute.Id]; !ok {
+		return false
+	}
+	dr.disputes[dispute.Id] = dispute
+	return true
+}
+
+func (dr *DisputesRepository) GetDispute(id string) *models.Dispute {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	dispute, ok := dr.disputes[id]
+	if !ok {
+		return nil
+	}
+	dispute.Evidence = append([]models.DisputeEvidence{}, dispute.Evidence...)
+	return &dispute
+}
+
+func (dr *DisputesRepository) GetByAcquirerDisputeId(acquirerDisputeId string) *models.Dispute {
+	dr.mu.RLock()
+	id, ok := dr.byAcquirer[acquirerDisputeId]
+	dr.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return dr.GetDispute(id)
+}
+
+// ListDisputes returns the disputes with the closest deadline first, empty filters match everything.
+func (dr *DisputesRepository) ListDisputes(merchantID, status string) []models.Dispute {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	disputes := []models.Dispute{}
+	for _, dispute := range dr.disputes {
+		if merchantID != "" && dispute.MerchantID != merchantID {
+			continue
+		}
+		if status != "" && dispute.Status != status {
+			continue
+		}
+		disputes = append(disputes, dispute)
+	}
+	sort.Slice(disputes, func(i, j int) bool {
+		if disputes[i].RespondBy.Equal(disputes[j].RespondBy) {
+			return disputes[i].Id < disputes[j].Id
+		}
+		return disputes[i].RespondBy.Before(disputes[j].RespondBy)
+	})
+	return disputes
+}
+
+// OpenPaymentIds returns the payments with a dispute that has not been won or lost yet.
+func (dr *DisputesRepository) OpenPaymentIds() map[string]bool {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	ids := map[string]bool{}
+	for _, dispute := range dr.disputes {
+		if dispute.Status == models.DisputeNeedsResponse || dispute.Status == models.DisputeUnderReview {
+			ids[dispute.PaymentId] = true
+		}
+	}
+	return ids
+}
+
+// Overdue returns the ids of the disputes still waiting for the merchant after their deadline.
+func (dr *DisputesRepository) Overdue(now time.Time) []string {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	ids := []string{}
+	for id, dispute := range dr.disputes {
+		if dispute.Status == models.DisputeNeedsResponse && now.After(dispute.RespondBy) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (dr *DisputesRepository) AddEvidenceContent(evidenceId string, content []byte) {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	dr.evidence[evidenceId] = content
+}
+
+func (dr *DisputesRepository) GetEvidenceContent(evidenceId string) ([]byte, bool) {
+	dr.mu.RLock()
+	defer dr.mu.RUnlock()
+
+	content, ok := dr.evidence[evidenceId]
+	return content, ok
+}
@@ -0,0 +1,261 @@
+package repository
+
+/*
+Block and allow lists are read on every payment so lookups need to stay cheap as the lists grow.  Card fingerprints, currencies and countries are exact matches and live in maps, BIN ranges are kept sorted by their start so that we can binary search for the candidates instead of walking every range.
+*/
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// binLength is the length every BIN is padded to so that 6 and 8 digit ranges can be compared.
+const binLength = 8
+
+var ErrListEntryNotFound = errors.New("list entry not found")
+
+type binRange struct {
+	start int
+	end   int
+	id    string
+}
+
+type ListsRepository struct {
+	mu      sync.RWMutex
+	entries map[string]models.ListEntry
+	exact   map[string][]string
+	ranges  []binRange
+	maxEnd  []int
+	audit   []models.ListAuditEntry
+}
+
+func NewListsRepository() *ListsRepository {
+	return &ListsRepository{
+		entries: map[string]models.ListEntry{},
+		exact:   map[string][]string{},
+		audit:   []models.ListAuditEntry{},
+	}
+}
+
+func (lr *ListsRepository) AddEntry(entry models.ListEntry) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	if entry.Type == models.ListEntryBINRange {
+		start, end, err := ParseBINRange(entry.BINStart, entry.BINEnd)
+		if err != nil {
+			return err
+		}
+		lr.ranges = append(lr.ranges, binRange{start: start, end: end, id: entry.Id})
+		lr.reindexRanges()
+	} else {
+		key := exactKey(entry.Type, entry.Value)
+		lr.exact[key] = append(lr.exact[key], entry.Id)
+	}
+
+	lr.entries[entry.Id] = entry
+	lr.audit = append(lr.audit, models.ListAuditEntry{
+		Action: "created",
+		Actor:  entry.CreatedBy,
+		At:     entry.CreatedAt,
+		Entry:  entry,
+	})
+	return nil
+}
+
+func (lr *ListsRepository) DeleteEntry(id, actor string, at time.Time) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	entry, ok := lr.entries[id]
+	if !ok {
+		return ErrListEntryNotFound
+	}
+	delete(lr.entries, id)
+
+	if entry.Type == models.ListEntryBINRange {
+		ranges := []binRange{}
+		for _, r := range lr.ranges {
+			if r.id != id {
+				ranges = append(ranges, r)
+			}
+		}
+		lr.ranges = ranges
+		lr.reindexRanges()
+	} else {
+		key := exactKey(entry.Type, entry.Value)
+		lr.exact[key] = removeID(lr.exact[key], id)
+		if len(lr.exact[key]) == 0 {
+			delete(lr.exact, key)
+		}
+	}
+
+	lr.audit = append(lr.audit, models.ListAuditEntry{
+		Action: "deleted",
+		Actor:  actor,
+		At:     at,
+		Entry:  entry,
+	})
+	return nil
+}
+
+func (lr *ListsRepository) GetEntry(id string) *models.ListEntry {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+
+	entry, ok := lr.entries[id]
+	if !ok {
+		return nil
+	}
+	return &entry
+}
+
+// ListEntries returns every entry ordered by creation time, an empty list returns entries from both lists.
+func (lr *ListsRepository) ListEntries(list string) []models.ListEntry {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+
+	entries := []models.ListEntry{}
+	for _, entry := range lr.entries {
+		if list == "" || entry.List == list {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries
+}
+
+// ForgetValue blanks the value out of the list audit, for entries that were removed because the card
+// holder asked to be erased.
+func (lr *ListsRepository) ForgetValue(entryType, value string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	for i, entry := range lr.audit {
+		if entry.Entry.Type == entryType && entry.Entry.Value == value {
+			lr.audit[i].Entry.Value = ""
+		}
+	}
+}
+
+func (lr *ListsRepository) Audit() []models.ListAuditEntry {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+
+	return append([]models.ListAuditEntry{}, lr.audit...)
+}
+
+// Match returns the unexpired entries that apply to the given value, use MatchBIN for card numbers.
+func (lr *ListsRepository) Match(entryType, value string, now time.Time) []models.ListEntry {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+
+	return lr.active(lr.exact[exactKey(entryType, value)], now)
+}
+
+// MatchBIN returns the unexpired BIN range entries containing the card number.
+func (lr *ListsRepository) MatchBIN(cardNumber string, now time.Time) []models.ListEntry {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+
+	bin, err := padBIN(cardNumber, "0")
+	if err != nil {
+		return nil
+	}
+
+	// ranges are sorted by start, so everything after i starts above the BIN
+	i := sort.Search(len(lr.ranges), func(i int) bool {
+		return lr.ranges[i].start > bin
+	})
+
+	ids := []string{}
+	for j := i - 1; j >= 0 && lr.maxEnd[j] >= bin; j-- {
+		if lr.ranges[j].end >= bin {
+			ids = append(ids, lr.ranges[j].id)
+		}
+	}
+	return lr.active(ids, now)
+}
+
+func (lr *ListsRepository) active(ids []string, now time.Time) []models.ListEntry {
+	entries := []models.ListEntry{}
+	for _, id := range ids {
+		entry := lr.entries[id]
+		if entry.ExpiresAt != nil && !entry.ExpiresAt.After(now) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// reindexRanges keeps the ranges sorted and tracks the running maximum end so the backwards scan in MatchBIN can stop early.
+func (lr *ListsRepository) reindexRanges() {
+	sort.Slice(lr.ranges, func(i, j int) bool {
+		return lr.ranges[i].start < lr.ranges[j].start
+	})
+
+	lr.maxEnd = make([]int, len(lr.ranges))
+	for i, r := range lr.ranges {
+		lr.maxEnd[i] = r.end
+		if i > 0 && lr.maxEnd[i-1] > r.end {
+			lr.maxEnd[i] = lr.maxEnd[i-1]
+		}
+	}
+}
+
+// ParseBINRange validates a BIN range and pads both ends so 6 and 8 digit BINs can be mixed.
+func ParseBINRange(start, end string) (int, int, error) {
+	if end == "" {
+		end = start
+	}
+	s, err := padBIN(start, "0")
+	if err != nil {
+		return 0, 0, err
+	}
+	e, err := padBIN(end, "9")
+	if err != nil {
+		return 0, 0, err
+	}
+	if s > e {
+		return 0, 0, errors.New("bin range start is after its end")
+	}
+	return s, e, nil
+}
+
+func padBIN(bin, pad string) (int, error) {
+	if len(bin) > binLength {
+		bin = bin[:binLength]
+	}
+	if len(bin) < 4 {
+		return 0, errors.New("bin must have at least 4 digits")
+	}
+	// Atoi would take a sign as well
+	if strings.Trim(bin, "0123456789") != "" {
+		return 0, errors.New("bin must only have digits")
+	}
+	bin += strings.Repeat(pad, binLength-len(bin))
+	return strconv.Atoi(bin)
+}
+
+func exactKey(entryType, value string) string {
+	return entryType + ":" + strings.ToUpper(value)
+}
+
+func removeID(ids []string, id string) []string {
+	remaining := []string{}
+	for _, existing := range ids {
+		if existing != id {
+			remaining = append(remaining, existing)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,90 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListsRepository_MatchBIN(t *testing.T) {
+	now := time.Now()
+	repo := repository.NewListsRepository()
+
+	require.NoError(t, repo.AddEntry(models.ListEntry{Id: "wide", List: models.ListBlock, Type: models.ListEntryBINRange, BINStart: "400000", BINEnd: "499999"}))
+	require.NoError(t, repo.AddEntry(models.ListEntry{Id: "narrow", List: models.ListAllow, Type: models.ListEntryBINRange, BINStart: "42424242", BINEnd: "42424242"}))
+	require.NoError(t, repo.AddEntry(models.ListEntry{Id: "other", List: models.ListBlock, Type: models.ListEntryBINRange, BINStart: "510000", BINEnd: "519999"}))
+
+	matches := repo.MatchBIN("4242424242424242", now)
+	assert.ElementsMatch(t, []string{"wide", "narrow"}, entryIDs(matches))
+
+	matches = repo.MatchBIN("4111111111111111", now)
+	assert.Equal(t, []string{"wide"}, entryIDs(matches))
+
+	matches = repo.MatchBIN("5555555555554444", now)
+	assert.Empty(t, matches)
+
+	matches = repo.MatchBIN("5100000000000000", now)
+	assert.Equal(t, []string{"other"}, entryIDs(matches))
+}
+
+func TestListsRepository_Expiry(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	repo := repository.NewListsRepository()
+
+	require.NoError(t, repo.AddEntry(models.ListEntry{Id: "gbp", List: models.ListBlock, Type: models.ListEntryCurrency, Value: "GBP", ExpiresAt: &expiresAt}))
+
+	assert.Len(t, repo.Match(models.ListEntryCurrency, "GBP", now), 1)
+	assert.Empty(t, repo.Match(models.ListEntryCurrency, "GBP", now.Add(2*time.Hour)))
+}
+
+func TestListsRepository_DeleteEntry(t *testing.T) {
+	now := time.Now()
+	repo := repository.NewListsRepository()
+
+	require.NoError(t, repo.AddEntry(models.ListEntry{Id: "range", List: models.ListBlock, Type: models.ListEntryBINRange, BINStart: "400000", CreatedBy: "alice"}))
+	require.NoError(t, repo.AddEntry(models.ListEntry{Id: "country", List: models.ListBlock, Type: models.ListEntryCountry, Value: "GB", CreatedBy: "alice"}))
+
+	require.NoError(t, repo.DeleteEntry("range", "bob", now))
+	require.NoError(t, repo.DeleteEntry("country", "bob", now))
+	assert.ErrorIs(t, repo.DeleteEntry("country", "bob", now), repository.ErrListEntryNotFound)
+
+	assert.Empty(t, repo.MatchBIN("4000001234567890", now))
+	assert.Empty(t, repo.Match(models.ListEntryCountry, "GB", now))
+	assert.Empty(t, repo.ListEntries(""))
+
+	audit := repo.Audit()
+	require.Len(t, audit, 4)
+	assert.Equal(t, "created", audit[0].Action)
+	assert.Equal(t, "alice", audit[0].Actor)
+	assert.Equal(t, "deleted", audit[3].Action)
+	assert.Equal(t, "bob", audit[3].Actor)
+	assert.Equal(t, "country", audit[3].Entry.Id)
+}
+
+func TestParseBINRange(t *testing.T) {
+	start, end, err := repository.ParseBINRange("411111", "")
+	require.NoError(t, err)
+	assert.Equal(t, 41111100, start)
+	assert.Equal(t, 41111199, end)
+
+	_, _, err = repository.ParseBINRange("499999", "400000")
+	assert.Error(t, err)
+
+	for _, bin := range []string{"abc", "-1234", "+1234", "4111 1"} {
+		_, _, err = repository.ParseBINRange(bin, "")
+		assert.Error(t, err, bin)
+	}
+}
+
+func entryIDs(entries []models.ListEntry) []string {
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.Id)
+	}
+	return ids
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+var ErrMerchantProfileNotFound = errors.New("merchant profile not found")
+
+type volumeKey struct {
+	merchantID string
+	currency   string
+	day        string
+}
+
+type MerchantsRepository struct {
+	mu       sync.RWMutex
+	profiles map[string]models.MerchantProfile
+	volumes  map[volumeKey]int
+}
+
+func NewMerchantsRepository() *MerchantsRepository {
+	return &MerchantsRepository{
+		profiles: map[string]models.MerchantProfile{},
+		volumes:  map[volumeKey]int{},
+	}
+}
+
+func (mr *MerchantsRepository) PutProfile(profile models.MerchantProfile) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.profiles[profile.MerchantID] = profile
+}
+
+func (mr *MerchantsRepository) GetProfile(merchantID string) *models.MerchantProfile {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	profile, ok := mr.profiles[merchantID]
+	if !ok {
+		return nil
+	}
+	return &profile
+}
+
+func (mr *MerchantsRepository) DeleteProfile(merchantID string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.profiles[merchantID]; !ok {
+		return ErrMerchantProfileNotFound
+	}
+	delete(mr.profiles, merchantID)
+	return nil
+}
+
+func (mr *MerchantsRepository) ListProfiles() []models.MerchantProfile {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	profiles := []models.MerchantProfile{}
+	for _, profile := range mr.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].MerchantID < profiles[j].MerchantID })
+	return profiles
+}
+
+// ReserveVolume adds amount to the merchant's volume for the day unless that would take it over
+// limit, checking and adding under one lock so concurrent payments cannot both squeeze in.
+func (mr *MerchantsRepository) ReserveVolume(merchantID, currency, day string, amount, limit int) bool {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	key := volumeKey{merchantID: merchantID, currency: currency, day: day}
+	if mr.volumes[key]+amount > limit {
+		return false
+	}
+	mr.volumes[key] += amount
+	return true
+}
+
+// ReleaseVolume gives back a reservation for a payment that did not go through.
+func (mr *MerchantsRepository) ReleaseVolume(merchantID, currency, day string, amount int) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	key := volumeKey{merchantID: merchantID, currency: currency, day: day}
+	mr.volumes[key] -= amount
+	if mr.volumes[key] <= 0 {
+		delete(mr.volumes, key)
+	}
+}
+
+func (mr *MerchantsRepository) Volume(merchantID, currency, day string) int {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+
+	return mr.volumes[volumeKey{merchantID: merchantID, currency: currency, day: day}]
+}
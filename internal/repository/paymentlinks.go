@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+var (
+	ErrPaymentLinkNotFound = errors.New("payment link not found")
+	ErrPaymentLinkUsed     = errors.New("payment link has already been used")
+	ErrPaymentLinkExpired  = errors.New("payment link has expired")
+)
+
+type PaymentLinksRepository struct {
+	mu    sync.RWMutex
+	links map[string]models.PaymentLink
+}
+
+func NewPaymentLinksRepository() *PaymentLinksRepository {
+	return &PaymentLinksRepository{
+		links: map[string]models.PaymentLink{},
+	}
+}
+
+func (lr *PaymentLinksRepository) AddLink(link models.PaymentLink) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.links[link.Id] = link
+}
+
+// GetLink returns the link as of now, active links past their expiry are reported as expired.
+func (lr *PaymentLinksRepository) GetLink(id string, now time.Time) *models.PaymentLink {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+
+	link, ok := lr.links[id]
+	if !ok {
+		return nil
+	}
+	if link.Status == models.PaymentLinkActive && now.After(link.ExpiresAt) {
+		link.Status = models.PaymentLinkExpired
+	}
+	return &link
+}
+
+// ClaimLink moves an active link to processing so that only one payment can be made with it at a time.
+func (lr *PaymentLinksRepository) ClaimLink(id string, now time.Time) (*models.PaymentLink, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	link, ok := lr.links[id]
+	switch {
+	case !ok:
+		return nil, ErrPaymentLinkNotFound
+	case link.Status != models.PaymentLinkActive:
+		return nil, ErrPaymentLinkUsed
+	case now.After(link.ExpiresAt):
+		return nil, ErrPaymentLinkExpired
+	}
+
+	link.Status = models.PaymentLinkProcessing
+	lr.links[id] = link
+	return &link, nil
+}
+
+// ReleaseLink makes a claimed link usable again, for when no payment came out of the attempt.
+func (lr *PaymentLinksRepository) ReleaseLink(id string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	if link, ok := lr.links[id]; ok && link.Status == models.PaymentLinkProcessing {
+		link.Status = models.PaymentLinkActive
+		lr.links[id] = link
+	}
+}
+
+// CompleteLink records the payment made with a claimed link, the link cannot be used again.
+func (lr *PaymentLinksRepository) CompleteLink(id, paymentID string, now time.Time) *models.PaymentLink {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	link, ok := lr.links[id]
+	if !ok {
+		return nil
+	}
+	link.Status = models.PaymentLinkCompleted
+	link.PaymentId = paymentID
+	link.CompletedAt = &now
+	lr.links[id] = link
+	return &link
+}
@@ -1,28 +1,216 @@
 package repository
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
 )
 
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// paymentSecrets are the fields of a payment that are encrypted at rest when the repository has a keyring.
+type paymentSecrets struct {
+	ExpiryMonth int `json:"expiry_month"`
+	ExpiryYear  int `json:"expiry_year"`
+}
+
+// storedPayment is a payment as it is kept, sealed holds its secrets with the fields themselves zeroed.
+type storedPayment struct {
+	payment models.PostPaymentResponse
+	sealed  string
+}
+
 type PaymentsRepository struct {
-	payments []models.PostPaymentResponse
+	mu       sync.RWMutex
+	payments []storedPayment
+	keyring  *keyring.Keyring
 }
 
 func NewPaymentsRepository() *PaymentsRepository {
 	return &PaymentsRepository{
-		payments: []models.PostPaymentResponse{},
+		payments: []storedPayment{},
+	}
+}
+
+// WithKeyring encrypts the card expiry of the payments stored from now on.
+func (ps *PaymentsRepository) WithKeyring(k *keyring.Keyring) *PaymentsRepository {
+	ps.keyring = k
+	return ps
+}
+
+// store seals the secrets of payment.  Sealing only fails when the system runs out of randomness,
+// there is no sensible way on from there so it panics rather than keep the payment without its expiry
+// or in the clear.
+func (ps *PaymentsRepository) store(payment models.PostPaymentResponse) storedPayment {
+	if ps.keyring == nil {
+		return storedPayment{payment: payment}
+	}
+
+	secrets, _ := json.Marshal(paymentSecrets{ExpiryMonth: payment.ExpiryMonth, ExpiryYear: payment.ExpiryYear})
+	sealed, err := ps.keyring.Seal(secrets, paymentContext(payment.Id))
+	if err != nil {
+		panic(fmt.Errorf("could not seal payment %s: %w", payment.Id, err))
+	}
+	payment.ExpiryMonth, payment.ExpiryYear = 0, 0
+	return storedPayment{payment: payment, sealed: sealed}
+}
+
+// load returns the payment with its secrets, a payment that cannot be unsealed is returned without them.
+func (ps *PaymentsRepository) load(stored storedPayment) models.PostPaymentResponse {
+	payment := stored.payment
+	if stored.sealed == "" {
+		return payment
+	}
+
+	plaintext, err := ps.keyring.Unseal(stored.sealed, paymentContext(payment.Id))
+	if err != nil {
+		log.Printf("could not unseal payment %s: %v", payment.Id, err)
+		return payment
+	}
+	var secrets paymentSecrets
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		log.Printf("could not unseal payment %s: %v", payment.Id, err)
+		return payment
 	}
+	payment.ExpiryMonth, payment.ExpiryYear = secrets.ExpiryMonth, secrets.ExpiryYear
+	return payment
+}
+
+func paymentContext(id string) []byte {
+	return []byte("payment:" + id)
 }
 
 func (ps *PaymentsRepository) GetPayment(id string) *models.PostPaymentResponse {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
 	for _, element := range ps.payments {
-		if element.Id == id {
-			return &element
+		if element.payment.Id == id {
+			payment := ps.load(element)
+			return &payment
 		}
 	}
 	return nil
 }
 
 func (ps *PaymentsRepository) AddPayment(payment models.PostPaymentResponse) {
-	ps.payments = append(ps.payments, payment)
+	stored := ps.store(payment)
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.payments = append(ps.payments, stored)
+}
+
+// ForEachPayment calls fn for every payment in the order they were added and stops at the first error.
+// The repository is read locked while this runs so fn must not write to it.
+func (ps *PaymentsRepository) ForEachPayment(fn func(payment models.PostPaymentResponse) error) error {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	for _, stored := range ps.payments {
+		if err := fn(ps.load(stored)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Page returns a copy of up to limit payments starting at offset, in the order they were added.
+// Exports page through the repository so that they never hold the lock or the whole data set at once.
+func (ps *PaymentsRepository) Page(offset, limit int) []models.PostPaymentResponse {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	if offset >= len(ps.payments) {
+		return []models.PostPaymentResponse{}
+	}
+	end := offset + limit
+	if end > len(ps.payments) {
+		end = len(ps.payments)
+	}
+	page := make([]models.PostPaymentResponse, 0, end-offset)
+	for _, stored := range ps.payments[offset:end] {
+		page = append(page, ps.load(stored))
+	}
+	return page
+}
+
+// ModifyPayment changes the stored payment with id through change, under the lock so that changes
+// made at the same time are applied one after the other rather than overwrite each other.  Nothing is
+// stored when change fails.  It returns the payment as stored.
+func (ps *PaymentsRepository) ModifyPayment(id string, change func(payment *models.PostPaymentResponse) error) (*models.PostPaymentResponse, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for i := range ps.payments {
+		if ps.payments[i].payment.Id != id {
+			continue
+		}
+		payment := ps.load(ps.payments[i])
+		if err := change(&payment); err != nil {
+			return nil, err
+		}
+		payment.Id = id
+		ps.payments[i] = ps.store(payment)
+		return &payment, nil
+	}
+	return nil, ErrPaymentNotFound
+}
+
+// AddPaymentIfAbsent stores the payment unless one with the same id is already there.
+func (ps *PaymentsRepository) AddPaymentIfAbsent(payment models.PostPaymentResponse) bool {
+	stored := ps.store(payment)
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for i := range ps.payments {
+		if ps.payments[i].payment.Id == payment.Id {
+			return false
+		}
+	}
+	ps.payments = append(ps.payments, stored)
+	return true
+}
+
+// DeletePayment removes the payment with id for good, it reports whether there was one.
+func (ps *PaymentsRepository) DeletePayment(id string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for i := range ps.payments {
+		if ps.payments[i].payment.Id == id {
+			ps.payments = append(ps.payments[:i], ps.payments[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Rewrap moves the sealed payments over to the primary key of the keyring, one payment at a time so
+// that payments keep being served meanwhile.
+func (ps *PaymentsRepository) Rewrap() (int, error) {
+	rewrapped := 0
+	for i := 0; ; i++ {
+		ps.mu.Lock()
+		if i >= len(ps.payments) {
+			ps.mu.Unlock()
+			return rewrapped, nil
+		}
+		changed, err := rewrap(ps.keyring, &ps.payments[i].sealed)
+		id := ps.payments[i].payment.Id
+		ps.mu.Unlock()
+		if err != nil {
+			return rewrapped, fmt.Errorf("payment %s: %w", id, err)
+		}
+		if changed {
+			rewrapped++
+		}
+	}
 }
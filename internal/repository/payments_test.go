@@ -1,6 +1,8 @@
 package repository_test
 
 import (
+	"errors"
+	"sync"
 	"testing"
 
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
@@ -52,3 +54,55 @@ func TestAddPayment(t *testing.T) {
 	// assert
 	assert.Equal(t, &expectedPayment, repository.GetPayment(expectedPayment.Id))
 }
+
+func TestPage(t *testing.T) {
+
+	// arrange
+	repository := repository.NewPaymentsRepository()
+	for _, id := range []string{"a", "b", "c"} {
+		repository.AddPayment(models.PostPaymentResponse{Id: id})
+	}
+
+	// act
+	first := repository.Page(0, 2)
+	second := repository.Page(2, 2)
+	third := repository.Page(4, 2)
+
+	// assert
+	assert.Equal(t, []models.PostPaymentResponse{{Id: "a"}, {Id: "b"}}, first)
+	assert.Equal(t, []models.PostPaymentResponse{{Id: "c"}}, second)
+	assert.Empty(t, third)
+}
+
+func TestModifyPayment(t *testing.T) {
+	repo := repository.NewPaymentsRepository()
+	repo.AddPayment(models.PostPaymentResponse{Id: "test-id", CardNumberLastFour: 1234})
+
+	// changes made at the same time all make it
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.ModifyPayment("test-id", func(payment *models.PostPaymentResponse) error {
+				payment.ChargebackAmount++
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 50, repo.GetPayment("test-id").ChargebackAmount)
+
+	// a failed change is not stored
+	failure := errors.New("failed")
+	_, err := repo.ModifyPayment("test-id", func(payment *models.PostPaymentResponse) error {
+		payment.CardNumberLastFour = 0
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, 1234, repo.GetPayment("test-id").CardNumberLastFour)
+
+	_, err = repo.ModifyPayment("missing", func(*models.PostPaymentResponse) error { return nil })
+	assert.ErrorIs(t, err, repository.ErrPaymentNotFound)
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+type QuotesRepository struct {
+	mu     sync.RWMutex
+	quotes map[string]models.FXQuote
+}
+
+func NewQuotesRepository() *QuotesRepository {
+	return &QuotesRepository{
+		quotes: map[string]models.FXQuote{},
+	}
+}
+
+func (qr *QuotesRepository) AddQuote(quote models.FXQuote) {
+	qr.mu.Lock()
+	defer qr.mu.Unlock()
+
+	qr.quotes[quote.Id] = quote
+}
+
+func (qr *QuotesRepository) GetQuote(id string) *models.FXQuote {
+	qr.mu.RLock()
+	defer qr.mu.RUnlock()
+
+	quote, ok := qr.quotes[id]
+	if !ok {
+		return nil
+	}
+	return &quote
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+type ReconciliationsRepository struct {
+	mu      sync.RWMutex
+	reports map[string]models.ReconciliationReport
+}
+
+func NewReconciliationsRepository() *ReconciliationsRepository {
+	return &ReconciliationsRepository{
+		reports: map[string]models.ReconciliationReport{},
+	}
+}
+
+func (rr *ReconciliationsRepository) AddReport(report models.ReconciliationReport) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	rr.reports[report.Id] = report
+}
+
+func (rr *ReconciliationsRepository) GetReport(id string) *models.ReconciliationReport {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	report, ok := rr.reports[id]
+	if !ok {
+		return nil
+	}
+	return &report
+}
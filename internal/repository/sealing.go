@@ -0,0 +1,16 @@
+package repository
+
+import "github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+
+// rewrap moves a sealed value over to the primary key of k, it reports whether the value changed.
+func rewrap(k *keyring.Keyring, sealed *string) (bool, error) {
+	if k == nil || *sealed == "" || k.Current(*sealed) {
+		return false, nil
+	}
+	rewrapped, err := k.Rewrap(*sealed)
+	if err != nil {
+		return false, err
+	}
+	*sealed = rewrapped
+	return true, nil
+}
@@ -0,0 +1,83 @@
+package repository_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openKeyring returns a keyring backed by a file and a function rotating it, which hands back a keyring
+// holding only the new key.
+func openKeyring(t *testing.T) (*keyring.Keyring, func() *keyring.Keyring) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	_, err := keyring.Generate(path)
+	require.NoError(t, err)
+	k, err := keyring.Open(path)
+	require.NoError(t, err)
+
+	rotate := func() *keyring.Keyring {
+		_, err := keyring.Rotate(path)
+		require.NoError(t, err)
+		later := time.Now().Add(time.Second)
+		require.NoError(t, os.Chtimes(path, later, later))
+		_, err = k.Reload()
+		require.NoError(t, err)
+
+		file, err := keyring.List(path)
+		require.NoError(t, err)
+		file.Keys = file.Keys[1:]
+		onlyNew, err := keyring.New(file)
+		require.NoError(t, err)
+		return onlyNew
+	}
+	return k, rotate
+}
+
+func TestPaymentsRepository_Keyring(t *testing.T) {
+	k, rotate := openKeyring(t)
+	payment := models.PostPaymentResponse{Id: "test-id", PaymentStatus: "Authorized", ExpiryMonth: 10, ExpiryYear: 2035}
+	repo := repository.NewPaymentsRepository().WithKeyring(k)
+	repo.AddPayment(payment)
+	assert.Equal(t, payment, *repo.GetPayment("test-id"))
+
+	onlyNew := rotate()
+	// until rewrapped the payment needs the old key
+	repo.WithKeyring(onlyNew)
+	assert.Zero(t, repo.GetPayment("test-id").ExpiryMonth)
+
+	repo.WithKeyring(k)
+	rewrapped, err := repo.Rewrap()
+	require.NoError(t, err)
+	assert.Equal(t, 1, rewrapped)
+	rewrapped, err = repo.Rewrap()
+	require.NoError(t, err)
+	assert.Equal(t, 0, rewrapped)
+
+	repo.WithKeyring(onlyNew)
+	assert.Equal(t, payment, *repo.GetPayment("test-id"))
+}
+
+func TestSubscriptionsRepository_Keyring(t *testing.T) {
+	k, rotate := openKeyring(t)
+	subscription := models.Subscription{Id: "sub-1", CardNumber: 2222405343248877, ExpiryMonth: 4, ExpiryYear: 2030}
+	repo := repository.NewSubscriptionsRepository().WithKeyring(k)
+	repo.AddSubscription(subscription)
+	assert.Equal(t, subscription.CardNumber, repo.GetSubscription("sub-1").CardNumber)
+
+	onlyNew := rotate()
+	rewrapped, err := repo.Rewrap()
+	require.NoError(t, err)
+	assert.Equal(t, 1, rewrapped)
+
+	repo.WithKeyring(onlyNew)
+	got := repo.GetSubscription("sub-1")
+	assert.Equal(t, subscription.CardNumber, got.CardNumber)
+	assert.Equal(t, subscription.ExpiryYear, got.ExpiryYear)
+}
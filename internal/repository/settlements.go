@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+type SettlementsRepository struct {
+	mu      sync.RWMutex
+	batches map[string]models.SettlementBatch
+	// settled is how much of each payment went into batches, per line type
+	settled map[string]int
+}
+
+func NewSettlementsRepository() *SettlementsRepository {
+	return &SettlementsRepository{
+		batches: map[string]models.SettlementBatch{},
+		settled: map[string]int{},
+	}
+}
+
+// AddBatch stores the batch and remembers its lines so that they are never settled twice.
+func (sr *SettlementsRepository) AddBatch(batch models.SettlementBatch) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sr.batches[batch.Id] = batch
+	for _, line := range batch.Lines {
+		amount := line.Amount
+		if amount < 0 {
+			amount = -amount
+		}
+		sr.settled[settledKey(line.PaymentId, line.Type)] += amount
+	}
+}
+
+// Settled returns how much of the payment went into batches as lines of lineType, see settlement.Settled.
+func (sr *SettlementsRepository) Settled(paymentID, lineType string) int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	return sr.settled[settledKey(paymentID, lineType)]
+}
+
+func (sr *SettlementsRepository) GetBatch(id string) *models.SettlementBatch {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	batch, ok := sr.batches[id]
+	if !ok {
+		return nil
+	}
+	return &batch
+}
+
+// ListBatches returns the batches without their lines, empty filters match everything.
+func (sr *SettlementsRepository) ListBatches(merchantID, date string) []models.SettlementBatch {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	batches := []models.SettlementBatch{}
+	for _, batch := range sr.batches {
+		if merchantID != "" && batch.MerchantID != merchantID {
+			continue
+		}
+		if date != "" && batch.Date != date {
+			continue
+		}
+		batch.Lines = nil
+		batches = append(batches, batch)
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		if batches[i].Date != batches[j].Date {
+			return batches[i].Date < batches[j].Date
+		}
+		if batches[i].MerchantID != batches[j].MerchantID {
+			return batches[i].MerchantID < batches[j].MerchantID
+		}
+		return batches[i].Currency < batches[j].Currency
+	})
+	return batches
+}
+
+func settledKey(paymentID, lineType string) string {
+	return paymentID + "\x00" + lineType
+}
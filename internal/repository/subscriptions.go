@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/keyring"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// subscriptionSecrets are the card details of a subscription that are encrypted at rest when the
+// repository has a keyring.
+type subscriptionSecrets struct {
+	CardNumber  int `json:"card_number"`
+	ExpiryMonth int `json:"expiry_month"`
+	ExpiryYear  int `json:"expiry_year"`
+}
+
+// storedSubscription is a subscription as it is kept, sealed holds its card details with the fields themselves zeroed.
+type storedSubscription struct {
+	subscription models.Subscription
+	sealed       string
+}
+
+type SubscriptionsRepository struct {
+	mu            sync.RWMutex
+	subscriptions map[string]storedSubscription
+	keyring       *keyring.Keyring
+}
+
+func NewSubscriptionsRepository() *SubscriptionsRepository {
+	return &SubscriptionsRepository{
+		subscriptions: map[string]storedSubscription{},
+	}
+}
+
+// WithKeyring encrypts the card details of the subscriptions stored from now on.
+func (sr *SubscriptionsRepository) WithKeyring(k *keyring.Keyring) *SubscriptionsRepository {
+	sr.keyring = k
+	return sr
+}
+
+// store seals the card details of subscription, it panics like PaymentsRepository.store when that fails.
+func (sr *SubscriptionsRepository) store(subscription models.Subscription) storedSubscription {
+	if sr.keyring == nil {
+		return storedSubscription{subscription: subscription}
+	}
+
+	secrets, _ := json.Marshal(subscriptionSecrets{
+		CardNumber:  subscription.CardNumber,
+		ExpiryMonth: subscription.ExpiryMonth,
+		ExpiryYear:  subscription.ExpiryYear,
+	})
+	sealed, err := sr.keyring.Seal(secrets, subscriptionContext(subscription.Id))
+	if err != nil {
+		panic(fmt.Errorf("could not seal subscription %s: %w", subscription.Id, err))
+	}
+	subscription.CardNumber, subscription.ExpiryMonth, subscription.ExpiryYear = 0, 0, 0
+	return storedSubscription{subscription: subscription, sealed: sealed}
+}
+
+// load returns a copy of the subscription with its card details, they are left out when it cannot be unsealed.
+func (sr *SubscriptionsRepository) load(stored storedSubscription) models.Subscription {
+	subscription := stored.subscription
+	subscription.PaymentIds = append([]string(nil), subscription.PaymentIds...)
+	if stored.sealed == "" {
+		return subscription
+	}
+
+	plaintext, err := sr.keyring.Unseal(stored.sealed, subscriptionContext(subscription.Id))
+	if err != nil {
+		log.Printf("could not unseal subscription %s: %v", subscription.Id, err)
+		return subscription
+	}
+	var secrets subscriptionSecrets
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		log.Printf("could not unseal subscription %s: %v", subscription.Id, err)
+		return subscription
+	}
+	subscription.CardNumber, subscription.ExpiryMonth, subscription.ExpiryYear =
+		secrets.CardNumber, secrets.ExpiryMonth, secrets.ExpiryYear
+	return subscription
+}
+
+func subscriptionContext(id string) []byte {
+	return []byte("subscription:" + id)
+}
+
+func (sr *SubscriptionsRepository) AddSubscription(subscription models.Subscription) {
+	stored := sr.store(subscription)
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sr.subscriptions[subscription.Id] = stored
+}
+
+func (sr *SubscriptionsRepository) GetSubscription(id string) *models.Subscription {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	stored, ok := sr.subscriptions[id]
+	if !ok {
+		return nil
+	}
+	subscription := sr.load(stored)
+	return &subscription
+}
+
+// UpdateSubscription replaces a stored subscription, it returns false when there is none with that id.
+func (sr *SubscriptionsRepository) UpdateSubscription(subscription models.Subscription) bool {
+	stored := sr.store(subscription)
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if _, ok := sr.subscriptions[subscription.Id]; !ok {
+		return false
+	}
+	sr.subscriptions[subscription.Id] = stored
+	return true
+}
+
+// ListSubscriptions returns the merchant's subscriptions oldest first, an empty merchant matches everything.
+func (sr *SubscriptionsRepository) ListSubscriptions(merchantID string) []models.Subscription {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	subscriptions := []models.Subscription{}
+	for _, stored := range sr.subscriptions {
+		if merchantID != "" && stored.subscription.MerchantID != merchantID {
+			continue
+		}
+		subscriptions = append(subscriptions, sr.load(stored))
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].Id < subscriptions[j].Id
+		}
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+	return subscriptions
+}
+
+// Due returns the ids of the subscriptions with a charge scheduled at or before now.
+func (sr *SubscriptionsRepository) Due(now time.Time) []string {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+
+	ids := []string{}
+	for id, stored := range sr.subscriptions {
+		if stored.subscription.NextChargeAt != nil && !stored.subscription.NextChargeAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Rewrap moves the sealed card details over to the primary key of the keyring, there are few enough
+// subscriptions to do them all under one lock.
+func (sr *SubscriptionsRepository) Rewrap() (int, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	rewrapped := 0
+	for id, stored := range sr.subscriptions {
+		changed, err := rewrap(sr.keyring, &stored.sealed)
+		if err != nil {
+			return rewrapped, fmt.Errorf("subscription %s: %w", id, err)
+		}
+		if changed {
+			sr.subscriptions[id] = stored
+			rewrapped++
+		}
+	}
+	return rewrapped, nil
+}
@@ -0,0 +1,39 @@
+package risk
+
+import "time"
+
+type Config struct {
+	// ReviewScore and BlockScore are the totals at which a payment is flagged or stopped.
+	ReviewScore int
+	BlockScore  int
+
+	// Amounts are in minor units and apply to every currency.
+	ReviewAmount int
+	BlockAmount  int
+
+	// BINCountries maps a BIN prefix to the ISO country of the issuer, the longest prefix wins.
+	BINCountries map[string]string
+	BlockedBINs  []string
+
+	VelocityLimit  int
+	VelocityWindow time.Duration
+	VelocityScore  int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ReviewScore:  50,
+		BlockScore:   100,
+		ReviewAmount: 500000,
+		BlockAmount:  10000000,
+		BINCountries: map[string]string{
+			"222240": "GB",
+			"4":      "US",
+			"5":      "US",
+		},
+		BlockedBINs:    []string{},
+		VelocityLimit:  10,
+		VelocityWindow: 10 * time.Minute,
+		VelocityScore:  50,
+	}
+}
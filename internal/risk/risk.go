@@ -0,0 +1,109 @@
+package risk
+
+/*
+The risk engine sits in front of the acquiring bank and gives us a chance to stop obviously bad traffic before we pay for an authorisation.  Each rule looks at the payment in isolation and contributes a score, the engine adds the scores up and turns the total into an outcome.
+
+Blocked payments never reach the bank, review payments are sent to the bank but flagged so that someone can take a look at them later.
+*/
+
+import (
+	"sync"
+)
+
+type Outcome string
+
+const (
+	OutcomeAllow  Outcome = "allow"
+	OutcomeReview Outcome = "review"
+	OutcomeBlock  Outcome = "block"
+)
+
+// Input is everything a rule is allowed to see about a payment.
+type Input struct {
+	CardFingerprint string
+	BIN             string
+	Currency        string
+	Amount          int
+}
+
+// Rule is a single check, it returns whether it fired and the score it contributes.
+type Rule interface {
+	Name() string
+	Evaluate(input Input) (bool, int)
+}
+
+// CardRule is a rule that keeps state per card.
+type CardRule interface {
+	Rule
+	Forget(cardFingerprint string)
+}
+
+type Assessment struct {
+	Score          int
+	Outcome        Outcome
+	TriggeredRules []string
+}
+
+type Engine struct {
+	mu          sync.Mutex
+	rules       []Rule
+	reviewScore int
+	blockScore  int
+}
+
+func NewEngine(config Config) *Engine {
+	rules := []Rule{
+		NewAmountRule(config.ReviewAmount, config.BlockAmount),
+		NewCurrencyCountryRule(config.BINCountries),
+		NewBlockedBINRule(config.BlockedBINs),
+	}
+	if config.VelocityLimit > 0 {
+		rules = append(rules, NewVelocityRule(config.VelocityLimit, config.VelocityWindow, config.VelocityScore))
+	}
+
+	return NewEngineWithRules(config.ReviewScore, config.BlockScore, rules...)
+}
+
+func NewEngineWithRules(reviewScore, blockScore int, rules ...Rule) *Engine {
+	return &Engine{
+		rules:       rules,
+		reviewScore: reviewScore,
+		blockScore:  blockScore,
+	}
+}
+
+// Forget drops whatever the rules remember about a card, for when its holder asks to be erased.
+func (e *Engine) Forget(cardFingerprint string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rule := range e.rules {
+		if rule, ok := rule.(CardRule); ok {
+			rule.Forget(cardFingerprint)
+		}
+	}
+}
+
+func (e *Engine) Evaluate(input Input) Assessment {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	assessment := Assessment{Outcome: OutcomeAllow}
+	for _, rule := range e.rules {
+		triggered, score := rule.Evaluate(input)
+		if !triggered {
+			continue
+		}
+		assessment.Score += score
+		assessment.TriggeredRules = append(assessment.TriggeredRules, rule.Name())
+	}
+
+	switch {
+	case assessment.Score >= e.blockScore:
+		assessment.Outcome = OutcomeBlock
+	case assessment.Score >= e.reviewScore:
+		assessment.Outcome = OutcomeReview
+	}
+
+	return assessment
+}
@@ -0,0 +1,98 @@
+package risk_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/risk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine_Allow(t *testing.T) {
+	engine := risk.NewEngine(risk.DefaultConfig())
+
+	assessment := engine.Evaluate(risk.Input{
+		CardFingerprint: "fingerprint",
+		BIN:             "222240",
+		Currency:        "GBP",
+		Amount:          100,
+	})
+
+	assert.Equal(t, risk.OutcomeAllow, assessment.Outcome)
+	assert.Equal(t, 0, assessment.Score)
+	assert.Empty(t, assessment.TriggeredRules)
+}
+
+func TestEngine_ReviewOnAmount(t *testing.T) {
+	engine := risk.NewEngine(risk.DefaultConfig())
+
+	assessment := engine.Evaluate(risk.Input{
+		BIN:      "222240",
+		Currency: "GBP",
+		Amount:   600000,
+	})
+
+	assert.Equal(t, risk.OutcomeReview, assessment.Outcome)
+	assert.Equal(t, []string{"amount_threshold"}, assessment.TriggeredRules)
+}
+
+func TestEngine_BlockedBIN(t *testing.T) {
+	config := risk.DefaultConfig()
+	config.BlockedBINs = []string{"4111"}
+	engine := risk.NewEngine(config)
+
+	assessment := engine.Evaluate(risk.Input{
+		BIN:      "411111",
+		Currency: "USD",
+		Amount:   100,
+	})
+
+	assert.Equal(t, risk.OutcomeBlock, assessment.Outcome)
+	assert.Equal(t, 100, assessment.Score)
+	assert.Equal(t, []string{"blocked_bin"}, assessment.TriggeredRules)
+}
+
+func TestEngine_CurrencyCountryMismatch(t *testing.T) {
+	engine := risk.NewEngine(risk.DefaultConfig())
+
+	assessment := engine.Evaluate(risk.Input{
+		BIN:      "222240",
+		Currency: "USD",
+		Amount:   600000,
+	})
+
+	// the mismatch on its own is not enough, together with a large amount it is
+	assert.Equal(t, risk.OutcomeReview, assessment.Outcome)
+	assert.Equal(t, 80, assessment.Score)
+	assert.Equal(t, []string{"amount_threshold", "currency_country_mismatch"}, assessment.TriggeredRules)
+}
+
+func TestVelocityRule(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rule := risk.NewVelocityRule(2, time.Minute, 100).WithClock(func() time.Time { return now })
+	engine := risk.NewEngineWithRules(50, 100, rule)
+
+	input := risk.Input{CardFingerprint: "fingerprint"}
+
+	assert.Equal(t, risk.OutcomeAllow, engine.Evaluate(input).Outcome)
+	assert.Equal(t, risk.OutcomeAllow, engine.Evaluate(input).Outcome)
+	assert.Equal(t, risk.OutcomeBlock, engine.Evaluate(input).Outcome)
+
+	// a different card is unaffected
+	assert.Equal(t, risk.OutcomeAllow, engine.Evaluate(risk.Input{CardFingerprint: "other"}).Outcome)
+
+	// once the window has moved on the card is allowed again
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, risk.OutcomeAllow, engine.Evaluate(input).Outcome)
+}
+
+func TestLookupBINCountry(t *testing.T) {
+	binCountries := map[string]string{
+		"4":      "US",
+		"424242": "GB",
+	}
+
+	assert.Equal(t, "GB", risk.LookupBINCountry(binCountries, "424242"))
+	assert.Equal(t, "US", risk.LookupBINCountry(binCountries, "411111"))
+	assert.Equal(t, "", risk.LookupBINCountry(binCountries, "511111"))
+}
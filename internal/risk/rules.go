@@ -0,0 +1,191 @@
+package risk
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	amountRuleName          = "amount_threshold"
+	currencyCountryRuleName = "currency_country_mismatch"
+	blockedBINRuleName      = "blocked_bin"
+	velocityRuleName        = "card_velocity"
+
+	reviewAmountScore    = 50
+	blockAmountScore     = 100
+	currencyCountryScore = 30
+	blockedBINScore      = 100
+
+	// velocitySweepInterval is how often the velocity rule drops the cards it has not seen inside the window.
+	velocitySweepInterval = time.Minute
+)
+
+type AmountRule struct {
+	reviewAmount int
+	blockAmount  int
+}
+
+func NewAmountRule(reviewAmount, blockAmount int) *AmountRule {
+	return &AmountRule{
+		reviewAmount: reviewAmount,
+		blockAmount:  blockAmount,
+	}
+}
+
+func (r *AmountRule) Name() string {
+	return amountRuleName
+}
+
+func (r *AmountRule) Evaluate(input Input) (bool, int) {
+	if r.blockAmount > 0 && input.Amount >= r.blockAmount {
+		return true, blockAmountScore
+	}
+	if r.reviewAmount > 0 && input.Amount >= r.reviewAmount {
+		return true, reviewAmountScore
+	}
+	return false, 0
+}
+
+var currencyCountries = map[string][]string{
+	"GBP": {"GB"},
+	"USD": {"US"},
+	"EUR": {"AT", "BE", "CY", "DE", "EE", "ES", "FI", "FR", "GR", "HR", "IE", "IT", "LT", "LU", "LV", "MT", "NL", "PT", "SI", "SK"},
+}
+
+// CurrencyCountryRule fires when the card was issued in a country that does not use the payment currency.
+type CurrencyCountryRule struct {
+	binCountries map[string]string
+}
+
+func NewCurrencyCountryRule(binCountries map[string]string) *CurrencyCountryRule {
+	return &CurrencyCountryRule{
+		binCountries: binCountries,
+	}
+}
+
+func (r *CurrencyCountryRule) Name() string {
+	return currencyCountryRuleName
+}
+
+func (r *CurrencyCountryRule) Evaluate(input Input) (bool, int) {
+	country := LookupBINCountry(r.binCountries, input.BIN)
+	if country == "" {
+		return false, 0
+	}
+
+	countries, ok := currencyCountries[input.Currency]
+	if !ok {
+		return false, 0
+	}
+
+	for _, c := range countries {
+		if c == country {
+			return false, 0
+		}
+	}
+	return true, currencyCountryScore
+}
+
+// LookupBINCountry returns the issuing country for the longest matching prefix or an empty string.
+func LookupBINCountry(binCountries map[string]string, bin string) string {
+	country := ""
+	longest := 0
+	for prefix, c := range binCountries {
+		if len(prefix) > longest && strings.HasPrefix(bin, prefix) {
+			country = c
+			longest = len(prefix)
+		}
+	}
+	return country
+}
+
+type BlockedBINRule struct {
+	prefixes []string
+}
+
+func NewBlockedBINRule(prefixes []string) *BlockedBINRule {
+	return &BlockedBINRule{
+		prefixes: prefixes,
+	}
+}
+
+func (r *BlockedBINRule) Name() string {
+	return blockedBINRuleName
+}
+
+func (r *BlockedBINRule) Evaluate(input Input) (bool, int) {
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(input.BIN, prefix) {
+			return true, blockedBINScore
+		}
+	}
+	return false, 0
+}
+
+// VelocityRule counts attempts per card fingerprint inside a sliding window, every evaluation counts as an attempt.
+type VelocityRule struct {
+	limit     int
+	window    time.Duration
+	score     int
+	attempts  map[string][]time.Time
+	now       func() time.Time
+	nextSweep time.Time
+}
+
+func NewVelocityRule(limit int, window time.Duration, score int) *VelocityRule {
+	return &VelocityRule{
+		limit:    limit,
+		window:   window,
+		score:    score,
+		attempts: map[string][]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// WithClock swaps the clock used by the rule, handy for tests.
+func (r *VelocityRule) WithClock(now func() time.Time) *VelocityRule {
+	r.now = now
+	return r
+}
+
+func (r *VelocityRule) Name() string {
+	return velocityRuleName
+}
+
+// Forget drops the attempts of a card.
+func (r *VelocityRule) Forget(cardFingerprint string) {
+	delete(r.attempts, cardFingerprint)
+}
+
+func (r *VelocityRule) Evaluate(input Input) (bool, int) {
+	if input.CardFingerprint == "" {
+		return false, 0
+	}
+
+	now := r.now()
+	cutoff := now.Add(-r.window)
+
+	recent := []time.Time{}
+	for _, attempt := range r.attempts[input.CardFingerprint] {
+		if attempt.After(cutoff) {
+			recent = append(recent, attempt)
+		}
+	}
+	recent = append(recent, now)
+	r.attempts[input.CardFingerprint] = recent
+
+	// a card is only pruned when it is seen again, the ones that are not would stay forever
+	if now.After(r.nextSweep) {
+		for fingerprint, attempts := range r.attempts {
+			if !attempts[len(attempts)-1].After(cutoff) {
+				delete(r.attempts, fingerprint)
+			}
+		}
+		r.nextSweep = now.Add(velocitySweepInterval)
+	}
+
+	if len(recent) > r.limit {
+		return true, r.score
+	}
+	return false, 0
+}
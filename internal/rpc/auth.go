@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/auth"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/certs"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/ratelimit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/rpc/paymentsv1"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Auth authenticates and limits gRPC calls the same way as the REST API, a merchant has one set of
+// credentials and one rate limit budget across both.
+type Auth struct {
+	// Merchants checks the API key merchants send with basic auth in the authorization metadata.
+	Merchants auth.Tokens
+	// ClientCerts identifies merchants by their client certificate, nil when there is no client CA.
+	ClientCerts *certs.ServerConfig
+	// Limiter is the one the REST API uses, nil turns rate limiting off.
+	Limiter *ratelimit.Limiter
+}
+
+// routes are the rate limit routes of the REST endpoints that do the same as a method.
+var routes = map[string]string{
+	paymentsv1.PaymentService_CreatePayment_FullMethodName: "payments.create",
+	paymentsv1.PaymentService_GetPayment_FullMethodName:    "payments.get",
+	paymentsv1.PaymentService_ListPayments_FullMethodName:  "payments.list",
+}
+
+// Interceptor puts the authenticated merchant on the context and takes a token for the call.  Calls
+// without credentials go on anonymously, wrong ones are refused.
+func (a Auth) Interceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	merchantID, err := a.merchant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if merchantID != "" {
+		ctx = handlers.WithMerchantID(ctx, merchantID)
+	}
+
+	if a.Limiter != nil {
+		route, ok := routes[info.FullMethod]
+		if !ok {
+			route = info.FullMethod
+		}
+		if allowed, retryAfter := a.Limiter.Allow(route, ratelimit.Key(merchantID, clientIP(ctx))); !allowed {
+			return nil, withDetails(status.New(codes.ResourceExhausted, "too many requests"),
+				&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+			)
+		}
+	}
+	return handler(ctx, req)
+}
+
+// merchant checks the basic auth credentials and the client certificate, a certificate wins but must
+// not name another merchant than the credentials.
+func (a Auth) merchant(ctx context.Context) (string, error) {
+	merchantID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, authorization := range md.Get("authorization") {
+			r := &http.Request{Header: http.Header{"Authorization": {authorization}}}
+			name, key, ok := r.BasicAuth()
+			if !ok {
+				continue
+			}
+			if !a.Merchants.Check(name, key) {
+				return "", status.Error(codes.Unauthenticated, "invalid merchant credentials")
+			}
+			merchantID = name
+			break
+		}
+	}
+	if a.ClientCerts == nil {
+		return merchantID, nil
+	}
+
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &tlsInfo.State
+		}
+	}
+	certMerchant, err := a.ClientCerts.Merchant(state)
+	if err != nil {
+		log.Printf("refused client certificate: %v", err)
+		return "", status.Error(codes.PermissionDenied, "client certificate is not allowed")
+	}
+	if certMerchant == "" {
+		return merchantID, nil
+	}
+	if merchantID != "" && merchantID != certMerchant {
+		log.Printf("client certificate of %s used with basic auth for %s", certMerchant, merchantID)
+		return "", status.Error(codes.PermissionDenied, "client certificate is for another merchant")
+	}
+	return certMerchant, nil
+}
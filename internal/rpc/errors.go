@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/queue"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain identifies our errors in ErrorInfo details.
+const errorDomain = "payments.gateway"
+
+// toStatus maps the gateway errors onto gRPC status codes with the same details the REST API gives.
+func toStatus(err error) error {
+	var validationErr *gatewayerrors.ValidationError
+	if errors.As(err, &validationErr) {
+		st := status.New(codes.InvalidArgument, validationErr.Error())
+		return withDetails(st,
+			&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{Field: validationErr.GetFieldError(), Description: validationErr.Error()},
+			}},
+			&errdetails.ErrorInfo{Reason: "VALIDATION_FAILED", Domain: errorDomain, Metadata: map[string]string{"payment_id": validationErr.GetID()}},
+		)
+	}
+
+	var profileErr *gatewayerrors.ProfileError
+	if errors.As(err, &profileErr) {
+		st := status.New(codes.FailedPrecondition, profileErr.Error())
+		return withDetails(st,
+			&errdetails.ErrorInfo{Reason: profileErr.Code, Domain: errorDomain, Metadata: map[string]string{"payment_id": profileErr.ID}},
+		)
+	}
+
+	var limitErr *gatewayerrors.LimitError
+	if errors.As(err, &limitErr) {
+		st := status.New(codes.ResourceExhausted, "too many payment attempts for this "+limitErr.Scope)
+		return withDetails(st,
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(limitErr.RetryAfter)},
+		)
+	}
+
+	if errors.Is(err, queue.ErrQueueFull) {
+		return status.Error(codes.Unavailable, "too many payments are being processed")
+	}
+
+	var bankErr *gatewayerrors.BankError
+	if errors.As(err, &bankErr) && bankErr.StatusCode == http.StatusServiceUnavailable {
+		return status.Error(codes.Unavailable, "the acquiring bank is currently unavailable")
+	}
+
+	log.Printf("Unsupported error: %v", err)
+	return status.Error(codes.Internal, "unexpected error")
+}
+
+func fieldViolation(field, description string) error {
+	st := status.New(codes.InvalidArgument, description)
+	return withDetails(st, &errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+		{Field: field, Description: description},
+	}})
+}
+
+func withDetails(st *status.Status, details ...protoadapt.MessageV1) error {
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
@@ -0,0 +1,198 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/handlers"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/rpc/paymentsv1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Server implements the gRPC PaymentService on top of the same domain and repository as the REST handlers.
+type Server struct {
+	paymentsv1.UnimplementedPaymentServiceServer
+
+	storage *repository.PaymentsRepository
+	domain  *domain.Domain
+}
+
+func NewServer(storage *repository.PaymentsRepository, domain *domain.Domain) *Server {
+	return &Server{
+		storage: storage,
+		domain:  domain,
+	}
+}
+
+// NewGRPCServer returns a grpc.Server with the payment service and the auth interceptor registered.
+func NewGRPCServer(storage *repository.PaymentsRepository, domain *domain.Domain, auth Auth, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append(opts, grpc.UnaryInterceptor(auth.Interceptor))...)
+	paymentsv1.RegisterPaymentServiceServer(s, NewServer(storage, domain))
+	return s
+}
+
+func (s *Server) CreatePayment(ctx context.Context, req *paymentsv1.CreatePaymentRequest) (*paymentsv1.Payment, error) {
+	cardNumber, err := strconv.Atoi(req.GetCardNumber())
+	if err != nil {
+		return nil, fieldViolation("card_number", "card number must be digits only")
+	}
+	// merchant initiated payments have no cvv, the domain decides whether one is needed
+	cvv := 0
+	if req.GetCvv() != "" {
+		cvv, err = strconv.Atoi(req.GetCvv())
+		if err != nil {
+			return nil, fieldViolation("cvv", "cvv must be digits only")
+		}
+	}
+
+	payment, err := s.domain.PaymentService.Create(&models.PostPaymentHandlerRequest{
+		CardNumber:         cardNumber,
+		ExpiryMonth:        int(req.GetExpiryMonth()),
+		ExpiryYear:         int(req.GetExpiryYear()),
+		Currency:           req.GetCurrency(),
+		Amount:             int(req.GetAmount()),
+		Cvv:                cvv,
+		SettlementCurrency: req.GetSettlementCurrency(),
+		QuoteId:            req.GetQuoteId(),
+
+		Initiator:              req.GetInitiator(),
+		StoredCredentialUsage:  req.GetStoredCredentialUsage(),
+		StoredCredentialReason: req.GetStoredCredentialReason(),
+		PreviousPaymentId:      req.GetPreviousPaymentId(),
+		NetworkTransactionId:   req.GetNetworkTransactionId(),
+
+		MerchantID: handlers.MerchantIDFromContext(ctx),
+		ClientIP:   clientIP(ctx),
+		RequestID:  requestID(ctx),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return toPayment(payment), nil
+}
+
+// GetPayment needs a merchant and only returns its own payments, like the REST API.
+func (s *Server) GetPayment(ctx context.Context, req *paymentsv1.GetPaymentRequest) (*paymentsv1.Payment, error) {
+	merchantID := handlers.MerchantIDFromContext(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "a merchant is required")
+	}
+	payment := s.storage.GetPayment(req.GetId())
+	if payment == nil || payment.MerchantID != merchantID {
+		return nil, status.Error(codes.NotFound, "payment not found")
+	}
+
+	return toPayment(payment), nil
+}
+
+// ListPayments pages through the merchant's payments in the order they were made, the page token is the
+// position in the repository to carry on from.
+func (s *Server) ListPayments(ctx context.Context, req *paymentsv1.ListPaymentsRequest) (*paymentsv1.ListPaymentsResponse, error) {
+	merchantID := handlers.MerchantIDFromContext(ctx)
+	if merchantID == "" {
+		return nil, status.Error(codes.Unauthenticated, "a merchant is required")
+	}
+
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, fieldViolation("page_size", "page size must not be negative")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	offset := 0
+	if req.GetPageToken() != "" {
+		var err error
+		offset, err = strconv.Atoi(req.GetPageToken())
+		if err != nil || offset < 0 {
+			return nil, fieldViolation("page_token", "invalid page token")
+		}
+	}
+
+	response := &paymentsv1.ListPaymentsResponse{}
+	for len(response.Payments) < pageSize {
+		page := s.storage.Page(offset, pageSize)
+		if len(page) == 0 {
+			return response, nil
+		}
+		for i := range page {
+			offset++
+			if page[i].MerchantID != merchantID {
+				continue
+			}
+			response.Payments = append(response.Payments, toPayment(&page[i]))
+			if len(response.Payments) == pageSize {
+				break
+			}
+		}
+	}
+
+	if len(s.storage.Page(offset, 1)) > 0 {
+		response.NextPageToken = strconv.Itoa(offset)
+	}
+	return response, nil
+}
+
+func toPayment(payment *models.PostPaymentResponse) *paymentsv1.Payment {
+	return &paymentsv1.Payment{
+		Id:                   payment.Id,
+		Status:               payment.PaymentStatus,
+		CardNumberLastFour:   int32(payment.CardNumberLastFour),
+		ExpiryMonth:          int32(payment.ExpiryMonth),
+		ExpiryYear:           int32(payment.ExpiryYear),
+		Currency:             payment.Currency,
+		Amount:               int64(payment.Amount),
+		AuthorizationCode:    payment.AuthorizationCode,
+		AcquirerReference:    payment.AcquirerReference,
+		DeclineCode:          payment.DeclineCode,
+		SettlementCurrency:   payment.SettlementCurrency,
+		SettlementAmount:     int64(payment.SettlementAmount),
+		FxRate:               payment.FXRate,
+		ChallengeUrl:         payment.ChallengeURL,
+		NetworkTransactionId: payment.NetworkTransactionId,
+		CreatedAt:            timestamppb.New(payment.CreatedAt),
+	}
+}
+
+// requestID is the x-request-id the client sent, if any, the same header the REST API takes.
+func requestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if ids := md.Get("x-request-id"); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,197 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/auth"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/client/mocks"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/domain"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/ratelimit"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/repository"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/rpc"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/rpc/paymentsv1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testMerchants all have the API key "secret".
+var testMerchants = auth.Tokens{"merchant-1": auth.Hash("secret"), "merchant-2": auth.Hash("secret")}
+
+func newTestClient(t *testing.T, repo *repository.PaymentsRepository, d *domain.Domain) paymentsv1.PaymentServiceClient {
+	return newAuthTestClient(t, repo, d, rpc.Auth{Merchants: testMerchants})
+}
+
+func newAuthTestClient(t *testing.T, repo *repository.PaymentsRepository, d *domain.Domain, grpcAuth rpc.Auth) paymentsv1.PaymentServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	server := rpc.NewGRPCServer(repo, d, grpcAuth)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return paymentsv1.NewPaymentServiceClient(conn)
+}
+
+func asMerchant(merchantID string) context.Context {
+	credentials := base64.StdEncoding.EncodeToString([]byte(merchantID + ":secret"))
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+credentials)
+}
+
+func TestServer_CreateAndGetPayment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mocks.NewMockClient(ctrl)
+	mockClient.EXPECT().PostBankPayment(gomock.Any()).Return(&models.PostPaymentBankResponse{
+		Authorised:        true,
+		AuthorizationCode: "auth-1",
+	}, nil)
+
+	repo := repository.NewPaymentsRepository()
+	client := newTestClient(t, repo, domain.NewDomain(domain.NewPaymentServiceImpl(repo, mockClient)))
+
+	created, err := client.CreatePayment(asMerchant("merchant-1"), &paymentsv1.CreatePaymentRequest{
+		CardNumber:  "2222405343248877",
+		ExpiryMonth: 12,
+		ExpiryYear:  int32(time.Now().Year() + 1),
+		Currency:    "GBP",
+		Amount:      100,
+		Cvv:         "123",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "authorized", created.Status)
+	assert.Equal(t, int32(8877), created.CardNumberLastFour)
+	assert.Equal(t, "merchant-1", repo.GetPayment(created.Id).MerchantID)
+
+	fetched, err := client.GetPayment(asMerchant("merchant-1"), &paymentsv1.GetPaymentRequest{Id: created.Id})
+	require.NoError(t, err)
+	assert.Equal(t, created.Id, fetched.Id)
+	assert.Equal(t, int64(100), fetched.Amount)
+
+	_, err = client.GetPayment(asMerchant("merchant-2"), &paymentsv1.GetPaymentRequest{Id: created.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetPayment(context.Background(), &paymentsv1.GetPaymentRequest{Id: created.Id})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_CreatePaymentValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := repository.NewPaymentsRepository()
+	client := newTestClient(t, repo, domain.NewDomain(domain.NewPaymentServiceImpl(repo, mocks.NewMockClient(ctrl))))
+
+	tests := []struct {
+		name    string
+		request *paymentsv1.CreatePaymentRequest
+		field   string
+	}{
+		{
+			name:    "card number not digits",
+			request: &paymentsv1.CreatePaymentRequest{CardNumber: "2222-4053", Cvv: "123"},
+			field:   "card_number",
+		},
+		{
+			name: "unsupported currency",
+			request: &paymentsv1.CreatePaymentRequest{
+				CardNumber:  "2222405343248877",
+				ExpiryMonth: 12,
+				ExpiryYear:  int32(time.Now().Year() + 1),
+				Currency:    "XXX",
+				Amount:      100,
+				Cvv:         "123",
+			},
+			field: "currency",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.CreatePayment(context.Background(), tt.request)
+			st := status.Convert(err)
+			require.Equal(t, codes.InvalidArgument, st.Code())
+
+			var badRequest *errdetails.BadRequest
+			for _, detail := range st.Details() {
+				if d, ok := detail.(*errdetails.BadRequest); ok {
+					badRequest = d
+				}
+			}
+			require.NotNil(t, badRequest)
+			assert.Equal(t, tt.field, badRequest.FieldViolations[0].Field)
+		})
+	}
+}
+
+func TestServer_ListPayments(t *testing.T) {
+	repo := repository.NewPaymentsRepository()
+	for i, merchantID := range []string{"merchant-1", "merchant-2", "merchant-1", "merchant-1", "merchant-2"} {
+		repo.AddPayment(models.PostPaymentResponse{
+			Id:            string(rune('a' + i)),
+			PaymentStatus: "authorized",
+			MerchantID:    merchantID,
+		})
+	}
+	client := newTestClient(t, repo, domain.NewDomain(nil))
+
+	first, err := client.ListPayments(asMerchant("merchant-1"), &paymentsv1.ListPaymentsRequest{PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, first.Payments, 2)
+	assert.Equal(t, "a", first.Payments[0].Id)
+	assert.Equal(t, "c", first.Payments[1].Id)
+	require.NotEmpty(t, first.NextPageToken)
+
+	second, err := client.ListPayments(asMerchant("merchant-1"), &paymentsv1.ListPaymentsRequest{PageSize: 2, PageToken: first.NextPageToken})
+	require.NoError(t, err)
+	require.Len(t, second.Payments, 1)
+	assert.Equal(t, "d", second.Payments[0].Id)
+
+	_, err = client.ListPayments(asMerchant("merchant-1"), &paymentsv1.ListPaymentsRequest{PageToken: "nope"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// anonymous callers would see every merchant's payments
+	_, err = client.ListPayments(context.Background(), &paymentsv1.ListPaymentsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_Auth(t *testing.T) {
+	repo := repository.NewPaymentsRepository()
+	repo.AddPayment(models.PostPaymentResponse{Id: "a", PaymentStatus: "authorized", MerchantID: "merchant-1"})
+	limiter := ratelimit.NewLimiter(ratelimit.Config{Default: ratelimit.Rule{Rate: 0, Burst: 2}}, nil)
+	client := newAuthTestClient(t, repo, domain.NewDomain(nil), rpc.Auth{Merchants: testMerchants, Limiter: limiter})
+
+	wrongKey := metadata.AppendToOutgoingContext(context.Background(), "authorization",
+		"Basic "+base64.StdEncoding.EncodeToString([]byte("merchant-1:wrong")))
+	_, err := client.GetPayment(wrongKey, &paymentsv1.GetPaymentRequest{Id: "a"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// the limiter counts calls against the merchant, the same buckets as the REST API
+	for i := 0; i < 2; i++ {
+		_, err = client.GetPayment(asMerchant("merchant-1"), &paymentsv1.GetPaymentRequest{Id: "a"})
+		require.NoError(t, err)
+	}
+	_, err = client.GetPayment(asMerchant("merchant-1"), &paymentsv1.GetPaymentRequest{Id: "a"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	allowed, _ := limiter.Allow("payments.get", ratelimit.Key("merchant-1", ""))
+	assert.False(t, allowed)
+}
@@ -0,0 +1,117 @@
+package settlement
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+)
+
+// soldStatuses are the payment statuses that were sold and end up in a settlement batch.  We do not have a
+// separate capture step yet so an authorised payment is treated as captured, unless it was taken with manual
+// capture.  A refunded payment was sold before it was refunded.
+var soldStatuses = map[string]bool{
+	"authorized": true,
+	"captured":   true,
+	"refunded":   true,
+}
+
+// Settled reports how much of a payment is already in a batch as lines of lineType, zero when none are.
+type Settled func(paymentID, lineType string) int
+
+// Build groups the payments authorised up to the end of day into one batch per merchant and currency.
+// Earlier days are included so a payment authorised after its day was settled goes into the next batch.
+// Every payment gets a sale line once, a refund line once it is refunded and a chargeback line for whatever
+// it lost to disputes since the last batch, whatever settled says is already in a batch is left out.  Sales
+// add to the batch, refunds and chargebacks are taken off it.  The fee is charged on sales and refunds.
+func Build(payments []models.PostPaymentResponse, day time.Time, fees FeeSchedule, settled Settled) []models.SettlementBatch {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+
+	batches := map[[2]string]*models.SettlementBatch{}
+	for _, payment := range payments {
+		if !soldStatuses[payment.PaymentStatus] || !settledAt(payment).Before(end) {
+			continue
+		}
+		if payment.PaymentStatus == "authorized" && payment.CaptureMode == models.CaptureManual {
+			continue
+		}
+		// card verifications move no money and are not charged a fee
+		if payment.Amount == 0 {
+			continue
+		}
+
+		// converted payments settle in the currency the merchant asked for
+		currency, amount := payment.Currency, payment.Amount
+		if payment.SettlementCurrency != "" {
+			currency, amount = payment.SettlementCurrency, payment.SettlementAmount
+		}
+
+		lines := []models.SettlementBatchLine{}
+		if settled(payment.Id, models.SettlementLineSale) == 0 {
+			lines = append(lines, line(payment, models.SettlementLineSale, amount, fees.Fee(payment.MerchantID, payment.CardScheme, currency, amount)))
+		}
+		if payment.PaymentStatus == "refunded" && settled(payment.Id, models.SettlementLineRefund) == 0 {
+			lines = append(lines, line(payment, models.SettlementLineRefund, -amount, fees.Fee(payment.MerchantID, payment.CardScheme, currency, amount)))
+		}
+		// a payment can lose more than one dispute, each loss is settled once
+		if chargedBack := payment.ChargebackAmount - settled(payment.Id, models.SettlementLineChargeback); chargedBack > 0 {
+			lines = append(lines, line(payment, models.SettlementLineChargeback, -chargedBack, 0))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		key := [2]string{payment.MerchantID, currency}
+		batch, ok := batches[key]
+		if !ok {
+			batch = &models.SettlementBatch{
+				MerchantID: payment.MerchantID,
+				Currency:   currency,
+				Date:       start.Format(time.DateOnly),
+				Lines:      []models.SettlementBatchLine{},
+			}
+			batches[key] = batch
+		}
+
+		for _, line := range lines {
+			batch.Lines = append(batch.Lines, line)
+			batch.Gross += line.Amount
+			batch.Fees += line.Fee
+			batch.Net += line.Net
+			batch.Count++
+		}
+	}
+
+	sorted := []models.SettlementBatch{}
+	for _, batch := range batches {
+		sorted = append(sorted, *batch)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].MerchantID != sorted[j].MerchantID {
+			return sorted[i].MerchantID < sorted[j].MerchantID
+		}
+		return sorted[i].Currency < sorted[j].Currency
+	})
+	return sorted
+}
+
+func line(payment models.PostPaymentResponse, lineType string, amount, fee int) models.SettlementBatchLine {
+	return models.SettlementBatchLine{
+		PaymentId: payment.Id,
+		Type:      lineType,
+		Scheme:    payment.CardScheme,
+		Amount:    amount,
+		Fee:       fee,
+		Net:       amount - fee,
+	}
+}
+
+// settledAt is when a payment became due for settlement, payments stored before AuthorizedAt was
+// recorded go by when they were created.
+func settledAt(payment models.PostPaymentResponse) time.Time {
+	if payment.AuthorizedAt != nil {
+		return *payment.AuthorizedAt
+	}
+	return payment.CreatedAt
+}
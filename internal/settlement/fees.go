@@ -0,0 +1,68 @@
+package settlement
+
+/*
+Fees are a percentage of the amount plus a fixed amount, both can differ per card scheme and currency and merchants can have their own schedule on top of the default one.  Percentages are kept in basis points so we never have to deal with floats when money is involved.
+*/
+
+// FeeRule applies to payments of Scheme in Currency, an empty Scheme or Currency matches anything.
+type FeeRule struct {
+	Scheme      string `json:"scheme,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	BasisPoints int    `json:"basis_points"`
+	Fixed       int    `json:"fixed"`
+}
+
+type FeeSchedule struct {
+	Default   []FeeRule
+	Merchants map[string][]FeeRule
+}
+
+func DefaultFeeSchedule() FeeSchedule {
+	return FeeSchedule{
+		Default: []FeeRule{
+			{BasisPoints: 290, Fixed: 30},
+			{Scheme: "amex", BasisPoints: 350, Fixed: 30},
+			{Currency: "EUR", BasisPoints: 250, Fixed: 25},
+		},
+		Merchants: map[string][]FeeRule{},
+	}
+}
+
+// rule returns the most specific rule for the payment, merchant rules win over the default schedule.
+func (s FeeSchedule) rule(merchantID, scheme, currency string) FeeRule {
+	if rule, ok := mostSpecific(s.Merchants[merchantID], scheme, currency); ok {
+		return rule
+	}
+	rule, _ := mostSpecific(s.Default, scheme, currency)
+	return rule
+}
+
+func mostSpecific(rules []FeeRule, scheme, currency string) (FeeRule, bool) {
+	best := FeeRule{}
+	bestScore := -1
+	for _, rule := range rules {
+		if (rule.Scheme != "" && rule.Scheme != scheme) || (rule.Currency != "" && rule.Currency != currency) {
+			continue
+		}
+
+		// a scheme match is worth more than a currency match
+		score := 0
+		if rule.Scheme != "" {
+			score += 2
+		}
+		if rule.Currency != "" {
+			score++
+		}
+		if score > bestScore {
+			best = rule
+			bestScore = score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// Fee is the fee for a payment of amount minor units, the percentage part is rounded half up.
+func (s FeeSchedule) Fee(merchantID, scheme, currency string, amount int) int {
+	rule := s.rule(merchantID, scheme, currency)
+	return (amount*rule.BasisPoints+5000)/10000 + rule.Fixed
+}
@@ -0,0 +1,130 @@
+package settlement_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/models"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/settlement"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFee(t *testing.T) {
+	fees := settlement.DefaultFeeSchedule()
+	fees.Merchants["m-2"] = []settlement.FeeRule{{BasisPoints: 100}}
+
+	tests := []struct {
+		name     string
+		merchant string
+		scheme   string
+		currency string
+		amount   int
+		want     int
+	}{
+		{name: "default", merchant: "m-1", scheme: "visa", currency: "GBP", amount: 10000, want: 320},
+		{name: "scheme beats currency", merchant: "m-1", scheme: "amex", currency: "EUR", amount: 10000, want: 380},
+		{name: "currency", merchant: "m-1", scheme: "visa", currency: "EUR", amount: 10000, want: 275},
+		{name: "rounds half up", merchant: "m-2", scheme: "visa", currency: "GBP", amount: 150, want: 2},
+		{name: "merchant schedule", merchant: "m-2", scheme: "amex", currency: "GBP", amount: 10000, want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, fees.Fee(tt.merchant, tt.scheme, tt.currency, tt.amount))
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	payments := []models.PostPaymentResponse{
+		{Id: "p-1", MerchantID: "m-1", PaymentStatus: "authorized", Currency: "GBP", Amount: 10000, CardScheme: "visa", CreatedAt: day.Add(time.Hour)},
+		{Id: "p-2", MerchantID: "m-1", PaymentStatus: "refunded", Currency: "GBP", Amount: 1000, CardScheme: "visa", CreatedAt: day.Add(2 * time.Hour)},
+		{Id: "p-3", MerchantID: "m-1", PaymentStatus: "authorized", Currency: "EUR", Amount: 10000, CardScheme: "visa", CreatedAt: day.Add(3 * time.Hour)},
+		{Id: "p-4", MerchantID: "m-1", PaymentStatus: "authorized", Currency: "JPY", Amount: 1000, CardScheme: "visa", SettlementCurrency: "EUR", SettlementAmount: 600, CreatedAt: day.Add(4 * time.Hour)},
+		{Id: "declined", MerchantID: "m-1", PaymentStatus: "declined", Currency: "GBP", Amount: 10000, CreatedAt: day.Add(time.Hour)},
+		{Id: "next-day", MerchantID: "m-1", PaymentStatus: "authorized", Currency: "GBP", Amount: 10000, CreatedAt: day.AddDate(0, 0, 1)},
+	}
+
+	// p-2 was sold in an earlier batch and refunded since
+	settled := func(paymentID, lineType string) int {
+		if paymentID == "p-2" && lineType == models.SettlementLineSale {
+			return 1000
+		}
+		return 0
+	}
+	batches := settlement.Build(payments, day, settlement.DefaultFeeSchedule(), settled)
+	require.Len(t, batches, 2)
+
+	eur, gbp := batches[0], batches[1]
+	assert.Equal(t, "EUR", eur.Currency)
+	assert.Equal(t, 2, eur.Count)
+	assert.Equal(t, 10600, eur.Gross)
+	assert.Equal(t, 275+40, eur.Fees)
+
+	assert.Equal(t, "GBP", gbp.Currency)
+	assert.Equal(t, "2024-01-01", gbp.Date)
+	assert.Equal(t, 2, gbp.Count)
+	assert.Equal(t, 9000, gbp.Gross)
+	assert.Equal(t, 320+59, gbp.Fees)
+	assert.Equal(t, 9000-320-59, gbp.Net)
+	assert.Equal(t, models.SettlementLineRefund, gbp.Lines[1].Type)
+	assert.Equal(t, -1000, gbp.Lines[1].Amount)
+}
+
+func TestBuild_SettlesByAuthorisation(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	authorizedAt := func(at time.Time) *time.Time { return &at }
+	payments := []models.PostPaymentResponse{
+		// created before the previous day was settled but only authorised after it
+		{Id: "late", MerchantID: "m-1", PaymentStatus: "authorized", Currency: "GBP", Amount: 10000, CreatedAt: day.Add(-time.Hour), AuthorizedAt: authorizedAt(day.Add(time.Hour))},
+		{Id: "missed", MerchantID: "m-1", PaymentStatus: "authorized", Currency: "GBP", Amount: 10000, CreatedAt: day.AddDate(0, 0, -3)},
+		{Id: "authorised-tomorrow", MerchantID: "m-1", PaymentStatus: "authorized", Currency: "GBP", Amount: 10000, CreatedAt: day.Add(time.Hour), AuthorizedAt: authorizedAt(day.AddDate(0, 0, 1))},
+		{Id: "not-captured", MerchantID: "m-1", PaymentStatus: "authorized", CaptureMode: models.CaptureManual, Currency: "GBP", Amount: 10000, CreatedAt: day.Add(time.Hour), AuthorizedAt: authorizedAt(day.Add(time.Hour))},
+	}
+
+	batches := settlement.Build(payments, day, settlement.DefaultFeeSchedule(), nothingSettled)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0].Lines, 2)
+	assert.Equal(t, "late", batches[0].Lines[0].PaymentId)
+	assert.Equal(t, "missed", batches[0].Lines[1].PaymentId)
+	assert.Equal(t, "2024-01-02", batches[0].Date)
+}
+
+func TestBuild_RefundedBeforeSettlement(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	payments := []models.PostPaymentResponse{
+		{Id: "p-1", MerchantID: "m-1", PaymentStatus: "refunded", Currency: "GBP", Amount: 10000, CardScheme: "visa", CreatedAt: day.Add(time.Hour)},
+	}
+
+	batches := settlement.Build(payments, day, settlement.DefaultFeeSchedule(), nothingSettled)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0].Lines, 2)
+	assert.Equal(t, models.SettlementLineSale, batches[0].Lines[0].Type)
+	assert.Equal(t, models.SettlementLineRefund, batches[0].Lines[1].Type)
+	assert.Equal(t, 0, batches[0].Gross)
+	assert.Equal(t, -2*320, batches[0].Net)
+}
+
+func TestBuild_Chargebacks(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	payments := []models.PostPaymentResponse{
+		{Id: "p-1", MerchantID: "m-1", PaymentStatus: "authorized", Currency: "GBP", Amount: 10000, CardScheme: "visa", CreatedAt: day.Add(-time.Hour), ChargebackAmount: 3000},
+	}
+	// the sale and a first lost dispute of 1000 were settled before
+	settled := func(paymentID, lineType string) int {
+		return map[string]int{models.SettlementLineSale: 10000, models.SettlementLineChargeback: 1000}[lineType]
+	}
+
+	batches := settlement.Build(payments, day, settlement.DefaultFeeSchedule(), settled)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0].Lines, 1)
+	assert.Equal(t, models.SettlementLineChargeback, batches[0].Lines[0].Type)
+	assert.Equal(t, -2000, batches[0].Lines[0].Amount)
+	assert.Equal(t, 0, batches[0].Lines[0].Fee)
+	assert.Equal(t, -2000, batches[0].Net)
+}
+
+func nothingSettled(string, string) int {
+	return 0
+}
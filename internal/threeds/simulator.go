@@ -0,0 +1,173 @@
+package threeds
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// SimulatorCode is the one time code that completes a challenge on the simulator, anything else fails it.
+const SimulatorCode = "1234"
+
+// simulatorTTL is how long the simulator remembers a challenge, well past the time the shopper has to
+// complete it.
+const simulatorTTL = time.Hour
+
+var ErrInvalidReturnURL = errors.New("return url is not on the gateway")
+
+// simulatedTransaction keeps what the challenge page and the result need, not the card number.
+type simulatedTransaction struct {
+	Amount    int
+	Currency  string
+	eci       string
+	returnURL string
+	createdAt time.Time
+	result    *Result
+}
+
+// Simulator plays both the directory server and the ACS so the flow can be run locally and in tests.
+// Its challenge page lives under /3ds/acs/{id} of the handler returned by Handler.  Anyone who knows
+// SimulatorCode passes, so it is only wired up in dev mode.
+type Simulator struct {
+	mu           sync.Mutex
+	baseURL      string
+	transactions map[string]*simulatedTransaction
+}
+
+func NewSimulator(baseURL string) *Simulator {
+	return &Simulator{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		transactions: map[string]*simulatedTransaction{},
+	}
+}
+
+func (s *Simulator) Start(request Request) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// shoppers are only ever sent back to the gateway itself
+	if !strings.HasPrefix(request.ReturnURL, s.baseURL+"/") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidReturnURL, request.ReturnURL)
+	}
+
+	now := time.Now()
+	for id, transaction := range s.transactions {
+		if now.Sub(transaction.createdAt) > simulatorTTL {
+			delete(s.transactions, id)
+		}
+	}
+
+	id := uuid.New().String()
+	s.transactions[id] = &simulatedTransaction{
+		Amount:    request.Amount,
+		Currency:  request.Currency,
+		eci:       authenticatedECI(request.CardNumber),
+		returnURL: request.ReturnURL,
+		createdAt: now,
+	}
+
+	return &Session{
+		TransactionId: id,
+		ChallengeURL:  fmt.Sprintf("%s/3ds/acs/%s", s.baseURL, id),
+	}, nil
+}
+
+// Result returns the outcome of the challenge, a challenge that was never completed is reported as unavailable.
+func (s *Simulator) Result(transactionId string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transaction, ok := s.transactions[transactionId]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+	if transaction.result == nil {
+		return &Result{TransactionId: transactionId, Status: StatusUnavailable}, nil
+	}
+	result := *transaction.result
+	return &result, nil
+}
+
+// Complete answers the challenge as the shopper would and returns where the shopper is sent back to.
+func (s *Simulator) Complete(transactionId, code string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transaction, ok := s.transactions[transactionId]
+	if !ok {
+		return "", ErrTransactionNotFound
+	}
+
+	result := &Result{TransactionId: transactionId, Status: StatusFailed}
+	if code == SimulatorCode {
+		result.Status = StatusAuthenticated
+		result.ECI = transaction.eci
+		result.CAVV = newCAVV()
+	}
+	transaction.result = result
+
+	return transaction.returnURL, nil
+}
+
+// authenticatedECI is 05 for Visa style schemes and 02 for Mastercard.
+func authenticatedECI(cardNumber string) string {
+	if strings.HasPrefix(cardNumber, "5") || strings.HasPrefix(cardNumber, "2") {
+		return "02"
+	}
+	return "05"
+}
+
+func newCAVV() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+var challengePage = template.Must(template.New("challenge").Parse(`<!DOCTYPE html>
+<html>
+<head><title>3-D Secure</title></head>
+<body>
+<p>Enter the code sent to your phone to pay {{.Amount}} {{.Currency}}.</p>
+<form method="post">
+<input name="code" autocomplete="one-time-code">
+<button type="submit">Submit</button>
+</form>
+</body>
+</html>
+`))
+
+// Handler serves the ACS challenge page.
+func (s *Simulator) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/3ds/acs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		transaction, ok := s.transactions[chi.URLParam(r, "id")]
+		s.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = challengePage.Execute(w, transaction)
+	})
+	r.Post("/3ds/acs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		returnURL, err := s.Complete(chi.URLParam(r, "id"), r.FormValue("code"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		http.Redirect(w, r, returnURL, http.StatusSeeOther)
+	})
+	return r
+}
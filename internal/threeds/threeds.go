@@ -0,0 +1,77 @@
+package threeds
+
+/*
+3-D Secure moves the cardholder over to their issuer's access control server (ACS) to prove who they are before the payment is authorised.  The gateway starts an authentication, hands the shopper the challenge URL, and once the shopper is sent back we fetch the outcome and pass the ECI and CAVV on to the bank so the issuer can see the payment was authenticated.
+*/
+
+import (
+	"errors"
+	"slices"
+)
+
+// Authentication statuses as defined by EMV 3DS.
+const (
+	StatusAuthenticated = "Y"
+	StatusFailed        = "N"
+	StatusAttempted     = "A"
+	StatusUnavailable   = "U"
+)
+
+var ErrTransactionNotFound = errors.New("3ds transaction not found")
+
+type Request struct {
+	PaymentId  string
+	CardNumber string
+	Amount     int
+	Currency   string
+	ReturnURL  string
+}
+
+// Session is a started authentication, the shopper has to complete the challenge at ChallengeURL.
+type Session struct {
+	TransactionId string
+	ChallengeURL  string
+}
+
+type Result struct {
+	TransactionId string
+	Status        string
+	ECI           string
+	CAVV          string
+}
+
+// Succeeded reports whether the liability for the payment shifted to the issuer.
+func (r *Result) Succeeded() bool {
+	return r.Status == StatusAuthenticated || r.Status == StatusAttempted
+}
+
+type Authenticator interface {
+	Start(request Request) (*Session, error)
+	Result(transactionId string) (*Result, error)
+}
+
+// Config decides which payments have to be authenticated.
+type Config struct {
+	// Currencies that require strong customer authentication.
+	Currencies []string
+	// LowValueExemptions exempts payments below the amount, in minor units, of their currency.
+	LowValueExemptions map[string]int
+}
+
+// DefaultConfig asks for SCA on euro payments with the PSD2 low value exemption of 30 EUR.
+func DefaultConfig() Config {
+	return Config{
+		Currencies:         []string{"EUR"},
+		LowValueExemptions: map[string]int{"EUR": 3000},
+	}
+}
+
+func (c Config) Required(currency string, amount int) bool {
+	if !slices.Contains(c.Currencies, currency) {
+		return false
+	}
+	if limit, ok := c.LowValueExemptions[currency]; ok && amount < limit {
+		return false
+	}
+	return true
+}
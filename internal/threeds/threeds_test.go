@@ -0,0 +1,80 @@
+package threeds_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/threeds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Required(t *testing.T) {
+	config := threeds.DefaultConfig()
+
+	assert.True(t, config.Required("EUR", 3000))
+	assert.False(t, config.Required("EUR", 2999), "low value payments are exempt")
+	assert.False(t, config.Required("GBP", 100000))
+}
+
+func TestSimulator(t *testing.T) {
+	simulator := threeds.NewSimulator("http://gateway.test/")
+	server := httptest.NewServer(simulator.Handler())
+	defer server.Close()
+
+	challenge := func(cardNumber, code string) *threeds.Result {
+		session, err := simulator.Start(threeds.Request{
+			PaymentId:  "payment-1",
+			CardNumber: cardNumber,
+			Amount:     5000,
+			Currency:   "EUR",
+			ReturnURL:  "http://gateway.test/callback",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "http://gateway.test/3ds/acs/"+session.TransactionId, session.ChallengeURL)
+
+		result, err := simulator.Result(session.TransactionId)
+		require.NoError(t, err)
+		assert.Equal(t, threeds.StatusUnavailable, result.Status)
+
+		page, err := http.Get(server.URL + "/3ds/acs/" + session.TransactionId)
+		require.NoError(t, err)
+		page.Body.Close()
+		assert.Equal(t, http.StatusOK, page.StatusCode)
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Post(server.URL+"/3ds/acs/"+session.TransactionId, "application/x-www-form-urlencoded", strings.NewReader(url.Values{"code": {code}}.Encode()))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "http://gateway.test/callback", resp.Header.Get("Location"))
+
+		result, err = simulator.Result(session.TransactionId)
+		require.NoError(t, err)
+		return result
+	}
+
+	result := challenge("4111111111111111", threeds.SimulatorCode)
+	assert.True(t, result.Succeeded())
+	assert.Equal(t, "05", result.ECI)
+	assert.NotEmpty(t, result.CAVV)
+
+	result = challenge("5555555555554444", threeds.SimulatorCode)
+	assert.Equal(t, "02", result.ECI)
+
+	result = challenge("4111111111111111", "0000")
+	assert.False(t, result.Succeeded())
+	assert.Empty(t, result.CAVV)
+
+	_, err := simulator.Result("missing")
+	assert.ErrorIs(t, err, threeds.ErrTransactionNotFound)
+
+	// the shopper cannot be sent off the gateway
+	for _, returnURL := range []string{"https://evil.test/callback", "http://gateway.test.evil.test/callback", ""} {
+		_, err = simulator.Start(threeds.Request{PaymentId: "payment-2", Amount: 5000, Currency: "EUR", ReturnURL: returnURL})
+		assert.ErrorIs(t, err, threeds.ErrInvalidReturnURL, returnURL)
+	}
+}
@@ -0,0 +1,165 @@
+package velocity
+
+/*
+Sliding window limits protect us against card testing, where someone throws thousands of small payments at us to find out which stolen cards still work.  Every accepted attempt is recorded against the card fingerprint, the merchant and the client IP, and a new attempt is refused when any of the windows it falls into is already full.
+*/
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+)
+
+type Scope string
+
+const (
+	ScopeCard     Scope = "card"
+	ScopeMerchant Scope = "merchant"
+	ScopeIP       Scope = "ip"
+)
+
+// Limit caps the attempts for a scope inside Window, a zero MaxCount or MaxAmount means no cap.
+// MaxAmount is in minor units and is applied per currency.
+type Limit struct {
+	Scope     Scope
+	Window    time.Duration
+	MaxCount  int
+	MaxAmount int
+}
+
+type Attempt struct {
+	CardFingerprint string
+	MerchantID      string
+	ClientIP        string
+	Amount          int
+	Currency        string
+}
+
+func (a Attempt) key(scope Scope) string {
+	switch scope {
+	case ScopeCard:
+		return a.CardFingerprint
+	case ScopeMerchant:
+		return a.MerchantID
+	case ScopeIP:
+		return a.ClientIP
+	}
+	return ""
+}
+
+type Limiter struct {
+	mu     sync.Mutex
+	store  Store
+	limits []Limit
+	now    func() time.Time
+}
+
+func NewLimiter(store Store, limits ...Limit) *Limiter {
+	return &Limiter{
+		store:  store,
+		limits: limits,
+		now:    time.Now,
+	}
+}
+
+// WithClock swaps the clock used by the limiter, handy for tests.
+func (l *Limiter) WithClock(now func() time.Time) *Limiter {
+	l.now = now
+	return l
+}
+
+func DefaultLimits() []Limit {
+	return []Limit{
+		{Scope: ScopeCard, Window: time.Minute, MaxCount: 5},
+		{Scope: ScopeCard, Window: 24 * time.Hour, MaxCount: 50, MaxAmount: 5000000},
+		{Scope: ScopeIP, Window: time.Minute, MaxCount: 30},
+		{Scope: ScopeMerchant, Window: time.Minute, MaxCount: 1000},
+	}
+}
+
+// Allow checks the attempt against every limit and records it when none of them trip.
+func (l *Limiter) Allow(attempt Attempt) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, limit := range l.limits {
+		key := attempt.key(limit.Scope)
+		if key == "" {
+			continue
+		}
+
+		events, err := l.store.Events(storeKey(limit.Scope, key), now.Add(-limit.Window))
+		if err != nil {
+			return fmt.Errorf("failed to read velocity events: %w", err)
+		}
+
+		count := len(events) + 1
+		total := attempt.Amount
+		for _, event := range events {
+			if event.Currency == attempt.Currency {
+				total += event.Amount
+			}
+		}
+
+		if limit.MaxCount > 0 && count > limit.MaxCount {
+			return newLimitError(limit, "count", retryAfter(events, limit.Window, now))
+		}
+		if limit.MaxAmount > 0 && total > limit.MaxAmount {
+			return newLimitError(limit, "amount", retryAfter(events, limit.Window, now))
+		}
+	}
+
+	// a scope can have several windows, its events have to be kept for the longest
+	retain := map[string]time.Duration{}
+	for _, limit := range l.limits {
+		key := attempt.key(limit.Scope)
+		if key != "" && limit.Window > retain[storeKey(limit.Scope, key)] {
+			retain[storeKey(limit.Scope, key)] = limit.Window
+		}
+	}
+	event := Event{At: now, Amount: attempt.Amount, Currency: attempt.Currency}
+	for key, window := range retain {
+		if err := l.store.Record(key, event, window); err != nil {
+			return fmt.Errorf("failed to record velocity event: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Forget drops the attempts recorded against a card, for when its holder asks to be erased.
+func (l *Limiter) Forget(cardFingerprint string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.store.Delete(storeKey(ScopeCard, cardFingerprint))
+}
+
+func storeKey(scope Scope, key string) string {
+	return string(scope) + ":" + key
+}
+
+// retryAfter is how long until the oldest event in the window drops out of it.
+func retryAfter(events []Event, window time.Duration, now time.Time) time.Duration {
+	if len(events) == 0 {
+		return window
+	}
+	oldest := events[0].At
+	for _, event := range events {
+		if event.At.Before(oldest) {
+			oldest = event.At
+		}
+	}
+	return oldest.Add(window).Sub(now)
+}
+
+func newLimitError(limit Limit, kind string, retryAfter time.Duration) *gatewayerrors.LimitError {
+	return gatewayerrors.NewLimitError(
+		fmt.Errorf("%s %s limit exceeded", limit.Scope, kind),
+		string(limit.Scope),
+		retryAfter,
+	)
+}
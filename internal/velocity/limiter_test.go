@@ -0,0 +1,102 @@
+package velocity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/gatewayerrors"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/velocity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_CountLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := velocity.NewLimiter(
+		velocity.NewMemoryStore(),
+		velocity.Limit{Scope: velocity.ScopeCard, Window: time.Minute, MaxCount: 2},
+	).WithClock(func() time.Time { return now })
+
+	attempt := velocity.Attempt{CardFingerprint: "card", Amount: 100, Currency: "GBP"}
+
+	require.NoError(t, limiter.Allow(attempt))
+	now = now.Add(10 * time.Second)
+	require.NoError(t, limiter.Allow(attempt))
+
+	var limitErr *gatewayerrors.LimitError
+	err := limiter.Allow(attempt)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "card", limitErr.Scope)
+	assert.Equal(t, "card count limit exceeded", limitErr.Error())
+	assert.Equal(t, 50*time.Second, limitErr.RetryAfter)
+
+	// another card has its own window
+	require.NoError(t, limiter.Allow(velocity.Attempt{CardFingerprint: "other", Amount: 100, Currency: "GBP"}))
+
+	// the first attempt drops out of the window
+	now = now.Add(51 * time.Second)
+	require.NoError(t, limiter.Allow(attempt))
+}
+
+func TestLimiter_AmountLimitPerCurrency(t *testing.T) {
+	limiter := velocity.NewLimiter(
+		velocity.NewMemoryStore(),
+		velocity.Limit{Scope: velocity.ScopeMerchant, Window: time.Hour, MaxAmount: 1000},
+	)
+
+	require.NoError(t, limiter.Allow(velocity.Attempt{MerchantID: "merchant", Amount: 600, Currency: "GBP"}))
+	require.NoError(t, limiter.Allow(velocity.Attempt{MerchantID: "merchant", Amount: 600, Currency: "EUR"}))
+
+	var limitErr *gatewayerrors.LimitError
+	err := limiter.Allow(velocity.Attempt{MerchantID: "merchant", Amount: 600, Currency: "GBP"})
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "merchant amount limit exceeded", limitErr.Error())
+}
+
+func TestLimiter_RefusedAttemptsAreNotRecorded(t *testing.T) {
+	limiter := velocity.NewLimiter(
+		velocity.NewMemoryStore(),
+		velocity.Limit{Scope: velocity.ScopeIP, Window: time.Minute, MaxCount: 1},
+		velocity.Limit{Scope: velocity.ScopeCard, Window: time.Minute, MaxCount: 1},
+	)
+
+	require.NoError(t, limiter.Allow(velocity.Attempt{ClientIP: "10.0.0.1", CardFingerprint: "card-1"}))
+
+	// the IP limit trips so nothing is recorded against card-2
+	require.Error(t, limiter.Allow(velocity.Attempt{ClientIP: "10.0.0.1", CardFingerprint: "card-2"}))
+	require.NoError(t, limiter.Allow(velocity.Attempt{ClientIP: "10.0.0.2", CardFingerprint: "card-2"}))
+}
+
+func TestLimiter_MissingKeysAreSkipped(t *testing.T) {
+	limiter := velocity.NewLimiter(
+		velocity.NewMemoryStore(),
+		velocity.Limit{Scope: velocity.ScopeMerchant, Window: time.Minute, MaxCount: 1},
+	)
+
+	require.NoError(t, limiter.Allow(velocity.Attempt{}))
+	require.NoError(t, limiter.Allow(velocity.Attempt{}))
+}
+
+func TestLimiter_WindowsOfOneScope(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := velocity.NewLimiter(
+		velocity.NewMemoryStore(),
+		velocity.Limit{Scope: velocity.ScopeCard, Window: time.Minute, MaxCount: 2},
+		velocity.Limit{Scope: velocity.ScopeCard, Window: 24 * time.Hour, MaxCount: 3},
+	).WithClock(func() time.Time { return now })
+
+	attempt := velocity.Attempt{CardFingerprint: "card", Amount: 100, Currency: "GBP"}
+	require.NoError(t, limiter.Allow(attempt))
+	require.NoError(t, limiter.Allow(attempt))
+
+	// reading the minute window must not throw away what the day window still counts
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, limiter.Allow(attempt))
+	now = now.Add(2 * time.Minute)
+	var limitErr *gatewayerrors.LimitError
+	require.ErrorAs(t, limiter.Allow(attempt), &limitErr)
+	assert.Equal(t, 24*time.Hour-4*time.Minute, limitErr.RetryAfter)
+
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, limiter.Allow(attempt))
+}
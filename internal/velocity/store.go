@@ -0,0 +1,89 @@
+package velocity
+
+import (
+	"sync"
+	"time"
+)
+
+type Event struct {
+	At       time.Time
+	Amount   int
+	Currency string
+}
+
+// Store keeps the events the limiter counts, swap the in-memory store for a shared one when running more than one gateway.
+type Store interface {
+	// Record adds event under key, events of the key older than retain are no longer needed.
+	Record(key string, event Event, retain time.Duration) error
+	Events(key string, since time.Time) ([]Event, error)
+	// Delete drops every event of key.
+	Delete(key string) error
+}
+
+// sweepInterval is how often the memory store drops the keys nobody recorded anything for in a while.
+const sweepInterval = time.Minute
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	events    map[string][]Event
+	expires   map[string]time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		events:  map[string][]Event{},
+		expires: map[string]time.Time{},
+	}
+}
+
+// Record prunes the events of key as it goes.  Pruning only happens here since only the limiter knows the
+// longest window a key is counted in, a shorter window reading it must not throw away what a longer one needs.
+func (s *MemoryStore) Record(key string, event Event, retain time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := event.At.Add(-retain)
+	recent := []Event{}
+	for _, existing := range s.events[key] {
+		if existing.At.After(cutoff) {
+			recent = append(recent, existing)
+		}
+	}
+	s.events[key] = append(recent, event)
+	s.expires[key] = event.At.Add(retain)
+
+	if event.At.After(s.nextSweep) {
+		for key, expires := range s.expires {
+			if expires.Before(event.At) {
+				delete(s.events, key)
+				delete(s.expires, key)
+			}
+		}
+		s.nextSweep = event.At.Add(sweepInterval)
+	}
+	return nil
+}
+
+// Events returns the events recorded for key after since.
+func (s *MemoryStore) Events(key string, since time.Time) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recent := []Event{}
+	for _, event := range s.events[key] {
+		if event.At.After(since) {
+			recent = append(recent, event)
+		}
+	}
+	return recent, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, key)
+	delete(s.expires, key)
+	return nil
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/cko-recruitment/payment-gateway-challenge-go/docs"
 	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/api"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/cli"
+	"github.com/cko-recruitment/payment-gateway-challenge-go/internal/config"
 )
 
 var (
@@ -25,6 +27,14 @@ var (
 
 // @securityDefinitions.basic	BasicAuth
 func main() {
+	if len(os.Args) > 1 {
+		if err := cli.Run(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Printf("version %s, commit %s, built at %s\n", version, commit, date)
 	docs.SwaggerInfo.Version = version
 
@@ -54,7 +64,12 @@ func run() error {
 		}
 	}()
 
-	api := api.New()
+	config, err := config.Load(os.Getenv(config.EnvVar))
+	if err != nil {
+		return err
+	}
+
+	api := api.New(config)
 	if err := api.Run(ctx, ":8090"); err != nil {
 		return err
 	}